@@ -1,10 +1,17 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"go_template_v3/pkg/config"
+	"go_template_v3/pkg/currency"
+	"go_template_v3/pkg/global/utils"
+	"go_template_v3/pkg/jobs"
+	"go_template_v3/pkg/recurring"
+	ctrFeatureOne "go_template_v3/pkg/services/featureOne/controller"
+	"go_template_v3/pkg/webhooks"
 	"go_template_v3/routers"
 	"log"
 	"strings"
@@ -35,8 +42,20 @@ func init() {
 	folders := []string{"system"}
 	apilogs.CreateInitialFolder(folders)
 
+	// Load JWT signing and verification keys
+	if err := utils.LoadJWTKeys(); err != nil {
+		log.Fatal("Error loading JWT keys:", err)
+	}
+
 	// Connect to DB
 	config.PostgreSQLConnect()
+
+	// Connect to Redis when configured, otherwise features fall back to in-memory state
+	if redisAddress := utils_v1.GetEnv("REDIS_ADDRESS"); redisAddress != "" {
+		if !config.RedisConnect(redisAddress, utils_v1.GetEnv("REDIS_PASSWORD")) {
+			config.RedisClient = nil
+		}
+	}
 }
 
 func main() {
@@ -46,21 +65,53 @@ func main() {
 		DisableKeepalive: true,
 		JSONEncoder:      json.Marshal,
 		JSONDecoder:      json.Unmarshal,
+		// Large uploads such as expense imports are streamed instead of
+		// being held in memory whole
+		BodyLimit:         utils.EnvInt("BODY_LIMIT_MB", 110, 1) * 1024 * 1024,
+		StreamRequestBody: true,
 	})
 
 	// CORS configuration
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: []string{"*"},
 		AllowMethods: []string{"GET,POST,PUT,DELETE"},
-		AllowHeaders: []string{"Origin, Content-Type, Accept, Authorization"},
+		AllowHeaders: []string{"Origin, Content-Type, Accept, Authorization, X-API-Key"},
 	}))
 
 	app.Use(logger.New())
 	app.Use(recover.New())
 
+	// Load exchange rates shipped as a file
+	if ratesFile := utils_v1.GetEnv("EXCHANGE_RATES_FILE"); ratesFile != "" {
+		if loaded, err := currency.LoadFile(ratesFile); err != nil {
+			log.Printf("Error loading exchange rates from %s: %v", ratesFile, err)
+		} else {
+			fmt.Println("EXCHANGE RATES LOADED:", loaded)
+		}
+	}
+
+	// Uploaded and generated files must stay out of the public assets
+	if err := ctrFeatureOne.CheckStoragePaths(); err != nil {
+		log.Fatal("Error in storage settings:", err)
+	}
+
 	// Initialize API Endpoints
 	routers.APIRoute(app)
 
+	// Start background job workers, resuming jobs interrupted by a restart
+	ctrFeatureOne.RegisterJobHandlers()
+	jobs.OnFinish(webhooks.JobFinished)
+	jobs.Start(context.Background())
+
+	// Start webhook delivery workers
+	webhooks.Start(context.Background())
+
+	// Start creating recurring expenses, catching up on missed days
+	recurring.Start(context.Background())
+
+	// Start checking budgets for crossed alert thresholds
+	ctrFeatureOne.StartBudgetAlerts(context.Background())
+
 	// TLS Configuration
 	if strings.ToUpper(utils_v1.GetEnv("SSL_MODE")) == "ENABLED" {
 		fmt.Println("SSL_MODE: ENABLED")
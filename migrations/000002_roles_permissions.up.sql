@@ -0,0 +1,51 @@
+-- Role-based permissions. Users without a row in user_roles get the
+-- DEFAULT_USER_ROLE role ("user").
+CREATE TABLE IF NOT EXISTS roles (
+    id          SERIAL PRIMARY KEY,
+    name        TEXT NOT NULL UNIQUE,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Permission names are "resource:action"; "*" and "resource:*" are
+-- wildcards
+CREATE TABLE IF NOT EXISTS permissions (
+    id          SERIAL PRIMARY KEY,
+    name        TEXT NOT NULL UNIQUE,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id        INTEGER NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    permission_id  INTEGER NOT NULL REFERENCES permissions (id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id     INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role_id     INTEGER NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, role_id)
+);
+
+INSERT INTO roles (name) VALUES ('user'), ('admin') ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO permissions (name) VALUES
+    ('*'),
+    ('expenses:read'),
+    ('expenses:write'),
+    ('expenses:batch'),
+    ('categories:write'),
+    ('users:manage'),
+    ('encryption:manage')
+ON CONFLICT (name) DO NOTHING;
+
+-- Categories are shared by every user, so managing them is left to admins
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p
+WHERE r.name = 'user' AND p.name IN ('expenses:read', 'expenses:write', 'expenses:batch')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r, permissions p
+WHERE r.name = 'admin' AND p.name = '*'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,11 @@
+-- Security-relevant authentication events such as login lockouts
+CREATE TABLE IF NOT EXISTS auth_events (
+    id          BIGSERIAL PRIMARY KEY,
+    event_type  TEXT NOT NULL,
+    email       TEXT,
+    ip_address  TEXT,
+    details     JSONB,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS auth_events_email_idx ON auth_events (email, created_at);
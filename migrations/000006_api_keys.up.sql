@@ -0,0 +1,16 @@
+-- Personal API keys. Only a SHA-512 hash of the key is kept; key_prefix is
+-- the non-secret part shown in listings. scopes is a JSON array of scope names.
+CREATE TABLE IF NOT EXISTS api_keys (
+    id            SERIAL PRIMARY KEY,
+    user_id       INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name          TEXT NOT NULL,
+    key_prefix    TEXT NOT NULL,
+    key_hash      TEXT NOT NULL UNIQUE,
+    scopes        JSONB NOT NULL DEFAULT '[]',
+    expires_at    TIMESTAMPTZ,
+    last_used_at  TIMESTAMPTZ,
+    revoked_at    TIMESTAMPTZ,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys (user_id);
@@ -0,0 +1,20 @@
+-- One row per login. Access tokens carry the session id so revoking a
+-- session logs that device out immediately.
+CREATE TABLE IF NOT EXISTS user_sessions (
+    id            SERIAL PRIMARY KEY,
+    user_id       INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    device        TEXT NOT NULL,
+    ip_address    TEXT,
+    user_agent    TEXT,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    revoked_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS user_sessions_user_id_idx ON user_sessions (user_id);
+
+-- Refresh tokens issued before sessions existed keep a NULL session_id
+ALTER TABLE refresh_tokens
+    ADD COLUMN IF NOT EXISTS session_id INTEGER REFERENCES user_sessions (id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_session_id_idx ON refresh_tokens (session_id);
@@ -0,0 +1,26 @@
+-- External OpenID Connect identities linked to local users
+CREATE TABLE IF NOT EXISTS user_identities (
+    id          SERIAL PRIMARY KEY,
+    user_id     INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    provider    TEXT NOT NULL,
+    subject     TEXT NOT NULL,
+    email       TEXT,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS user_identities_user_id_idx ON user_identities (user_id);
+
+-- In-flight logins between the redirect to the provider and its callback.
+-- user_id is set when a logged-in user is linking a provider explicitly.
+CREATE TABLE IF NOT EXISTS oidc_login_states (
+    state_hash     TEXT PRIMARY KEY,
+    provider       TEXT NOT NULL,
+    nonce          TEXT NOT NULL,
+    code_verifier  TEXT NOT NULL,
+    user_id        INTEGER REFERENCES users (id) ON DELETE CASCADE,
+    expires_at     TIMESTAMPTZ NOT NULL,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS oidc_login_states_expires_at_idx ON oidc_login_states (expires_at);
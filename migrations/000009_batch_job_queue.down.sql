@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS batch_jobs_processing_locked_at_idx;
+DROP INDEX IF EXISTS batch_jobs_pending_idx;
+
+ALTER TABLE batch_jobs
+    DROP COLUMN IF EXISTS locked_at,
+    DROP COLUMN IF EXISTS locked_by,
+    DROP COLUMN IF EXISTS payload;
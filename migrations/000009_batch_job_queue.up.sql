@@ -0,0 +1,12 @@
+-- Columns the job queue needs on batch_jobs. payload is what the worker
+-- runs; locked_by/locked_at name the instance running the job and when it
+-- last reported in, so abandoned jobs can be requeued.
+ALTER TABLE batch_jobs
+    ADD COLUMN IF NOT EXISTS payload    JSONB,
+    ADD COLUMN IF NOT EXISTS locked_by  TEXT,
+    ADD COLUMN IF NOT EXISTS locked_at  TIMESTAMPTZ;
+
+-- Workers claim the oldest pending job
+CREATE INDEX IF NOT EXISTS batch_jobs_pending_idx ON batch_jobs (id) WHERE status = 'pending';
+
+CREATE INDEX IF NOT EXISTS batch_jobs_processing_locked_at_idx ON batch_jobs (locked_at) WHERE status = 'processing';
@@ -0,0 +1 @@
+ALTER TABLE batch_jobs DROP COLUMN IF EXISTS cancel_requested_at;
@@ -0,0 +1,3 @@
+-- Set when a user cancels a running job; the worker stops at its next
+-- cancellation check
+ALTER TABLE batch_jobs ADD COLUMN IF NOT EXISTS cancel_requested_at TIMESTAMPTZ;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS expense_import_errors;
+DROP TABLE IF EXISTS expense_imports;
@@ -0,0 +1,28 @@
+-- Uploaded import files waiting to be mapped and committed. last_job_id is
+-- the latest run, dry or not; committed_job_id the run that saves expenses.
+CREATE TABLE IF NOT EXISTS expense_imports (
+    id                SERIAL PRIMARY KEY,
+    user_id           INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    file_path         TEXT NOT NULL,
+    original_name     TEXT NOT NULL,
+    delimiter         TEXT NOT NULL,
+    headers           JSONB NOT NULL DEFAULT '[]',
+    row_count         INTEGER NOT NULL,
+    last_job_id       INTEGER REFERENCES batch_jobs (id) ON DELETE SET NULL,
+    committed_job_id  INTEGER REFERENCES batch_jobs (id) ON DELETE SET NULL,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS expense_imports_user_id_idx ON expense_imports (user_id);
+
+-- Rows an import job rejected, with the original fields for the error report
+CREATE TABLE IF NOT EXISTS expense_import_errors (
+    id          BIGSERIAL PRIMARY KEY,
+    job_id      INTEGER NOT NULL REFERENCES batch_jobs (id) ON DELETE CASCADE,
+    row_number  INTEGER NOT NULL,
+    message     TEXT NOT NULL,
+    fields      JSONB NOT NULL DEFAULT '[]',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS expense_import_errors_job_id_idx ON expense_import_errors (job_id, row_number);
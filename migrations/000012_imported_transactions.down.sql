@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS imported_transactions;
+
+ALTER TABLE expense_imports
+    DROP COLUMN IF EXISTS format;
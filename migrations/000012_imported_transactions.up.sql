@@ -0,0 +1,14 @@
+-- Uploads can be bank statements as well as CSV files
+ALTER TABLE expense_imports
+    ADD COLUMN IF NOT EXISTS format TEXT NOT NULL DEFAULT 'csv';
+
+-- Bank transactions already imported, so a statement imported twice, or two
+-- overlapping statements, do not add the same expense again. account_id is
+-- empty when the statement does not name the account.
+CREATE TABLE IF NOT EXISTS imported_transactions (
+    user_id         INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    account_id      TEXT NOT NULL DEFAULT '',
+    transaction_id  TEXT NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, account_id, transaction_id)
+);
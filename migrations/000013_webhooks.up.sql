@@ -0,0 +1,36 @@
+-- Endpoints users register for signed event callbacks. Deleting one only
+-- deactivates it, so its delivery log is kept. An empty events list
+-- subscribes to every event.
+CREATE TABLE IF NOT EXISTS webhook_endpoints (
+    id          SERIAL PRIMARY KEY,
+    user_id     INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    url         TEXT NOT NULL,
+    secret      TEXT NOT NULL,
+    events      JSONB NOT NULL DEFAULT '[]',
+    active      BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS webhook_endpoints_user_id_idx ON webhook_endpoints (user_id) WHERE active;
+
+-- One row per event and endpoint, sent by the webhook workers and kept as
+-- the delivery log. status is pending, succeeded or failed.
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id                SERIAL PRIMARY KEY,
+    endpoint_id       INTEGER NOT NULL REFERENCES webhook_endpoints (id) ON DELETE CASCADE,
+    user_id           INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    event             TEXT NOT NULL,
+    payload           JSONB NOT NULL,
+    status            TEXT NOT NULL DEFAULT 'pending',
+    attempts          INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_status_code  INTEGER,
+    last_error        TEXT,
+    replay_of         INTEGER REFERENCES webhook_deliveries (id) ON DELETE SET NULL,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    delivered_at      TIMESTAMPTZ
+);
+
+-- Workers claim the earliest due pending delivery
+CREATE INDEX IF NOT EXISTS webhook_deliveries_pending_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_deliveries_endpoint_id_idx ON webhook_deliveries (endpoint_id, id);
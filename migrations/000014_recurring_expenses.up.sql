@@ -0,0 +1,35 @@
+-- Rules that create an expense on a schedule. next_run_date is the next
+-- occurrence still to create, or NULL once the rule has ended.
+CREATE TABLE IF NOT EXISTS recurring_expenses (
+    id              SERIAL PRIMARY KEY,
+    user_id         INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    title           TEXT NOT NULL,
+    amount          NUMERIC(19, 4) NOT NULL,
+    currency        CHAR(3),
+    category_id     INTEGER,
+    notes           TEXT,
+    frequency       TEXT NOT NULL,
+    interval_count  INTEGER NOT NULL DEFAULT 1,
+    start_date      DATE NOT NULL,
+    end_date        DATE,
+    skip_dates      JSONB NOT NULL DEFAULT '[]',
+    next_run_date   DATE,
+    active          BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS recurring_expenses_user_id_idx ON recurring_expenses (user_id);
+-- The scheduler claims the earliest due active rule
+CREATE INDEX IF NOT EXISTS recurring_expenses_due_idx ON recurring_expenses (next_run_date, id) WHERE active;
+
+-- One row per occurrence a rule has reached, so each is created only once.
+-- status is created or failed.
+CREATE TABLE IF NOT EXISTS recurring_expense_runs (
+    rule_id          INTEGER NOT NULL REFERENCES recurring_expenses (id) ON DELETE CASCADE,
+    occurrence_date  DATE NOT NULL,
+    status           TEXT NOT NULL,
+    message          TEXT,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (rule_id, occurrence_date)
+);
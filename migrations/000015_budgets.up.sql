@@ -0,0 +1,37 @@
+-- Spending limits per category, or overall when category_id is NULL. Month
+-- and week budgets repeat every calendar month or ISO week; a custom budget
+-- covers start_date to end_date once.
+CREATE TABLE IF NOT EXISTS budgets (
+    id           SERIAL PRIMARY KEY,
+    user_id      INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    category_id  INTEGER,
+    period       TEXT NOT NULL,
+    amount       NUMERIC(19, 4) NOT NULL,
+    start_date   DATE,
+    end_date     DATE,
+    thresholds   JSONB NOT NULL DEFAULT '[80,100]',
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- One repeating budget per category, or overall, and period
+CREATE UNIQUE INDEX IF NOT EXISTS budgets_repeating_key
+    ON budgets (user_id, COALESCE(category_id, 0), period) WHERE period <> 'custom';
+
+-- Thresholds a budget's period has crossed. The unique key lets every
+-- instance check budgets while each threshold alerts once per period.
+CREATE TABLE IF NOT EXISTS budget_alerts (
+    id             SERIAL PRIMARY KEY,
+    budget_id      INTEGER NOT NULL REFERENCES budgets (id) ON DELETE CASCADE,
+    user_id        INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    period_start   DATE NOT NULL,
+    period_end     DATE NOT NULL,
+    threshold      INTEGER NOT NULL,
+    spent          NUMERIC(19, 4) NOT NULL,
+    budget_amount  NUMERIC(19, 4) NOT NULL,
+    emailed_at     TIMESTAMPTZ,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (budget_id, period_start, threshold)
+);
+
+CREATE INDEX IF NOT EXISTS budget_alerts_user_id_idx ON budget_alerts (user_id, created_at DESC);
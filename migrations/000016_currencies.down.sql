@@ -0,0 +1,7 @@
+ALTER TABLE expenses
+    DROP COLUMN IF EXISTS currency;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS base_currency;
+
+DROP TABLE IF EXISTS exchange_rates;
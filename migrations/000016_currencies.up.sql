@@ -0,0 +1,20 @@
+-- Exchange rates quoted against the reference currency
+-- (EXCHANGE_RATE_REFERENCE): how many units of currency one unit of the
+-- reference buys on rate_date. Conversions use the latest rate on or before
+-- a date, which the primary key serves.
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    currency    CHAR(3) NOT NULL,
+    rate_date   DATE NOT NULL,
+    rate        NUMERIC NOT NULL CHECK (rate > 0),
+    source      TEXT,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (currency, rate_date)
+);
+
+-- NULL means DEFAULT_CURRENCY for users, and the owner's base currency for
+-- expenses
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS base_currency CHAR(3);
+
+ALTER TABLE expenses
+    ADD COLUMN IF NOT EXISTS currency CHAR(3);
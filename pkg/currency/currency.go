@@ -0,0 +1,101 @@
+// Package currency knows the ISO 4217 currencies and converts amounts
+// between them with the exchange_rates table.
+//
+// Rates are quoted against one reference currency (EXCHANGE_RATE_REFERENCE,
+// USD by default): a rate is how many units of the currency one unit of the
+// reference buys. Converting on a date uses the latest rate on or before
+// it, so weekends and holidays take the last published rate.
+//
+// Tables and columns:
+//
+//	exchange_rates (currency char(3), rate_date date, rate numeric,
+//	                source text, created_at, PRIMARY KEY (currency, rate_date))
+//	users.base_currency    char(3), null for DEFAULT_CURRENCY
+//	expenses.currency      char(3), null for the owner's base currency;
+//	                       add_expense_v2, add_expense_v3 and
+//	                       update_expense_v3 store the payload's currency
+//	                       in it
+package currency
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	utils_v1 "github.com/FDSAP-Git-Org/hephaestus/utils/v1"
+)
+
+// minorUnits lists the active ISO 4217 currencies and their number of
+// decimal places
+var minorUnits = map[string]int{
+	"AED": 2, "AFN": 2, "ALL": 2, "AMD": 2, "ANG": 2, "AOA": 2, "ARS": 2, "AUD": 2, "AWG": 2, "AZN": 2,
+	"BAM": 2, "BBD": 2, "BDT": 2, "BGN": 2, "BHD": 3, "BIF": 0, "BMD": 2, "BND": 2, "BOB": 2, "BRL": 2,
+	"BSD": 2, "BTN": 2, "BWP": 2, "BYN": 2, "BZD": 2, "CAD": 2, "CDF": 2, "CHF": 2, "CLP": 0, "CNY": 2,
+	"COP": 2, "CRC": 2, "CUP": 2, "CVE": 2, "CZK": 2, "DJF": 0, "DKK": 2, "DOP": 2, "DZD": 2, "EGP": 2,
+	"ERN": 2, "ETB": 2, "EUR": 2, "FJD": 2, "FKP": 2, "GBP": 2, "GEL": 2, "GHS": 2, "GIP": 2, "GMD": 2,
+	"GNF": 0, "GTQ": 2, "GYD": 2, "HKD": 2, "HNL": 2, "HTG": 2, "HUF": 2, "IDR": 2, "ILS": 2, "INR": 2,
+	"IQD": 3, "IRR": 2, "ISK": 0, "JMD": 2, "JOD": 3, "JPY": 0, "KES": 2, "KGS": 2, "KHR": 2, "KMF": 0,
+	"KPW": 2, "KRW": 0, "KWD": 3, "KYD": 2, "KZT": 2, "LAK": 2, "LBP": 2, "LKR": 2, "LRD": 2, "LSL": 2,
+	"LYD": 3, "MAD": 2, "MDL": 2, "MGA": 2, "MKD": 2, "MMK": 2, "MNT": 2, "MOP": 2, "MRU": 2, "MUR": 2,
+	"MVR": 2, "MWK": 2, "MXN": 2, "MYR": 2, "MZN": 2, "NAD": 2, "NGN": 2, "NIO": 2, "NOK": 2, "NPR": 2,
+	"NZD": 2, "OMR": 3, "PAB": 2, "PEN": 2, "PGK": 2, "PHP": 2, "PKR": 2, "PLN": 2, "PYG": 0, "QAR": 2,
+	"RON": 2, "RSD": 2, "RUB": 2, "RWF": 0, "SAR": 2, "SBD": 2, "SCR": 2, "SDG": 2, "SEK": 2, "SGD": 2,
+	"SHP": 2, "SLE": 2, "SOS": 2, "SRD": 2, "SSP": 2, "STN": 2, "SVC": 2, "SYP": 2, "SZL": 2, "THB": 2,
+	"TJS": 2, "TMT": 2, "TND": 3, "TOP": 2, "TRY": 2, "TTD": 2, "TWD": 2, "TZS": 2, "UAH": 2, "UGX": 0,
+	"USD": 2, "UYU": 2, "UZS": 2, "VES": 2, "VND": 0, "VUV": 0, "WST": 2, "XAF": 0, "XCD": 2, "XOF": 0,
+	"XPF": 0, "YER": 2, "ZAR": 2, "ZMW": 2, "ZWG": 2,
+}
+
+var errUnknownCurrency = errors.New("currency must be an ISO 4217 code such as USD or EUR")
+
+// Valid reports whether code is a known currency code, in upper case
+func Valid(code string) bool {
+	_, ok := minorUnits[code]
+	return ok
+}
+
+// Normalize trims and upper-cases a currency code and checks it is known
+func Normalize(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if !Valid(code) {
+		return "", errUnknownCurrency
+	}
+	return code, nil
+}
+
+// MinorUnits is the number of decimal places amounts in the currency have
+func MinorUnits(code string) int {
+	if units, ok := minorUnits[code]; ok {
+		return units
+	}
+	return 2
+}
+
+// Codes lists every known currency code in order
+func Codes() []string {
+	codes := make([]string, 0, len(minorUnits))
+	for code := range minorUnits {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// Default is the base currency of users who have not chosen one
+// (DEFAULT_CURRENCY, USD by default)
+func Default() string {
+	return envCode("DEFAULT_CURRENCY")
+}
+
+// Reference is the currency exchange rates are quoted against
+// (EXCHANGE_RATE_REFERENCE, USD by default)
+func Reference() string {
+	return envCode("EXCHANGE_RATE_REFERENCE")
+}
+
+func envCode(key string) string {
+	if code, err := Normalize(utils_v1.GetEnv(key)); err == nil {
+		return code
+	}
+	return "USD"
+}
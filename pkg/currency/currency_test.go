@@ -0,0 +1,48 @@
+package currency
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"USD", "USD"},
+		{" eur ", "EUR"},
+		{"jpy", "JPY"},
+	}
+	for _, tt := range tests {
+		if got, err := Normalize(tt.code); err != nil || got != tt.want {
+			t.Errorf("Normalize(%q) = %q, %v, want %q", tt.code, got, err, tt.want)
+		}
+	}
+
+	for _, code := range []string{"", "US", "USDT", "XXX", "€"} {
+		if _, err := Normalize(code); err == nil {
+			t.Errorf("Normalize(%q) accepted", code)
+		}
+	}
+	if Valid("usd") {
+		t.Error("Valid accepted a lower-case code")
+	}
+}
+
+func TestMinorUnits(t *testing.T) {
+	tests := map[string]int{"USD": 2, "JPY": 0, "KWD": 3, "unknown": 2}
+	for code, want := range tests {
+		if got := MinorUnits(code); got != want {
+			t.Errorf("MinorUnits(%q) = %d, want %d", code, got, want)
+		}
+	}
+}
+
+func TestDefaultAndReference(t *testing.T) {
+	t.Setenv("DEFAULT_CURRENCY", " gbp")
+	t.Setenv("EXCHANGE_RATE_REFERENCE", "not a code")
+	if got := Default(); got != "GBP" {
+		t.Errorf("Default() = %q, want GBP", got)
+	}
+	if got := Reference(); got != "USD" {
+		t.Errorf("Reference() = %q, want the USD fallback", got)
+	}
+}
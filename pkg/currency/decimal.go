@@ -0,0 +1,133 @@
+package currency
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// rateDecimals is the most decimal places a rate keeps. Inverted rates are
+// rounded to it, which leaves 12 significant digits for a quote of a million.
+const rateDecimals = 18
+
+// maxRateDigits bounds the whole part of a rate
+const maxRateDigits = 18
+
+var errInvalidDecimal = errors.New("rate must be a plain decimal number such as 0.92 or 156.3")
+
+// Decimal is an exact non-negative decimal, such as an exchange rate, kept
+// as text so no digit is lost between the file or request and the numeric
+// column. ParseDecimal returns it without leading or trailing zeros.
+type Decimal string
+
+// ParseDecimal reads a plain decimal such as "1.0850" or ".5". Signs,
+// exponents and more than rateDecimals decimal places are refused.
+func ParseDecimal(value string) (Decimal, error) {
+	whole, fraction, _ := strings.Cut(strings.TrimSpace(value), ".")
+	if whole == "" && fraction == "" || !digits(whole) || !digits(fraction) {
+		return "", errInvalidDecimal
+	}
+	whole = strings.TrimLeft(whole, "0")
+	fraction = strings.TrimRight(fraction, "0")
+	if len(whole) > maxRateDigits {
+		return "", fmt.Errorf("rate must be less than 1e%d", maxRateDigits)
+	}
+	if len(fraction) > rateDecimals {
+		return "", fmt.Errorf("rate must not have more than %d decimal places", rateDecimals)
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	if fraction == "" {
+		return Decimal(whole), nil
+	}
+	return Decimal(whole + "." + fraction), nil
+}
+
+func digits(value string) bool {
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Positive reports whether d is a valid decimal greater than zero
+func (d Decimal) Positive() bool {
+	parsed, err := ParseDecimal(string(d))
+	return err == nil && strings.Trim(string(parsed), "0.") != ""
+}
+
+// Inverse is 1/d rounded half away from zero to rateDecimals places, or
+// an error when d is not positive
+func (d Decimal) Inverse() (Decimal, error) {
+	if !d.Positive() {
+		return "", errors.New("only a rate greater than 0 can be inverted")
+	}
+	r, _ := new(big.Rat).SetString(string(d))
+	return ParseDecimal(r.Inv(r).FloatString(rateDecimals))
+}
+
+// String returns the decimal text
+func (d Decimal) String() string {
+	return string(d)
+}
+
+// MarshalJSON writes the decimal as a JSON number
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	if d == "" {
+		return []byte("null"), nil
+	}
+	return []byte(d), nil
+}
+
+// UnmarshalJSON reads a JSON number or a numeric string without going
+// through float64
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(text); err == nil {
+		text = unquoted
+	}
+	parsed, err := ParseDecimal(text)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// Value stores the decimal as text, which numeric columns take exactly
+func (d Decimal) Value() (driver.Value, error) {
+	return string(d), nil
+}
+
+// Scan reads a numeric column
+func (d *Decimal) Scan(src interface{}) error {
+	var text string
+	switch v := src.(type) {
+	case nil:
+		*d = ""
+		return nil
+	case []byte:
+		text = string(v)
+	case string:
+		text = v
+	case int64:
+		text = strconv.FormatInt(v, 10)
+	default:
+		return fmt.Errorf("cannot scan %T into a decimal", src)
+	}
+	parsed, err := ParseDecimal(text)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
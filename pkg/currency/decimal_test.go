@@ -0,0 +1,135 @@
+package currency
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Decimal
+	}{
+		{"0.9200", "0.92"},
+		{"156.3", "156.3"},
+		{" 1 ", "1"},
+		{".5", "0.5"},
+		{"7.", "7"},
+		{"000", "0"},
+		{"0012.500", "12.5"},
+		{"0.000000000000000001", "0.000000000000000001"},
+		{"999999999999999999", "999999999999999999"},
+	}
+	for _, tt := range tests {
+		got, err := ParseDecimal(tt.value)
+		if err != nil {
+			t.Errorf("ParseDecimal(%q) failed: %v", tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseDecimal(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+
+	rejected := map[string]string{
+		"":                      "plain decimal",
+		".":                     "plain decimal",
+		"-1":                    "plain decimal",
+		"+1":                    "plain decimal",
+		"1e-3":                  "plain decimal",
+		"1,5":                   "plain decimal",
+		"NaN":                   "plain decimal",
+		"0.0000000000000000001": "decimal places",
+		"1000000000000000000":   "less than",
+	}
+	for value, wantErr := range rejected {
+		_, err := ParseDecimal(value)
+		if err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("ParseDecimal(%q) = %v, want an error mentioning %q", value, err, wantErr)
+		}
+	}
+}
+
+func TestDecimalInverse(t *testing.T) {
+	tests := []struct {
+		rate Decimal
+		want Decimal
+	}{
+		{"1", "1"},
+		{"0.8", "1.25"},
+		{"1.25", "0.8"},
+		{"156.25", "0.0064"},
+		{"3", "0.333333333333333333"},
+		{"1.5", "0.666666666666666667"},
+		{"42000", "0.000023809523809524"},
+	}
+	for _, tt := range tests {
+		got, err := tt.rate.Inverse()
+		if err != nil || got != tt.want {
+			t.Errorf("%s.Inverse() = %q, %v, want %q", tt.rate, got, err, tt.want)
+		}
+	}
+
+	for _, rate := range []Decimal{"0", "0.000", "", "x"} {
+		if _, err := rate.Inverse(); err == nil {
+			t.Errorf("%q.Inverse() accepted", rate)
+		}
+	}
+}
+
+func TestDecimalJSON(t *testing.T) {
+	var rates map[string]Decimal
+	if err := json.Unmarshal([]byte(`{"EUR":0.9200,"JPY":"156.30","GBP":null}`), &rates); err != nil {
+		t.Fatal(err)
+	}
+	if rates["EUR"] != "0.92" || rates["JPY"] != "156.3" || rates["GBP"] != "" {
+		t.Errorf("decoded %q", rates)
+	}
+
+	// Digits a float64 would drop are kept
+	out, err := json.Marshal(Rate{Date: "2024-03-01", Currency: "IDR", Rate: "16012.123456789012345"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"date":"2024-03-01","currency":"IDR","rate":16012.123456789012345}`; string(out) != want {
+		t.Errorf("encoded %s, want %s", out, want)
+	}
+	if out, _ := json.Marshal(Decimal("")); string(out) != "null" {
+		t.Errorf("empty decimal encoded as %s", out)
+	}
+
+	var rate Decimal
+	for _, data := range []string{`-1`, `1e3`, `"abc"`, `true`} {
+		if err := json.Unmarshal([]byte(data), &rate); err == nil {
+			t.Errorf("%s accepted", data)
+		}
+	}
+}
+
+func TestDecimalValueAndScan(t *testing.T) {
+	if value, err := Decimal("0.92").Value(); err != nil || value != "0.92" {
+		t.Errorf("Value() = %v, %v", value, err)
+	}
+
+	tests := []struct {
+		src  interface{}
+		want Decimal
+	}{
+		{[]byte("0.920000"), "0.92"},
+		{"156.3", "156.3"},
+		{int64(3), "3"},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		rate := Decimal("1")
+		if err := rate.Scan(tt.src); err != nil || rate != tt.want {
+			t.Errorf("Scan(%#v) = %q, %v, want %q", tt.src, rate, err, tt.want)
+		}
+	}
+
+	var rate Decimal
+	if err := rate.Scan(0.92); err == nil {
+		t.Error("a float64 was scanned")
+	}
+}
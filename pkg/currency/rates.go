@@ -0,0 +1,207 @@
+package currency
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"go_template_v3/pkg/config"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// maxRatesPerLoad bounds one file or request
+const maxRatesPerLoad = 100000
+
+// Rate is how many units of Currency one unit of the reference currency
+// bought on Date
+type Rate struct {
+	Date     string  `json:"date"`
+	Currency string  `json:"currency"`
+	Rate     Decimal `json:"rate"`
+}
+
+// Validate normalizes the rate's currency and checks its date and value
+func (r *Rate) Validate() error {
+	code, err := Normalize(r.Currency)
+	if err != nil {
+		return err
+	}
+	r.Currency = code
+	if _, err := time.Parse("2006-01-02", r.Date); err != nil {
+		return fmt.Errorf("invalid date %q (expected YYYY-MM-DD)", r.Date)
+	}
+	rate, err := ParseDecimal(string(r.Rate))
+	if err != nil {
+		return fmt.Errorf("rate for %s on %s: %v", r.Currency, r.Date, err)
+	}
+	r.Rate = rate
+	if !rate.Positive() {
+		return fmt.Errorf("rate for %s on %s must be greater than 0", r.Currency, r.Date)
+	}
+	return nil
+}
+
+// ParseRatesCSV reads rates from a CSV with date, currency and rate
+// columns, in any order. An optional base column must name the reference
+// currency, or the rate's currency when the row quotes the reference
+// against it, in which case the rate is inverted.
+func ParseRatesCSV(r io.Reader) ([]Rate, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	headers, err := reader.Read()
+	if err != nil {
+		return nil, errors.New("rates file is empty or not a CSV")
+	}
+	columns := map[string]int{}
+	for i, header := range headers {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(header, "\ufeff")))] = i
+	}
+	for _, required := range []string{"date", "currency", "rate"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("rates file needs a %s column", required)
+		}
+	}
+	baseColumn, hasBase := columns["base"]
+	reference := Reference()
+
+	var rates []Rate
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+		value := func(index int) string {
+			if index < len(fields) {
+				return strings.TrimSpace(fields[index])
+			}
+			return ""
+		}
+		if value(columns["date"]) == "" && value(columns["currency"]) == "" {
+			continue
+		}
+
+		amount, err := ParseDecimal(value(columns["rate"]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid rate %q", line, value(columns["rate"]))
+		}
+		rate := Rate{Date: value(columns["date"]), Currency: value(columns["currency"]), Rate: amount}
+
+		if hasBase {
+			base, err := Normalize(value(baseColumn))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+			quote := strings.ToUpper(rate.Currency)
+			switch {
+			case base == reference:
+			case quote == reference && amount.Positive():
+				// The row prices the reference in another currency
+				inverse, err := amount.Inverse()
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %v", line, err)
+				}
+				rate.Currency, rate.Rate = base, inverse
+			default:
+				return nil, fmt.Errorf("line %d: rates must be quoted against %s", line, reference)
+			}
+		}
+
+		if err := rate.Validate(); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		rates = append(rates, rate)
+		if len(rates) > maxRatesPerLoad {
+			return nil, fmt.Errorf("at most %d rates can be loaded at once", maxRatesPerLoad)
+		}
+	}
+	return rates, nil
+}
+
+// Store saves rates, replacing any already stored for the same currency
+// and date, and returns how many were saved. Rates for the reference
+// currency itself are skipped, as it is always 1.
+func Store(db *gorm.DB, rates []Rate, source string) (int, error) {
+	reference := Reference()
+	stored := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, rate := range rates {
+			if err := rate.Validate(); err != nil {
+				return err
+			}
+			if rate.Currency == reference {
+				continue
+			}
+			err := tx.Exec(`
+				INSERT INTO exchange_rates (currency, rate_date, rate, source)
+				VALUES (?, ?::date, ?, ?)
+				ON CONFLICT (currency, rate_date) DO UPDATE SET rate = EXCLUDED.rate, source = EXCLUDED.source
+			`, rate.Currency, rate.Date, rate.Rate, source).Error
+			if err != nil {
+				return err
+			}
+			stored++
+		}
+		return nil
+	})
+	return stored, err
+}
+
+// LoadFile stores the rates in a CSV file
+func LoadFile(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	rates, err := ParseRatesCSV(f)
+	if err != nil {
+		return 0, err
+	}
+	return Store(&config.DBConnList[0], rates, "file:"+path)
+}
+
+// RateSQL returns a SQL expression for the rate that converts amounts in
+// the currency fromExpr into toExpr on dateExpr, or NULL when a rate is
+// missing. The arguments are SQL expressions; callers must not pass user
+// input in them.
+func RateSQL(fromExpr, toExpr, dateExpr string) string {
+	reference := "'" + Reference() + "'"
+	rateOf := func(code string) string {
+		return fmt.Sprintf(`CASE WHEN %[1]s = %[2]s THEN 1::numeric ELSE (
+			SELECT xr.rate FROM exchange_rates xr
+			WHERE xr.currency = %[1]s AND xr.rate_date <= %[3]s
+			ORDER BY xr.rate_date DESC LIMIT 1
+		) END`, code, reference, dateExpr)
+	}
+	return fmt.Sprintf("(CASE WHEN %[1]s = %[2]s THEN 1::numeric ELSE (%[3]s) / NULLIF(%[4]s, 0) END)",
+		fromExpr, toExpr, rateOf(toExpr), rateOf(fromExpr))
+}
+
+// Literal quotes a known currency code for use in SQL built with RateSQL
+func Literal(code string) string {
+	if !Valid(code) {
+		code = Default()
+	}
+	return "'" + code + "'"
+}
+
+// UserBase is the currency the user's totals are reported in
+func UserBase(db *gorm.DB, userId int) string {
+	var base *string
+	db.Raw("SELECT base_currency FROM users WHERE id = ?", userId).Scan(&base)
+	if base != nil && Valid(*base) {
+		return *base
+	}
+	return Default()
+}
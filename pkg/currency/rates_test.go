@@ -0,0 +1,141 @@
+package currency
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRatesCSV(t *testing.T) {
+	t.Setenv("EXCHANGE_RATE_REFERENCE", "USD")
+
+	tests := []struct {
+		name string
+		file string
+		want []Rate
+	}{
+		{
+			"columns in any order",
+			"\ufeffRate, Date ,CURRENCY\n0.9200,2024-03-01,eur\n156.3,2024-03-01,JPY\n",
+			[]Rate{{"2024-03-01", "EUR", "0.92"}, {"2024-03-01", "JPY", "156.3"}},
+		},
+		{
+			"blank rows skipped",
+			"date,currency,rate\n\n,,\n2024-03-01,GBP,0.79\n",
+			[]Rate{{"2024-03-01", "GBP", "0.79"}},
+		},
+		{
+			"quoted against the reference",
+			"date,base,currency,rate\n2024-03-01,usd,EUR,0.8\n",
+			[]Rate{{"2024-03-01", "EUR", "0.8"}},
+		},
+		{
+			"reference quoted against the currency is inverted",
+			"date,base,currency,rate\n2024-03-01,EUR,USD,1.25\n2024-03-01,CHF,USD,1.5\n",
+			[]Rate{{"2024-03-01", "EUR", "0.8"}, {"2024-03-01", "CHF", "0.666666666666666667"}},
+		},
+		{
+			"no rows",
+			"date,currency,rate\n",
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRatesCSV(strings.NewReader(tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRatesCSVRejects(t *testing.T) {
+	t.Setenv("EXCHANGE_RATE_REFERENCE", "USD")
+
+	tests := []struct {
+		name    string
+		file    string
+		wantErr string
+	}{
+		{"empty file", "", "empty"},
+		{"missing column", "date,currency\n2024-03-01,EUR\n", "rate column"},
+		{"invalid rate", "date,currency,rate\n2024-03-01,EUR,0.92\n2024-03-01,JPY,abc\n", "line 3: invalid rate"},
+		{"exponent", "date,currency,rate\n2024-03-01,EUR,9.2e-1\n", "invalid rate"},
+		{"negative rate", "date,currency,rate\n2024-03-01,EUR,-0.92\n", "invalid rate"},
+		{"zero rate", "date,currency,rate\n2024-03-01,EUR,0\n", "greater than 0"},
+		{"bad date", "date,currency,rate\n01/03/2024,EUR,0.92\n", "invalid date"},
+		{"unknown currency", "date,currency,rate\n2024-03-01,EUX,0.92\n", "ISO 4217"},
+		{"unknown base", "date,base,currency,rate\n2024-03-01,EUX,USD,1.1\n", "line 2"},
+		{"cross rate", "date,base,currency,rate\n2024-03-01,EUR,GBP,0.85\n", "quoted against USD"},
+		{"zero inverted rate", "date,base,currency,rate\n2024-03-01,EUR,USD,0\n", "quoted against USD"},
+		{"malformed quoting", "date,currency,rate\n\"2024-03-01,EUR,0.92\n", "invalid CSV"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseRatesCSV(strings.NewReader(tt.file))
+			if err == nil {
+				t.Fatal("file accepted")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error %q does not mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRateValidate(t *testing.T) {
+	rate := Rate{Date: "2024-02-29", Currency: " eur ", Rate: "0.9200"}
+	if err := rate.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if rate.Currency != "EUR" || rate.Rate != "0.92" {
+		t.Errorf("validated rate = %+v", rate)
+	}
+
+	for _, rate := range []Rate{
+		{Date: "2023-02-29", Currency: "EUR", Rate: "1"},
+		{Date: "2024-03-01", Currency: "EUR", Rate: ""},
+		{Date: "2024-03-01", Currency: "EUR", Rate: "0.0"},
+		{Date: "2024-03-01", Currency: "EUR", Rate: "1e2"},
+	} {
+		if err := rate.Validate(); err == nil {
+			t.Errorf("%+v accepted", rate)
+		}
+	}
+}
+
+func TestLiteral(t *testing.T) {
+	t.Setenv("DEFAULT_CURRENCY", "eur")
+
+	tests := map[string]string{
+		"JPY":        "'JPY'",
+		"usd":        "'EUR'",
+		"'; DROP --": "'EUR'",
+		"":           "'EUR'",
+	}
+	for code, want := range tests {
+		if got := Literal(code); got != want {
+			t.Errorf("Literal(%q) = %s, want %s", code, got, want)
+		}
+	}
+}
+
+func TestRateSQL(t *testing.T) {
+	t.Setenv("EXCHANGE_RATE_REFERENCE", "EUR")
+
+	sql := RateSQL("e.currency", "'JPY'", "e.date")
+	for _, want := range []string{
+		"WHEN e.currency = 'JPY' THEN 1::numeric",
+		"WHEN 'JPY' = 'EUR' THEN 1::numeric",
+		"xr.currency = e.currency AND xr.rate_date <= e.date",
+		"NULLIF(",
+	} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("RateSQL does not contain %q:\n%s", want, sql)
+		}
+	}
+}
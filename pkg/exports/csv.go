@@ -0,0 +1,59 @@
+package exports
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+var csvHeaders = []string{"id", "date", "title", "category", "amount", "currency", "converted_amount", "converted_currency", "notes"}
+
+// csvWriter writes plain rows, without totals, so the file can be imported
+// back as is; the import maps amount and currency and ignores the
+// converted columns
+type csvWriter struct {
+	writer         *csv.Writer
+	reportCurrency string
+	headerWritten  bool
+}
+
+func newCSVWriter(w io.Writer, reportCurrency string) *csvWriter {
+	return &csvWriter{writer: csv.NewWriter(w), reportCurrency: reportCurrency}
+}
+
+func (w *csvWriter) Write(expense Expense) error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	converted := ""
+	if expense.Converted != nil {
+		converted = expense.Converted.Format(w.reportCurrency)
+	}
+	return w.writer.Write([]string{
+		strconv.Itoa(expense.Id),
+		expense.Date,
+		expense.Title,
+		expense.Category,
+		expense.Amount.Format(expense.Currency),
+		expense.Currency,
+		converted,
+		w.reportCurrency,
+		expense.Notes,
+	})
+}
+
+func (w *csvWriter) Close() error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+func (w *csvWriter) writeHeader() error {
+	if w.headerWritten {
+		return nil
+	}
+	w.headerWritten = true
+	return w.writer.Write(csvHeaders)
+}
@@ -0,0 +1,58 @@
+package exports
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"testing"
+)
+
+func TestCSVWriter(t *testing.T) {
+	var out bytes.Buffer
+	writer, err := NewWriter(FormatCSV, &out, "Expenses", "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expenses := testExpenses(t)
+	expenses[0].Notes = "milk, \"organic\""
+	for _, expense := range expenses {
+		if err := writer.Write(expense); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		csvHeaders,
+		{"1", "2024-03-01", "Groceries", "Food", "42.50", "USD", "42.50", "USD", "milk, \"organic\""},
+		{"2", "2024-03-02", "Ramen", "Food", "1500", "JPY", "10.05", "USD", ""},
+		{"3", "2024-03-03", "Train", "", "12.00", "USD", "12.00", "USD", ""},
+		{"4", "2024-03-04", "Souvenir", "Gifts", "30", "XAF", "", "USD", "no rate"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows =\n%q\nwant\n%q", rows, want)
+	}
+}
+
+func TestCSVWriterEmpty(t *testing.T) {
+	var out bytes.Buffer
+	writer, _ := NewWriter(FormatCSV, &out, "Expenses", "USD")
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// An export with no expenses still has its header
+	rows, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rows, [][]string{csvHeaders}) {
+		t.Errorf("rows = %q", rows)
+	}
+}
@@ -0,0 +1,128 @@
+// Package exports writes expenses out as CSV, XLSX or a printable PDF report.
+// Writers take one expense at a time so an export of any size is written
+// without holding it in memory; only the per-category totals are kept.
+package exports
+
+import (
+	"errors"
+	"go_template_v3/pkg/money"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Formats an export can be written in
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+	FormatPDF  = "pdf"
+)
+
+// Expense is one exported row. Amount is in the expense's own Currency;
+// Converted is it in the report's currency, or nil when no exchange rate
+// was known for its date.
+type Expense struct {
+	Id        int
+	Date      string
+	Title     string
+	Category  string
+	Amount    money.Amount
+	Currency  string
+	Converted *money.Amount
+	Notes     string
+}
+
+// Writer writes expenses in one format. Close finishes the file, adding the
+// totals where the format has room for them; it does not close the
+// underlying io.Writer.
+type Writer interface {
+	Write(expense Expense) error
+	Close() error
+}
+
+// NewWriter returns a writer for the format. The title heads PDF reports,
+// and totals are in reportCurrency, the currency expenses were converted
+// into.
+func NewWriter(format string, w io.Writer, title, reportCurrency string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w, reportCurrency), nil
+	case FormatXLSX:
+		return newXLSXWriter(w, reportCurrency), nil
+	case FormatPDF:
+		return newPDFWriter(w, title, reportCurrency), nil
+	}
+	return nil, errors.New("format must be csv, xlsx or pdf")
+}
+
+// ContentType returns the MIME type of a format
+func ContentType(format string) string {
+	switch format {
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case FormatPDF:
+		return "application/pdf"
+	}
+	return "text/csv"
+}
+
+// IsFormat reports whether format is one NewWriter accepts
+func IsFormat(format string) bool {
+	return format == FormatCSV || format == FormatXLSX || format == FormatPDF
+}
+
+// CategoryTotal is the sum of one category's expenses
+type CategoryTotal struct {
+	Category string
+	Count    int
+	Amount   money.Amount
+}
+
+// totals adds up the converted amounts of expenses per category as they
+// are written. Expenses that could not be converted are only counted in
+// unconverted.
+type totals struct {
+	byCategory  map[string]*CategoryTotal
+	count       int
+	amount      money.Amount
+	unconverted int
+}
+
+func newTotals() *totals {
+	return &totals{byCategory: map[string]*CategoryTotal{}}
+}
+
+func (t *totals) add(expense Expense) {
+	if expense.Converted == nil {
+		t.unconverted++
+		return
+	}
+	category := expense.Category
+	if strings.TrimSpace(category) == "" {
+		category = "Uncategorized"
+	}
+	total, ok := t.byCategory[category]
+	if !ok {
+		total = &CategoryTotal{Category: category}
+		t.byCategory[category] = total
+	}
+	total.Count++
+	total.Amount += *expense.Converted
+	t.count++
+	t.amount += *expense.Converted
+}
+
+// sorted returns the categories from the largest amount down
+func (t *totals) sorted() []CategoryTotal {
+	list := make([]CategoryTotal, 0, len(t.byCategory))
+	for _, total := range t.byCategory {
+		list = append(list, *total)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Amount != list[j].Amount {
+			return list[i].Amount > list[j].Amount
+		}
+		return list[i].Category < list[j].Category
+	})
+	return list
+}
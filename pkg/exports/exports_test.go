@@ -0,0 +1,89 @@
+package exports
+
+import (
+	"go_template_v3/pkg/money"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func amount(t *testing.T, value string) money.Amount {
+	t.Helper()
+	a, err := money.Parse(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// testExpenses are in two currencies, with one that has no exchange rate
+func testExpenses(t *testing.T) []Expense {
+	converted := func(value string) *money.Amount {
+		a := amount(t, value)
+		return &a
+	}
+	return []Expense{
+		{Id: 1, Date: "2024-03-01", Title: "Groceries", Category: "Food", Amount: amount(t, "42.5"), Currency: "USD", Converted: converted("42.5")},
+		{Id: 2, Date: "2024-03-02", Title: "Ramen", Category: "Food", Amount: amount(t, "1500"), Currency: "JPY", Converted: converted("10.05")},
+		{Id: 3, Date: "2024-03-03", Title: "Train", Category: "", Amount: amount(t, "12"), Currency: "USD", Converted: converted("12")},
+		{Id: 4, Date: "2024-03-04", Title: "Souvenir", Category: "Gifts", Amount: amount(t, "30"), Currency: "XAF", Notes: "no rate"},
+	}
+}
+
+func TestNewWriterFormats(t *testing.T) {
+	for _, format := range []string{FormatCSV, FormatXLSX, FormatPDF} {
+		if !IsFormat(format) {
+			t.Errorf("IsFormat(%q) = false", format)
+		}
+		if _, err := NewWriter(format, io.Discard, "Expenses", "USD"); err != nil {
+			t.Errorf("NewWriter(%q) failed: %v", format, err)
+		}
+	}
+
+	if IsFormat("json") {
+		t.Error("IsFormat(json) = true")
+	}
+	if _, err := NewWriter("json", io.Discard, "Expenses", "USD"); err == nil {
+		t.Error("NewWriter(json) accepted")
+	}
+	if got := ContentType(FormatPDF); got != "application/pdf" {
+		t.Errorf("ContentType(pdf) = %q", got)
+	}
+	if got := ContentType(FormatCSV); got != "text/csv" {
+		t.Errorf("ContentType(csv) = %q", got)
+	}
+}
+
+func TestTotals(t *testing.T) {
+	totals := newTotals()
+	for _, expense := range testExpenses(t) {
+		totals.add(expense)
+	}
+
+	want := []CategoryTotal{
+		{Category: "Food", Count: 2, Amount: amount(t, "52.55")},
+		{Category: "Uncategorized", Count: 1, Amount: amount(t, "12")},
+	}
+	if got := totals.sorted(); !reflect.DeepEqual(got, want) {
+		t.Errorf("sorted totals = %+v, want %+v", got, want)
+	}
+	if totals.count != 3 || totals.amount != amount(t, "64.55") || totals.unconverted != 1 {
+		t.Errorf("totals = %d expenses, %s, %d unconverted", totals.count, totals.amount, totals.unconverted)
+	}
+}
+
+func TestTotalsTieOrder(t *testing.T) {
+	totals := newTotals()
+	for _, category := range []string{"Rent", "Books", "Music"} {
+		a := amount(t, "10")
+		totals.add(Expense{Category: category, Converted: &a})
+	}
+
+	var got []string
+	for _, total := range totals.sorted() {
+		got = append(got, total.Category)
+	}
+	if want := []string{"Books", "Music", "Rent"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("equal totals in order %q, want %q", got, want)
+	}
+}
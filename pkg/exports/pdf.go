@@ -0,0 +1,289 @@
+package exports
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A4 page layout in points
+const (
+	pdfPageWidth  = 595
+	pdfPageHeight = 842
+	pdfMargin     = 40
+	pdfLineHeight = 14
+	pdfFontSize   = 9
+)
+
+// Reserved object numbers; pages and their contents follow
+const (
+	pdfCatalogObject = 1
+	pdfPagesObject   = 2
+	pdfFontObject    = 3
+	pdfBoldObject    = 4
+)
+
+// pdfWriter writes a plain tabular report in the standard Helvetica fonts,
+// one page at a time, with per-category totals at the end. Each row shows
+// the amount as entered and converted into the report's currency.
+type pdfWriter struct {
+	out            *countingWriter
+	title          string
+	reportCurrency string
+	offsets        map[int]int64
+	next           int
+	pages          []int
+	page           *bytes.Buffer
+	y              float64
+	totals         *totals
+	started        bool
+	// headingsDue is set on each new page until the table headings are drawn
+	headingsDue bool
+}
+
+func newPDFWriter(w io.Writer, title, reportCurrency string) *pdfWriter {
+	return &pdfWriter{
+		out:            &countingWriter{w: w},
+		title:          title,
+		reportCurrency: reportCurrency,
+		offsets:        map[int]int64{},
+		next:           pdfBoldObject + 1,
+		totals:         newTotals(),
+	}
+}
+
+func (w *pdfWriter) Write(expense Expense) error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	w.totals.add(expense)
+
+	if err := w.ensureSpace(1); err != nil {
+		return err
+	}
+	if w.headingsDue {
+		w.headings()
+	}
+	converted := "-"
+	if expense.Converted != nil {
+		converted = expense.Converted.Format(w.reportCurrency)
+	}
+	w.text("F1", pdfMargin, w.y, expense.Date)
+	w.text("F1", pdfMargin+70, w.y, truncate(expense.Title, 36))
+	w.text("F1", pdfMargin+250, w.y, truncate(expense.Category, 18))
+	w.textRight("F1", pdfMargin+430, w.y, expense.Amount.Format(expense.Currency)+" "+expense.Currency)
+	w.textRight("F1", pdfPageWidth-pdfMargin, w.y, converted)
+	w.y -= pdfLineHeight
+	return nil
+}
+
+func (w *pdfWriter) Close() error {
+	if err := w.start(); err != nil {
+		return err
+	}
+
+	// Totals by category
+	categories := w.totals.sorted()
+	if err := w.ensureSpace(3); err != nil {
+		return err
+	}
+	w.y -= pdfLineHeight
+	w.text("F2", pdfMargin, w.y, "Totals by category")
+	w.y -= pdfLineHeight * 1.5
+	for _, total := range categories {
+		if err := w.ensureSpace(1); err != nil {
+			return err
+		}
+		w.text("F1", pdfMargin, w.y, truncate(total.Category, 50))
+		w.textRight("F1", pdfMargin+370, w.y, strconv.Itoa(total.Count))
+		w.textRight("F1", pdfPageWidth-pdfMargin, w.y, total.Amount.Format(w.reportCurrency))
+		w.y -= pdfLineHeight
+	}
+	if err := w.ensureSpace(2); err != nil {
+		return err
+	}
+	w.text("F2", pdfMargin, w.y, "Total ("+w.reportCurrency+")")
+	w.textRight("F2", pdfMargin+370, w.y, strconv.Itoa(w.totals.count))
+	w.textRight("F2", pdfPageWidth-pdfMargin, w.y, w.totals.amount.Format(w.reportCurrency))
+	if w.totals.unconverted > 0 {
+		w.y -= pdfLineHeight
+		w.text("F1", pdfMargin, w.y, fmt.Sprintf("%d expenses without an exchange rate are left out of the totals", w.totals.unconverted))
+	}
+
+	if err := w.finishPage(); err != nil {
+		return err
+	}
+
+	// Page tree, catalog and cross-reference table
+	kids := make([]string, len(w.pages))
+	for i, page := range w.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", page)
+	}
+	w.object(pdfPagesObject, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(w.pages)))
+	w.object(pdfCatalogObject, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pdfPagesObject))
+
+	xref := w.out.n
+	fmt.Fprintf(w.out, "xref\n0 %d\n0000000000 65535 f \n", w.next)
+	for i := 1; i < w.next; i++ {
+		fmt.Fprintf(w.out, "%010d 00000 n \n", w.offsets[i])
+	}
+	fmt.Fprintf(w.out, "trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", w.next, pdfCatalogObject, xref)
+	return w.out.err
+}
+
+// start writes the file header and fonts, and opens the first page
+func (w *pdfWriter) start() error {
+	if w.started {
+		return w.out.err
+	}
+	w.started = true
+
+	io.WriteString(w.out, "%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	w.object(pdfFontObject, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	w.object(pdfBoldObject, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	w.startPage()
+	return w.out.err
+}
+
+func (w *pdfWriter) startPage() {
+	w.page = &bytes.Buffer{}
+	w.y = pdfPageHeight - pdfMargin
+	w.headingsDue = true
+
+	if len(w.pages) == 0 {
+		w.textSized("F2", 14, pdfMargin, w.y, w.title)
+		w.y -= pdfLineHeight
+		w.text("F1", pdfMargin, w.y, "Generated "+time.Now().UTC().Format("2006-01-02 15:04 UTC"))
+		w.y -= pdfLineHeight * 2
+	}
+}
+
+// ensureSpace starts a new page when fewer than lines rows (plus headings)
+// fit on this one
+func (w *pdfWriter) ensureSpace(lines int) error {
+	if w.y-float64(lines+2)*pdfLineHeight < pdfMargin {
+		if err := w.finishPage(); err != nil {
+			return err
+		}
+		w.startPage()
+	}
+	return nil
+}
+
+func (w *pdfWriter) headings() {
+	w.text("F2", pdfMargin, w.y, "Date")
+	w.text("F2", pdfMargin+70, w.y, "Title")
+	w.text("F2", pdfMargin+250, w.y, "Category")
+	w.textRight("F2", pdfMargin+430, w.y, "Amount")
+	w.textRight("F2", pdfPageWidth-pdfMargin, w.y, "Amount ("+w.reportCurrency+")")
+	w.y -= pdfLineHeight * 1.5
+	w.headingsDue = false
+}
+
+// finishPage writes the open page's content stream and page object
+func (w *pdfWriter) finishPage() error {
+	pageNumber := len(w.pages) + 1
+	w.text("F1", pdfMargin, pdfMargin/2, fmt.Sprintf("Page %d", pageNumber))
+
+	contents := w.next
+	page := w.next + 1
+	w.next += 2
+
+	w.object(contents, fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", w.page.Len(), w.page.String()))
+	w.object(page, fmt.Sprintf(
+		"<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 %d 0 R /F2 %d 0 R >> >> /Contents %d 0 R >>",
+		pdfPagesObject, pdfPageWidth, pdfPageHeight, pdfFontObject, pdfBoldObject, contents,
+	))
+	w.pages = append(w.pages, page)
+	w.page = nil
+	return w.out.err
+}
+
+func (w *pdfWriter) object(number int, body string) {
+	w.offsets[number] = w.out.n
+	fmt.Fprintf(w.out, "%d 0 obj\n%s\nendobj\n", number, body)
+}
+
+func (w *pdfWriter) text(font string, x, y float64, value string) {
+	w.textSized(font, pdfFontSize, x, y, value)
+}
+
+func (w *pdfWriter) textSized(font string, size, x, y float64, value string) {
+	fmt.Fprintf(w.page, "BT /%s %g Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, pdfString(value))
+}
+
+// textRight right-aligns short numeric text, whose Helvetica widths are
+// known, at x
+func (w *pdfWriter) textRight(font string, x, y float64, value string) {
+	w.text(font, x-textWidth(value, pdfFontSize), y, value)
+}
+
+// textWidth measures digits and number punctuation in Helvetica, using an
+// average width for anything else
+func textWidth(value string, size float64) float64 {
+	units := 0
+	for _, r := range value {
+		switch {
+		case r >= '0' && r <= '9':
+			units += 556
+		case r == '.' || r == ',' || r == ' ':
+			units += 278
+		case r == '-':
+			units += 333
+		default:
+			units += 600
+		}
+	}
+	return float64(units) * size / 1000
+}
+
+// pdfString escapes a value for a literal string in WinAnsi encoding,
+// replacing characters outside Latin-1
+func pdfString(value string) string {
+	var b strings.Builder
+	for _, r := range value {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			b.WriteByte(byte(r))
+		case r == '\t' || r == '\n' || r == '\r':
+			b.WriteByte(' ')
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+func truncate(value string, max int) string {
+	runes := []rune(value)
+	if len(runes) <= max {
+		return value
+	}
+	return string(runes[:max-1]) + "..."
+}
+
+// countingWriter tracks the offset of each PDF object and keeps the first
+// write error
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
@@ -0,0 +1,135 @@
+package exports
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// checkPDF checks the file's frame: the header, every object in the
+// cross-reference table at its offset, and the trailer pointing at the
+// table. It returns the number of pages.
+func checkPDF(t *testing.T, file []byte) int {
+	t.Helper()
+	if !bytes.HasPrefix(file, []byte("%PDF-1.4\n")) {
+		t.Fatal("missing PDF header")
+	}
+	if !bytes.HasSuffix(file, []byte("%%EOF\n")) {
+		t.Fatal("missing end of file marker")
+	}
+
+	match := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(file)
+	if match == nil {
+		t.Fatal("missing startxref")
+	}
+	xref, _ := strconv.Atoi(string(match[1]))
+	if !bytes.HasPrefix(file[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+
+	lines := strings.Split(string(file[xref:]), "\n")
+	var count int
+	fmt.Sscanf(lines[1], "0 %d", &count)
+	for i := 1; i < count; i++ {
+		offset, _ := strconv.Atoi(lines[2+i][:10])
+		if want := fmt.Sprintf("%d 0 obj\n", i); !bytes.HasPrefix(file[offset:], []byte(want)) {
+			t.Errorf("object %d is not at offset %d", i, offset)
+		}
+	}
+
+	pages := regexp.MustCompile(`/Type /Pages /Kids \[[^\]]*\] /Count (\d+)`).FindSubmatch(file)
+	if pages == nil {
+		t.Fatal("missing page tree")
+	}
+	n, _ := strconv.Atoi(string(pages[1]))
+	return n
+}
+
+func TestPDFWriter(t *testing.T) {
+	var out bytes.Buffer
+	writer, err := NewWriter(FormatPDF, &out, "March (2024) report", "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expense := range testExpenses(t) {
+		if err := writer.Write(expense); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if pages := checkPDF(t, out.Bytes()); pages != 1 {
+		t.Errorf("got %d pages, want 1", pages)
+	}
+	file := out.String()
+	for _, want := range []string{
+		`(March \(2024\) report) Tj`,
+		"(1500 JPY) Tj",
+		"(10.05) Tj",
+		"(Totals by category) Tj",
+		"(Total \\(USD\\)) Tj",
+		"(64.55) Tj",
+		"(1 expenses without an exchange rate are left out of the totals) Tj",
+	} {
+		if !strings.Contains(file, want) {
+			t.Errorf("report does not contain %q", want)
+		}
+	}
+}
+
+func TestPDFWriterPaginates(t *testing.T) {
+	var out bytes.Buffer
+	writer, _ := NewWriter(FormatPDF, &out, "Expenses", "USD")
+	expense := testExpenses(t)[0]
+	for i := 0; i < 150; i++ {
+		if err := writer.Write(expense); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	pages := checkPDF(t, out.Bytes())
+	if pages < 3 {
+		t.Errorf("150 rows fit on %d pages", pages)
+	}
+	// Every page repeats the table headings
+	if got := strings.Count(out.String(), "(Amount \\(USD\\)) Tj"); got != pages {
+		t.Errorf("headings drawn %d times on %d pages", got, pages)
+	}
+	if !strings.Contains(out.String(), fmt.Sprintf("(Page %d) Tj", pages)) {
+		t.Error("last page is not numbered")
+	}
+}
+
+func TestPDFString(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{`a (b) \c`, `a \(b\) \\c`},
+		{"Café", "Caf\xe9"},
+		{"tab\tnew\nline", "tab new line"},
+		{"€5 ramen 🍜", "?5 ramen ?"},
+	}
+	for _, tt := range tests {
+		if got := pdfString(tt.value); got != tt.want {
+			t.Errorf("pdfString(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if got := truncate("Groceries", 20); got != "Groceries" {
+		t.Errorf("short value truncated to %q", got)
+	}
+	if got := truncate("Crème brûlée and more", 10); got != "Crème brû..." {
+		t.Errorf("truncate = %q", got)
+	}
+}
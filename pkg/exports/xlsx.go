@@ -0,0 +1,185 @@
+package exports
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"go_template_v3/pkg/money"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// xlsxWriter writes a workbook with an Expenses sheet and a Totals sheet.
+// The Expenses sheet is streamed into the zip as rows arrive; the other
+// parts are small and written on Close.
+type xlsxWriter struct {
+	zip            *zip.Writer
+	sheet          *bufio.Writer
+	row            int
+	totals         *totals
+	reportCurrency string
+	err            error
+}
+
+func newXLSXWriter(w io.Writer, reportCurrency string) *xlsxWriter {
+	return &xlsxWriter{zip: zip.NewWriter(w), totals: newTotals(), reportCurrency: reportCurrency}
+}
+
+func (w *xlsxWriter) Write(expense Expense) error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	w.totals.add(expense)
+	converted := textCell("")
+	if expense.Converted != nil {
+		converted = moneyCell(*expense.Converted, w.reportCurrency)
+	}
+	w.writeRow(w.sheet, &w.row,
+		numberCell(float64(expense.Id)),
+		textCell(expense.Date),
+		textCell(expense.Title),
+		textCell(expense.Category),
+		moneyCell(expense.Amount, expense.Currency),
+		textCell(expense.Currency),
+		converted,
+		textCell(w.reportCurrency),
+		textCell(expense.Notes),
+	)
+	return w.err
+}
+
+func (w *xlsxWriter) Close() error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	w.sheet.WriteString(`</sheetData></worksheet>`)
+	if err := w.sheet.Flush(); err != nil {
+		return err
+	}
+
+	// Totals sheet
+	part, err := w.zip.Create("xl/worksheets/sheet2.xml")
+	if err != nil {
+		return err
+	}
+	totalsSheet := bufio.NewWriter(part)
+	totalsSheet.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	row := 0
+	w.writeRow(totalsSheet, &row, textCell("category"), textCell("count"), textCell("amount"), textCell("currency"))
+	for _, total := range w.totals.sorted() {
+		w.writeRow(totalsSheet, &row, textCell(total.Category), numberCell(float64(total.Count)),
+			moneyCell(total.Amount, w.reportCurrency), textCell(w.reportCurrency))
+	}
+	w.writeRow(totalsSheet, &row, textCell("Total"), numberCell(float64(w.totals.count)),
+		moneyCell(w.totals.amount, w.reportCurrency), textCell(w.reportCurrency))
+	if w.totals.unconverted > 0 {
+		w.writeRow(totalsSheet, &row, textCell("No exchange rate, not totalled"), numberCell(float64(w.totals.unconverted)))
+	}
+	totalsSheet.WriteString(`</sheetData></worksheet>`)
+	if err := totalsSheet.Flush(); err != nil {
+		return err
+	}
+	if w.err != nil {
+		return w.err
+	}
+
+	parts := map[string]string{
+		"[Content_Types].xml": `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+			`<Override PartName="/xl/worksheets/sheet2.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+			`</Types>`,
+		"_rels/.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`,
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="Expenses" sheetId="1" r:id="rId1"/><sheet name="Totals" sheetId="2" r:id="rId2"/></sheets>` +
+			`</workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+			`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet2.xml"/>` +
+			`</Relationships>`,
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels"} {
+		part, err := w.zip.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(part, xml.Header+parts[name]); err != nil {
+			return err
+		}
+	}
+
+	return w.zip.Close()
+}
+
+// start opens the Expenses sheet and writes its header row
+func (w *xlsxWriter) start() error {
+	if w.sheet != nil {
+		return nil
+	}
+	part, err := w.zip.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	w.sheet = bufio.NewWriter(part)
+	w.sheet.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	w.writeRow(w.sheet, &w.row, textCell("id"), textCell("date"), textCell("title"), textCell("category"), textCell("amount"),
+		textCell("currency"), textCell("converted_amount"), textCell("converted_currency"), textCell("notes"))
+	return w.err
+}
+
+// cell is the inner XML of one cell and its type attribute
+type cell struct {
+	kind  string
+	value string
+}
+
+func textCell(value string) cell {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(cleanXMLText(value)))
+	return cell{kind: "inlineStr", value: `<is><t xml:space="preserve">` + b.String() + `</t></is>`}
+}
+
+func numberCell(value float64) cell {
+	return cell{value: "<v>" + strconv.FormatFloat(value, 'f', -1, 64) + "</v>"}
+}
+
+// moneyCell writes an amount exactly, with the currency's number of
+// decimals
+func moneyCell(amount money.Amount, code string) cell {
+	return cell{value: "<v>" + amount.Format(code) + "</v>"}
+}
+
+func (w *xlsxWriter) writeRow(sheet *bufio.Writer, row *int, cells ...cell) {
+	*row++
+	number := strconv.Itoa(*row)
+	sheet.WriteString(`<row r="` + number + `">`)
+	for i, c := range cells {
+		ref := string(rune('A'+i)) + number
+		if c.kind != "" {
+			sheet.WriteString(`<c r="` + ref + `" t="` + c.kind + `">` + c.value + `</c>`)
+		} else {
+			sheet.WriteString(`<c r="` + ref + `">` + c.value + `</c>`)
+		}
+	}
+	if _, err := sheet.WriteString(`</row>`); err != nil && w.err == nil {
+		w.err = err
+	}
+}
+
+// cleanXMLText drops control characters XML 1.0 does not allow
+func cleanXMLText(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+			return -1
+		}
+		if r == 0xFFFE || r == 0xFFFF {
+			return -1
+		}
+		return r
+	}, value)
+}
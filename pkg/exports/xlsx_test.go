@@ -0,0 +1,131 @@
+package exports
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+// readSheet returns a worksheet's cell values row by row, as a spreadsheet
+// would read them
+func readSheet(t *testing.T, files map[string]*zip.File, name string) [][]string {
+	t.Helper()
+	file, ok := files[name]
+	if !ok {
+		t.Fatalf("workbook has no %s", name)
+	}
+	f, err := file.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var sheet struct {
+		Rows []struct {
+			R     string `xml:"r,attr"`
+			Cells []struct {
+				R      string `xml:"r,attr"`
+				V      string `xml:"v"`
+				Inline string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := xml.NewDecoder(f).Decode(&sheet); err != nil {
+		t.Fatalf("%s is not valid XML: %v", name, err)
+	}
+
+	var rows [][]string
+	for _, row := range sheet.Rows {
+		var values []string
+		for _, c := range row.Cells {
+			if !strings.HasSuffix(c.R, row.R) {
+				t.Errorf("%s: cell %s in row %s", name, c.R, row.R)
+			}
+			values = append(values, c.V+c.Inline)
+		}
+		rows = append(rows, values)
+	}
+	return rows
+}
+
+func TestXLSXWriter(t *testing.T) {
+	var out bytes.Buffer
+	writer, err := NewWriter(FormatXLSX, &out, "Expenses", "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expenses := testExpenses(t)
+	expenses[0].Title = "Fish & <chips>\x01"
+	for _, expense := range expenses {
+		if err := writer.Write(expense); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]*zip.File{}
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("workbook has no %s", name)
+		}
+	}
+
+	rows := readSheet(t, files, "xl/worksheets/sheet1.xml")
+	if len(rows) != 5 {
+		t.Fatalf("expenses sheet has %d rows, want 5", len(rows))
+	}
+	if strings.Join(rows[0], ",") != strings.Join(csvHeaders, ",") {
+		t.Errorf("header row = %q", rows[0])
+	}
+	// Text is escaped and stripped of control characters, amounts keep the
+	// currency's decimals
+	if got := strings.Join(rows[1], "|"); got != "1|2024-03-01|Fish & <chips>|Food|42.50|USD|42.50|USD|" {
+		t.Errorf("first row = %q", got)
+	}
+	if got := strings.Join(rows[4], "|"); got != "4|2024-03-04|Souvenir|Gifts|30|XAF||USD|no rate" {
+		t.Errorf("unconverted row = %q", got)
+	}
+
+	totals := readSheet(t, files, "xl/worksheets/sheet2.xml")
+	want := []string{
+		"category|count|amount|currency",
+		"Food|2|52.55|USD",
+		"Uncategorized|1|12.00|USD",
+		"Total|3|64.55|USD",
+		"No exchange rate, not totalled|1",
+	}
+	if len(totals) != len(want) {
+		t.Fatalf("totals sheet has %d rows, want %d", len(totals), len(want))
+	}
+	for i := range want {
+		if got := strings.Join(totals[i], "|"); got != want[i] {
+			t.Errorf("totals row %d = %q, want %q", i+1, got, want[i])
+		}
+	}
+}
+
+func TestXLSXWriterReportsWriteErrors(t *testing.T) {
+	writer, _ := NewWriter(FormatXLSX, failingWriter{}, "Expenses", "USD")
+	for i := 0; i < 2000; i++ {
+		writer.Write(testExpenses(t)[0])
+	}
+	if err := writer.Close(); err == nil {
+		t.Error("Close succeeded on a failing writer")
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) { return 0, io.ErrClosedPipe }
@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"encoding/json"
+	"go_template_v3/pkg/config"
+	"log"
+	"sort"
+	"time"
+
+	utils_v1 "github.com/FDSAP-Git-Org/hephaestus/utils/v1"
+)
+
+// APIKeyPrefix marks keys issued by this service so they are easy to spot in logs and secret scanners
+const APIKeyPrefix = "gtk_"
+
+// APIKeyScopes maps the scopes a user can grant to a key onto permissions
+var APIKeyScopes = map[string][]string{
+	"read-only":      {"expenses:read"},
+	"expenses:write": {"expenses:read", "expenses:write"},
+	"batch":          {"expenses:read", "expenses:batch"},
+}
+
+// APIKeyIdentity is what AuthMiddleware needs to know about a valid key
+type APIKeyIdentity struct {
+	KeyId         int
+	UserId        int
+	Email         string
+	EmailVerified bool
+	Roles         []string
+	Permissions   []string
+}
+
+// GenerateAPIKey returns a new raw key and the short prefix shown in listings
+func GenerateAPIKey() (string, string) {
+	displayPrefix := GenerateOpaqueToken(8)
+	return APIKeyPrefix + displayPrefix + "_" + GenerateOpaqueToken(40), APIKeyPrefix + displayPrefix
+}
+
+// APIKeyPermissions expands scopes into permissions
+func APIKeyPermissions(scopes []string) []string {
+	set := map[string]bool{}
+	for _, scope := range scopes {
+		for _, permission := range APIKeyScopes[scope] {
+			set[permission] = true
+		}
+	}
+
+	permissions := make([]string, 0, len(set))
+	for permission := range set {
+		permissions = append(permissions, permission)
+	}
+	sort.Strings(permissions)
+	return permissions
+}
+
+// AuthenticateAPIKey resolves a raw key to its owner. Keys never carry more
+// permissions than the owner currently has, so demoting a user also limits
+// their keys.
+func AuthenticateAPIKey(rawKey string) (*APIKeyIdentity, error) {
+	var key struct {
+		Id            int
+		UserId        int
+		Email         string
+		EmailVerified bool
+		Scopes        string
+	}
+	err := config.DBConnList[0].Raw(`
+		SELECT k.id, k.user_id, u.email, u.email_verified_at IS NOT NULL AS email_verified, k.scopes
+		FROM api_keys k
+		JOIN users u ON u.id = k.user_id
+		WHERE k.key_hash = ?
+			AND k.revoked_at IS NULL
+			AND (k.expires_at IS NULL OR k.expires_at > NOW())
+			AND u.deleted_at IS NULL
+	`, utils_v1.HashDataSHA512(rawKey)).Scan(&key).Error
+	if err != nil || key.Id == 0 {
+		return nil, err
+	}
+
+	var scopes []string
+	if err := json.Unmarshal([]byte(key.Scopes), &scopes); err != nil {
+		return nil, err
+	}
+
+	roles, userPermissions, err := GetUserAccess(key.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions := []string{}
+	for _, permission := range APIKeyPermissions(scopes) {
+		if HasPermission(userPermissions, permission) {
+			permissions = append(permissions, permission)
+		}
+	}
+
+	// Only touch last_used_at once a minute to keep writes down on busy keys
+	go func(keyId int) {
+		err := config.DBConnList[0].Exec(`
+			UPDATE api_keys SET last_used_at = NOW()
+			WHERE id = ? AND (last_used_at IS NULL OR last_used_at < ?)
+		`, keyId, time.Now().Add(-time.Minute)).Error
+		if err != nil {
+			log.Printf("Error updating api key %d last use: %v", keyId, err)
+		}
+	}(key.Id)
+
+	return &APIKeyIdentity{
+		KeyId:         key.Id,
+		UserId:        key.UserId,
+		Email:         key.Email,
+		EmailVerified: key.EmailVerified,
+		Roles:         roles,
+		Permissions:   permissions,
+	}, nil
+}
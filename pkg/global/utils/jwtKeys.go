@@ -0,0 +1,216 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	utils_v1 "github.com/FDSAP-Git-Org/hephaestus/utils/v1"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// jwtKey is one signing or verification key. Retired keys only have a public
+// half and stay loaded until every token they signed has expired.
+type jwtKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+var (
+	jwtKeysMutex  sync.RWMutex
+	jwtSigningKey *jwtKey
+	jwtVerifyKeys = map[string]*jwtKey{}
+)
+
+// LoadJWTKeys reads every <kid>.pem file in JWT_KEYS_DIR. Private keys (RSA
+// or Ed25519, PKCS#8 or PKCS#1) can sign and verify; public keys only verify.
+// JWT_ACTIVE_KID selects the signing key, defaulting to the last private key
+// by name. Without JWT_KEYS_DIR tokens fall back to HS256 with JWT_SECRET.
+func LoadJWTKeys() error {
+	dir := utils_v1.GetEnv("JWT_KEYS_DIR")
+	if dir == "" {
+		return nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	verifyKeys := map[string]*jwtKey{}
+	var lastPrivate *jwtKey
+	for _, file := range files {
+		key, err := readJWTKey(file)
+		if err != nil {
+			return fmt.Errorf("loading %s: %w", file, err)
+		}
+		verifyKeys[key.ID] = key
+		if key.Private != nil {
+			lastPrivate = key
+		}
+	}
+
+	signingKey := lastPrivate
+	if activeKid := utils_v1.GetEnv("JWT_ACTIVE_KID"); activeKid != "" {
+		signingKey = verifyKeys[activeKid]
+	}
+	if signingKey == nil || signingKey.Private == nil {
+		return errors.New("no private signing key found in JWT_KEYS_DIR")
+	}
+
+	jwtKeysMutex.Lock()
+	defer jwtKeysMutex.Unlock()
+	jwtSigningKey = signingKey
+	jwtVerifyKeys = verifyKeys
+
+	log.Printf("JWT signing key %s (%s), %d verification key(s)", signingKey.ID, signingKey.Method.Alg(), len(verifyKeys))
+	return nil
+}
+
+func readJWTKey(file string) (*jwtKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	key := &jwtKey{ID: strings.TrimSuffix(filepath.Base(file), ".pem")}
+
+	var parsed interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	return key, nil
+}
+
+// signingKey returns the active key, or an HS256 key when none are configured
+func signingKey() *jwtKey {
+	jwtKeysMutex.RLock()
+	defer jwtKeysMutex.RUnlock()
+
+	if jwtSigningKey != nil {
+		return jwtSigningKey
+	}
+	return &jwtKey{Method: jwt.SigningMethodHS256}
+}
+
+// verificationKey looks up the key named by a token's kid header and the
+// value jwt.Parse needs to verify with it
+func verificationKey(kid string) (*jwtKey, interface{}, error) {
+	jwtKeysMutex.RLock()
+	defer jwtKeysMutex.RUnlock()
+
+	if jwtSigningKey == nil {
+		if kid != "" {
+			return nil, nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		return &jwtKey{Method: jwt.SigningMethodHS256}, []byte(utils_v1.GetEnv("JWT_SECRET")), nil
+	}
+
+	key, ok := jwtVerifyKeys[kid]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return key, key.Public, nil
+}
+
+// JWTIssuer returns the iss claim (JWT_ISSUER, defaults to PROJECT)
+func JWTIssuer() string {
+	if issuer := utils_v1.GetEnv("JWT_ISSUER"); issuer != "" {
+		return issuer
+	}
+	if project := utils_v1.GetEnv("PROJECT"); project != "" {
+		return project
+	}
+	return "go_template_v3"
+}
+
+// JWTAudience returns the aud claim (JWT_AUDIENCE, defaults to the issuer)
+func JWTAudience() string {
+	if audience := utils_v1.GetEnv("JWT_AUDIENCE"); audience != "" {
+		return audience
+	}
+	return JWTIssuer()
+}
+
+// JWKS returns every public verification key as a JSON Web Key Set
+func JWKS() map[string]interface{} {
+	jwtKeysMutex.RLock()
+	defer jwtKeysMutex.RUnlock()
+
+	kids := make([]string, 0, len(jwtVerifyKeys))
+	for kid := range jwtVerifyKeys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	keys := make([]map[string]interface{}, 0, len(kids))
+	for _, kid := range kids {
+		key := jwtVerifyKeys[kid]
+		jwk := map[string]interface{}{
+			"kid": key.ID,
+			"use": "sig",
+			"alg": key.Method.Alg(),
+		}
+
+		switch pub := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk["kty"] = "RSA"
+			jwk["n"] = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk["kty"] = "OKP"
+			jwk["crv"] = "Ed25519"
+			jwk["x"] = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+
+		keys = append(keys, jwk)
+	}
+
+	return map[string]interface{}{"keys": keys}
+}
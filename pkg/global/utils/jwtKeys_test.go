@@ -0,0 +1,259 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// testKeyDir holds an RSA key, an Ed25519 key and a retired public-only
+// RSA key, named so the Ed25519 key sorts last
+type testKeyDir struct {
+	dir     string
+	rsa     *rsa.PrivateKey
+	ed25519 ed25519.PrivateKey
+	retired *rsa.PrivateKey
+}
+
+func newTestKeyDir(t *testing.T) *testKeyDir {
+	t.Helper()
+	keys := &testKeyDir{dir: t.TempDir()}
+
+	var err error
+	if keys.rsa, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		t.Fatal(err)
+	}
+	if _, keys.ed25519, err = ed25519.GenerateKey(rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	if keys.retired, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		t.Fatal(err)
+	}
+
+	edDER, err := x509.MarshalPKCS8PrivateKey(keys.ed25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retiredDER, err := x509.MarshalPKIXPublicKey(&keys.retired.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys.write(t, "2024-01", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(keys.rsa))
+	keys.write(t, "2024-06", "PRIVATE KEY", edDER)
+	keys.write(t, "2023-12", "PUBLIC KEY", retiredDER)
+	return keys
+}
+
+func (k *testKeyDir) write(t *testing.T, kid, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(filepath.Join(k.dir, kid+".pem"), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// loadTestKeys points LoadJWTKeys at dir and restores the HS256 fallback
+// when the test ends
+func loadTestKeys(t *testing.T, dir, activeKid string) error {
+	t.Helper()
+	t.Setenv("JWT_KEYS_DIR", dir)
+	t.Setenv("JWT_ACTIVE_KID", activeKid)
+	t.Cleanup(func() {
+		jwtKeysMutex.Lock()
+		defer jwtKeysMutex.Unlock()
+		jwtSigningKey = nil
+		jwtVerifyKeys = map[string]*jwtKey{}
+	})
+	return LoadJWTKeys()
+}
+
+// signTestToken signs valid access token claims with any method and key,
+// setting kid when given
+func signTestToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, jwt.MapClaims{
+		"jti":       "test",
+		"iss":       JWTIssuer(),
+		"aud":       JWTAudience(),
+		"tokenType": TokenTypeAccess,
+		"iat":       time.Now().Unix(),
+		"exp":       time.Now().Add(time.Minute).Unix(),
+		"body":      map[string]interface{}{"userId": 1},
+	})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestLoadJWTKeys(t *testing.T) {
+	keys := newTestKeyDir(t)
+
+	if err := loadTestKeys(t, keys.dir, ""); err != nil {
+		t.Fatal(err)
+	}
+	signing := signingKey()
+	if signing.ID != "2024-06" || signing.Method != jwt.SigningMethodEdDSA {
+		t.Errorf("signing key = %s (%s), want the last private key 2024-06 (EdDSA)", signing.ID, signing.Method.Alg())
+	}
+	if len(jwtVerifyKeys) != 3 {
+		t.Errorf("loaded %d verification keys, want 3", len(jwtVerifyKeys))
+	}
+	if retired := jwtVerifyKeys["2023-12"]; retired == nil || retired.Private != nil {
+		t.Error("public-only key should be loaded for verification without a private half")
+	}
+
+	if err := loadTestKeys(t, keys.dir, "2024-01"); err != nil {
+		t.Fatal(err)
+	}
+	if signing := signingKey(); signing.ID != "2024-01" || signing.Method != jwt.SigningMethodRS256 {
+		t.Errorf("JWT_ACTIVE_KID ignored, signing with %s (%s)", signing.ID, signing.Method.Alg())
+	}
+}
+
+func TestLoadJWTKeysRejectsBadConfig(t *testing.T) {
+	keys := newTestKeyDir(t)
+
+	if err := loadTestKeys(t, keys.dir, "2023-12"); err == nil {
+		t.Error("a public-only key was accepted as the active signing key")
+	}
+	if err := loadTestKeys(t, keys.dir, "missing"); err == nil {
+		t.Error("an unknown JWT_ACTIVE_KID was accepted")
+	}
+
+	if err := os.WriteFile(filepath.Join(keys.dir, "broken.pem"), []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadTestKeys(t, keys.dir, ""); err == nil {
+		t.Error("a file without a PEM block was accepted")
+	}
+}
+
+func TestParseTokenLooksUpKid(t *testing.T) {
+	keys := newTestKeyDir(t)
+	if err := loadTestKeys(t, keys.dir, "2024-01"); err != nil {
+		t.Fatal(err)
+	}
+
+	token, _, err := GenerateToken(TokenTypeAccess, map[string]interface{}{"userId": 1}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseToken(token, TokenTypeAccess); err != nil {
+		t.Fatalf("token from the active key rejected: %v", err)
+	}
+
+	// After rotating to another key, tokens from the old one still verify
+	if err := loadTestKeys(t, keys.dir, "2024-06"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseToken(token, TokenTypeAccess); err != nil {
+		t.Errorf("token from the previous key rejected after rotation: %v", err)
+	}
+
+	// Tokens signed by a retired key that is still published verify too
+	retired := signTestToken(t, jwt.SigningMethodRS256, "2023-12", keys.retired)
+	if _, err := ParseToken(retired, TokenTypeAccess); err != nil {
+		t.Errorf("token from a retired key rejected: %v", err)
+	}
+
+	unknown := signTestToken(t, jwt.SigningMethodRS256, "2022-01", keys.rsa)
+	if _, err := ParseToken(unknown, TokenTypeAccess); err == nil {
+		t.Error("token with an unknown kid accepted")
+	}
+	noKid := signTestToken(t, jwt.SigningMethodRS256, "", keys.rsa)
+	if _, err := ParseToken(noKid, TokenTypeAccess); err == nil {
+		t.Error("token without a kid accepted while keys are configured")
+	}
+}
+
+func TestParseTokenRejectsUnexpectedAlg(t *testing.T) {
+	keys := newTestKeyDir(t)
+	if err := loadTestKeys(t, keys.dir, "2024-01"); err != nil {
+		t.Fatal(err)
+	}
+
+	// HS256 keyed with the published RSA public key
+	publicDER, err := x509.MarshalPKIXPublicKey(&keys.rsa.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"hs256 with public key", signTestToken(t, jwt.SigningMethodHS256, "2024-01", publicPEM)},
+		{"none", signTestToken(t, jwt.SigningMethodNone, "2024-01", jwt.UnsafeAllowNoneSignatureType)},
+		{"rs512 under an rs256 kid", signTestToken(t, jwt.SigningMethodRS512, "2024-01", keys.rsa)},
+		{"eddsa under an rs256 kid", signTestToken(t, jwt.SigningMethodEdDSA, "2024-01", keys.ed25519)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseToken(tt.token, TokenTypeAccess); err == nil {
+				t.Error("token accepted")
+			}
+		})
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	keys := newTestKeyDir(t)
+	if err := loadTestKeys(t, keys.dir, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	jwks, ok := JWKS()["keys"].([]map[string]interface{})
+	if !ok || len(jwks) != 3 {
+		t.Fatalf("JWKS returned %v, want 3 keys", JWKS())
+	}
+
+	// Keys are listed by kid and never include private material
+	wantKids := []string{"2023-12", "2024-01", "2024-06"}
+	for i, jwk := range jwks {
+		if jwk["kid"] != wantKids[i] {
+			t.Errorf("key %d has kid %v, want %s", i, jwk["kid"], wantKids[i])
+		}
+		if jwk["use"] != "sig" {
+			t.Errorf("key %v has use %v, want sig", jwk["kid"], jwk["use"])
+		}
+		if _, ok := jwk["d"]; ok {
+			t.Errorf("key %v exposes a private exponent", jwk["kid"])
+		}
+	}
+
+	rsaKey := jwks[1]
+	if rsaKey["kty"] != "RSA" || rsaKey["alg"] != "RS256" {
+		t.Errorf("RSA key published as %v/%v", rsaKey["kty"], rsaKey["alg"])
+	}
+	n, _ := base64.RawURLEncoding.DecodeString(rsaKey["n"].(string))
+	e, _ := base64.RawURLEncoding.DecodeString(rsaKey["e"].(string))
+	if new(big.Int).SetBytes(n).Cmp(keys.rsa.N) != 0 || new(big.Int).SetBytes(e).Int64() != int64(keys.rsa.E) {
+		t.Error("RSA modulus or exponent does not match the key")
+	}
+
+	edKey := jwks[2]
+	if edKey["kty"] != "OKP" || edKey["crv"] != "Ed25519" || edKey["alg"] != "EdDSA" {
+		t.Errorf("Ed25519 key published as %v/%v/%v", edKey["kty"], edKey["crv"], edKey["alg"])
+	}
+	x, _ := base64.RawURLEncoding.DecodeString(edKey["x"].(string))
+	if string(x) != string(keys.ed25519.Public().(ed25519.PublicKey)) {
+		t.Error("Ed25519 public key does not match")
+	}
+}
@@ -0,0 +1,267 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go_template_v3/pkg/config"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	utils_v1 "github.com/FDSAP-Git-Org/hephaestus/utils/v1"
+	"github.com/go-redis/redis/v8"
+)
+
+// AttemptStore keeps failed-login counters and lockouts. Redis is used when
+// config.RedisClient is connected so counters are shared across instances;
+// otherwise counters live in process memory.
+type AttemptStore interface {
+	// Fail records a failed attempt and returns the number of failures inside the window
+	Fail(key string, window time.Duration) (int, error)
+	// LockedFor returns how long the key stays locked, zero when it is not locked
+	LockedFor(key string) (time.Duration, error)
+	Lock(key string, duration time.Duration) error
+	Reset(key string) error
+}
+
+// RespCodeTooManyRequests is the response code sent with HTTP 429 while a
+// caller is locked out. respcode has no code of its own for it.
+const RespCodeTooManyRequests = "429"
+
+var (
+	memoryAttempts    = newMemoryAttemptStore()
+	dummyPasswordHash string
+	dummyPasswordOnce sync.Once
+)
+
+func loginAttemptStore() AttemptStore {
+	if config.RedisClient != nil {
+		return redisAttemptStore{client: config.RedisClient}
+	}
+	return memoryAttempts
+}
+
+// CheckLoginAllowed returns how long the caller must wait before another
+// login attempt for this email or IP, zero when an attempt is allowed
+func CheckLoginAllowed(email, ip string) (time.Duration, error) {
+	store := loginAttemptStore()
+
+	var wait time.Duration
+	for _, key := range []string{accountAttemptKey(email), ipAttemptKey(ip)} {
+		lockedFor, err := store.LockedFor(key)
+		if err != nil {
+			return 0, err
+		}
+		if lockedFor > wait {
+			wait = lockedFor
+		}
+	}
+	return wait, nil
+}
+
+// RecordLoginFailure counts a failed login against the email and the IP and
+// locks either one out with exponential backoff once its limit is passed
+func RecordLoginFailure(email, ip string) {
+	store := loginAttemptStore()
+	window := envDuration("LOGIN_ATTEMPT_WINDOW_MINUTES", 15, time.Minute)
+
+	limits := map[string]int{
+		accountAttemptKey(email): EnvInt("LOGIN_MAX_ATTEMPTS", 5, 1),
+		ipAttemptKey(ip):         EnvInt("LOGIN_MAX_ATTEMPTS_PER_IP", 20, 1),
+	}
+
+	for key, limit := range limits {
+		failures, err := store.Fail(key, window)
+		if err != nil {
+			log.Printf("Error recording login failure for %s: %v", key, err)
+			continue
+		}
+		if failures < limit {
+			continue
+		}
+
+		lockout := lockoutDuration(failures - limit)
+		if err := store.Lock(key, lockout); err != nil {
+			log.Printf("Error locking %s: %v", key, err)
+			continue
+		}
+
+		RecordAuthEvent("login_lockout", email, ip, map[string]interface{}{
+			"key":             key,
+			"failures":        failures,
+			"lockoutSeconds":  int(lockout.Seconds()),
+			"lockedUntilUnix": time.Now().Add(lockout).Unix(),
+		})
+	}
+}
+
+// ResetLoginFailures clears the account counter after a successful login.
+// The IP counter is left alone so one valid account cannot reset it.
+func ResetLoginFailures(email string) {
+	if err := loginAttemptStore().Reset(accountAttemptKey(email)); err != nil {
+		log.Printf("Error resetting login failures for %s: %v", email, err)
+	}
+}
+
+// DummyPasswordHash returns a hash to compare against when the account does
+// not exist, so both paths take the same time
+func DummyPasswordHash() string {
+	dummyPasswordOnce.Do(func() {
+		dummyPasswordHash, _ = utils_v1.HashData(GenerateOpaqueToken(16))
+	})
+	return dummyPasswordHash
+}
+
+// RecordAuthEvent stores a security-relevant authentication event
+func RecordAuthEvent(eventType, email, ip string, details map[string]interface{}) {
+	log.Printf("AUTH EVENT %s email=%s ip=%s details=%v", eventType, email, ip, details)
+
+	detailsJSON, _ := json.Marshal(details)
+	err := config.DBConnList[0].Exec(
+		"INSERT INTO auth_events (event_type, email, ip_address, details) VALUES (?, ?, ?, ?)",
+		eventType, email, ip, string(detailsJSON),
+	).Error
+	if err != nil {
+		log.Printf("Error recording auth event %s: %v", eventType, err)
+	}
+}
+
+// lockoutDuration doubles the base lockout for every failure past the limit
+func lockoutDuration(excess int) time.Duration {
+	base := envDuration("LOGIN_LOCKOUT_BASE_SECONDS", 30, time.Second)
+	maximum := envDuration("LOGIN_LOCKOUT_MAX_SECONDS", 3600, time.Second)
+
+	lockout := time.Duration(float64(base) * math.Pow(2, float64(excess)))
+	if lockout > maximum || lockout <= 0 {
+		return maximum
+	}
+	return lockout
+}
+
+func accountAttemptKey(email string) string {
+	return "login:account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipAttemptKey(ip string) string {
+	return "login:ip:" + ip
+}
+
+// IN-MEMORY STORE
+type memoryAttemptStore struct {
+	mu       sync.Mutex
+	failures map[string]memoryAttempt
+	locks    map[string]time.Time
+}
+
+type memoryAttempt struct {
+	count     int
+	expiresAt time.Time
+}
+
+func newMemoryAttemptStore() *memoryAttemptStore {
+	return &memoryAttemptStore{
+		failures: make(map[string]memoryAttempt),
+		locks:    make(map[string]time.Time),
+	}
+}
+
+func (s *memoryAttemptStore) Fail(key string, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.prune(now)
+
+	attempt := s.failures[key]
+	attempt.count++
+	attempt.expiresAt = now.Add(window)
+	s.failures[key] = attempt
+	return attempt.count, nil
+}
+
+func (s *memoryAttemptStore) LockedFor(key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	until, ok := s.locks[key]
+	if !ok {
+		return 0, nil
+	}
+	remaining := time.Until(until)
+	if remaining <= 0 {
+		delete(s.locks, key)
+		return 0, nil
+	}
+	return remaining, nil
+}
+
+func (s *memoryAttemptStore) Lock(key string, duration time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.locks[key] = time.Now().Add(duration)
+	return nil
+}
+
+func (s *memoryAttemptStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.failures, key)
+	delete(s.locks, key)
+	return nil
+}
+
+// prune drops expired counters and locks so the maps do not grow without bound
+func (s *memoryAttemptStore) prune(now time.Time) {
+	for key, attempt := range s.failures {
+		if now.After(attempt.expiresAt) {
+			delete(s.failures, key)
+		}
+	}
+	for key, until := range s.locks {
+		if now.After(until) {
+			delete(s.locks, key)
+		}
+	}
+}
+
+// REDIS STORE
+type redisAttemptStore struct {
+	client *redis.Client
+}
+
+func (s redisAttemptStore) Fail(key string, window time.Duration) (int, error) {
+	ctx := context.Background()
+	failKey := key + ":failures"
+
+	pipe := s.client.TxPipeline()
+	incr := pipe.Incr(ctx, failKey)
+	pipe.Expire(ctx, failKey, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return int(incr.Val()), nil
+}
+
+func (s redisAttemptStore) LockedFor(key string) (time.Duration, error) {
+	ttl, err := s.client.PTTL(context.Background(), key+":lock").Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+func (s redisAttemptStore) Lock(key string, duration time.Duration) error {
+	return s.client.Set(context.Background(), key+":lock", fmt.Sprint(time.Now().Add(duration).Unix()), duration).Err()
+}
+
+func (s redisAttemptStore) Reset(key string) error {
+	return s.client.Del(context.Background(), key+":failures", key+":lock").Err()
+}
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutDurationDoubles(t *testing.T) {
+	tests := []struct {
+		excess int
+		want   time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, time.Minute},
+		{3, 4 * time.Minute},
+		{7, 3600 * time.Second},
+		{1000, 3600 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := lockoutDuration(tt.excess); got != tt.want {
+			t.Errorf("lockoutDuration(%d) = %s, want %s", tt.excess, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryAttemptStore(t *testing.T) {
+	store := newMemoryAttemptStore()
+	key := accountAttemptKey(" Someone@Example.com ")
+	if key != "login:account:someone@example.com" {
+		t.Fatalf("account key = %q, emails should be normalized", key)
+	}
+
+	for want := 1; want <= 3; want++ {
+		got, err := store.Fail(key, time.Minute)
+		if err != nil || got != want {
+			t.Fatalf("Fail = %d, %v, want %d", got, err, want)
+		}
+	}
+
+	if lockedFor, _ := store.LockedFor(key); lockedFor != 0 {
+		t.Fatalf("LockedFor before Lock = %s, want 0", lockedFor)
+	}
+	store.Lock(key, time.Minute)
+	if lockedFor, _ := store.LockedFor(key); lockedFor <= 0 || lockedFor > time.Minute {
+		t.Fatalf("LockedFor after Lock = %s, want up to a minute", lockedFor)
+	}
+
+	store.Reset(key)
+	if lockedFor, _ := store.LockedFor(key); lockedFor != 0 {
+		t.Fatalf("LockedFor after Reset = %s, want 0", lockedFor)
+	}
+	if got, _ := store.Fail(key, time.Minute); got != 1 {
+		t.Fatalf("Fail after Reset = %d, want 1", got)
+	}
+}
+
+func TestMemoryAttemptStoreExpires(t *testing.T) {
+	store := newMemoryAttemptStore()
+	store.Fail("k", time.Nanosecond)
+	store.Lock("k", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	if lockedFor, _ := store.LockedFor("k"); lockedFor != 0 {
+		t.Fatalf("expired lock still reported: %s", lockedFor)
+	}
+	if got, _ := store.Fail("k", time.Minute); got != 1 {
+		t.Fatalf("Fail after the window = %d, want 1", got)
+	}
+}
@@ -0,0 +1,398 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	utils_v1 "github.com/FDSAP-Git-Org/hephaestus/utils/v1"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// OIDCProvider is an OpenID Connect identity provider configured through
+// the environment. OIDC_PROVIDERS lists the enabled names and each name has
+// its own OIDC_<NAME>_DISCOVERY_URL, _CLIENT_ID, _CLIENT_SECRET,
+// _REDIRECT_URL and optional _SCOPES.
+type OIDCProvider struct {
+	Name         string
+	DiscoveryURL string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// OIDCIdentity is what we keep from a verified ID token
+type OIDCIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+	fetchedAt             time.Time
+}
+
+type oidcKeySet struct {
+	keys      map[string]interface{}
+	fetchedAt time.Time
+}
+
+const (
+	oidcDiscoveryTTL  = time.Hour
+	oidcKeyRefreshMin = time.Minute
+	oidcHTTPTimeout   = 10 * time.Second
+	oidcClockSkew     = time.Minute
+)
+
+var (
+	oidcCacheMutex sync.Mutex
+	oidcDiscovered = map[string]*oidcDiscovery{}
+	oidcKeySets    = map[string]*oidcKeySet{}
+	oidcHTTPClient = &http.Client{Timeout: oidcHTTPTimeout}
+)
+
+// GetOIDCProvider returns the named provider, or an error when it is not
+// enabled or incompletely configured
+func GetOIDCProvider(name string) (*OIDCProvider, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	enabled := false
+	for _, provider := range strings.Split(utils_v1.GetEnv("OIDC_PROVIDERS"), ",") {
+		if strings.ToLower(strings.TrimSpace(provider)) == name && name != "" {
+			enabled = true
+			break
+		}
+	}
+	if !enabled {
+		return nil, fmt.Errorf("unknown OIDC provider %q", name)
+	}
+
+	prefix := "OIDC_" + strings.ToUpper(name) + "_"
+	provider := &OIDCProvider{
+		Name:         name,
+		DiscoveryURL: utils_v1.GetEnv(prefix + "DISCOVERY_URL"),
+		ClientID:     utils_v1.GetEnv(prefix + "CLIENT_ID"),
+		ClientSecret: utils_v1.GetEnv(prefix + "CLIENT_SECRET"),
+		RedirectURL:  utils_v1.GetEnv(prefix + "REDIRECT_URL"),
+		Scopes:       strings.Fields(utils_v1.GetEnv(prefix + "SCOPES")),
+	}
+	if len(provider.Scopes) == 0 {
+		provider.Scopes = []string{"openid", "email", "profile"}
+	}
+	if provider.DiscoveryURL == "" || provider.ClientID == "" || provider.RedirectURL == "" {
+		return nil, fmt.Errorf("OIDC provider %q is not fully configured", name)
+	}
+
+	return provider, nil
+}
+
+// CanAutoLinkOIDC reports whether a new external identity may be attached to
+// the existing account with the same email without the user logging in.
+// Both the provider and this service must have verified the address, or
+// whoever controls either side could take over the other.
+func CanAutoLinkOIDC(identity *OIDCIdentity, localEmailVerified bool) bool {
+	return identity != nil && identity.EmailVerified && localEmailVerified
+}
+
+// NewPKCEVerifier returns a random code verifier and its S256 challenge
+func NewPKCEVerifier() (verifier, challenge string) {
+	verifier = GenerateOpaqueToken(64)
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthorizationURL builds the URL the browser is sent to for login
+func (p *OIDCProvider) AuthorizationURL(state, nonce, codeChallenge string) (string, error) {
+	discovery, err := p.discovery()
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.ClientID)
+	query.Set("redirect_uri", p.RedirectURL)
+	query.Set("scope", strings.Join(p.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange trades an authorization code for the provider's ID token
+func (p *OIDCProvider) Exchange(code, codeVerifier string) (string, error) {
+	discovery, err := p.discovery()
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("code_verifier", codeVerifier)
+	if p.ClientSecret != "" {
+		form.Set("client_secret", p.ClientSecret)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var tokenResponse struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := oidcDo(req, &tokenResponse); err != nil {
+		if tokenResponse.Error != "" {
+			return "", fmt.Errorf("token exchange failed: %s %s", tokenResponse.Error, tokenResponse.ErrorDescription)
+		}
+		return "", err
+	}
+	if tokenResponse.IDToken == "" {
+		return "", errors.New("token response has no id_token")
+	}
+
+	return tokenResponse.IDToken, nil
+}
+
+// VerifyIDToken checks the ID token signature against the provider's JWKS
+// along with its issuer, audience, expiry and nonce
+func (p *OIDCProvider) VerifyIDToken(rawToken, nonce string) (*OIDCIdentity, error) {
+	discovery, err := p.discovery()
+	if err != nil {
+		return nil, err
+	}
+
+	parser := jwt.Parser{ValidMethods: []string{"RS256", "RS384", "RS512", "PS256", "ES256", "ES384", "ES512", "EdDSA"}}
+	token, err := parser.Parse(rawToken, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.publicKey(discovery.JwksURI, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid id_token claims")
+	}
+
+	now := time.Now()
+	if !claims.VerifyIssuer(discovery.Issuer, true) {
+		return nil, errors.New("id_token issuer mismatch")
+	}
+	if !claims.VerifyAudience(p.ClientID, true) {
+		return nil, errors.New("id_token audience mismatch")
+	}
+	if !claims.VerifyExpiresAt(now.Add(-oidcClockSkew).Unix(), true) {
+		return nil, errors.New("id_token expired")
+	}
+	if tokenNonce, _ := claims["nonce"].(string); tokenNonce == "" || tokenNonce != nonce {
+		return nil, errors.New("id_token nonce mismatch")
+	}
+
+	identity := &OIDCIdentity{}
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Email, _ = claims["email"].(string)
+	identity.Name, _ = claims["name"].(string)
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = verified
+	case string:
+		// Some providers send the flag as a string
+		identity.EmailVerified = verified == "true"
+	}
+	if identity.Subject == "" {
+		return nil, errors.New("id_token has no subject")
+	}
+
+	return identity, nil
+}
+
+// discovery returns the provider metadata, fetched at most once an hour
+func (p *OIDCProvider) discovery() (*oidcDiscovery, error) {
+	oidcCacheMutex.Lock()
+	cached := oidcDiscovered[p.DiscoveryURL]
+	oidcCacheMutex.Unlock()
+	if cached != nil && time.Since(cached.fetchedAt) < oidcDiscoveryTTL {
+		return cached, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, p.DiscoveryURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	discovery := &oidcDiscovery{}
+	if err := oidcDo(req, discovery); err != nil {
+		return nil, fmt.Errorf("OIDC discovery for %s failed: %w", p.Name, err)
+	}
+	if discovery.Issuer == "" || discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JwksURI == "" {
+		return nil, fmt.Errorf("OIDC discovery for %s is missing required fields", p.Name)
+	}
+	discovery.fetchedAt = time.Now()
+
+	oidcCacheMutex.Lock()
+	oidcDiscovered[p.DiscoveryURL] = discovery
+	oidcCacheMutex.Unlock()
+
+	return discovery, nil
+}
+
+// publicKey finds a signing key by kid, refetching the key set when the
+// kid is unknown so provider key rotation is picked up
+func (p *OIDCProvider) publicKey(jwksURI, kid string) (interface{}, error) {
+	oidcCacheMutex.Lock()
+	keySet := oidcKeySets[jwksURI]
+	oidcCacheMutex.Unlock()
+
+	if keySet != nil {
+		if key := keySet.lookup(kid); key != nil {
+			return key, nil
+		}
+		if time.Since(keySet.fetchedAt) < oidcKeyRefreshMin {
+			return nil, fmt.Errorf("unknown id_token key id %q", kid)
+		}
+	}
+
+	keySet, err := fetchOIDCKeySet(jwksURI)
+	if err != nil {
+		return nil, err
+	}
+
+	oidcCacheMutex.Lock()
+	oidcKeySets[jwksURI] = keySet
+	oidcCacheMutex.Unlock()
+
+	if key := keySet.lookup(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown id_token key id %q", kid)
+}
+
+// lookup returns the key with that kid, or the only key when the token
+// carries no kid
+func (s *oidcKeySet) lookup(kid string) interface{} {
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key
+		}
+	}
+	return s.keys[kid]
+}
+
+func fetchOIDCKeySet(jwksURI string) (*oidcKeySet, error) {
+	req, err := http.NewRequest(http.MethodGet, jwksURI, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			Crv string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := oidcDo(req, &jwks); err != nil {
+		return nil, fmt.Errorf("fetching OIDC keys failed: %w", err)
+	}
+
+	keySet := &oidcKeySet{keys: map[string]interface{}{}, fetchedAt: time.Now()}
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		switch jwk.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+			e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+			if errN != nil || errE != nil {
+				continue
+			}
+			keySet.keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch jwk.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				continue
+			}
+			x, errX := base64.RawURLEncoding.DecodeString(jwk.X)
+			y, errY := base64.RawURLEncoding.DecodeString(jwk.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			keySet.keys[jwk.Kid] = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		case "OKP":
+			x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+			if jwk.Crv != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+				continue
+			}
+			keySet.keys[jwk.Kid] = ed25519.PublicKey(x)
+		}
+	}
+
+	return keySet, nil
+}
+
+// oidcDo sends a request to the provider and decodes the JSON response.
+// Error bodies are still decoded so callers can report the provider's error.
+func oidcDo(req *http.Request, out interface{}) error {
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	decodeErr := json.Unmarshal(body, out)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, req.URL.Host)
+	}
+	return decodeErr
+}
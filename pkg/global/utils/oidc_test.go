@@ -0,0 +1,286 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// mockOIDCProvider is a minimal identity provider: discovery, JWKS and a
+// token endpoint that enforces PKCE for codes it handed out
+type mockOIDCProvider struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	mutex    sync.Mutex
+	codes    map[string]mockAuthorization
+	subject  string
+	email    string
+	verified interface{}
+}
+
+type mockAuthorization struct {
+	challenge string
+	nonce     string
+}
+
+func newMockOIDCProvider(t *testing.T) *mockOIDCProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock := &mockOIDCProvider{
+		key:      key,
+		codes:    map[string]mockAuthorization{},
+		subject:  "user-123",
+		email:    "someone@example.com",
+		verified: true,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 mock.server.URL,
+			"authorization_endpoint": mock.server.URL + "/authorize",
+			"token_endpoint":         mock.server.URL + "/token",
+			"jwks_uri":               mock.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kid": "mock-key",
+				"kty": "RSA",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		mock.mutex.Lock()
+		authorization, ok := mock.codes[r.Form.Get("code")]
+		delete(mock.codes, r.Form.Get("code"))
+		mock.mutex.Unlock()
+
+		sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != authorization.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": mock.idToken(t, authorization.nonce)})
+	})
+	mock.server = httptest.NewServer(mux)
+	t.Cleanup(mock.server.Close)
+	return mock
+}
+
+// authorize plays the user logging in at the provider and returns the code
+// the provider would redirect back with
+func (m *mockOIDCProvider) authorize(t *testing.T, authorizationURL string) (code string, query url.Values) {
+	t.Helper()
+	parsed, err := url.Parse(authorizationURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query = parsed.Query()
+	code = GenerateOpaqueToken(16)
+	m.mutex.Lock()
+	m.codes[code] = mockAuthorization{challenge: query.Get("code_challenge"), nonce: query.Get("nonce")}
+	m.mutex.Unlock()
+	return code, query
+}
+
+func (m *mockOIDCProvider) idToken(t *testing.T, nonce string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            m.server.URL,
+		"aud":            "mock-client",
+		"sub":            m.subject,
+		"email":          m.email,
+		"email_verified": m.verified,
+		"name":           "Someone",
+		"nonce":          nonce,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(5 * time.Minute).Unix(),
+	})
+	token.Header["kid"] = "mock-key"
+	signed, err := token.SignedString(m.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func (m *mockOIDCProvider) provider() *OIDCProvider {
+	return &OIDCProvider{
+		Name:         "mock",
+		DiscoveryURL: m.server.URL + "/.well-known/openid-configuration",
+		ClientID:     "mock-client",
+		RedirectURL:  "http://localhost/auth/oidc/mock/callback",
+		Scopes:       []string{"openid", "email"},
+	}
+}
+
+func TestOIDCDiscoveryAndAuthorizationURL(t *testing.T) {
+	mock := newMockOIDCProvider(t)
+	provider := mock.provider()
+
+	_, challenge := NewPKCEVerifier()
+	authorizationURL, err := provider.AuthorizationURL("the-state", "the-nonce", challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, _ := url.Parse(authorizationURL)
+	if got := parsed.Scheme + "://" + parsed.Host + parsed.Path; got != mock.server.URL+"/authorize" {
+		t.Errorf("authorization endpoint = %s, want the discovered one", got)
+	}
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             "mock-client",
+		"redirect_uri":          provider.RedirectURL,
+		"scope":                 "openid email",
+		"state":                 "the-state",
+		"nonce":                 "the-nonce",
+		"code_challenge":        challenge,
+		"code_challenge_method": "S256",
+	}
+	for key, value := range want {
+		if got := parsed.Query().Get(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+}
+
+func TestOIDCDiscoveryRejectsIncompleteMetadata(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"issuer": "https://idp.example.com"})
+	}))
+	defer server.Close()
+
+	provider := &OIDCProvider{Name: "broken", DiscoveryURL: server.URL, ClientID: "c", RedirectURL: "http://localhost/cb"}
+	if _, err := provider.AuthorizationURL("s", "n", "c"); err == nil {
+		t.Fatal("discovery without endpoints accepted")
+	}
+}
+
+func TestOIDCCodeFlowWithPKCE(t *testing.T) {
+	mock := newMockOIDCProvider(t)
+	provider := mock.provider()
+
+	verifier, challenge := NewPKCEVerifier()
+	authorizationURL, err := provider.AuthorizationURL("state", "nonce-1", challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := mock.authorize(t, authorizationURL)
+
+	idToken, err := provider.Exchange(code, verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	identity, err := provider.VerifyIDToken(idToken, "nonce-1")
+	if err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+	if identity.Subject != "user-123" || identity.Email != "someone@example.com" || !identity.EmailVerified {
+		t.Errorf("unexpected identity %+v", identity)
+	}
+}
+
+func TestOIDCExchangeRejectsWrongVerifier(t *testing.T) {
+	mock := newMockOIDCProvider(t)
+	provider := mock.provider()
+
+	_, challenge := NewPKCEVerifier()
+	authorizationURL, err := provider.AuthorizationURL("state", "nonce", challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := mock.authorize(t, authorizationURL)
+
+	otherVerifier, _ := NewPKCEVerifier()
+	if _, err := provider.Exchange(code, otherVerifier); err == nil {
+		t.Fatal("code exchanged with a verifier that does not match the challenge")
+	}
+}
+
+func TestOIDCVerifyIDTokenNonceMismatch(t *testing.T) {
+	mock := newMockOIDCProvider(t)
+	provider := mock.provider()
+
+	if _, err := provider.VerifyIDToken(mock.idToken(t, "nonce-a"), "nonce-b"); err == nil {
+		t.Fatal("id_token with another login's nonce accepted")
+	}
+	if _, err := provider.VerifyIDToken(mock.idToken(t, ""), ""); err == nil {
+		t.Fatal("id_token without a nonce accepted")
+	}
+}
+
+func TestOIDCVerifyIDTokenRejectsOtherAudience(t *testing.T) {
+	mock := newMockOIDCProvider(t)
+	provider := mock.provider()
+	provider.ClientID = "another-client"
+
+	if _, err := provider.VerifyIDToken(mock.idToken(t, "nonce"), "nonce"); err == nil {
+		t.Fatal("id_token for another client accepted")
+	}
+}
+
+func TestOIDCEmailVerifiedAsString(t *testing.T) {
+	mock := newMockOIDCProvider(t)
+	mock.verified = "false"
+	provider := mock.provider()
+
+	identity, err := provider.VerifyIDToken(mock.idToken(t, "nonce"), "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.EmailVerified {
+		t.Error(`email_verified "false" read as verified`)
+	}
+	// An unverified provider email never links to a verified local account
+	if CanAutoLinkOIDC(identity, true) {
+		t.Error("identity with an unverified email allowed to auto-link")
+	}
+}
+
+func TestCanAutoLinkOIDC(t *testing.T) {
+	tests := []struct {
+		name          string
+		idpVerified   bool
+		localVerified bool
+		want          bool
+	}{
+		{"both verified", true, true, true},
+		{"provider unverified", false, true, false},
+		{"local account unverified", true, false, false},
+		{"neither verified", false, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity := &OIDCIdentity{Subject: "s", Email: "someone@example.com", EmailVerified: tt.idpVerified}
+			if got := CanAutoLinkOIDC(identity, tt.localVerified); got != tt.want {
+				t.Errorf("CanAutoLinkOIDC = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if CanAutoLinkOIDC(nil, true) {
+		t.Error("CanAutoLinkOIDC accepted a nil identity")
+	}
+}
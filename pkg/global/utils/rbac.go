@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"go_template_v3/pkg/config"
+	"strings"
+
+	utils_v1 "github.com/FDSAP-Git-Org/hephaestus/utils/v1"
+	"github.com/gofiber/fiber/v3"
+)
+
+// DefaultUserRole is assigned on registration and assumed for accounts that
+// predate role assignments (DEFAULT_USER_ROLE, default "user")
+func DefaultUserRole() string {
+	if role := utils_v1.GetEnv("DEFAULT_USER_ROLE"); role != "" {
+		return role
+	}
+	return "user"
+}
+
+// GetUserAccess loads the role names and the union of their permissions for a user
+func GetUserAccess(userId int) ([]string, []string, error) {
+	roles := []string{}
+	err := config.DBConnList[0].Raw(`
+		SELECT r.name
+		FROM user_roles ur
+		JOIN roles r ON r.id = ur.role_id
+		WHERE ur.user_id = ?
+		ORDER BY r.name
+	`, userId).Scan(&roles).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(roles) == 0 {
+		roles = []string{DefaultUserRole()}
+	}
+
+	permissions := []string{}
+	err = config.DBConnList[0].Raw(`
+		SELECT DISTINCT p.name
+		FROM roles r
+		JOIN role_permissions rp ON rp.role_id = r.id
+		JOIN permissions p ON p.id = rp.permission_id
+		WHERE r.name IN ?
+		ORDER BY p.name
+	`, roles).Scan(&permissions).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return roles, permissions, nil
+}
+
+// AssignUserRole links a user to a role by name, ignoring duplicates
+func AssignUserRole(userId int, role string) error {
+	return config.DBConnList[0].Exec(`
+		INSERT INTO user_roles (user_id, role_id)
+		SELECT ?, r.id FROM roles r WHERE r.name = ?
+		ON CONFLICT (user_id, role_id) DO NOTHING
+	`, userId, role).Error
+}
+
+// HasPermission checks a granted permission list against a required one.
+// "*" grants everything and "expenses:*" grants every expenses permission.
+func HasPermission(granted []string, required string) bool {
+	resource := strings.SplitN(required, ":", 2)[0]
+	for _, permission := range granted {
+		if permission == required || permission == "*" || permission == resource+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+// GetUserPermissions returns the permissions stored in the context by AuthMiddleware
+func GetUserPermissions(c fiber.Ctx) []string {
+	return toStringSlice(c.Locals("permissions"))
+}
+
+// GetUserRoles returns the roles stored in the context by AuthMiddleware
+func GetUserRoles(c fiber.Ctx) []string {
+	return toStringSlice(c.Locals("roles"))
+}
+
+func toStringSlice(value interface{}) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,27 @@
+package utils
+
+import "testing"
+
+func TestHasPermission(t *testing.T) {
+	tests := []struct {
+		name     string
+		granted  []string
+		required string
+		want     bool
+	}{
+		{"exact", []string{"expenses:read"}, "expenses:read", true},
+		{"other action", []string{"expenses:read"}, "expenses:write", false},
+		{"resource wildcard", []string{"expenses:*"}, "expenses:batch", true},
+		{"other resource wildcard", []string{"categories:*"}, "expenses:read", false},
+		{"global wildcard", []string{"*"}, "users:manage", true},
+		{"none", nil, "expenses:read", false},
+		{"prefix is not a match", []string{"expenses"}, "expenses:read", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HasPermission(tt.granted, tt.required); got != tt.want {
+				t.Errorf("HasPermission(%v, %q) = %v, want %v", tt.granted, tt.required, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"go_template_v3/pkg/config"
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
+)
+
+// CreateSession records a new login for the user and returns its ID
+func CreateSession(c fiber.Ctx, userId int, device string) (int, error) {
+	device = strings.TrimSpace(device)
+	if device == "" {
+		device = c.Get("X-Device")
+	}
+	if device == "" {
+		device = "unknown"
+	}
+
+	var sessionId int
+	err := config.DBConnList[0].Raw(`
+		INSERT INTO user_sessions (user_id, device, ip_address, user_agent, last_seen_at)
+		VALUES (?, ?, ?, ?, NOW())
+		RETURNING id
+	`, userId, device, c.IP(), c.Get("User-Agent")).Scan(&sessionId).Error
+	return sessionId, err
+}
+
+// IsSessionActive reports whether a session exists and has not been revoked,
+// refreshing its last-seen time at most once a minute
+func IsSessionActive(sessionId int) (bool, error) {
+	var active int
+	err := config.DBConnList[0].Raw(
+		"SELECT 1 FROM user_sessions WHERE id = ? AND revoked_at IS NULL",
+		sessionId,
+	).Scan(&active).Error
+	if err != nil || active == 0 {
+		return false, err
+	}
+
+	go func() {
+		err := config.DBConnList[0].Exec(`
+			UPDATE user_sessions SET last_seen_at = NOW()
+			WHERE id = ? AND last_seen_at < NOW() - INTERVAL '1 minute'
+		`, sessionId).Error
+		if err != nil {
+			log.Printf("Error updating session %d last seen: %v", sessionId, err)
+		}
+	}()
+
+	return true, nil
+}
+
+// RevokeSession ends one of the user's sessions and its refresh tokens.
+// It returns false when the session does not belong to the user or was
+// already revoked.
+func RevokeSession(userId, sessionId int) (bool, error) {
+	revoked := false
+	err := config.DBConnList[0].Transaction(func(tx *gorm.DB) error {
+		result := tx.Exec(
+			"UPDATE user_sessions SET revoked_at = NOW() WHERE id = ? AND user_id = ? AND revoked_at IS NULL",
+			sessionId, userId,
+		)
+		if result.Error != nil {
+			return result.Error
+		}
+		revoked = result.RowsAffected > 0
+
+		return tx.Exec(
+			"UPDATE refresh_tokens SET revoked_at = NOW() WHERE session_id = ? AND revoked_at IS NULL",
+			sessionId,
+		).Error
+	})
+	return revoked, err
+}
+
+// RevokeUserSessions ends every session of a user except keepSessionId
+// (pass 0 to end them all) and returns how many were revoked
+func RevokeUserSessions(userId, keepSessionId int) (int64, error) {
+	var count int64
+	err := config.DBConnList[0].Transaction(func(tx *gorm.DB) error {
+		result := tx.Exec(
+			"UPDATE user_sessions SET revoked_at = NOW() WHERE user_id = ? AND id <> ? AND revoked_at IS NULL",
+			userId, keepSessionId,
+		)
+		if result.Error != nil {
+			return result.Error
+		}
+		count = result.RowsAffected
+
+		return tx.Exec(`
+			UPDATE refresh_tokens SET revoked_at = NOW()
+			WHERE user_id = ? AND (session_id IS NULL OR session_id <> ?) AND revoked_at IS NULL
+		`, userId, keepSessionId).Error
+	})
+	return count, err
+}
+
+// GetSessionId returns the session stored in the context by AuthMiddleware
+func GetSessionId(c fiber.Ctx) int {
+	switch v := c.Locals("sessionId").(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	default:
+		return 0
+	}
+}
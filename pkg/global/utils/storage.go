@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	utils_v1 "github.com/FDSAP-Git-Org/hephaestus/utils/v1"
+)
+
+// PublicAssetsDir is served to anyone, without authentication, under /assets
+const PublicAssetsDir = "./assets"
+
+// PrivateStoragePath returns the directory named by envKey, or fallback when
+// it is unset. Files kept there belong to one user, so a directory inside
+// PublicAssetsDir is refused.
+func PrivateStoragePath(envKey, fallback string) (string, error) {
+	path := utils_v1.GetEnv(envKey)
+	if path == "" {
+		path = fallback
+	}
+	if isInsideDir(path, PublicAssetsDir) {
+		return "", fmt.Errorf("%s %q is inside the public %s directory", envKey, path, PublicAssetsDir)
+	}
+	return path, nil
+}
+
+// isInsideDir reports whether path is dir or somewhere below it
+func isInsideDir(path, dir string) bool {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+
+	// Follow symlinks where the directories already exist
+	if resolved, err := filepath.EvalSymlinks(absPath); err == nil {
+		absPath = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(absDir); err == nil {
+		absDir = resolved
+	}
+
+	rel, err := filepath.Rel(absDir, absPath)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsInsideDir(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"./assets", true},
+		{"assets/", true},
+		{"./assets/imports", true},
+		{"./storage/../assets/exports", true},
+		{"./storage/imports", false},
+		{"./assets-private", false},
+		{"../assets", false},
+		{"/var/lib/app/exports", false},
+	}
+	for _, tt := range tests {
+		if got := isInsideDir(tt.path, "./assets"); got != tt.want {
+			t.Errorf("isInsideDir(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestIsInsideDirFollowsSymlinks(t *testing.T) {
+	root := t.TempDir()
+	public := filepath.Join(root, "assets")
+	if err := os.Mkdir(public, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(root, "storage")
+	if err := os.Symlink(public, link); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	if !isInsideDir(link, public) {
+		t.Error("a symlink into the public directory was not detected")
+	}
+}
+
+func TestPrivateStoragePath(t *testing.T) {
+	t.Setenv("TEST_STORAGE_PATH", "")
+	if path, err := PrivateStoragePath("TEST_STORAGE_PATH", "./storage/imports"); err != nil || path != "./storage/imports" {
+		t.Errorf("unset setting gave %q, %v, want the fallback", path, err)
+	}
+
+	t.Setenv("TEST_STORAGE_PATH", "/data/imports")
+	if path, err := PrivateStoragePath("TEST_STORAGE_PATH", "./storage/imports"); err != nil || path != "/data/imports" {
+		t.Errorf("configured setting gave %q, %v", path, err)
+	}
+
+	t.Setenv("TEST_STORAGE_PATH", "./assets/imports")
+	if _, err := PrivateStoragePath("TEST_STORAGE_PATH", "./storage/imports"); err == nil {
+		t.Error("a directory under the public assets was accepted")
+	}
+}
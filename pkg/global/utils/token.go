@@ -0,0 +1,200 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"go_template_v3/pkg/config"
+	"strconv"
+	"strings"
+	"time"
+
+	utils_v1 "github.com/FDSAP-Git-Org/hephaestus/utils/v1"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Token types are stored in the "tokenType" claim so a token minted for one
+// purpose cannot be replayed as another.
+const (
+	TokenTypeAccess            = "access"
+	TokenTypeEmailVerification = "email_verification"
+	TokenTypeMFAPending        = "mfa_pending"
+)
+
+// TokenClaims holds the parts of a verified JWT the handlers care about
+type TokenClaims struct {
+	ID        string
+	Type      string
+	ExpiresAt time.Time
+	Body      map[string]interface{}
+}
+
+// AccessTokenTTL returns the access token lifetime (ACCESS_TOKEN_TTL_MINUTES, default 15)
+func AccessTokenTTL() time.Duration {
+	return envDuration("ACCESS_TOKEN_TTL_MINUTES", 15, time.Minute)
+}
+
+// RefreshTokenTTL returns the refresh token lifetime (REFRESH_TOKEN_TTL_HOURS, default 720)
+func RefreshTokenTTL() time.Duration {
+	return envDuration("REFRESH_TOKEN_TTL_HOURS", 720, time.Hour)
+}
+
+// EmailVerificationTTL returns how long verification links stay valid (EMAIL_VERIFICATION_TTL_HOURS, default 24)
+func EmailVerificationTTL() time.Duration {
+	return envDuration("EMAIL_VERIFICATION_TTL_HOURS", 24, time.Hour)
+}
+
+// MFAPendingTTL returns how long a password-verified login may wait for its
+// second factor (MFA_PENDING_TTL_MINUTES, default 5)
+func MFAPendingTTL() time.Duration {
+	return envDuration("MFA_PENDING_TTL_MINUTES", 5, time.Minute)
+}
+
+// GenerateToken signs the body claims as a JWT of the given type with the
+// active key and returns the token together with its unique ID (jti)
+func GenerateToken(tokenType string, body map[string]interface{}, ttl time.Duration) (string, string, error) {
+	now := time.Now()
+	tokenId := GenerateOpaqueToken(32)
+
+	claims := jwt.MapClaims{
+		"jti":       tokenId,
+		"iss":       JWTIssuer(),
+		"aud":       JWTAudience(),
+		"tokenType": tokenType,
+		"iat":       now.Unix(),
+		"exp":       now.Add(ttl).Unix(),
+		"body":      body,
+	}
+
+	key := signingKey()
+	token := jwt.NewWithClaims(key.Method, claims)
+
+	var signingSecret interface{} = []byte(utils_v1.GetEnv("JWT_SECRET"))
+	if key.Private != nil {
+		token.Header["kid"] = key.ID
+		signingSecret = key.Private
+	}
+
+	signed, err := token.SignedString(signingSecret)
+	if err != nil {
+		return "", "", err
+	}
+
+	return signed, tokenId, nil
+}
+
+// ParseToken verifies the signature, algorithm, issuer, audience, expiry and
+// type of a JWT
+func ParseToken(tokenString string, tokenType string) (*TokenClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, verifyWith, err := verificationKey(kid)
+		if err != nil {
+			return nil, err
+		}
+		// The algorithm comes from our key, never from the token header
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		return verifyWith, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	if !claims.VerifyIssuer(JWTIssuer(), true) {
+		return nil, errors.New("invalid token issuer")
+	}
+	if !claims.VerifyAudience(JWTAudience(), true) {
+		return nil, errors.New("invalid token audience")
+	}
+
+	if claimType, _ := claims["tokenType"].(string); claimType != tokenType {
+		return nil, errors.New("invalid token type")
+	}
+
+	body, ok := claims["body"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("token body missing")
+	}
+
+	tokenId, _ := claims["jti"].(string)
+	exp, _ := claims["exp"].(float64)
+
+	return &TokenClaims{
+		ID:        tokenId,
+		Type:      tokenType,
+		ExpiresAt: time.Unix(int64(exp), 0),
+		Body:      body,
+	}, nil
+}
+
+// GenerateOpaqueToken returns a random alphanumeric string for use as a
+// bearer secret (refresh tokens, token IDs)
+func GenerateOpaqueToken(length int) string {
+	return utils_v1.GenerateRandomStrings(length, []string{utils_v1.UpperString, utils_v1.LowerString, utils_v1.NumericString})
+}
+
+// RevokeToken adds a token ID to the revocation list until it expires
+func RevokeToken(tokenId string, expiresAt time.Time) error {
+	if tokenId == "" {
+		return nil
+	}
+
+	// Expired entries can never match a valid token, so prune them here
+	config.DBConnList[0].Exec("DELETE FROM revoked_tokens WHERE expires_at < NOW()")
+
+	return config.DBConnList[0].Exec(
+		"INSERT INTO revoked_tokens (jti, expires_at) VALUES (?, ?) ON CONFLICT (jti) DO NOTHING",
+		tokenId, expiresAt,
+	).Error
+}
+
+// ClaimToken revokes a single-use token and reports whether this call was
+// the one that used it. Concurrent claims of the same token let one through.
+func ClaimToken(tokenId string, expiresAt time.Time) (bool, error) {
+	if tokenId == "" {
+		return false, nil
+	}
+
+	result := config.DBConnList[0].Exec(
+		"INSERT INTO revoked_tokens (jti, expires_at) VALUES (?, ?) ON CONFLICT (jti) DO NOTHING",
+		tokenId, expiresAt,
+	)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// IsTokenRevoked reports whether a token ID is on the revocation list
+func IsTokenRevoked(tokenId string) (bool, error) {
+	var revoked int
+	err := config.DBConnList[0].Raw(
+		"SELECT 1 FROM revoked_tokens WHERE jti = ? AND expires_at > NOW() LIMIT 1",
+		tokenId,
+	).Scan(&revoked).Error
+	if err != nil {
+		return false, err
+	}
+	return revoked == 1, nil
+}
+
+func envDuration(key string, fallback int, unit time.Duration) time.Duration {
+	return time.Duration(EnvInt(key, fallback, 1)) * unit
+}
+
+// EnvInt reads a whole number setting. It returns fallback when the setting
+// is unset, not a whole number or below min, so a typo cannot turn a limit
+// off. Settings where 0 means "none" pass a min of 0.
+func EnvInt(key string, fallback, min int) int {
+	value, err := strconv.Atoi(strings.TrimSpace(utils_v1.GetEnv(key)))
+	if err != nil || value < min {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,28 @@
+package utils
+
+import "testing"
+
+func TestEnvInt(t *testing.T) {
+	tests := []struct {
+		value string
+		min   int
+		want  int
+	}{
+		{"", 0, 7},
+		{"3", 0, 3},
+		{" 12 ", 0, 12},
+		{"0", 0, 0},
+		{"-1", 0, 7},
+		{"many", 0, 7},
+		{"1.5", 0, 7},
+		{"0", 1, 7},
+		{"1", 1, 1},
+		{"-1", -1, -1},
+	}
+	for _, tt := range tests {
+		t.Setenv("UTILS_TEST_SETTING", tt.value)
+		if got := EnvInt("UTILS_TEST_SETTING", 7, tt.min); got != tt.want {
+			t.Errorf("EnvInt(%q, min %d) = %d, want %d", tt.value, tt.min, got, tt.want)
+		}
+	}
+}
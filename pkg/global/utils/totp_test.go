@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B secret "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTPVectors(t *testing.T) {
+	// Last six digits of the RFC 6238 SHA1 test vectors
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		now := time.Unix(tt.unix, 0)
+		step, ok := ValidateTOTP(rfcSecret, tt.code, now)
+		if !ok {
+			t.Errorf("ValidateTOTP at %d rejected %s", tt.unix, tt.code)
+			continue
+		}
+		if want := tt.unix / totpPeriod; step != want {
+			t.Errorf("ValidateTOTP at %d matched step %d, want %d", tt.unix, step, want)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+
+	// One period either side is accepted, two is not
+	if _, ok := ValidateTOTP(rfcSecret, "005924", now.Add(totpPeriod*time.Second)); !ok {
+		t.Error("code from the previous step rejected")
+	}
+	if _, ok := ValidateTOTP(rfcSecret, "005924", now.Add(-totpPeriod*time.Second)); !ok {
+		t.Error("code from the next step rejected")
+	}
+	if _, ok := ValidateTOTP(rfcSecret, "005924", now.Add(3*totpPeriod*time.Second)); ok {
+		t.Error("code three steps old accepted")
+	}
+}
+
+func TestValidateTOTPRejectsMalformed(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	for _, code := range []string{"", "05924", "0059240", "abcdef"} {
+		if _, ok := ValidateTOTP(rfcSecret, code, now); ok {
+			t.Errorf("ValidateTOTP accepted %q", code)
+		}
+	}
+	if _, ok := ValidateTOTP("not base32!", "005924", now); ok {
+		t.Error("ValidateTOTP accepted an invalid secret")
+	}
+	// Surrounding whitespace and a lowercase secret are tolerated
+	if _, ok := ValidateTOTP(strings.ToLower(rfcSecret), " 005924 ", now); !ok {
+		t.Error("ValidateTOTP rejected a padded code")
+	}
+}
+
+func TestGenerateTOTPSecretRoundTrip(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Fatalf("secret %q does not decode to 20 bytes: %v", secret, err)
+	}
+
+	now := time.Now()
+	if _, ok := ValidateTOTP(secret, totpCode(key, now.Unix()/totpPeriod), now); !ok {
+		t.Error("current code for a generated secret rejected")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := TOTPProvisioningURI("Expense Tracker", "someone@example.com", rfcSecret)
+	if !strings.HasPrefix(uri, "otpauth://totp/Expense%20Tracker:someone@example.com?") {
+		t.Errorf("unexpected label in %s", uri)
+	}
+	for _, part := range []string{"secret=" + rfcSecret, "issuer=Expense%20Tracker", "digits=6", "period=30"} {
+		if !strings.Contains(uri, part) {
+			t.Errorf("%s is missing %s", uri, part)
+		}
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes := GenerateRecoveryCodes(8)
+	if len(codes) != 8 {
+		t.Fatalf("got %d codes, want 8", len(codes))
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("code %q is not formatted xxxxx-xxxxx", code)
+		}
+		if seen[code] {
+			t.Errorf("duplicate code %q", code)
+		}
+		seen[code] = true
+		if NormalizeRecoveryCode(" "+strings.ToUpper(code)+"\n") != code {
+			t.Errorf("normalizing %q does not round-trip", code)
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"os/exec"
 	"strconv"
+	"strings"
 	"time"
 
 	v1 "github.com/FDSAP-Git-Org/hephaestus/helper/v1"
@@ -120,6 +121,11 @@ func GetUserId(c fiber.Ctx) int {
 	}
 }
 
+func GetUserEmail(c fiber.Ctx) string {
+	email, _ := c.Locals("email").(string)
+	return email
+}
+
 // Generic handler - just executes the query with the provided payload
 func ExecuteDBFunction(c fiber.Ctx, query string, payload map[string]interface{}) error {
 	payloadJSON, err := json.Marshal(payload)
@@ -133,14 +139,16 @@ func ExecuteDBFunction(c fiber.Ctx, query string, payload map[string]interface{}
 		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
 	}
 
-	// Convert string to []byte for JSON unmarshalling
-	resultJSON := []byte(resultStr)
+	// Decode numbers as json.Number so amounts pass through exactly
+	decoder := json.NewDecoder(strings.NewReader(resultStr))
+	decoder.UseNumber()
 	var dbResponse map[string]interface{}
-	if err := json.Unmarshal(resultJSON, &dbResponse); err != nil {
+	if err := decoder.Decode(&dbResponse); err != nil {
 		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to parse DB response", err, http.StatusInternalServerError)
 	}
 
-	code, _ := dbResponse["code"].(float64)
+	codeNumber, _ := dbResponse["code"].(json.Number)
+	code, _ := codeNumber.Int64()
 	codeInt := int(code)
 	codeStr := strconv.Itoa(codeInt)
 	message, _ := dbResponse["message"].(string)
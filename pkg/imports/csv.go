@@ -0,0 +1,398 @@
+package imports
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"go_template_v3/pkg/currency"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fields an import can map columns to. Category is looked up by name,
+// CategoryId takes the ID as written.
+const (
+	FieldTitle      = "title"
+	FieldAmount     = "amount"
+	FieldDate       = "date"
+	FieldNotes      = "notes"
+	FieldCategory   = "category"
+	FieldCategoryId = "categoryId"
+	FieldCurrency   = "currency"
+)
+
+// Mapping maps an import field to the CSV header it is read from
+type Mapping map[string]string
+
+// Preview describes an uploaded CSV before it is imported
+type Preview struct {
+	Delimiter           string     `json:"delimiter"`
+	Headers             []string   `json:"headers"`
+	SampleRows          [][]string `json:"sampleRows"`
+	RowCount            int        `json:"rowCount"`
+	SuggestedMapping    Mapping    `json:"suggestedMapping"`
+	SuggestedDateFormat string     `json:"suggestedDateFormat,omitempty"`
+}
+
+// Options controls how mapped CSV values become rows
+type Options struct {
+	Mapping          Mapping
+	DateFormat       string
+	DecimalSeparator string
+	// Categories maps lower-cased category names to their IDs
+	Categories map[string]int
+	// Currency is the currency of rows that do not name their own
+	Currency string
+}
+
+// Record is one data line of the file. Err is set when the line was
+// rejected, and Row otherwise. Bank statements also set the account and the
+// bank's transaction ID, which identify the transaction across imports.
+type Record struct {
+	Line       int
+	Fields     []string
+	Row        *Row
+	Err        error
+	Account    string
+	ExternalId string
+}
+
+// headerSynonyms are normalized header names that suggest each field
+var headerSynonyms = map[string][]string{
+	FieldTitle:      {"title", "description", "payee", "merchant", "name", "narrative", "details"},
+	FieldAmount:     {"amount", "value", "debit", "total", "sum", "amt"},
+	FieldDate:       {"date", "transactiondate", "posteddate", "posted", "postingdate", "bookingdate", "valuedate"},
+	FieldNotes:      {"notes", "note", "memo", "comment", "comments", "reference"},
+	FieldCategory:   {"category", "categoryname"},
+	FieldCategoryId: {"categoryid"},
+	FieldCurrency:   {"currency", "currencycode", "ccy", "cur"},
+}
+
+// dateFormats are tried in order when suggesting a date format
+var dateFormats = []string{"YYYY-MM-DD", "DD/MM/YYYY", "MM/DD/YYYY", "DD.MM.YYYY", "DD-MM-YYYY", "YYYY/MM/DD", "MM-DD-YYYY"}
+
+// PreviewCSV reads the header, the first sampleSize rows and the row count
+// without holding the whole file in memory
+func PreviewCSV(r io.Reader, sampleSize int) (*Preview, error) {
+	buffered := bufio.NewReader(r)
+	delimiter, err := detectDelimiter(buffered)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := newCSVReader(buffered, delimiter)
+	headers, err := reader.Read()
+	if err != nil {
+		return nil, errors.New("CSV file has no header row")
+	}
+	headers = cleanHeaders(headers)
+
+	preview := &Preview{
+		Delimiter:        string(delimiter),
+		Headers:          headers,
+		SampleRows:       [][]string{},
+		SuggestedMapping: SuggestMapping(headers),
+	}
+
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		if isBlank(fields) {
+			continue
+		}
+		preview.RowCount++
+		if len(preview.SampleRows) < sampleSize {
+			preview.SampleRows = append(preview.SampleRows, fields)
+		}
+	}
+
+	if column, ok := preview.SuggestedMapping[FieldDate]; ok {
+		preview.SuggestedDateFormat = suggestDateFormat(columnValues(preview, column))
+	}
+
+	return preview, nil
+}
+
+// SuggestMapping matches headers to fields by common names
+func SuggestMapping(headers []string) Mapping {
+	mapping := Mapping{}
+	used := map[string]bool{}
+
+	for _, field := range []string{FieldCategoryId, FieldTitle, FieldAmount, FieldDate, FieldNotes, FieldCategory, FieldCurrency} {
+		for _, synonym := range headerSynonyms[field] {
+			for _, header := range headers {
+				if !used[header] && normalizeHeader(header) == synonym {
+					mapping[field] = header
+					used[header] = true
+					break
+				}
+			}
+			if _, ok := mapping[field]; ok {
+				break
+			}
+		}
+	}
+
+	return mapping
+}
+
+// CSVReader streams mapped and validated records from a CSV file
+type CSVReader struct {
+	reader     *csv.Reader
+	options    Options
+	dateLayout string
+	columns    map[string]int
+	headers    []string
+}
+
+// NewCSVReader reads the header and checks the mapping against it
+func NewCSVReader(r io.Reader, delimiter string, options Options) (*CSVReader, error) {
+	dateLayout, err := options.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	comma := ','
+	if delimiter != "" {
+		comma = []rune(delimiter)[0]
+	}
+	reader := newCSVReader(r, comma)
+	headers, err := reader.Read()
+	if err != nil {
+		return nil, errors.New("CSV file has no header row")
+	}
+	headers = cleanHeaders(headers)
+
+	columns := map[string]int{}
+	for field, header := range options.Mapping {
+		if _, ok := headerSynonyms[field]; !ok {
+			return nil, fmt.Errorf("unknown field %q in mapping", field)
+		}
+		if header == "" {
+			continue
+		}
+		index := -1
+		for i, h := range headers {
+			if h == header {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return nil, fmt.Errorf("column %q mapped to %s is not in the file", header, field)
+		}
+		columns[field] = index
+	}
+	for _, required := range []string{FieldTitle, FieldAmount} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("a column must be mapped to %s", required)
+		}
+	}
+
+	return &CSVReader{
+		reader:     reader,
+		options:    options,
+		dateLayout: dateLayout,
+		columns:    columns,
+		headers:    headers,
+	}, nil
+}
+
+// Headers returns the file's column names
+func (r *CSVReader) Headers() []string {
+	return r.headers
+}
+
+// Next returns the next non-blank record, or io.EOF after the last one.
+// Other errors mean the file itself is malformed.
+func (r *CSVReader) Next() (*Record, error) {
+	for {
+		fields, err := r.reader.Read()
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		if isBlank(fields) {
+			continue
+		}
+
+		line, _ := r.reader.FieldPos(0)
+		record := &Record{Line: line, Fields: fields}
+		record.Row, record.Err = r.convert(fields)
+		return record, nil
+	}
+}
+
+func (r *CSVReader) convert(fields []string) (*Row, error) {
+	value := func(field string) string {
+		if index, ok := r.columns[field]; ok && index < len(fields) {
+			return strings.TrimSpace(fields[index])
+		}
+		return ""
+	}
+
+	row := &Row{Title: value(FieldTitle), Notes: value(FieldNotes)}
+	if row.Title == "" {
+		return nil, errors.New("title is required")
+	}
+
+	amount, err := ParseAmount(value(FieldAmount), r.options.DecimalSeparator)
+	if err != nil {
+		return nil, err
+	}
+	row.Amount = amount
+
+	if row.Currency, err = ParseCurrency(value(FieldCurrency), r.options.Currency); err != nil {
+		return nil, err
+	}
+	if err := row.checkAmount(); err != nil {
+		return nil, err
+	}
+
+	if date := value(FieldDate); date != "" {
+		if row.Date, err = ParseDate(date, r.dateLayout); err != nil {
+			return nil, fmt.Errorf("invalid date %q", date)
+		}
+	}
+
+	if categoryId := value(FieldCategoryId); categoryId != "" {
+		id, err := strconv.Atoi(categoryId)
+		if err != nil {
+			return nil, fmt.Errorf("invalid category ID %q", categoryId)
+		}
+		row.CategoryId = &id
+	} else if category := value(FieldCategory); category != "" {
+		id, ok := r.options.Categories[strings.ToLower(category)]
+		if !ok {
+			return nil, fmt.Errorf("unknown category %q", category)
+		}
+		row.CategoryId = &id
+	}
+
+	return row, nil
+}
+
+// normalize applies defaults, checks the options and returns the date layout
+func (o *Options) normalize() (string, error) {
+	if o.DecimalSeparator == "" {
+		o.DecimalSeparator = "."
+	}
+	if o.DecimalSeparator != "." && o.DecimalSeparator != "," {
+		return "", errors.New("decimal separator must be \".\" or \",\"")
+	}
+	if o.Currency != "" {
+		code, err := currency.Normalize(o.Currency)
+		if err != nil {
+			return "", err
+		}
+		o.Currency = code
+	}
+	return DateLayout(o.DateFormat)
+}
+
+func newCSVReader(r io.Reader, delimiter rune) *csv.Reader {
+	reader := csv.NewReader(r)
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	return reader
+}
+
+// detectDelimiter picks the most common of , ; tab and | in the header line
+func detectDelimiter(r *bufio.Reader) (rune, error) {
+	peeked, err := r.Peek(4096)
+	if len(peeked) == 0 {
+		if err == nil || err == io.EOF {
+			err = errors.New("CSV file is empty")
+		}
+		return 0, err
+	}
+
+	header := string(peeked)
+	if i := strings.IndexAny(header, "\r\n"); i >= 0 {
+		header = header[:i]
+	}
+
+	best, bestCount := ',', 0
+	for _, candidate := range []rune{',', ';', '\t', '|'} {
+		if count := strings.Count(header, string(candidate)); count > bestCount {
+			best, bestCount = candidate, count
+		}
+	}
+	return best, nil
+}
+
+// cleanHeaders trims headers and drops a UTF-8 byte order mark
+func cleanHeaders(headers []string) []string {
+	cleaned := make([]string, len(headers))
+	for i, header := range headers {
+		cleaned[i] = strings.TrimSpace(strings.TrimPrefix(header, "\ufeff"))
+	}
+	return cleaned
+}
+
+func normalizeHeader(header string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(header) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func isBlank(fields []string) bool {
+	for _, field := range fields {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func columnValues(preview *Preview, header string) []string {
+	index := -1
+	for i, h := range preview.Headers {
+		if h == header {
+			index = i
+		}
+	}
+	values := []string{}
+	for _, row := range preview.SampleRows {
+		if index >= 0 && index < len(row) && strings.TrimSpace(row[index]) != "" {
+			values = append(values, strings.TrimSpace(row[index]))
+		}
+	}
+	return values
+}
+
+// suggestDateFormat returns the first format every sample value parses with
+func suggestDateFormat(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	for _, format := range dateFormats {
+		layout, _ := DateLayout(format)
+		matches := true
+		for _, value := range values {
+			if _, err := time.Parse(layout, value); err != nil {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return format
+		}
+	}
+	return ""
+}
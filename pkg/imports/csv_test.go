@@ -0,0 +1,245 @@
+package imports
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPreviewCSV(t *testing.T) {
+	file := "\ufeffDate;Payee;Amount;Memo\n" +
+		"31/01/2024;Coffee;3,50;\n" +
+		";;;\n" +
+		"01/02/2024;Books;12,00;gift\n" +
+		"15/02/2024;Rent;900,00;\n"
+
+	preview, err := PreviewCSV(strings.NewReader(file), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if preview.Delimiter != ";" {
+		t.Errorf("delimiter = %q, want ;", preview.Delimiter)
+	}
+	if want := []string{"Date", "Payee", "Amount", "Memo"}; !reflect.DeepEqual(preview.Headers, want) {
+		t.Errorf("headers = %q, want %q", preview.Headers, want)
+	}
+	// Blank lines are not counted
+	if preview.RowCount != 3 {
+		t.Errorf("row count = %d, want 3", preview.RowCount)
+	}
+	if len(preview.SampleRows) != 2 {
+		t.Errorf("got %d sample rows, want 2", len(preview.SampleRows))
+	}
+	wantMapping := Mapping{FieldDate: "Date", FieldTitle: "Payee", FieldAmount: "Amount", FieldNotes: "Memo"}
+	if !reflect.DeepEqual(preview.SuggestedMapping, wantMapping) {
+		t.Errorf("suggested mapping = %v, want %v", preview.SuggestedMapping, wantMapping)
+	}
+	if preview.SuggestedDateFormat != "DD/MM/YYYY" {
+		t.Errorf("suggested date format = %q, want DD/MM/YYYY", preview.SuggestedDateFormat)
+	}
+}
+
+func TestPreviewCSVRejectsEmptyFile(t *testing.T) {
+	if _, err := PreviewCSV(strings.NewReader(""), 10); err == nil {
+		t.Error("empty file accepted")
+	}
+}
+
+func TestSuggestMapping(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []string
+		want    Mapping
+	}{
+		{
+			"exact names",
+			[]string{"title", "amount", "categoryid", "date", "notes"},
+			Mapping{FieldTitle: "title", FieldAmount: "amount", FieldCategoryId: "categoryid", FieldDate: "date", FieldNotes: "notes"},
+		},
+		{
+			"bank export names",
+			[]string{"Transaction Date", "Description", "Debit", "Currency Code"},
+			Mapping{FieldDate: "Transaction Date", FieldTitle: "Description", FieldAmount: "Debit", FieldCurrency: "Currency Code"},
+		},
+		{
+			"category ID is not taken as the category name",
+			[]string{"Name", "Value", "Category ID", "Category"},
+			Mapping{FieldTitle: "Name", FieldAmount: "Value", FieldCategoryId: "Category ID", FieldCategory: "Category"},
+		},
+		{
+			"unknown headers",
+			[]string{"foo", "bar"},
+			Mapping{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SuggestMapping(tt.headers); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SuggestMapping(%q) = %v, want %v", tt.headers, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewCSVReaderChecksMapping(t *testing.T) {
+	const file = "what,cost,when\nLunch,10,2024-01-01\n"
+
+	tests := []struct {
+		name    string
+		options Options
+		wantErr string
+	}{
+		{"unknown field", Options{Mapping: Mapping{FieldTitle: "what", FieldAmount: "cost", "price": "cost"}}, "unknown field"},
+		{"missing column", Options{Mapping: Mapping{FieldTitle: "what", FieldAmount: "total"}}, "not in the file"},
+		{"title not mapped", Options{Mapping: Mapping{FieldAmount: "cost"}}, "mapped to title"},
+		{"amount not mapped", Options{Mapping: Mapping{FieldTitle: "what", FieldAmount: ""}}, "mapped to amount"},
+		{"bad separator", Options{Mapping: Mapping{FieldTitle: "what", FieldAmount: "cost"}, DecimalSeparator: "'"}, "decimal separator"},
+		{"bad date format", Options{Mapping: Mapping{FieldTitle: "what", FieldAmount: "cost"}, DateFormat: "MM/DD"}, "date format"},
+		{"bad currency", Options{Mapping: Mapping{FieldTitle: "what", FieldAmount: "cost"}, Currency: "XXY"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewCSVReader(strings.NewReader(file), ",", tt.options)
+			if err == nil {
+				t.Fatal("mapping accepted")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error %q does not mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// readAll collects every record, as a dry run does before deciding what
+// would be saved
+func readAll(t *testing.T, reader Reader) []*Record {
+	t.Helper()
+	var records []*Record
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			return records
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+}
+
+func TestCSVReaderMapsColumns(t *testing.T) {
+	file := "Kind;Spent;On;Memo;Ccy\n" +
+		"Food;\"1.234,50\";31.01.2024;weekly shop;\n" +
+		"\n" +
+		"Travel;(20,00);01.02.2024;;eur\n"
+
+	reader, err := NewCSVReader(strings.NewReader(file), ";", Options{
+		Mapping: Mapping{
+			FieldCategory: "Kind",
+			FieldTitle:    "Memo",
+			FieldAmount:   "Spent",
+			FieldDate:     "On",
+			FieldCurrency: "Ccy",
+		},
+		DateFormat:       "DD.MM.YYYY",
+		DecimalSeparator: ",",
+		Categories:       map[string]int{"food": 3, "travel": 7},
+		Currency:         "usd",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := readAll(t, reader)
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+
+	first := records[0]
+	if first.Err != nil {
+		t.Fatalf("first row rejected: %v", first.Err)
+	}
+	if first.Line != 2 {
+		t.Errorf("first row on line %d, want 2", first.Line)
+	}
+	row := first.Row
+	if row.Title != "weekly shop" || row.Amount.String() != "1234.5" || row.Date != "2024-01-31" ||
+		row.Currency != "USD" || row.CategoryId == nil || *row.CategoryId != 3 {
+		t.Errorf("first row = %+v", row)
+	}
+
+	// The blank line is skipped but still counts toward line numbers, and a
+	// row without a title is rejected rather than stopping the import
+	second := records[1]
+	if second.Line != 4 {
+		t.Errorf("second row on line %d, want 4", second.Line)
+	}
+	if second.Err == nil || !strings.Contains(second.Err.Error(), "title") {
+		t.Errorf("row without a title gave %v", second.Err)
+	}
+	if !reflect.DeepEqual(second.Fields, []string{"Travel", "(20,00)", "01.02.2024", "", "eur"}) {
+		t.Errorf("rejected row kept fields %q", second.Fields)
+	}
+}
+
+func TestCSVReaderRejectsBadRows(t *testing.T) {
+	file := "title,amount,date,category,categoryId,currency\n" +
+		"ok,10,2024-01-01,,,\n" +
+		"bad amount,ten,,,,\n" +
+		"bad date,10,2024-13-01,,,\n" +
+		"unknown category,10,,Pets,,\n" +
+		"bad category id,10,,,x,\n" +
+		"bad currency,10,,,,ABCD\n" +
+		"too precise,10.001,,,,USD\n" +
+		"whole yen,10.5,,,,JPY\n"
+
+	reader, err := NewCSVReader(strings.NewReader(file), ",", Options{
+		Mapping: Mapping{
+			FieldTitle:      "title",
+			FieldAmount:     "amount",
+			FieldDate:       "date",
+			FieldCategory:   "category",
+			FieldCategoryId: "categoryId",
+			FieldCurrency:   "currency",
+		},
+		Categories: map[string]int{"food": 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantErrors := map[string]string{
+		"bad amount":       "invalid amount",
+		"bad date":         "invalid date",
+		"unknown category": "unknown category",
+		"bad category id":  "invalid category ID",
+		"bad currency":     "invalid currency",
+		"too precise":      "decimal places",
+		"whole yen":        "whole numbers",
+	}
+	for _, record := range readAll(t, reader) {
+		title := record.Fields[0]
+		want, shouldFail := wantErrors[title]
+		switch {
+		case !shouldFail && record.Err != nil:
+			t.Errorf("%s: rejected with %v", title, record.Err)
+		case shouldFail && record.Err == nil:
+			t.Errorf("%s: accepted", title)
+		case shouldFail && !strings.Contains(record.Err.Error(), want):
+			t.Errorf("%s: error %q does not mention %q", title, record.Err, want)
+		}
+	}
+}
+
+func TestCSVReaderStopsOnMalformedFile(t *testing.T) {
+	reader, err := NewCSVReader(strings.NewReader("title,amount\n\"unclosed,10\n"), ",",
+		Options{Mapping: Mapping{FieldTitle: "title", FieldAmount: "amount"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reader.Next(); err == nil || err == io.EOF {
+		t.Errorf("malformed quoting gave %v, want an error", err)
+	}
+}
@@ -0,0 +1,150 @@
+package imports
+
+import (
+	"bufio"
+	"errors"
+	"go_template_v3/pkg/currency"
+	"html"
+	"io"
+	"strings"
+	"time"
+)
+
+// OFXReader streams debit transactions from an OFX or QFX statement. Both
+// the SGML flavour (OFX 1.x, where leaf elements are not closed) and the XML
+// flavour (OFX 2.x) are read by the same tokenizer.
+type OFXReader struct {
+	reader           *bufio.Reader
+	decimalSeparator string
+	currency         string
+	account          string
+	transaction      map[string]string
+	count            int
+	seen             map[string]int
+}
+
+// NewOFXReader checks the options and prepares to read the statement
+func NewOFXReader(r io.Reader, options Options) (*OFXReader, error) {
+	if _, err := options.normalize(); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(r)
+	// Everything before the first tag is the SGML header or XML prolog text
+	if _, err := reader.ReadString('<'); err != nil {
+		return nil, errors.New("not an OFX file")
+	}
+
+	return &OFXReader{
+		reader:           reader,
+		decimalSeparator: options.DecimalSeparator,
+		currency:         options.Currency,
+		seen:             map[string]int{},
+	}, nil
+}
+
+// Next returns the next debit transaction, or io.EOF after the last one
+func (r *OFXReader) Next() (*Record, error) {
+	for {
+		tag, text, err := r.nextTag()
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case tag == "" || tag[0] == '?' || tag[0] == '!':
+			// Processing instructions and comments
+		case tag == "STMTTRN":
+			r.transaction = map[string]string{}
+		case tag == "/STMTTRN":
+			if r.transaction == nil {
+				continue
+			}
+			r.count++
+			record := r.record(r.transaction)
+			r.transaction = nil
+			if record != nil {
+				return record, nil
+			}
+		case tag[0] == '/':
+			// Closing tags carry nothing the SGML form does not
+		case tag == "ACCTID":
+			r.account = text
+		case tag == "CURDEF":
+			// The statement's currency overrides the default when it is known
+			if code, err := currency.Normalize(text); err == nil {
+				r.currency = code
+			}
+		case r.transaction != nil && text != "":
+			r.transaction[tag] = text
+		}
+	}
+}
+
+// nextTag reads one tag and the text up to the next tag. The opening "<"
+// was consumed by the previous call.
+func (r *OFXReader) nextTag() (string, string, error) {
+	tag, err := r.reader.ReadString('>')
+	if err != nil {
+		if err == io.EOF && strings.TrimSpace(tag) == "" {
+			return "", "", io.EOF
+		}
+		if err == io.EOF {
+			return "", "", errors.New("invalid OFX: unterminated tag")
+		}
+		return "", "", err
+	}
+	tag = strings.TrimSuffix(tag, ">")
+	if i := strings.IndexAny(tag, " \t\r\n"); i >= 0 && tag[0] != '?' && tag[0] != '!' {
+		tag = tag[:i]
+	}
+
+	text, err := r.reader.ReadString('<')
+	if err != nil && err != io.EOF {
+		return "", "", err
+	}
+	text = strings.TrimSuffix(text, "<")
+	text = html.UnescapeString(toUTF8(strings.TrimSpace(text)))
+
+	return strings.ToUpper(strings.TrimSpace(tag)), text, nil
+}
+
+func (r *OFXReader) record(transaction map[string]string) *Record {
+	payee := transaction["NAME"]
+	if payee == "" {
+		payee = transaction["PAYEE"]
+	}
+	memo := transaction["MEMO"]
+	amount := transaction["TRNAMT"]
+
+	date, dateErr := parseOFXDate(transaction["DTPOSTED"])
+	externalId := transaction["FITID"]
+	if externalId == "" {
+		externalId = syntheticId(r.seen, r.account, transaction["DTPOSTED"], amount, payee, memo, transaction["CHECKNUM"])
+	}
+
+	record := statementRecord(r.count, date, amount, payee, memo, r.account, externalId, r.decimalSeparator)
+	if record != nil && record.Err == nil && dateErr != nil {
+		record.Err, record.Row = dateErr, nil
+	}
+	if record != nil && record.Row != nil {
+		record.Row.Date = date
+		record.Row.Currency = r.currency
+		if err := record.Row.checkAmount(); err != nil {
+			record.Row, record.Err = nil, err
+		}
+	}
+	return record
+}
+
+// parseOFXDate reads YYYYMMDD, ignoring any time and time zone after it
+func parseOFXDate(value string) (string, error) {
+	if len(value) < 8 {
+		return value, errors.New("invalid date")
+	}
+	parsed, err := time.Parse("20060102", value[:8])
+	if err != nil {
+		return value, errors.New("invalid date")
+	}
+	return parsed.Format("2006-01-02"), nil
+}
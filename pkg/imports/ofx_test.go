@@ -0,0 +1,131 @@
+package imports
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOFXReaderSGML(t *testing.T) {
+	file := "OFXHEADER:100\r\nDATA:OFXSGML\r\nVERSION:102\r\n\r\n" +
+		"<OFX><BANKMSGSRSV1><STMTTRNRS><STMTRS>\r\n" +
+		"<CURDEF>EUR\r\n" +
+		"<BANKACCTFROM><BANKID>123<ACCTID>987654<ACCTTYPE>CHECKING</BANKACCTFROM>\r\n" +
+		"<BANKTRANLIST>\r\n" +
+		"<STMTTRN><TRNTYPE>DEBIT<DTPOSTED>20240131120000[-5:EST]<TRNAMT>-42.10<FITID>T1<NAME>Grocer &amp; Co<MEMO>Weekly</STMTTRN>\r\n" +
+		"<STMTTRN><TRNTYPE>CREDIT<DTPOSTED>20240201<TRNAMT>1000.00<FITID>T2<NAME>Salary</STMTTRN>\r\n" +
+		"<STMTTRN><TRNTYPE>DEBIT<DTPOSTED>2024<TRNAMT>-5.00<FITID>T3<NAME>Bad date</STMTTRN>\r\n" +
+		"<STMTTRN><TRNTYPE>DEBIT<DTPOSTED>20240203<TRNAMT>-7.00<PAYEE>Kiosk</STMTTRN>\r\n" +
+		"</BANKTRANLIST></STMTRS></STMTTRNRS></BANKMSGSRSV1></OFX>\r\n"
+
+	reader, err := NewOFXReader(strings.NewReader(file), Options{Currency: "USD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := readAll(t, reader)
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want 3", len(records))
+	}
+
+	first := records[0]
+	if first.Err != nil {
+		t.Fatal(first.Err)
+	}
+	row := first.Row
+	if row.Title != "Grocer & Co" || row.Notes != "Weekly" || row.Amount.String() != "42.1" ||
+		row.Date != "2024-01-31" || row.Currency != "EUR" {
+		t.Errorf("first row = %+v", row)
+	}
+	if first.Account != "987654" || first.ExternalId != "T1" || first.Line != 1 {
+		t.Errorf("first record = line %d, account %q, ID %q", first.Line, first.Account, first.ExternalId)
+	}
+
+	// The credit is skipped but still counted
+	if records[1].Line != 3 || records[1].Err == nil || !strings.Contains(records[1].Err.Error(), "date") {
+		t.Errorf("transaction with a bad date gave line %d, %v", records[1].Line, records[1].Err)
+	}
+
+	last := records[2]
+	if last.Err != nil || last.Row.Title != "Kiosk" {
+		t.Errorf("last record = %+v, %v", last.Row, last.Err)
+	}
+	if !strings.HasPrefix(last.ExternalId, "sha1:") {
+		t.Errorf("transaction without a FITID got ID %q", last.ExternalId)
+	}
+}
+
+func TestOFXReaderXML(t *testing.T) {
+	file := `<?xml version="1.0" encoding="UTF-8"?>
+<?OFX OFXHEADER="200" VERSION="220"?>
+<OFX>
+  <CREDITCARDMSGSRSV1><CCSTMTTRNRS><CCSTMTRS>
+    <CURDEF>JPY</CURDEF>
+    <CCACCTFROM><ACCTID>4111</ACCTID></CCACCTFROM>
+    <BANKTRANLIST>
+      <STMTTRN>
+        <TRNTYPE>DEBIT</TRNTYPE>
+        <DTPOSTED>20240229</DTPOSTED>
+        <TRNAMT>-1500</TRNAMT>
+        <FITID>X-1</FITID>
+        <NAME>Ramen</NAME>
+      </STMTTRN>
+      <STMTTRN>
+        <DTPOSTED>20240301</DTPOSTED>
+        <TRNAMT>-10.5</TRNAMT>
+        <FITID>X-2</FITID>
+        <NAME>Fractional yen</NAME>
+      </STMTTRN>
+    </BANKTRANLIST>
+  </CCSTMTRS></CCSTMTTRNRS></CREDITCARDMSGSRSV1>
+</OFX>
+`
+	reader, err := NewOFXReader(strings.NewReader(file), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := readAll(t, reader)
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+	if records[0].Err != nil || records[0].Row.Date != "2024-02-29" || records[0].Row.Currency != "JPY" ||
+		records[0].Row.Amount.String() != "1500" || records[0].Account != "4111" {
+		t.Errorf("first record = %+v, %v", records[0].Row, records[0].Err)
+	}
+	// Amounts are checked against the statement's currency
+	if records[1].Err == nil || !strings.Contains(records[1].Err.Error(), "whole numbers") {
+		t.Errorf("fractional yen gave %v", records[1].Err)
+	}
+}
+
+func TestOFXReaderRejectsBadFiles(t *testing.T) {
+	if _, err := NewOFXReader(strings.NewReader("just text"), Options{}); err == nil {
+		t.Error("file without tags accepted")
+	}
+
+	reader, err := NewOFXReader(strings.NewReader("<OFX><STMTTRN><TRNAMT>-1<NAME"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reader.Next(); err == nil || !strings.Contains(err.Error(), "unterminated") {
+		t.Errorf("unterminated tag gave %v", err)
+	}
+}
+
+func TestParseOFXDate(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+		ok    bool
+	}{
+		{"20240229", "2024-02-29", true},
+		{"20231231235959.000[+2:EET]", "2023-12-31", true},
+		{"20230229", "", false},
+		{"202401", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, err := parseOFXDate(tt.value)
+		if (err == nil) != tt.ok || (tt.ok && got != tt.want) {
+			t.Errorf("parseOFXDate(%q) = %q, %v", tt.value, got, err)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package imports
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// qifBankTypes are the QIF sections that hold bank transactions. Investment
+// and list sections are skipped.
+var qifBankTypes = map[string]bool{"bank": true, "cash": true, "ccard": true, "oth a": true, "oth l": true}
+
+// QIFReader streams debit transactions from a QIF file. QIF has no
+// transaction IDs, so each one is identified by its content instead.
+type QIFReader struct {
+	scanner          *bufio.Scanner
+	options          Options
+	dateOrder        string
+	line             int
+	inBankSection    bool
+	inAccountSection bool
+	account          string
+	seen             map[string]int
+}
+
+// NewQIFReader checks the options and prepares to read the file. The date
+// format only decides the order of day, month and year, since QIF writes
+// dates in several loose forms (1/5'24, 01/05/2024, 5.1.24).
+func NewQIFReader(r io.Reader, options Options) (*QIFReader, error) {
+	if _, err := options.normalize(); err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return &QIFReader{
+		scanner:   scanner,
+		options:   options,
+		dateOrder: qifDateOrder(options.DateFormat),
+		// Files without a !Type header are treated as a bank register
+		inBankSection: true,
+		seen:          map[string]int{},
+	}, nil
+}
+
+// Next returns the next debit transaction, or io.EOF after the last one
+func (r *QIFReader) Next() (*Record, error) {
+	fields := map[byte]string{}
+	start := 0
+
+	for r.scanner.Scan() {
+		r.line++
+		line := strings.TrimRight(toUTF8(r.scanner.Text()), "\r")
+		if r.line == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if line[0] == '!' {
+			header := strings.ToLower(strings.TrimSpace(line[1:]))
+			switch {
+			case header == "account":
+				r.inAccountSection = true
+			case strings.HasPrefix(header, "type:"):
+				r.inAccountSection = false
+				r.inBankSection = qifBankTypes[strings.TrimSpace(strings.TrimPrefix(header, "type:"))]
+			}
+			fields = map[byte]string{}
+			continue
+		}
+
+		if line[0] == '^' {
+			if r.inAccountSection {
+				r.account = fields['N']
+			} else if r.inBankSection && len(fields) > 0 {
+				if record := r.record(start, fields); record != nil {
+					return record, nil
+				}
+			}
+			fields = map[byte]string{}
+			continue
+		}
+
+		if len(fields) == 0 {
+			start = r.line
+		}
+		code := line[0]
+		// Only the first split line of each kind is kept; splits are not imported
+		if _, ok := fields[code]; !ok {
+			fields[code] = strings.TrimSpace(line[1:])
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// A last transaction without its closing ^
+	if r.inBankSection && !r.inAccountSection && len(fields) > 0 {
+		if record := r.record(start, fields); record != nil {
+			return record, nil
+		}
+	}
+	return nil, io.EOF
+}
+
+func (r *QIFReader) record(line int, fields map[byte]string) *Record {
+	amount := fields['T']
+	if amount == "" {
+		amount = fields['U']
+	}
+	payee, memo := fields['P'], fields['M']
+
+	externalId := syntheticId(r.seen, r.account, fields['D'], amount, payee, memo, fields['N'])
+	record := statementRecord(line, fields['D'], amount, payee, memo, r.account, externalId, r.options.DecimalSeparator)
+	if record == nil || record.Row == nil {
+		return record
+	}
+
+	date, err := parseQIFDate(fields['D'], r.dateOrder)
+	if err != nil {
+		record.Row, record.Err = nil, err
+		return record
+	}
+	record.Row.Date = date
+	record.Row.Currency = r.options.Currency
+	if err := record.Row.checkAmount(); err != nil {
+		record.Row, record.Err = nil, err
+		return record
+	}
+
+	// L holds a category, or a transfer account in brackets
+	if category := strings.ToLower(strings.TrimSpace(fields['L'])); category != "" && !strings.HasPrefix(category, "[") {
+		if i := strings.Index(category, ":"); i >= 0 {
+			category = category[:i]
+		}
+		if id, ok := r.options.Categories[category]; ok {
+			record.Row.CategoryId = &id
+		}
+	}
+	return record
+}
+
+// qifDateOrder reduces a date format to the order of its parts: "mdy",
+// "dmy" or "ymd". US month-first dates are the QIF default.
+func qifDateOrder(format string) string {
+	format = strings.ToUpper(format)
+	switch {
+	case strings.HasPrefix(format, "D"):
+		return "dmy"
+	case strings.HasPrefix(format, "Y"):
+		return "ymd"
+	}
+	return "mdy"
+}
+
+// parseQIFDate reads a date with any separators. Two-digit years after an
+// apostrophe are in the 2000s, as Quicken writes them.
+func parseQIFDate(value, order string) (string, error) {
+	apostrophe := strings.Contains(value, "'")
+	parts := strings.FieldsFunc(value, func(r rune) bool { return r < '0' || r > '9' })
+	if len(parts) != 3 {
+		return "", errors.New("invalid date")
+	}
+
+	numbers := map[byte]int{}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return "", errors.New("invalid date")
+		}
+		numbers[order[i]] = n
+		if order[i] == 'y' && len(part) <= 2 {
+			if apostrophe || n < 70 {
+				numbers['y'] = 2000 + n
+			} else {
+				numbers['y'] = 1900 + n
+			}
+		}
+	}
+
+	date := time.Date(numbers['y'], time.Month(numbers['m']), numbers['d'], 0, 0, 0, 0, time.UTC)
+	if date.Month() != time.Month(numbers['m']) || date.Day() != numbers['d'] {
+		return "", errors.New("invalid date")
+	}
+	return date.Format("2006-01-02"), nil
+}
+
+// suggestQIFDateFormat guesses day-first or year-first dates from samples,
+// leaving month-first as the default
+func suggestQIFDateFormat(values []string) string {
+	for _, value := range values {
+		parts := strings.FieldsFunc(value, func(r rune) bool { return r < '0' || r > '9' })
+		if len(parts) != 3 {
+			continue
+		}
+		if len(parts[0]) == 4 {
+			return "YYYY/MM/DD"
+		}
+		if n, _ := strconv.Atoi(parts[0]); n > 12 {
+			return "DD/MM/YYYY"
+		}
+	}
+	return "MM/DD/YYYY"
+}
@@ -0,0 +1,132 @@
+package imports
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQIFReader(t *testing.T) {
+	file := "!Account\nNChecking\nTBank\n^\n" +
+		"!Type:Bank\n" +
+		"D1/31'24\nT-1,250.00\nPLandlord\nMJanuary rent\nLHousing:Rent\n^\n" +
+		"D2/1'24\nT500.00\nPPaycheck\n^\n" +
+		"D2/30'24\nT-3.00\nPNo such day\n^\n" +
+		"D2/2'24\nU-9.99\nPStreaming\nL[Savings]\n^\n" +
+		"!Type:Invst\n" +
+		"D2/3'24\nT-100.00\nPBuy shares\n^\n" +
+		"!Type:CCard\n" +
+		"D2/4'24\nT-20.00\nPFuel\nLcar\nSCar\n$-15.00\nSFood\n$-5.00"
+
+	reader, err := NewQIFReader(strings.NewReader(file), Options{
+		Currency:   "USD",
+		Categories: map[string]int{"housing": 4, "car": 9},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := readAll(t, reader)
+	if len(records) != 4 {
+		t.Fatalf("got %d records, want 4", len(records))
+	}
+
+	rent := records[0]
+	if rent.Err != nil {
+		t.Fatal(rent.Err)
+	}
+	if rent.Row.Title != "Landlord" || rent.Row.Notes != "January rent" || rent.Row.Amount.String() != "1250" ||
+		rent.Row.Date != "2024-01-31" || rent.Row.CategoryId == nil || *rent.Row.CategoryId != 4 {
+		t.Errorf("rent = %+v", rent.Row)
+	}
+	if rent.Account != "Checking" || rent.Line != 6 || !strings.HasPrefix(rent.ExternalId, "sha1:") {
+		t.Errorf("rent record = line %d, account %q, ID %q", rent.Line, rent.Account, rent.ExternalId)
+	}
+
+	if records[1].Err == nil || !strings.Contains(records[1].Err.Error(), "date") {
+		t.Errorf("30 February gave %v", records[1].Err)
+	}
+
+	// A transfer is not a category
+	streaming := records[2]
+	if streaming.Err != nil || streaming.Row.Amount.String() != "9.99" || streaming.Row.CategoryId != nil {
+		t.Errorf("streaming = %+v, %v", streaming.Row, streaming.Err)
+	}
+
+	// The investment section is skipped, and the last transaction is read
+	// without its closing ^
+	fuel := records[3]
+	if fuel.Err != nil || fuel.Row.Title != "Fuel" || fuel.Row.Amount.String() != "20" ||
+		fuel.Row.CategoryId == nil || *fuel.Row.CategoryId != 9 {
+		t.Errorf("fuel = %+v, %v", fuel.Row, fuel.Err)
+	}
+}
+
+func TestQIFReaderIdsAreStable(t *testing.T) {
+	file := "!Type:Bank\nD1/5/2024\nT-4.00\nPCoffee\n^\nD1/5/2024\nT-4.00\nPCoffee\n^\n"
+
+	read := func() []*Record {
+		reader, err := NewQIFReader(strings.NewReader(file), Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return readAll(t, reader)
+	}
+	first, again := read(), read()
+
+	if first[0].ExternalId == first[1].ExternalId {
+		t.Error("two identical transactions got the same ID")
+	}
+	for i := range first {
+		if first[i].ExternalId != again[i].ExternalId {
+			t.Errorf("transaction %d got a different ID on a second read", i)
+		}
+	}
+}
+
+func TestParseQIFDate(t *testing.T) {
+	tests := []struct {
+		value string
+		order string
+		want  string
+	}{
+		{"1/5'24", "mdy", "2024-01-05"},
+		{"01/05/2024", "mdy", "2024-01-05"},
+		{"5.1.24", "dmy", "2024-01-05"},
+		{"12/31/99", "mdy", "1999-12-31"},
+		{"2/29'24", "mdy", "2024-02-29"},
+		{"2024-02-29", "ymd", "2024-02-29"},
+	}
+	for _, tt := range tests {
+		if got, err := parseQIFDate(tt.value, tt.order); err != nil || got != tt.want {
+			t.Errorf("parseQIFDate(%q, %q) = %q, %v, want %q", tt.value, tt.order, got, err, tt.want)
+		}
+	}
+
+	for _, value := range []string{"2/29'23", "13/1'24", "1/5", ""} {
+		if _, err := parseQIFDate(value, "mdy"); err == nil {
+			t.Errorf("parseQIFDate(%q) accepted", value)
+		}
+	}
+}
+
+func TestQIFDateFormats(t *testing.T) {
+	for format, want := range map[string]string{"": "mdy", "MM/DD/YYYY": "mdy", "dd.mm.yy": "dmy", "YYYY-MM-DD": "ymd"} {
+		if got := qifDateOrder(format); got != want {
+			t.Errorf("qifDateOrder(%q) = %q, want %q", format, got, want)
+		}
+	}
+
+	tests := []struct {
+		values []string
+		want   string
+	}{
+		{[]string{"1/5'24", "2/7'24"}, "MM/DD/YYYY"},
+		{[]string{"1/5'24", "25/12'24"}, "DD/MM/YYYY"},
+		{[]string{"2024/01/05"}, "YYYY/MM/DD"},
+		{nil, "MM/DD/YYYY"},
+	}
+	for _, tt := range tests {
+		if got := suggestQIFDateFormat(tt.values); got != tt.want {
+			t.Errorf("suggestQIFDateFormat(%q) = %q, want %q", tt.values, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Package imports turns spreadsheet and bank exports into expense rows for
+// the batch pipeline. It does no database work; callers resolve categories
+// and insert the rows.
+package imports
+
+import (
+	"errors"
+	"fmt"
+	"go_template_v3/pkg/currency"
+	"go_template_v3/pkg/money"
+	"strings"
+	"time"
+)
+
+// Row is one expense ready for add_expense_v3
+type Row struct {
+	Title      string       `json:"title"`
+	Amount     money.Amount `json:"amount"`
+	CategoryId *int         `json:"categoryId,omitempty"`
+	Date       string       `json:"date,omitempty"`
+	Notes      string       `json:"notes,omitempty"`
+	Currency   string       `json:"currency,omitempty"`
+}
+
+// Payload returns the row as the JSON object add_expense_v3 expects
+func (r Row) Payload(userId int) map[string]interface{} {
+	payload := map[string]interface{}{
+		"userId": userId,
+		"title":  r.Title,
+		"amount": r.Amount,
+	}
+	if r.CategoryId != nil {
+		payload["categoryId"] = *r.CategoryId
+	}
+	if r.Date != "" {
+		payload["date"] = r.Date
+	}
+	if r.Notes != "" {
+		payload["notes"] = r.Notes
+	}
+	if r.Currency != "" {
+		payload["currency"] = r.Currency
+	}
+	return payload
+}
+
+// checkAmount rejects amounts with more decimals than the row's currency
+// allows
+func (r Row) checkAmount() error {
+	if r.Currency == "" {
+		return nil
+	}
+	return r.Amount.Check(r.Currency)
+}
+
+// ParseCurrency reads an ISO 4217 currency code, using fallback when the
+// value is empty
+func ParseCurrency(value, fallback string) (string, error) {
+	if strings.TrimSpace(value) == "" {
+		return fallback, nil
+	}
+	code, err := currency.Normalize(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid currency %q", value)
+	}
+	return code, nil
+}
+
+// DateLayout converts a user-facing date format such as DD/MM/YYYY into a
+// Go time layout. An empty format means YYYY-MM-DD.
+func DateLayout(format string) (string, error) {
+	if format == "" {
+		format = "YYYY-MM-DD"
+	}
+
+	format = strings.ToUpper(format)
+	if !strings.Contains(format, "YY") || !strings.Contains(format, "M") || !strings.Contains(format, "D") {
+		return "", errors.New("date format must contain year, month and day")
+	}
+
+	replacer := strings.NewReplacer("YYYY", "2006", "YY", "06", "MM", "01", "DD", "02", "M", "1", "D", "2")
+	return replacer.Replace(format), nil
+}
+
+// ParseDate reads a date in the given layout and returns it as YYYY-MM-DD
+func ParseDate(value, layout string) (string, error) {
+	parsed, err := time.Parse(layout, strings.TrimSpace(value))
+	if err != nil {
+		return "", errors.New("invalid date")
+	}
+	return parsed.Format("2006-01-02"), nil
+}
+
+// ParseAmount reads a money amount written with the given decimal separator
+// ("." or ","). The other separator, spaces and currency symbols are
+// ignored, and amounts in parentheses are negative.
+func ParseAmount(value, decimalSeparator string) (money.Amount, error) {
+	value = strings.TrimSpace(value)
+	if decimalSeparator == "" {
+		decimalSeparator = "."
+	}
+
+	negative := false
+	if strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") {
+		negative = true
+		value = value[1 : len(value)-1]
+	}
+
+	var b strings.Builder
+	for _, r := range value {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '-' || r == '+':
+			if b.Len() == 0 {
+				negative = negative || r == '-'
+			}
+		case string(r) == decimalSeparator:
+			b.WriteRune('.')
+		}
+	}
+
+	cleaned := b.String()
+	if cleaned == "" || strings.Count(cleaned, ".") > 1 {
+		return 0, errors.New("invalid amount")
+	}
+	amount, err := money.Parse(cleaned)
+	if err != nil {
+		return 0, errors.New("invalid amount")
+	}
+	if negative {
+		amount = -amount
+	}
+	return amount, nil
+}
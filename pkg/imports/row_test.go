@@ -0,0 +1,66 @@
+package imports
+
+import "testing"
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		value     string
+		separator string
+		want      string
+	}{
+		{"12.50", ".", "12.5"},
+		{"1,234.56", ".", "1234.56"},
+		{"1.234,56", ",", "1234.56"},
+		{"$ 99", "", "99"},
+		{"-4.20", ".", "-4.2"},
+		{"(15.00)", ".", "-15"},
+		{"€ -0,99", ",", "-0.99"},
+	}
+	for _, tt := range tests {
+		got, err := ParseAmount(tt.value, tt.separator)
+		if err != nil {
+			t.Errorf("ParseAmount(%q, %q) failed: %v", tt.value, tt.separator, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("ParseAmount(%q, %q) = %s, want %s", tt.value, tt.separator, got, tt.want)
+		}
+	}
+
+	for _, value := range []string{"", "abc", "1.2.3", "-"} {
+		if _, err := ParseAmount(value, "."); err == nil {
+			t.Errorf("ParseAmount(%q) accepted", value)
+		}
+	}
+}
+
+func TestDateLayout(t *testing.T) {
+	tests := []struct {
+		format string
+		value  string
+		want   string
+	}{
+		{"", "2024-02-29", "2024-02-29"},
+		{"DD/MM/YYYY", "29/02/2024", "2024-02-29"},
+		{"mm/dd/yyyy", "02/29/2024", "2024-02-29"},
+		{"D.M.YY", "1.2.24", "2024-02-01"},
+	}
+	for _, tt := range tests {
+		layout, err := DateLayout(tt.format)
+		if err != nil {
+			t.Errorf("DateLayout(%q) failed: %v", tt.format, err)
+			continue
+		}
+		if got, err := ParseDate(tt.value, layout); err != nil || got != tt.want {
+			t.Errorf("ParseDate(%q, %q) = %q, %v, want %q", tt.value, tt.format, got, err, tt.want)
+		}
+	}
+
+	if _, err := DateLayout("MM/YYYY"); err == nil {
+		t.Error("format without a day accepted")
+	}
+	layout, _ := DateLayout("YYYY-MM-DD")
+	if _, err := ParseDate("2023-02-29", layout); err == nil {
+		t.Error("29 February in a common year accepted")
+	}
+}
@@ -0,0 +1,150 @@
+package imports
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// File formats an import can be read from
+const (
+	FormatCSV = "csv"
+	FormatOFX = "ofx" // also QFX, which is OFX with Quicken extras
+	FormatQIF = "qif"
+)
+
+// Reader streams records from an import file. CSVReader, OFXReader and
+// QIFReader all return io.EOF after the last record.
+type Reader interface {
+	Next() (*Record, error)
+}
+
+// StatementHeaders are the columns of a bank statement record's Fields
+var StatementHeaders = []string{"date", "amount", "payee", "memo", "transactionId"}
+
+// DetectFormat tells the format of an upload from its name, falling back to
+// its first bytes
+func DetectFormat(filename string, head []byte) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".ofx", ".qfx":
+		return FormatOFX
+	case ".qif":
+		return FormatQIF
+	case ".csv", ".txt":
+		return FormatCSV
+	}
+
+	head = bytes.TrimSpace(bytes.TrimPrefix(head, []byte("\ufeff")))
+	upper := strings.ToUpper(string(head))
+	switch {
+	case strings.HasPrefix(upper, "OFXHEADER") || strings.Contains(upper, "<OFX>"):
+		return FormatOFX
+	case strings.HasPrefix(upper, "!TYPE:") || strings.HasPrefix(upper, "!ACCOUNT") || strings.HasPrefix(upper, "!OPTION"):
+		return FormatQIF
+	}
+	return FormatCSV
+}
+
+// NewStatementReader opens a bank statement in the given format
+func NewStatementReader(r io.Reader, format string, options Options) (Reader, error) {
+	if format == FormatQIF {
+		return NewQIFReader(r, options)
+	}
+	return NewOFXReader(r, options)
+}
+
+// PreviewStatement reads a bank statement the way PreviewCSV reads a CSV
+// file. Statements need no column mapping.
+func PreviewStatement(r io.Reader, format string, sampleSize int) (*Preview, error) {
+	reader, err := NewStatementReader(r, format, Options{})
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &Preview{
+		Headers:          StatementHeaders,
+		SampleRows:       [][]string{},
+		SuggestedMapping: Mapping{},
+	}
+	dates := []string{}
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		preview.RowCount++
+		if len(preview.SampleRows) < sampleSize {
+			preview.SampleRows = append(preview.SampleRows, record.Fields)
+			dates = append(dates, record.Fields[0])
+		}
+	}
+
+	if format == FormatQIF {
+		preview.SuggestedDateFormat = suggestQIFDateFormat(dates)
+	}
+	return preview, nil
+}
+
+// statementRecord turns a bank transaction into a record. Only debits are
+// expenses, so credits return nil and are left out of the import.
+func statementRecord(line int, date, amount, payee, memo, account, externalId string, decimalSeparator string) *Record {
+	value, err := ParseAmount(amount, decimalSeparator)
+	if err == nil && value >= 0 {
+		return nil
+	}
+
+	record := &Record{
+		Line:       line,
+		Fields:     []string{date, amount, payee, memo, externalId},
+		Account:    account,
+		ExternalId: externalId,
+	}
+	if err != nil {
+		record.Err = err
+		return record
+	}
+
+	title := payee
+	notes := memo
+	if title == "" {
+		title, notes = memo, ""
+	}
+	if title == "" {
+		record.Err = errors.New("transaction has no payee or memo")
+		return record
+	}
+
+	record.Row = &Row{Title: title, Amount: -value, Notes: notes}
+	return record
+}
+
+// syntheticId identifies a transaction whose bank gave it no ID by its
+// content, numbered so identical transactions in one file stay distinct
+func syntheticId(seen map[string]int, parts ...string) string {
+	sum := sha1.Sum([]byte(strings.Join(parts, "\x1f")))
+	key := hex.EncodeToString(sum[:])
+	seen[key]++
+	return "sha1:" + key + ":" + strconv.Itoa(seen[key])
+}
+
+// toUTF8 reads older single-byte bank exports as Latin-1 when they are not
+// valid UTF-8
+func toUTF8(value string) string {
+	if utf8.ValidString(value) {
+		return value
+	}
+	runes := make([]rune, len(value))
+	for i := 0; i < len(value); i++ {
+		runes[i] = rune(value[i])
+	}
+	return string(runes)
+}
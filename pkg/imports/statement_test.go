@@ -0,0 +1,93 @@
+package imports
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		filename string
+		head     string
+		want     string
+	}{
+		{"statement.OFX", "", FormatOFX},
+		{"statement.qfx", "", FormatOFX},
+		{"register.qif", "", FormatQIF},
+		{"expenses.csv", "OFXHEADER:100", FormatCSV},
+		{"download", "\ufeff  OFXHEADER:100\nDATA:OFXSGML", FormatOFX},
+		{"download", "<?xml version=\"1.0\"?>\n<?OFX OFXHEADER=\"200\"?>\n<OFX>", FormatOFX},
+		{"download", "!Type:Bank\nD01/05/2024", FormatQIF},
+		{"download", "!Account\nNChecking", FormatQIF},
+		{"download", "title,amount\nLunch,10", FormatCSV},
+	}
+	for _, tt := range tests {
+		if got := DetectFormat(tt.filename, []byte(tt.head)); got != tt.want {
+			t.Errorf("DetectFormat(%q, %q) = %q, want %q", tt.filename, tt.head, got, tt.want)
+		}
+	}
+}
+
+func TestStatementRecord(t *testing.T) {
+	// Credits are not expenses
+	if record := statementRecord(1, "2024-01-01", "25.00", "Salary", "", "", "1", "."); record != nil {
+		t.Errorf("credit gave %+v", record)
+	}
+
+	record := statementRecord(2, "2024-01-02", "-12.50", "", "Card payment", "acct", "2", ".")
+	if record.Err != nil {
+		t.Fatal(record.Err)
+	}
+	if record.Row.Title != "Card payment" || record.Row.Notes != "" || record.Row.Amount.String() != "12.5" {
+		t.Errorf("memo-only debit gave %+v", record.Row)
+	}
+
+	if record := statementRecord(3, "2024-01-03", "-1", "", "", "acct", "3", "."); record.Err == nil {
+		t.Error("debit without a payee or memo accepted")
+	}
+	if record := statementRecord(4, "2024-01-04", "lots", "Shop", "", "acct", "4", "."); record.Err == nil {
+		t.Error("bad amount accepted")
+	}
+}
+
+func TestSyntheticId(t *testing.T) {
+	seen := map[string]int{}
+	first := syntheticId(seen, "acct", "20240101", "-5", "Coffee")
+	second := syntheticId(seen, "acct", "20240101", "-5", "Coffee")
+	other := syntheticId(map[string]int{}, "acct", "20240101", "-5", "Coffee")
+
+	// Identical transactions in one file are numbered apart, and the same
+	// file read again gives the same IDs
+	if first == second {
+		t.Error("identical transactions got the same ID")
+	}
+	if first != other {
+		t.Errorf("the same transaction got %q and %q", first, other)
+	}
+}
+
+func TestPreviewStatement(t *testing.T) {
+	file := "!Type:Bank\n" +
+		"D25/12/2023\nT-40.00\nPGifts\n^\n" +
+		"D26/12/2023\nT100.00\nPRefund\n^\n" +
+		"D27/12/2023\nT-3.20\nPBakery\n^\n"
+
+	preview, err := PreviewStatement(strings.NewReader(file), FormatQIF, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(preview.Headers, StatementHeaders) {
+		t.Errorf("headers = %q", preview.Headers)
+	}
+	// The credit is not counted
+	if preview.RowCount != 2 {
+		t.Errorf("row count = %d, want 2", preview.RowCount)
+	}
+	if len(preview.SampleRows) != 1 || preview.SampleRows[0][2] != "Gifts" {
+		t.Errorf("sample rows = %q", preview.SampleRows)
+	}
+	if preview.SuggestedDateFormat != "DD/MM/YYYY" {
+		t.Errorf("suggested date format = %q, want DD/MM/YYYY", preview.SuggestedDateFormat)
+	}
+}
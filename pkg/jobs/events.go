@@ -0,0 +1,161 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go_template_v3/pkg/config"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/gorm"
+)
+
+// Job events are broadcast with Postgres NOTIFY so a client can follow a job
+// from any instance, not only the one running it
+const eventsChannel = "batch_job_events"
+
+// NOTIFY payloads are limited to 8000 bytes
+const maxEventPayload = 7900
+
+// Event types sent to subscribers
+const (
+	EventProgress = "progress"
+	EventFailure  = "failure"
+	EventStatus   = "status"
+)
+
+// Event is one change to a job
+type Event struct {
+	JobId           int                    `json:"jobId"`
+	Type            string                 `json:"type"`
+	Status          string                 `json:"status,omitempty"`
+	TotalItems      int                    `json:"totalItems"`
+	ProcessedItems  int                    `json:"processedItems"`
+	SuccessfulItems int                    `json:"successfulItems"`
+	FailedItems     int                    `json:"failedItems"`
+	Failure         map[string]interface{} `json:"failure,omitempty"`
+}
+
+// IsFinalStatus reports whether a job in this status will not change again
+func IsFinalStatus(status string) bool {
+	return status == "completed" || status == "failed" || status == "cancelled"
+}
+
+var (
+	subscribersMutex sync.Mutex
+	subscribers      = map[int]map[chan Event]struct{}{}
+	listenOnce       sync.Once
+)
+
+// Subscribe returns a channel of events for one job and a function that
+// must be called to stop receiving them. Events are dropped rather than
+// block when the subscriber falls behind.
+func Subscribe(jobId int) (<-chan Event, func()) {
+	listenOnce.Do(func() { go listen() })
+
+	ch := make(chan Event, 64)
+	subscribersMutex.Lock()
+	if subscribers[jobId] == nil {
+		subscribers[jobId] = map[chan Event]struct{}{}
+	}
+	subscribers[jobId][ch] = struct{}{}
+	subscribersMutex.Unlock()
+
+	return ch, func() {
+		subscribersMutex.Lock()
+		defer subscribersMutex.Unlock()
+		delete(subscribers[jobId], ch)
+		if len(subscribers[jobId]) == 0 {
+			delete(subscribers, jobId)
+		}
+	}
+}
+
+func publish(event Event) {
+	notify(&config.DBConnList[0], event)
+}
+
+// notify sends an event on db. Inside a transaction Postgres holds the
+// notification until commit and drops it on rollback.
+func notify(db *gorm.DB, event Event) {
+	payload, err := json.Marshal(event)
+	if err == nil && len(payload) > maxEventPayload && event.Failure != nil {
+		// Keep the event, without details too large to send
+		event.Failure = map[string]interface{}{"index": event.Failure["index"], "message": "details too large to stream"}
+		payload, err = json.Marshal(event)
+	}
+	if err != nil {
+		log.Printf("Error encoding event for job %d: %v", event.JobId, err)
+		return
+	}
+
+	if err := db.Exec("SELECT pg_notify(?, ?)", eventsChannel, string(payload)).Error; err != nil {
+		log.Printf("Error publishing event for job %d: %v", event.JobId, err)
+	}
+}
+
+func dispatch(payload string) {
+	var event Event
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		return
+	}
+
+	subscribersMutex.Lock()
+	defer subscribersMutex.Unlock()
+	for ch := range subscribers[event.JobId] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// listen holds one connection on LISTEN for the life of the process,
+// reconnecting after errors
+func listen() {
+	for {
+		if err := listenConn(); err != nil {
+			log.Printf("Job event listener stopped: %v", err)
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+func listenConn() error {
+	ctx := context.Background()
+
+	sqlDB, err := config.DBConnList[0].DB()
+	if err != nil {
+		return err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		conn.ExecContext(ctx, "UNLISTEN *")
+		conn.Close()
+	}()
+
+	if _, err := conn.ExecContext(ctx, "LISTEN "+eventsChannel); err != nil {
+		return err
+	}
+
+	return conn.Raw(func(driverConn interface{}) error {
+		stdConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("LISTEN needs a pgx connection, got %T", driverConn)
+		}
+		pgxConn := stdConn.Conn()
+		for {
+			notification, err := pgxConn.WaitForNotification(ctx)
+			if err != nil {
+				return err
+			}
+			dispatch(notification.Payload)
+		}
+	})
+}
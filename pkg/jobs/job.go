@@ -0,0 +1,222 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"go_template_v3/pkg/config"
+	"go_template_v3/pkg/global/utils"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Job is a claimed row of batch_jobs. Counters and results are loaded from
+// the row, so a job resumed after a restart continues from ProcessedItems.
+type Job struct {
+	Id              int
+	UserId          int
+	JobType         string
+	Payload         json.RawMessage
+	TotalItems      int
+	ProcessedItems  int
+	SuccessfulItems int
+	FailedItems     int
+	Results         []map[string]interface{}
+}
+
+// Handler processes one job. It should start at job.ProcessedItems, call
+// CheckCancelled and Throttle before each item and ItemDone after it (or
+// ItemsDoneTx after each chunk), and return their errors as they are.
+type Handler func(ctx context.Context, job *Job) error
+
+// ErrCancelled is returned by CheckCancelled once a user has asked for the
+// job to stop
+var ErrCancelled = errors.New("job cancelled")
+
+// DecodePayload unmarshals the payload stored when the job was enqueued.
+// Numbers decoded into interface{} values are json.Number rather than
+// float64, so amounts keep every digit.
+func (j *Job) DecodePayload(v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(j.Payload))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// ItemDone records the outcome of the next item and saves progress. Pass
+// nil for a success, or the details of a failure to keep in results.
+func (j *Job) ItemDone(failure map[string]interface{}) {
+	j.ProcessedItems++
+	if failure == nil {
+		j.SuccessfulItems++
+	} else {
+		j.FailedItems++
+		j.Results = append(j.Results, failure)
+		j.publish(EventFailure, "", failure)
+	}
+	j.saveProgress("")
+}
+
+// CheckCancelled returns ErrCancelled when cancellation was requested, so
+// handlers stop cleanly between items
+func (j *Job) CheckCancelled() error {
+	var requested bool
+	err := config.DBConnList[0].Raw(
+		"SELECT cancel_requested_at IS NOT NULL FROM batch_jobs WHERE id = ?",
+		j.Id,
+	).Scan(&requested).Error
+	if err != nil {
+		log.Printf("Error checking cancellation of job %d: %v", j.Id, err)
+		return nil
+	}
+	if requested {
+		return ErrCancelled
+	}
+	return nil
+}
+
+// Throttle waits until the job type's rate limit allows another item
+func (j *Job) Throttle(ctx context.Context) error {
+	return throttleFor(j.JobType).wait(ctx)
+}
+
+// ItemsDoneTx records a chunk of items inside the caller's transaction, so
+// the chunk and the progress covering it commit together and a resumed job
+// never repeats them. The progress event is only delivered on commit. If
+// the transaction rolls back the handler must return an error, since the
+// counters here already include the chunk.
+func (j *Job) ItemsDoneTx(tx *gorm.DB, successful, failed int) error {
+	j.ProcessedItems += successful + failed
+	j.SuccessfulItems += successful
+	j.FailedItems += failed
+	if err := j.saveProgressTx(tx, ""); err != nil {
+		return err
+	}
+	notify(tx, j.event(EventProgress, "", nil))
+	return nil
+}
+
+// saveProgress writes counters and results, with a new status when given
+func (j *Job) saveProgress(status string) {
+	if err := j.saveProgressTx(&config.DBConnList[0], status); err != nil {
+		log.Printf("Error updating progress for job %d: %v", j.Id, err)
+		return
+	}
+
+	if status == "" {
+		j.publish(EventProgress, "", nil)
+	} else {
+		j.publish(EventStatus, status, nil)
+	}
+}
+
+func (j *Job) saveProgressTx(tx *gorm.DB, status string) error {
+	results := j.Results
+	if results == nil {
+		results = []map[string]interface{}{}
+	}
+	resultsJSON, _ := json.Marshal(results)
+
+	var statusArg interface{}
+	if status != "" {
+		statusArg = status
+	}
+
+	return tx.Exec(
+		"SELECT update_batch_job_progress($1, $2, $3, $4, $5, $6)",
+		j.Id,
+		statusArg,
+		j.ProcessedItems,
+		j.SuccessfulItems,
+		j.FailedItems,
+		string(resultsJSON),
+	).Error
+}
+
+func (j *Job) publish(eventType, status string, failure map[string]interface{}) {
+	publish(j.event(eventType, status, failure))
+}
+
+func (j *Job) event(eventType, status string, failure map[string]interface{}) Event {
+	return Event{
+		JobId:           j.Id,
+		Type:            eventType,
+		Status:          status,
+		TotalItems:      j.TotalItems,
+		ProcessedItems:  j.ProcessedItems,
+		SuccessfulItems: j.SuccessfulItems,
+		FailedItems:     j.FailedItems,
+		Failure:         failure,
+	}
+}
+
+// heartbeat refreshes the lock so the job is not taken for abandoned
+func (j *Job) heartbeat() {
+	err := config.DBConnList[0].Exec(
+		"UPDATE batch_jobs SET locked_at = NOW() WHERE id = ? AND locked_by = ?",
+		j.Id, workerId,
+	).Error
+	if err != nil {
+		log.Printf("Error refreshing lock for job %d: %v", j.Id, err)
+	}
+}
+
+// throttle spaces items of one job type evenly across every worker
+type throttle struct {
+	mutex    sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+var (
+	throttlesMutex sync.Mutex
+	throttles      = map[string]*throttle{}
+)
+
+// throttleFor returns the limiter for a job type. The interval comes from
+// JOB_THROTTLE_MS_<JOB_TYPE>, falling back to JOB_THROTTLE_MS, and 0 means
+// no limit.
+func throttleFor(jobType string) *throttle {
+	throttlesMutex.Lock()
+	defer throttlesMutex.Unlock()
+
+	if t, ok := throttles[jobType]; ok {
+		return t
+	}
+
+	ms := utils.EnvInt("JOB_THROTTLE_MS_"+strings.ToUpper(jobType), -1, 0)
+	if ms < 0 {
+		ms = utils.EnvInt("JOB_THROTTLE_MS", 0, 0)
+	}
+	t := &throttle{interval: time.Duration(ms) * time.Millisecond}
+	throttles[jobType] = t
+	return t
+}
+
+func (t *throttle) wait(ctx context.Context) error {
+	if t.interval <= 0 {
+		return ctx.Err()
+	}
+
+	t.mutex.Lock()
+	now := time.Now()
+	at := t.next
+	if at.Before(now) {
+		at = now
+	}
+	t.next = at.Add(t.interval)
+	t.mutex.Unlock()
+
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,123 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestThrottleSpacesItems(t *testing.T) {
+	th := &throttle{interval: 20 * time.Millisecond}
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := th.wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The first item goes at once, each later one waits an interval
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("4 items took %v, want at least 60ms", elapsed)
+	}
+}
+
+func TestThrottleWithoutLimit(t *testing.T) {
+	th := &throttle{}
+
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		if err := th.wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("unthrottled items took %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := th.wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("wait on a cancelled context returned %v, want context.Canceled", err)
+	}
+}
+
+func TestThrottleStopsOnCancel(t *testing.T) {
+	th := &throttle{interval: time.Hour}
+	th.wait(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := th.wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wait returned %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestThrottleForReadsJobTypeSetting(t *testing.T) {
+	t.Setenv("JOB_THROTTLE_MS", "5")
+	t.Setenv("JOB_THROTTLE_MS_TEST_SLOW", "250")
+	t.Setenv("JOB_THROTTLE_MS_TEST_OFF", "0")
+	t.Cleanup(func() {
+		throttlesMutex.Lock()
+		defer throttlesMutex.Unlock()
+		delete(throttles, "test_slow")
+		delete(throttles, "test_default")
+		delete(throttles, "test_off")
+	})
+
+	if got := throttleFor("test_slow").interval; got != 250*time.Millisecond {
+		t.Errorf("per-type interval = %v, want 250ms", got)
+	}
+	if got := throttleFor("test_default").interval; got != 5*time.Millisecond {
+		t.Errorf("fallback interval = %v, want 5ms", got)
+	}
+	if got := throttleFor("test_off").interval; got != 0 {
+		t.Errorf("per-type 0 gave %v, want no throttle", got)
+	}
+	if throttleFor("test_slow") != throttleFor("test_slow") {
+		t.Error("a job type should share one throttle across workers")
+	}
+}
+
+func TestClaimWithoutHandlers(t *testing.T) {
+	// Nothing is claimed, and the database is not touched, until a job type
+	// has a handler
+	job, err := claim()
+	if job != nil || err != nil {
+		t.Errorf("claim() = %v, %v, want nothing", job, err)
+	}
+}
+
+func TestDecodePayload(t *testing.T) {
+	job := &Job{Payload: json.RawMessage(`{"format":"csv","ids":[1,2]}`)}
+
+	var payload struct {
+		Format string `json:"format"`
+		Ids    []int  `json:"ids"`
+	}
+	if err := job.DecodePayload(&payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Format != "csv" || len(payload.Ids) != 2 {
+		t.Errorf("decoded %+v", payload)
+	}
+}
+
+func TestDecodePayloadKeepsNumbersExact(t *testing.T) {
+	job := &Job{Payload: json.RawMessage(`[{"expenseId":7,"amount":12345678901234.5678}]`)}
+
+	var items []map[string]interface{}
+	if err := job.DecodePayload(&items); err != nil {
+		t.Fatal(err)
+	}
+	amount, ok := items[0]["amount"].(json.Number)
+	if !ok || amount.String() != "12345678901234.5678" {
+		t.Errorf("amount decoded as %#v", items[0]["amount"])
+	}
+	if id, ok := items[0]["expenseId"].(json.Number); !ok || id.String() != "7" {
+		t.Errorf("expense ID decoded as %#v", items[0]["expenseId"])
+	}
+}
@@ -0,0 +1,342 @@
+// Package jobs runs batch_jobs rows on a bounded pool of workers.
+//
+// Jobs are enqueued as pending rows with a JSON payload and claimed with
+// SELECT ... FOR UPDATE SKIP LOCKED, so several app instances can share the
+// table. A running job refreshes locked_at while it runs; jobs whose lock
+// goes stale (their process died) are put back to pending and resumed from
+// processed_items.
+//
+// The queue relies on these batch_jobs columns besides the ones
+// create_batch_job fills: payload jsonb, locked_by text, locked_at
+// timestamptz, cancel_requested_at timestamptz.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go_template_v3/pkg/config"
+	"go_template_v3/pkg/global/utils"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	utils_v1 "github.com/FDSAP-Git-Org/hephaestus/utils/v1"
+	"gorm.io/gorm"
+)
+
+var (
+	handlersMutex sync.RWMutex
+	handlers      = map[string]Handler{}
+
+	// wake nudges idle workers when a job is enqueued by this process
+	wake = make(chan struct{}, 1)
+
+	finishHooks []FinishFunc
+
+	// workerId identifies this instance in locked_by. It must be unique per
+	// running instance and stable across restarts (JOB_WORKER_ID, defaults to
+	// the hostname) so a restarted instance can resume its own jobs at once.
+	workerId string
+)
+
+// Register sets the handler for a job type. Call it before Start.
+func Register(jobType string, handler Handler) {
+	handlersMutex.Lock()
+	defer handlersMutex.Unlock()
+	handlers[jobType] = handler
+}
+
+// FinishFunc is told how a job ended: completed, failed or cancelled
+type FinishFunc func(job *Job, status string)
+
+// OnFinish adds a function called after a worker finishes a job. Hooks run
+// on the worker, so they should only record work to do elsewhere. Call it
+// before Start.
+func OnFinish(hook FinishFunc) {
+	handlersMutex.Lock()
+	defer handlersMutex.Unlock()
+	finishHooks = append(finishHooks, hook)
+}
+
+// Enqueue creates a pending job and returns its ID
+func Enqueue(userId int, jobType string, totalItems int, payload interface{}) (int, error) {
+	var jobId int
+	var err error
+	err = config.DBConnList[0].Transaction(func(tx *gorm.DB) error {
+		jobId, err = EnqueueTx(tx, userId, jobType, totalItems, payload)
+		return err
+	})
+	return jobId, err
+}
+
+// EnqueueTx creates a pending job inside the caller's transaction, so it
+// only becomes visible to workers if that transaction commits
+func EnqueueTx(tx *gorm.DB, userId int, jobType string, totalItems int, payload interface{}) (int, error) {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	var jobId int
+	err = tx.Raw("SELECT create_batch_job($1, $2, $3)", userId, jobType, totalItems).Scan(&jobId).Error
+	if err != nil {
+		return 0, err
+	}
+	err = tx.Exec("UPDATE batch_jobs SET payload = ? WHERE id = ?", string(payloadJSON), jobId).Error
+	if err != nil {
+		return 0, err
+	}
+
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+	return jobId, nil
+}
+
+// Start requeues abandoned jobs and launches JOB_WORKERS workers (default
+// 4) that run until ctx is cancelled
+func Start(ctx context.Context) {
+	workerId = utils_v1.GetEnv("JOB_WORKER_ID")
+	if workerId == "" {
+		workerId, _ = os.Hostname()
+	}
+
+	workers := utils.EnvInt("JOB_WORKERS", 4, 1)
+	if workers == 0 {
+		fmt.Println("JOB WORKERS: DISABLED")
+		return
+	}
+
+	requeueAbandoned(true)
+
+	for i := 0; i < workers; i++ {
+		go work(ctx)
+	}
+	go watchAbandoned(ctx)
+
+	fmt.Printf("JOB WORKERS: %d (%s)\n", workers, workerId)
+}
+
+func work(ctx context.Context) {
+	pollInterval := time.Duration(utils.EnvInt("JOB_POLL_SECONDS", 2, 1)) * time.Second
+	if pollInterval <= 0 {
+		pollInterval = time.Second
+	}
+
+	for {
+		job, err := claim()
+		if err != nil {
+			log.Printf("Error claiming job: %v", err)
+		}
+		if job != nil {
+			run(ctx, job)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// claim takes the oldest pending job of a registered type
+func claim() (*Job, error) {
+	handlersMutex.RLock()
+	jobTypes := make([]string, 0, len(handlers))
+	for jobType := range handlers {
+		jobTypes = append(jobTypes, jobType)
+	}
+	handlersMutex.RUnlock()
+	if len(jobTypes) == 0 {
+		return nil, nil
+	}
+
+	var row struct {
+		Id              int
+		UserId          int
+		JobType         string
+		Payload         *string
+		TotalItems      int
+		ProcessedItems  int
+		SuccessfulItems int
+		FailedItems     int
+		Results         *string
+	}
+	err := config.DBConnList[0].Raw(`
+		UPDATE batch_jobs SET status = 'processing', locked_by = ?, locked_at = NOW(), updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM batch_jobs
+			WHERE status = 'pending' AND job_type IN ?
+			ORDER BY id
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING id, user_id, job_type, payload, total_items, processed_items, successful_items, failed_items, results
+	`, workerId, jobTypes).Scan(&row).Error
+	if err != nil || row.Id == 0 {
+		return nil, err
+	}
+
+	job := &Job{
+		Id:              row.Id,
+		UserId:          row.UserId,
+		JobType:         row.JobType,
+		TotalItems:      row.TotalItems,
+		ProcessedItems:  row.ProcessedItems,
+		SuccessfulItems: row.SuccessfulItems,
+		FailedItems:     row.FailedItems,
+	}
+	if row.Payload != nil {
+		job.Payload = json.RawMessage(*row.Payload)
+	}
+	if row.Results != nil {
+		json.Unmarshal([]byte(*row.Results), &job.Results)
+	}
+	job.publish(EventStatus, "processing", nil)
+	return job, nil
+}
+
+// run executes a claimed job and records how it ended
+func run(ctx context.Context, job *Job) {
+	handlersMutex.RLock()
+	handler := handlers[job.JobType]
+	handlersMutex.RUnlock()
+
+	// Keep the lock fresh even when a single item is slow
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(heartbeatInterval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				job.heartbeat()
+			}
+		}
+	}()
+
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("job panicked: %v", r)
+			}
+		}()
+		return handler(ctx, job)
+	}()
+
+	var status string
+	switch {
+	case errors.Is(err, ErrCancelled):
+		status = "cancelled"
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		// Shutting down, leave it for the next worker to resume
+		release(job.Id)
+		return
+	case err != nil:
+		log.Printf("Job %d (%s) failed: %v", job.Id, job.JobType, err)
+		job.Results = append(job.Results, map[string]interface{}{"message": err.Error()})
+		status = "failed"
+	case job.TotalItems > 0 && job.FailedItems == job.TotalItems:
+		status = "failed"
+	default:
+		status = "completed"
+	}
+	job.saveProgress(status)
+
+	handlersMutex.RLock()
+	hooks := finishHooks
+	handlersMutex.RUnlock()
+	for _, hook := range hooks {
+		hook(job, status)
+	}
+}
+
+// Cancel stops a user's job. Pending jobs are cancelled at once; running
+// jobs are flagged and stop at their next CheckCancelled. It returns the
+// job's status afterwards, or "" when there is no such unfinished job.
+func Cancel(jobId, userId int) (string, error) {
+	var status string
+	err := config.DBConnList[0].Raw(`
+		UPDATE batch_jobs SET
+			cancel_requested_at = COALESCE(cancel_requested_at, NOW()),
+			status = CASE WHEN status = 'pending' THEN 'cancelled' ELSE status END,
+			completed_at = CASE WHEN status = 'pending' THEN NOW() ELSE completed_at END,
+			updated_at = NOW()
+		WHERE id = ? AND user_id = ? AND status IN ('pending', 'processing')
+		RETURNING status
+	`, jobId, userId).Scan(&status).Error
+	if status == "cancelled" {
+		publish(Event{JobId: jobId, Type: EventStatus, Status: status})
+	}
+	return status, err
+}
+
+func staleSeconds() int {
+	stale := utils.EnvInt("JOB_STALE_SECONDS", 120, 1)
+	if stale < 30 {
+		stale = 30
+	}
+	return stale
+}
+
+func heartbeatInterval() time.Duration {
+	return time.Duration(staleSeconds()) * time.Second / 4
+}
+
+func release(jobId int) {
+	err := config.DBConnList[0].Exec(
+		"UPDATE batch_jobs SET status = 'pending', locked_by = NULL, locked_at = NULL WHERE id = ? AND locked_by = ?",
+		jobId, workerId,
+	).Error
+	if err != nil {
+		log.Printf("Error releasing job %d: %v", jobId, err)
+	}
+}
+
+// requeueAbandoned puts processing jobs whose worker is gone back to
+// pending. Locks older than JOB_STALE_SECONDS (default 120) are abandoned;
+// on startup so are locks still held under this instance's worker ID.
+func requeueAbandoned(startup bool) {
+	query := `
+		UPDATE batch_jobs SET status = 'pending', locked_by = NULL, locked_at = NULL
+		WHERE status = 'processing'
+		  AND (locked_at IS NULL OR locked_at < NOW() - make_interval(secs => ?)`
+	args := []interface{}{staleSeconds()}
+	if startup {
+		query += ` OR locked_by = ?`
+		args = append(args, workerId)
+	}
+	query += `)`
+
+	result := config.DBConnList[0].Exec(query, args...)
+	if result.Error != nil {
+		log.Printf("Error requeueing abandoned jobs: %v", result.Error)
+		return
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Requeued %d abandoned job(s)", result.RowsAffected)
+	}
+}
+
+func watchAbandoned(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			requeueAbandoned(false)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"go_template_v3/pkg/global/utils"
 	"net/http"
 	"strings"
 
@@ -8,10 +9,14 @@ import (
 	"github.com/FDSAP-Git-Org/hephaestus/respcode"
 	utils_v1 "github.com/FDSAP-Git-Org/hephaestus/utils/v1"
 	"github.com/gofiber/fiber/v3"
-	"github.com/golang-jwt/jwt/v4"
 )
 
 func AuthMiddleware(c fiber.Ctx) error {
+	// Machine clients authenticate with a personal API key instead of a JWT
+	if apiKey := c.Get("X-API-Key"); apiKey != "" {
+		return apiKeyAuth(c, apiKey)
+	}
+
 	authHeader := c.Get("Authorization")
 	if authHeader == "" {
 		return v1.JSONResponseWithError(c, respcode.ERR_CODE_401,
@@ -25,20 +30,91 @@ func AuthMiddleware(c fiber.Ctx) error {
 	}
 
 	// Parse and validate JWT
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return []byte(utils_v1.GetEnv("JWT_SECRET")), nil
-	})
-
-	if err != nil || !token.Valid {
+	claims, err := utils.ParseToken(tokenString, utils.TokenTypeAccess)
+	if err != nil {
 		return v1.JSONResponseWithError(c, respcode.ERR_CODE_401,
 			"Invalid or expired token", err, http.StatusUnauthorized)
 	}
 
-	// Extract claims and store user info in context
-	if claims, ok := token.Claims.(jwt.MapClaims); ok {
-		c.Locals("userId", claims["body"].(map[string]interface{})["userId"])
-		c.Locals("email", claims["body"].(map[string]interface{})["email"])
+	// Reject tokens revoked through logout
+	revoked, err := utils.IsTokenRevoked(claims.ID)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500,
+			"Failed to validate token", err, http.StatusInternalServerError)
+	}
+	if revoked {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_401,
+			"Token has been revoked", nil, http.StatusUnauthorized)
+	}
+
+	// Reject tokens whose session was ended
+	sessionId, _ := claims.Body["sessionId"].(float64)
+	active, err := utils.IsSessionActive(int(sessionId))
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500,
+			"Failed to validate session", err, http.StatusInternalServerError)
+	}
+	if !active {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_401,
+			"Session has been revoked", nil, http.StatusUnauthorized)
+	}
+
+	// Optionally keep unverified accounts out of protected routes
+	if verified, _ := claims.Body["emailVerified"].(bool); !verified && emailVerificationRequired() {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_403,
+			"Email address has not been verified", nil, http.StatusForbidden)
 	}
 
+	// Store user info in context
+	c.Locals("userId", claims.Body["userId"])
+	c.Locals("email", claims.Body["email"])
+	c.Locals("roles", claims.Body["roles"])
+	c.Locals("permissions", claims.Body["permissions"])
+	c.Locals("tokenId", claims.ID)
+	c.Locals("tokenExpiresAt", claims.ExpiresAt)
+	c.Locals("sessionId", int(sessionId))
+	c.Locals("authMethod", "token")
+
+	return c.Next()
+}
+
+func apiKeyAuth(c fiber.Ctx, apiKey string) error {
+	identity, err := utils.AuthenticateAPIKey(apiKey)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500,
+			"Failed to validate API key", err, http.StatusInternalServerError)
+	}
+	if identity == nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_401,
+			"Invalid or revoked API key", nil, http.StatusUnauthorized)
+	}
+	if !identity.EmailVerified && emailVerificationRequired() {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_403,
+			"Email address has not been verified", nil, http.StatusForbidden)
+	}
+
+	c.Locals("userId", identity.UserId)
+	c.Locals("email", identity.Email)
+	c.Locals("roles", identity.Roles)
+	c.Locals("permissions", identity.Permissions)
+	c.Locals("apiKeyId", identity.KeyId)
+	c.Locals("authMethod", "api_key")
+
+	return c.Next()
+}
+
+// emailVerificationRequired reports whether unverified accounts are kept out
+// of protected routes, whichever way they authenticate
+func emailVerificationRequired() bool {
+	return strings.ToUpper(utils_v1.GetEnv("REQUIRE_EMAIL_VERIFICATION")) == "ENABLED"
+}
+
+// RequireTokenAuth blocks API keys from routes that manage the account
+// itself, such as creating more keys. It must run after AuthMiddleware.
+func RequireTokenAuth(c fiber.Ctx) error {
+	if c.Locals("authMethod") != "token" {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_403,
+			"This endpoint requires a user login", nil, http.StatusForbidden)
+	}
 	return c.Next()
 }
@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"go_template_v3/pkg/global/utils"
+	"net/http"
+
+	v1 "github.com/FDSAP-Git-Org/hephaestus/helper/v1"
+	"github.com/FDSAP-Git-Org/hephaestus/respcode"
+	"github.com/gofiber/fiber/v3"
+)
+
+// RequirePermission only lets callers through whose token carries the given
+// permission. It must run after AuthMiddleware.
+func RequirePermission(permission string) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		if !utils.HasPermission(utils.GetUserPermissions(c), permission) {
+			return v1.JSONResponseWithError(c, respcode.ERR_CODE_403,
+				"Insufficient permissions", nil, http.StatusForbidden)
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,273 @@
+// Package money holds amounts as exact decimals instead of float64.
+//
+// An Amount is a whole number of ten-thousandths. That covers the minor
+// units of every currency with a digit to spare, so sums and comparisons
+// never drift. Amounts are read and written as plain decimal text: JSON
+// numbers, query strings, CSV cells and numeric columns. Each currency
+// then rounds to its own number of decimals with Round.
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"go_template_v3/pkg/currency"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Scale is the number of decimal places an Amount keeps
+const Scale = 4
+
+const (
+	unit = 10000
+	// maxIntegerDigits keeps amounts well inside int64
+	maxIntegerDigits = 14
+)
+
+var (
+	errInvalid   = errors.New("amount must be a decimal number")
+	errPrecision = fmt.Errorf("amount must not have more than %d decimal places", Scale)
+	errTooLarge  = errors.New("amount is too large")
+)
+
+// Amount is an exact decimal amount in ten-thousandths
+type Amount int64
+
+// Parse reads a decimal such as "12.5", "-3" or ".75". More than Scale
+// decimal places is an error, so nothing is silently rounded away.
+func Parse(value string) (Amount, error) {
+	return parse(value, false)
+}
+
+// ParseRound reads a decimal like Parse, rounding extra decimal places half
+// away from zero. It is for values the database computed, such as
+// converted sums.
+func ParseRound(value string) (Amount, error) {
+	return parse(value, true)
+}
+
+func parse(value string, round bool) (Amount, error) {
+	value = strings.TrimSpace(value)
+	negative := false
+	if strings.HasPrefix(value, "-") || strings.HasPrefix(value, "+") {
+		negative = value[0] == '-'
+		value = value[1:]
+	}
+
+	whole, fraction, _ := strings.Cut(value, ".")
+	if whole == "" && fraction == "" || !digits(whole) || !digits(fraction) {
+		return 0, errInvalid
+	}
+	whole = strings.TrimLeft(whole, "0")
+	if len(whole) > maxIntegerDigits {
+		return 0, errTooLarge
+	}
+
+	roundUp := false
+	if len(fraction) > Scale {
+		if !round && strings.TrimRight(fraction[Scale:], "0") != "" {
+			return 0, errPrecision
+		}
+		roundUp = fraction[Scale] >= '5'
+		fraction = fraction[:Scale]
+	}
+	fraction += strings.Repeat("0", Scale-len(fraction))
+
+	units, _ := strconv.ParseInt(whole+fraction, 10, 64)
+	if roundUp {
+		units++
+	}
+	if negative {
+		units = -units
+	}
+	return Amount(units), nil
+}
+
+func digits(value string) bool {
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// FromFloat converts a float64, such as a number decoded from JSON into an
+// interface{}, using its shortest decimal form
+func FromFloat(value float64) (Amount, error) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, errInvalid
+	}
+	return parse(strconv.FormatFloat(value, 'f', -1, 64), false)
+}
+
+// FromValue reads an amount decoded from JSON as a number, json.Number or
+// string
+func FromValue(value interface{}) (Amount, error) {
+	switch v := value.(type) {
+	case Amount:
+		return v, nil
+	case float64:
+		return FromFloat(v)
+	case fmt.Stringer:
+		// json.Number
+		return Parse(v.String())
+	case string:
+		return Parse(v)
+	}
+	return 0, errInvalid
+}
+
+// Round rounds half away from zero to the currency's number of decimals
+func (a Amount) Round(code string) Amount {
+	step := currencyStep(code)
+	return divRound(a, step) * step
+}
+
+// currencyStep is the currency's smallest unit in ten-thousandths
+func currencyStep(code string) Amount {
+	return Amount(math.Pow10(Scale - currency.MinorUnits(code)))
+}
+
+// divRound divides, rounding half away from zero
+func divRound(a, n Amount) Amount {
+	quotient, remainder := a/n, a%n
+	if remainder < 0 {
+		remainder = -remainder
+	}
+	if remainder*2 >= n {
+		if a < 0 {
+			quotient--
+		} else {
+			quotient++
+		}
+	}
+	return quotient
+}
+
+// Fits reports whether the amount has no more decimals than the currency
+func (a Amount) Fits(code string) bool {
+	return a.Round(code) == a
+}
+
+// Check returns an error when the amount has more decimals than the
+// currency allows
+func (a Amount) Check(code string) error {
+	if a.Fits(code) {
+		return nil
+	}
+	units := currency.MinorUnits(code)
+	if units == 0 {
+		return fmt.Errorf("%s amounts must be whole numbers", code)
+	}
+	return fmt.Errorf("%s amounts must not have more than %d decimal places", code, units)
+}
+
+// DivRound divides by n, a positive count, and rounds the result to the
+// currency's number of decimals in one step
+func (a Amount) DivRound(n int, code string) Amount {
+	if n <= 0 {
+		return 0
+	}
+	step := currencyStep(code)
+	return divRound(a, Amount(n)*step) * step
+}
+
+// Float64 is the amount as a float, for ratios and percentages only
+func (a Amount) Float64() float64 {
+	return float64(a) / unit
+}
+
+// String writes the amount without trailing zeros, as in "12.5" or "3"
+func (a Amount) String() string {
+	return strings.TrimSuffix(strings.TrimRight(a.fixed(Scale), "0"), ".")
+}
+
+// Format writes the amount rounded to the currency's number of decimals,
+// as in "12.50" for USD or "1250" for JPY
+func (a Amount) Format(code string) string {
+	return a.Round(code).fixed(currency.MinorUnits(code))
+}
+
+// fixed writes the amount with places decimals, which must not drop any
+// non-zero digit
+func (a Amount) fixed(places int) string {
+	sign := ""
+	units := int64(a)
+	if units < 0 {
+		sign, units = "-", -units
+	}
+	whole, fraction := units/unit, units%unit
+	text := sign + strconv.FormatInt(whole, 10)
+	if places > 0 {
+		text += "." + fmt.Sprintf("%04d", fraction)[:places]
+	}
+	return text
+}
+
+// MarshalJSON writes the amount as a JSON number
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON reads a JSON number or a numeric string
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(text); err == nil {
+		text = unquoted
+	}
+	amount, err := Parse(text)
+	if err != nil {
+		return err
+	}
+	*a = amount
+	return nil
+}
+
+// UnmarshalText reads form and query values
+func (a *Amount) UnmarshalText(text []byte) error {
+	amount, err := Parse(string(text))
+	if err != nil {
+		return err
+	}
+	*a = amount
+	return nil
+}
+
+// Value stores the amount as decimal text, which numeric columns take
+// exactly
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
+
+// Scan reads a numeric column, rounding anything finer than Scale
+func (a *Amount) Scan(src interface{}) error {
+	var (
+		amount Amount
+		err    error
+	)
+	switch v := src.(type) {
+	case nil:
+		amount = 0
+	case []byte:
+		amount, err = ParseRound(string(v))
+	case string:
+		amount, err = ParseRound(v)
+	case int64:
+		amount = Amount(v * unit)
+	case float64:
+		amount, err = ParseRound(strconv.FormatFloat(v, 'f', -1, 64))
+	default:
+		err = fmt.Errorf("cannot scan %T into an amount", src)
+	}
+	if err != nil {
+		return err
+	}
+	*a = amount
+	return nil
+}
@@ -0,0 +1,286 @@
+package money
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Amount
+	}{
+		{"12.5", 125000},
+		{"-3", -30000},
+		{"+3", 30000},
+		{".75", 7500},
+		{"5.", 50000},
+		{" 7 ", 70000},
+		{"0.0001", 1},
+		{"1.23450", 12345},
+		{"00012", 120000},
+		{"99999999999999.9999", 999999999999999999},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.value)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr string
+	}{
+		{"", "decimal number"},
+		{".", "decimal number"},
+		{"-", "decimal number"},
+		{"abc", "decimal number"},
+		{"1,000", "decimal number"},
+		{"1.2.3", "decimal number"},
+		{"1e3", "decimal number"},
+		{"--1", "decimal number"},
+		{"1.23456", "decimal places"},
+		{"123456789012345", "too large"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.value)
+		if err == nil {
+			t.Errorf("Parse(%q) accepted", tt.value)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("Parse(%q) error %q does not mention %q", tt.value, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseRound(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Amount
+	}{
+		{"1.23454", 12345},
+		{"1.23455", 12346},
+		{"-1.23455", -12346},
+		{"0.99995", 10000},
+		{"2.000049999", 20000},
+		{"3.5", 35000},
+	}
+	for _, tt := range tests {
+		got, err := ParseRound(tt.value)
+		if err != nil {
+			t.Errorf("ParseRound(%q) failed: %v", tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseRound(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestFromValue(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  Amount
+	}{
+		{12.5, 125000},
+		{0.1, 1000},
+		{json.Number("3.25"), 32500},
+		{"1", 10000},
+		{Amount(42), 42},
+	}
+	for _, tt := range tests {
+		got, err := FromValue(tt.value)
+		if err != nil || got != tt.want {
+			t.Errorf("FromValue(%#v) = %d, %v, want %d", tt.value, got, err, tt.want)
+		}
+	}
+
+	for _, value := range []interface{}{nil, 3, true, 0.00001} {
+		if _, err := FromValue(value); err == nil {
+			t.Errorf("FromValue(%#v) accepted", value)
+		}
+	}
+}
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		amount Amount
+		code   string
+		want   Amount
+	}{
+		{12345, "USD", 12300},
+		{12350, "USD", 12400},
+		{-12350, "USD", -12400},
+		{-12349, "USD", -12300},
+		{125000, "JPY", 130000},
+		{124999, "JPY", 120000},
+		{12345, "BHD", 12350},
+		{12345, "XXX", 12300},
+	}
+	for _, tt := range tests {
+		if got := tt.amount.Round(tt.code); got != tt.want {
+			t.Errorf("%d.Round(%s) = %d, want %d", tt.amount, tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		amount  Amount
+		code    string
+		wantErr string
+	}{
+		{12300, "USD", ""},
+		{12345, "USD", "2 decimal places"},
+		{130000, "JPY", ""},
+		{125000, "JPY", "whole numbers"},
+		{12350, "BHD", ""},
+		{12345, "BHD", "3 decimal places"},
+	}
+	for _, tt := range tests {
+		err := tt.amount.Check(tt.code)
+		if fits := tt.amount.Fits(tt.code); fits != (tt.wantErr == "") {
+			t.Errorf("%d.Fits(%s) = %v", tt.amount, tt.code, fits)
+		}
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%d.Check(%s) = %v", tt.amount, tt.code, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%d.Check(%s) = %v, want an error mentioning %q", tt.amount, tt.code, err, tt.wantErr)
+		}
+	}
+}
+
+func TestDivRound(t *testing.T) {
+	tests := []struct {
+		amount Amount
+		n      int
+		code   string
+		want   Amount
+	}{
+		{100000, 3, "USD", 33300},
+		{200000, 3, "USD", 66700},
+		{-100000, 3, "USD", -33300},
+		{50000, 2, "JPY", 30000},
+		{10000, 8, "BHD", 1250},
+		{10000, 0, "USD", 0},
+		{10000, -2, "USD", 0},
+	}
+	for _, tt := range tests {
+		if got := tt.amount.DivRound(tt.n, tt.code); got != tt.want {
+			t.Errorf("%d.DivRound(%d, %s) = %d, want %d", tt.amount, tt.n, tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestStringAndFormat(t *testing.T) {
+	tests := []struct {
+		amount     Amount
+		want       string
+		code       string
+		wantFormat string
+	}{
+		{125000, "12.5", "USD", "12.50"},
+		{30000, "3", "USD", "3.00"},
+		{0, "0", "USD", "0.00"},
+		{-7500, "-0.75", "USD", "-0.75"},
+		{1, "0.0001", "USD", "0.00"},
+		{-50, "-0.005", "USD", "-0.01"},
+		{-5, "-0.0005", "USD", "0.00"},
+		{125000, "12.5", "JPY", "13"},
+		{12345, "1.2345", "BHD", "1.235"},
+		{9999999999990000, "999999999999", "EUR", "999999999999.00"},
+	}
+	for _, tt := range tests {
+		if got := tt.amount.String(); got != tt.want {
+			t.Errorf("%d.String() = %q, want %q", tt.amount, got, tt.want)
+		}
+		if got := tt.amount.Format(tt.code); got != tt.wantFormat {
+			t.Errorf("%d.Format(%s) = %q, want %q", tt.amount, tt.code, got, tt.wantFormat)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var body struct {
+		Amount Amount  `json:"amount"`
+		Tip    *Amount `json:"tip"`
+	}
+	if err := json.Unmarshal([]byte(`{"amount":12.50,"tip":"0.3"}`), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Amount != 125000 || body.Tip == nil || *body.Tip != 3000 {
+		t.Errorf("decoded %d, %v", body.Amount, body.Tip)
+	}
+
+	out, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `{"amount":12.5,"tip":0.3}` {
+		t.Errorf("encoded %s", out)
+	}
+
+	// null leaves the amount alone, as for any other JSON type
+	amount := Amount(5)
+	if err := json.Unmarshal([]byte(`null`), &amount); err != nil || amount != 5 {
+		t.Errorf("null gave %d, %v", amount, err)
+	}
+
+	for _, data := range []string{`"ten"`, `1e2`, `12.34567`, `true`} {
+		if err := json.Unmarshal([]byte(data), &amount); err == nil {
+			t.Errorf("%s accepted", data)
+		}
+	}
+}
+
+func TestUnmarshalText(t *testing.T) {
+	var amount Amount
+	if err := amount.UnmarshalText([]byte("4.20")); err != nil || amount != 42000 {
+		t.Errorf("UnmarshalText(4.20) = %d, %v", amount, err)
+	}
+	if err := amount.UnmarshalText([]byte("4,20")); err == nil {
+		t.Error("UnmarshalText(4,20) accepted")
+	}
+}
+
+func TestValueAndScan(t *testing.T) {
+	value, err := Amount(-12345).Value()
+	if err != nil || value != "-1.2345" {
+		t.Errorf("Value() = %v, %v", value, err)
+	}
+
+	tests := []struct {
+		src  interface{}
+		want Amount
+	}{
+		{[]byte("12.345678"), 123457},
+		{[]byte("-0.50"), -5000},
+		{"5", 50000},
+		{int64(7), 70000},
+		{0.1, 1000},
+		{nil, 0},
+	}
+	for _, tt := range tests {
+		amount := Amount(99)
+		if err := amount.Scan(tt.src); err != nil || amount != tt.want {
+			t.Errorf("Scan(%#v) = %d, %v, want %d", tt.src, amount, err, tt.want)
+		}
+	}
+
+	var amount Amount
+	for _, src := range []interface{}{true, []byte("n/a")} {
+		if err := amount.Scan(src); err == nil {
+			t.Errorf("Scan(%#v) accepted", src)
+		}
+	}
+}
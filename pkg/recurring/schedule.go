@@ -0,0 +1,164 @@
+// Package recurring materializes recurring expense rules into expenses.
+//
+// Rules live in recurring_expenses and keep the date of their next
+// occurrence in next_run_date. A scheduler on every app instance claims due
+// rules with FOR UPDATE SKIP LOCKED and inserts each occurrence through
+// add_expense_v3 in the same transaction that records it in
+// recurring_expense_runs, so an occurrence is created exactly once however
+// many instances run. Occurrences missed while no instance was running are
+// created on the next pass.
+//
+// Tables:
+//
+//	recurring_expenses     (id, user_id, title, amount, currency, category_id,
+//	                        notes, frequency, interval_count, start_date date,
+//	                        end_date date, skip_dates jsonb, next_run_date date,
+//	                        active, created_at, updated_at)
+//	recurring_expense_runs (rule_id, occurrence_date date, status, message,
+//	                        created_at, PRIMARY KEY (rule_id, occurrence_date))
+package recurring
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Frequencies a rule can repeat at
+const (
+	Daily   = "daily"
+	Weekly  = "weekly"
+	Monthly = "monthly"
+	Yearly  = "yearly"
+)
+
+// DateLayout is the format of every date a rule stores or accepts
+const DateLayout = "2006-01-02"
+
+const (
+	maxInterval  = 365
+	maxSkipDates = 366
+)
+
+// Schedule is when a rule repeats: every Interval days, weeks, months or
+// years from StartDate until EndDate, except on SkipDates. Monthly and
+// yearly rules keep the day of StartDate, falling back to the last day of
+// shorter months.
+type Schedule struct {
+	Frequency string
+	Interval  int
+	StartDate time.Time
+	EndDate   *time.Time
+	SkipDates []time.Time
+}
+
+// ParseDate reads a YYYY-MM-DD date
+func ParseDate(value string) (time.Time, error) {
+	date, err := time.Parse(DateLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q (expected YYYY-MM-DD)", value)
+	}
+	return date, nil
+}
+
+// Today is the current date in the server's time zone
+func Today() time.Time {
+	y, m, d := time.Now().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// Validate checks the schedule can be stored
+func (s Schedule) Validate() error {
+	switch s.Frequency {
+	case Daily, Weekly, Monthly, Yearly:
+	default:
+		return errors.New("frequency must be daily, weekly, monthly or yearly")
+	}
+	if s.Interval < 1 || s.Interval > maxInterval {
+		return fmt.Errorf("interval must be between 1 and %d", maxInterval)
+	}
+	if s.StartDate.IsZero() {
+		return errors.New("startDate is required")
+	}
+	if s.EndDate != nil && s.EndDate.Before(s.StartDate) {
+		return errors.New("endDate must not be before startDate")
+	}
+	if len(s.SkipDates) > maxSkipDates {
+		return fmt.Errorf("at most %d skip dates are allowed", maxSkipDates)
+	}
+	return nil
+}
+
+// Next returns the first occurrence on or after date, passing over skip
+// dates, or false when the schedule has ended by then
+func (s Schedule) Next(date time.Time) (time.Time, bool) {
+	skip := make(map[time.Time]bool, len(s.SkipDates))
+	for _, d := range s.SkipDates {
+		skip[d] = true
+	}
+
+	for n := s.estimate(date); ; n++ {
+		occurrence := s.occurrence(n)
+		if s.EndDate != nil && occurrence.After(*s.EndDate) {
+			return time.Time{}, false
+		}
+		if occurrence.Before(date) || skip[occurrence] {
+			continue
+		}
+		return occurrence, true
+	}
+}
+
+// occurrence is the nth date of the schedule. It is always counted from the
+// start date so month-end dates do not drift to earlier days.
+func (s Schedule) occurrence(n int) time.Time {
+	switch s.Frequency {
+	case Daily:
+		return s.StartDate.AddDate(0, 0, n*s.Interval)
+	case Weekly:
+		return s.StartDate.AddDate(0, 0, 7*n*s.Interval)
+	case Monthly:
+		return addMonths(s.StartDate, n*s.Interval)
+	default:
+		return addMonths(s.StartDate, 12*n*s.Interval)
+	}
+}
+
+// estimate is an occurrence index at or just before date, so Next does not
+// walk every occurrence since the start
+func (s Schedule) estimate(date time.Time) int {
+	if !date.After(s.StartDate) {
+		return 0
+	}
+
+	var units int
+	switch s.Frequency {
+	case Daily:
+		units = int(date.Sub(s.StartDate).Hours() / 24)
+	case Weekly:
+		units = int(date.Sub(s.StartDate).Hours() / 24 / 7)
+	case Monthly:
+		units = monthsBetween(s.StartDate, date)
+	default:
+		units = monthsBetween(s.StartDate, date) / 12
+	}
+
+	if n := units/s.Interval - 1; n > 0 {
+		return n
+	}
+	return 0
+}
+
+// addMonths moves t by months, clamping the day to the end of the month
+func addMonths(t time.Time, months int) time.Time {
+	y, m, d := t.Date()
+	first := time.Date(y, m+time.Month(months), 1, 0, 0, 0, 0, time.UTC)
+	if last := first.AddDate(0, 1, -1).Day(); d > last {
+		d = last
+	}
+	return time.Date(first.Year(), first.Month(), d, 0, 0, 0, 0, time.UTC)
+}
+
+func monthsBetween(from, to time.Time) int {
+	return (to.Year()-from.Year())*12 + int(to.Month()) - int(from.Month())
+}
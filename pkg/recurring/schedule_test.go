@@ -0,0 +1,163 @@
+package recurring
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func date(t *testing.T, value string) time.Time {
+	t.Helper()
+	d, err := ParseDate(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// occurrences lists the schedule's dates from its start, up to limit
+func occurrences(s Schedule, limit int) []string {
+	var dates []string
+	next, ok := s.Next(s.StartDate)
+	for ok && len(dates) < limit {
+		dates = append(dates, next.Format(DateLayout))
+		next, ok = s.Next(next.AddDate(0, 0, 1))
+	}
+	return dates
+}
+
+func TestScheduleOccurrences(t *testing.T) {
+	tests := []struct {
+		name      string
+		frequency string
+		interval  int
+		start     string
+		want      string
+	}{
+		{"daily across a leap day", Daily, 1, "2024-02-27", "2024-02-27 2024-02-28 2024-02-29 2024-03-01"},
+		{"every 10 days", Daily, 10, "2023-12-25", "2023-12-25 2024-01-04 2024-01-14 2024-01-24"},
+		{"fortnightly", Weekly, 2, "2024-12-23", "2024-12-23 2025-01-06 2025-01-20 2025-02-03"},
+		{"month end keeps the 31st", Monthly, 1, "2024-01-31", "2024-01-31 2024-02-29 2024-03-31 2024-04-30 2024-05-31"},
+		{"month end in a common year", Monthly, 1, "2023-01-31", "2023-01-31 2023-02-28 2023-03-31"},
+		{"the 30th", Monthly, 1, "2023-12-30", "2023-12-30 2024-01-30 2024-02-29 2024-03-30"},
+		{"quarterly from a month end", Monthly, 3, "2023-11-30", "2023-11-30 2024-02-29 2024-05-30 2024-08-30"},
+		{"yearly on a leap day", Yearly, 1, "2024-02-29", "2024-02-29 2025-02-28 2026-02-28 2027-02-28 2028-02-29"},
+		{"every 4 years on a leap day", Yearly, 4, "2096-02-29", "2096-02-29 2100-02-28 2104-02-29"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := NewSchedule(tt.frequency, tt.interval, tt.start, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := strings.Fields(tt.want)
+			if got := occurrences(schedule, len(want)); strings.Join(got, " ") != tt.want {
+				t.Errorf("occurrences = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestScheduleNextFromLaterDate(t *testing.T) {
+	schedule, err := NewSchedule(Monthly, 1, "2020-01-31", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Years after the start, without walking every occurrence, and without
+	// drifting to the 28th or 29th
+	tests := map[string]string{
+		"2024-02-01": "2024-02-29",
+		"2024-02-29": "2024-02-29",
+		"2024-03-01": "2024-03-31",
+		"2025-02-10": "2025-02-28",
+		"2019-06-01": "2020-01-31",
+	}
+	for from, want := range tests {
+		if got, ok := schedule.Next(date(t, from)); !ok || got.Format(DateLayout) != want {
+			t.Errorf("Next(%s) = %s, %v, want %s", from, got.Format(DateLayout), ok, want)
+		}
+	}
+}
+
+func TestScheduleEndAndSkipDates(t *testing.T) {
+	end := "2024-03-31"
+	schedule, err := NewSchedule(Monthly, 1, "2024-01-31", &end, []string{"2024-02-29"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := occurrences(schedule, 10); strings.Join(got, " ") != "2024-01-31 2024-03-31" {
+		t.Errorf("occurrences = %v", got)
+	}
+	if _, ok := schedule.Next(date(t, "2024-04-01")); ok {
+		t.Error("an occurrence after the end date")
+	}
+
+	// Skipping the last occurrence ends the schedule
+	schedule.SkipDates = append(schedule.SkipDates, date(t, end))
+	if next, ok := schedule.Next(date(t, "2024-03-01")); ok {
+		t.Errorf("Next after the last skipped occurrence = %s", next.Format(DateLayout))
+	}
+}
+
+func TestNewScheduleValidates(t *testing.T) {
+	before := "2023-12-31"
+	bad := "2024-02-30"
+	tests := []struct {
+		name      string
+		frequency string
+		interval  int
+		start     string
+		end       *string
+		skip      []string
+		wantErr   string
+	}{
+		{"unknown frequency", "hourly", 1, "2024-01-01", nil, nil, "frequency"},
+		{"zero interval", Daily, 0, "2024-01-01", nil, nil, "interval"},
+		{"interval too long", Daily, maxInterval + 1, "2024-01-01", nil, nil, "interval"},
+		{"missing start", Daily, 1, "", nil, nil, "invalid date"},
+		{"end before start", Daily, 1, "2024-01-01", &before, nil, "endDate"},
+		{"bad end date", Daily, 1, "2024-01-01", &bad, nil, "invalid date"},
+		{"bad skip date", Daily, 1, "2024-01-01", nil, []string{"2023-02-29"}, "invalid date"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewSchedule(tt.frequency, tt.interval, tt.start, tt.end, tt.skip)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NewSchedule error = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	skip := make([]string, maxSkipDates+1)
+	for i := range skip {
+		skip[i] = date(t, "2024-01-01").AddDate(0, 0, i).Format(DateLayout)
+	}
+	if _, err := NewSchedule(Daily, 1, "2024-01-01", nil, skip); err == nil || !strings.Contains(err.Error(), "skip dates") {
+		t.Errorf("too many skip dates gave %v", err)
+	}
+}
+
+func TestAddMonths(t *testing.T) {
+	tests := []struct {
+		from   string
+		months int
+		want   string
+	}{
+		{"2024-01-31", 1, "2024-02-29"},
+		{"2023-01-31", 1, "2023-02-28"},
+		{"2024-03-31", -1, "2024-02-29"},
+		{"2024-08-31", 1, "2024-09-30"},
+		{"2024-12-15", 1, "2025-01-15"},
+		{"2024-02-29", 12, "2025-02-28"},
+		{"2024-02-29", 48, "2028-02-29"},
+		{"1900-01-29", 1, "1900-02-28"},
+		{"2000-01-29", 1, "2000-02-29"},
+	}
+	for _, tt := range tests {
+		if got := addMonths(date(t, tt.from), tt.months).Format(DateLayout); got != tt.want {
+			t.Errorf("addMonths(%s, %d) = %s, want %s", tt.from, tt.months, got, tt.want)
+		}
+	}
+}
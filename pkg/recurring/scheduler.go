@@ -0,0 +1,219 @@
+package recurring
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go_template_v3/pkg/config"
+	"go_template_v3/pkg/global/utils"
+	"go_template_v3/pkg/money"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// rule is a recurring_expenses row as the scheduler reads it
+type rule struct {
+	Id            int
+	UserId        int
+	Title         string
+	Amount        money.Amount
+	Currency      *string
+	CategoryId    *int
+	Notes         *string
+	Frequency     string
+	IntervalCount int
+	StartDate     string
+	EndDate       *string
+	SkipDates     string
+	NextRunDate   string
+}
+
+// Start runs the scheduler until ctx is cancelled. It catches up at once and
+// then checks for due rules every RECURRING_POLL_SECONDS (default 60).
+func Start(ctx context.Context) {
+	pollInterval := time.Duration(utils.EnvInt("RECURRING_POLL_SECONDS", 60, 1)) * time.Second
+
+	go func() {
+		for {
+			runDue(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(pollInterval):
+			}
+		}
+	}()
+	fmt.Printf("RECURRING EXPENSES: every %s\n", pollInterval)
+}
+
+// runDue materializes every rule that is due today, one rule per
+// transaction
+func runDue(ctx context.Context) {
+	today := Today()
+	for ctx.Err() == nil {
+		claimed, err := materializeNext(today)
+		if err != nil {
+			log.Printf("Error creating recurring expenses: %v", err)
+			return
+		}
+		if !claimed {
+			return
+		}
+	}
+}
+
+// materializeNext locks one due rule, creates its occurrences up to today
+// (at most RECURRING_MAX_CATCHUP, default 400, per call) and moves its
+// next_run_date on. It reports whether a rule was due.
+func materializeNext(today time.Time) (bool, error) {
+	maxCatchUp := utils.EnvInt("RECURRING_MAX_CATCHUP", 400, 1)
+	claimed := false
+
+	err := config.DBConnList[0].Transaction(func(tx *gorm.DB) error {
+		var r rule
+		// Rules of deleted accounts are never run, even if they were left
+		// active
+		err := tx.Raw(`
+			SELECT r.id, r.user_id, r.title, r.amount, r.currency, r.category_id, r.notes, r.frequency, r.interval_count,
+				to_char(r.start_date, 'YYYY-MM-DD') AS start_date,
+				to_char(r.end_date, 'YYYY-MM-DD') AS end_date,
+				COALESCE(r.skip_dates, '[]'::jsonb)::text AS skip_dates,
+				to_char(r.next_run_date, 'YYYY-MM-DD') AS next_run_date
+			FROM recurring_expenses r
+			JOIN users u ON u.id = r.user_id AND u.deleted_at IS NULL
+			WHERE r.active AND r.next_run_date <= ?::date
+			ORDER BY r.next_run_date, r.id
+			FOR UPDATE OF r SKIP LOCKED
+			LIMIT 1
+		`, today.Format(DateLayout)).Scan(&r).Error
+		if err != nil || r.Id == 0 {
+			return err
+		}
+		claimed = true
+
+		schedule, err := r.schedule()
+		var from time.Time
+		if err == nil {
+			from, err = ParseDate(r.NextRunDate)
+		}
+		if err != nil {
+			// A rule that cannot be read again would be claimed forever
+			log.Printf("Recurring expense %d is invalid, pausing it: %v", r.Id, err)
+			return tx.Exec("UPDATE recurring_expenses SET active = FALSE, updated_at = NOW() WHERE id = ?", r.Id).Error
+		}
+
+		date, ok := schedule.Next(from)
+		for created := 0; ok && !date.After(today) && created < maxCatchUp; created++ {
+			if err := createOccurrence(tx, r, date); err != nil {
+				return err
+			}
+			date, ok = schedule.Next(date.AddDate(0, 0, 1))
+		}
+
+		var nextRunDate interface{}
+		if ok {
+			nextRunDate = date.Format(DateLayout)
+		}
+		return tx.Exec(
+			"UPDATE recurring_expenses SET next_run_date = ?::date, updated_at = NOW() WHERE id = ?",
+			nextRunDate, r.Id,
+		).Error
+	})
+	return claimed, err
+}
+
+// createOccurrence adds the rule's expense for date unless it was already
+// created. A rejected expense is recorded as a failed run rather than
+// retried.
+func createOccurrence(tx *gorm.DB, r rule, date time.Time) error {
+	occurrence := date.Format(DateLayout)
+	res := tx.Exec(`
+		INSERT INTO recurring_expense_runs (rule_id, occurrence_date, status)
+		VALUES (?, ?::date, 'created')
+		ON CONFLICT DO NOTHING
+	`, r.Id, occurrence)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return res.Error
+	}
+
+	payload := map[string]interface{}{
+		"userId": r.UserId,
+		"title":  r.Title,
+		"amount": r.Amount,
+		"date":   occurrence,
+	}
+	if r.CategoryId != nil {
+		payload["categoryId"] = *r.CategoryId
+	}
+	if r.Notes != nil && *r.Notes != "" {
+		payload["notes"] = *r.Notes
+	}
+	if r.Currency != nil {
+		payload["currency"] = *r.Currency
+	}
+	inputJSON, _ := json.Marshal(payload)
+
+	tx.SavePoint("occurrence")
+	var resultStr string
+	message := ""
+	if err := tx.Raw("SELECT add_expense_v3($1)", string(inputJSON)).Scan(&resultStr).Error; err != nil {
+		log.Printf("Error creating recurring expense %d for %s: %v", r.Id, occurrence, err)
+		message = "Insert failed"
+	} else {
+		var result map[string]interface{}
+		json.Unmarshal([]byte(resultStr), &result)
+		if result["success"] != true {
+			message = "Insert failed"
+			if m, ok := result["message"].(string); ok {
+				message = m
+			}
+		}
+	}
+	if message == "" {
+		return nil
+	}
+
+	tx.RollbackTo("occurrence")
+	return tx.Exec(
+		"UPDATE recurring_expense_runs SET status = 'failed', message = ? WHERE rule_id = ? AND occurrence_date = ?::date",
+		message, r.Id, occurrence,
+	).Error
+}
+
+func (r rule) schedule() (Schedule, error) {
+	var skipDates []string
+	if err := json.Unmarshal([]byte(r.SkipDates), &skipDates); err != nil {
+		return Schedule{}, err
+	}
+	return NewSchedule(r.Frequency, r.IntervalCount, r.StartDate, r.EndDate, skipDates)
+}
+
+// NewSchedule builds and validates a schedule from stored or requested
+// values
+func NewSchedule(frequency string, interval int, startDate string, endDate *string, skipDates []string) (Schedule, error) {
+	schedule := Schedule{Frequency: frequency, Interval: interval}
+
+	var err error
+	if schedule.StartDate, err = ParseDate(startDate); err != nil {
+		return Schedule{}, err
+	}
+	if endDate != nil && *endDate != "" {
+		end, err := ParseDate(*endDate)
+		if err != nil {
+			return Schedule{}, err
+		}
+		schedule.EndDate = &end
+	}
+	for _, value := range skipDates {
+		date, err := ParseDate(value)
+		if err != nil {
+			return Schedule{}, err
+		}
+		schedule.SkipDates = append(schedule.SkipDates, date)
+	}
+
+	return schedule, schedule.Validate()
+}
@@ -0,0 +1,202 @@
+package ctrFeatureOne
+
+import (
+	"fmt"
+	"go_template_v3/pkg/config"
+	"go_template_v3/pkg/global/utils"
+	"go_template_v3/pkg/jobs"
+	mdlFeatureOne "go_template_v3/pkg/services/featureOne/model"
+	"html"
+	"log"
+	"net/http"
+
+	v1 "github.com/FDSAP-Git-Org/hephaestus/helper/v1"
+	"github.com/FDSAP-Git-Org/hephaestus/respcode"
+	utils_v1 "github.com/FDSAP-Git-Org/hephaestus/utils/v1"
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
+)
+
+func ChangePassword(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Parse request body
+	var req mdlFeatureOne.ChangePasswordRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid body", err, http.StatusBadRequest)
+	}
+	if req.CurrentPassword == nil || req.NewPassword == nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Current and new password required", nil, http.StatusBadRequest)
+	}
+	if !utils_v1.IsPasswordValid(*req.NewPassword) {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Password does not meet requirements", nil, http.StatusBadRequest)
+	}
+	if *req.NewPassword == *req.CurrentPassword {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "New password must be different from the current one", nil, http.StatusBadRequest)
+	}
+
+	// 3. Confirm the current password
+	user, err := confirmCurrentPassword(c, userId, *req.CurrentPassword)
+	if user == nil {
+		return err
+	}
+
+	// 4. Store the new password
+	hashedPassword, err := utils_v1.HashData(*req.NewPassword)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to hash password", err, http.StatusInternalServerError)
+	}
+	err = config.DBConnList[0].Exec(
+		"UPDATE users SET password = ?, updated_at = NOW() WHERE id = ?",
+		hashedPassword, userId,
+	).Error
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to update password", err, http.StatusInternalServerError)
+	}
+
+	// 5. Log out every other device
+	revoked, err := utils.RevokeUserSessions(userId, utils.GetSessionId(c))
+	if err != nil {
+		log.Printf("Error revoking sessions for user %d: %v", userId, err)
+	}
+
+	utils.RecordAuthEvent("password_changed", *user.Email, c.IP(), map[string]interface{}{
+		"userId":          userId,
+		"revokedSessions": revoked,
+	})
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Password changed successfully", nil, http.StatusOK)
+}
+
+func DeleteAccount(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Parse request body
+	var req mdlFeatureOne.DeleteAccountRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid body", err, http.StatusBadRequest)
+	}
+	if req.Password == nil || *req.Password == "" {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Password is required", nil, http.StatusBadRequest)
+	}
+
+	// 3. Confirm the password
+	user, err := confirmCurrentPassword(c, userId, *req.Password)
+	if user == nil {
+		return err
+	}
+
+	// 4. Soft-delete the user and cut off every way back in
+	err = config.DBConnList[0].Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("UPDATE users SET deleted_at = NOW(), updated_at = NOW() WHERE id = ?", userId).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("UPDATE user_sessions SET revoked_at = NOW() WHERE user_id = ? AND revoked_at IS NULL", userId).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = ? AND revoked_at IS NULL", userId).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("UPDATE api_keys SET revoked_at = NOW() WHERE user_id = ? AND revoked_at IS NULL", userId).Error; err != nil {
+			return err
+		}
+		// Stop anything that would keep acting for the account
+		if err := tx.Exec("UPDATE recurring_expenses SET active = FALSE, updated_at = NOW() WHERE user_id = ? AND active", userId).Error; err != nil {
+			return err
+		}
+		return tx.Exec("UPDATE webhook_endpoints SET active = FALSE WHERE user_id = ? AND active", userId).Error
+	})
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to delete account", err, http.StatusInternalServerError)
+	}
+
+	// 5. Schedule expenses and receipt files for removal
+	var expenseCount int
+	config.DBConnList[0].Raw("SELECT COUNT(*) FROM expenses WHERE user_id = ?", userId).Scan(&expenseCount)
+
+	if _, err := jobs.Enqueue(userId, jobTypeAccountPurge, expenseCount, nil); err != nil {
+		// The account is already closed, a failed purge is picked up by an operator
+		log.Printf("Error creating purge job for user %d: %v", userId, err)
+	}
+
+	utils.RecordAuthEvent("account_deleted", *user.Email, c.IP(), map[string]interface{}{"userId": userId})
+
+	// 6. Confirm by email
+	name := ""
+	if user.Name != nil {
+		name = *user.Name
+	}
+	go func() {
+		if err := sendAccountDeletedEmail(*user.Email, name); err != nil {
+			log.Printf("Error sending account deletion email to user %d: %v", userId, err)
+		}
+	}()
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Account deleted successfully", nil, http.StatusOK)
+}
+
+// confirmCurrentPassword checks a password re-entered by a logged-in user.
+// Failures count toward the login lockout so these endpoints cannot be used
+// to guess passwords. On failure the user is nil and the error is the
+// response to return.
+func confirmCurrentPassword(c fiber.Ctx, userId int, password string) (*mdlFeatureOne.User, error) {
+	email := utils.GetUserEmail(c)
+	ip := c.IP()
+
+	retryAfter, err := utils.CheckLoginAllowed(email, ip)
+	if err != nil {
+		return nil, v1.JSONResponseWithError(c, respcode.ERR_CODE_500, respcode.ERR_CODE_500_MSG, err, http.StatusInternalServerError)
+	}
+	if retryAfter > 0 {
+		return nil, tooManyAttempts(c, retryAfter, "Too many failed attempts, try again later")
+	}
+
+	var user mdlFeatureOne.User
+	err = config.DBConnList[0].Raw("SELECT * FROM users WHERE id = ? AND deleted_at IS NULL", userId).Scan(&user).Error
+	if err != nil {
+		return nil, v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+	if user.Id == nil || user.Password == nil {
+		return nil, v1.JSONResponseWithError(c, respcode.ERR_CODE_404, "User not found", nil, http.StatusNotFound)
+	}
+
+	if !utils_v1.CheckHashData(password, *user.Password) {
+		utils.RecordLoginFailure(email, ip)
+		return nil, v1.JSONResponseWithError(c, respcode.ERR_CODE_401, "Invalid password", nil, http.StatusUnauthorized)
+	}
+
+	return &user, nil
+}
+
+func sendAccountDeletedEmail(email, name string) error {
+	subject := "Your account has been deleted"
+
+	htmlBody := fmt.Sprintf(`
+	<!DOCTYPE html>
+	<html>
+	<head>
+		<style>
+			body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+			.container { max-width: 600px; margin: 0 auto; padding: 20px; }
+			.footer { margin-top: 30px; font-size: 12px; color: #666; }
+		</style>
+	</head>
+	<body>
+		<div class="container">
+			<h2>Account Deleted</h2>
+			<p>Hello %s,</p>
+			<p>Your account has been deleted and you have been signed out on every device.</p>
+			<p>Your expenses and uploaded receipts are being removed.</p>
+			<p>If you didn't request this, please contact support immediately.</p>
+			<div class="footer">
+				<p>This is an automated message, please do not reply to this email.</p>
+			</div>
+		</div>
+	</body>
+	</html>
+	`, html.EscapeString(name))
+
+	return sendWithSMTP(email, subject, htmlBody)
+}
@@ -0,0 +1,114 @@
+package ctrFeatureOne
+
+import (
+	"encoding/json"
+	"fmt"
+	"go_template_v3/pkg/config"
+	"go_template_v3/pkg/global/utils"
+	mdlFeatureOne "go_template_v3/pkg/services/featureOne/model"
+	"net/http"
+	"strings"
+	"time"
+
+	v1 "github.com/FDSAP-Git-Org/hephaestus/helper/v1"
+	"github.com/FDSAP-Git-Org/hephaestus/respcode"
+	utils_v1 "github.com/FDSAP-Git-Org/hephaestus/utils/v1"
+	"github.com/gofiber/fiber/v3"
+)
+
+const maxActiveAPIKeys = 25
+
+func CreateAPIKey(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Parse request body
+	var req mdlFeatureOne.CreateAPIKeyRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid body", err, http.StatusBadRequest)
+	}
+
+	// 3. Field validation
+	if req.Name == nil || strings.TrimSpace(*req.Name) == "" {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Key name is required", nil, http.StatusBadRequest)
+	}
+	if len(req.Scopes) == 0 {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "At least one scope is required", nil, http.StatusBadRequest)
+	}
+	for _, scope := range req.Scopes {
+		if _, ok := utils.APIKeyScopes[scope]; !ok {
+			return v1.JSONResponseWithError(c, respcode.ERR_CODE_400,
+				fmt.Sprintf("Unknown scope '%s'", scope), nil, http.StatusBadRequest)
+		}
+	}
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Expiry must be in the future", nil, http.StatusBadRequest)
+	}
+
+	var active int64
+	config.DBConnList[0].Raw("SELECT COUNT(*) FROM api_keys WHERE user_id = ? AND revoked_at IS NULL", userId).Scan(&active)
+	if active >= maxActiveAPIKeys {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400,
+			fmt.Sprintf("Maximum of %d active API keys reached", maxActiveAPIKeys), nil, http.StatusBadRequest)
+	}
+
+	// 4. Store only the hash, the raw key is returned once
+	rawKey, keyPrefix := utils.GenerateAPIKey()
+	scopesJSON, _ := json.Marshal(req.Scopes)
+
+	var key mdlFeatureOne.APIKey
+	err := config.DBConnList[0].Raw(`
+		INSERT INTO api_keys (user_id, name, key_prefix, key_hash, scopes, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		RETURNING id, name, key_prefix, scopes, expires_at, last_used_at, revoked_at, created_at
+	`, userId, strings.TrimSpace(*req.Name), keyPrefix, utils_v1.HashDataSHA512(rawKey), string(scopesJSON), req.ExpiresAt).Scan(&key).Error
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to create API key", err, http.StatusInternalServerError)
+	}
+	key.Scopes = req.Scopes
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_201, "API key created, store it now as it will not be shown again",
+		mdlFeatureOne.CreateAPIKeyResponse{APIKey: key, Key: rawKey}, http.StatusCreated)
+}
+
+func GetAPIKeys(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Query keys, never returning hashes
+	keys := []mdlFeatureOne.APIKey{}
+	err := config.DBConnList[0].Raw(`
+		SELECT id, name, key_prefix, scopes, expires_at, last_used_at, revoked_at, created_at
+		FROM api_keys
+		WHERE user_id = ?
+		ORDER BY created_at DESC
+	`, userId).Scan(&keys).Error
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+
+	for i := range keys {
+		json.Unmarshal([]byte(keys[i].ScopesJSON), &keys[i].Scopes)
+	}
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "API keys retrieved", keys, http.StatusOK)
+}
+
+func RevokeAPIKey(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Revoke only the caller's own key
+	result := config.DBConnList[0].Exec(
+		"UPDATE api_keys SET revoked_at = NOW() WHERE id = ? AND user_id = ? AND revoked_at IS NULL",
+		c.Params("id"), userId,
+	)
+	if result.Error != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", result.Error, http.StatusInternalServerError)
+	}
+	if result.RowsAffected == 0 {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_404, "API key not found", nil, http.StatusNotFound)
+	}
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "API key revoked", nil, http.StatusOK)
+}
@@ -5,8 +5,13 @@ import (
 	"go_template_v3/pkg/config"
 	"go_template_v3/pkg/global/utils"
 	mdlFeatureOne "go_template_v3/pkg/services/featureOne/model"
+	"html"
+	"log"
+	"math"
 	"net/http"
 	"net/smtp"
+	"strconv"
+	"strings"
 	"time"
 
 	v1 "github.com/FDSAP-Git-Org/hephaestus/helper/v1"
@@ -35,23 +40,39 @@ func Register(c fiber.Ctx) error {
 			nil, http.StatusBadRequest)
 	}
 
+	// Hash password. It is hashed before the existence check so both
+	// outcomes take the same time.
+	hashedPassword, err := utils_v1.HashData(*req.Password)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500,
+			"Failed to hash password", err, http.StatusInternalServerError)
+	}
+
 	// Perform a quick raw query to check if the ID exists.
-	var exists int
-	existenceQuery := "SELECT 1 FROM users WHERE email = ? AND deleted_at IS NULL LIMIT 1"
-	err := config.DBConnList[0].Raw(existenceQuery, *req.Email).Scan(&exists).Error
+	var existing struct {
+		Id   int
+		Name *string
+	}
+	existenceQuery := "SELECT id, name FROM users WHERE email = ? AND deleted_at IS NULL LIMIT 1"
+	err = config.DBConnList[0].Raw(existenceQuery, *req.Email).Scan(&existing).Error
 
 	if err != nil {
 		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error during existence check", err, http.StatusInternalServerError)
 	}
-	if exists == 1 {
-		return v1.JSONResponseWithError(c, respcode.ERR_CODE_404, "Email already exists", nil, http.StatusNotFound)
-	}
 
-	// Hash password
-	hashedPassword, err := utils_v1.HashData(*req.Password)
-	if err != nil {
-		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500,
-			"Failed to hash password", err, http.StatusInternalServerError)
+	// A taken email gets the same response as a new account, so the endpoint
+	// does not reveal who is registered. The owner is told by email instead.
+	if existing.Id != 0 {
+		name := ""
+		if existing.Name != nil {
+			name = *existing.Name
+		}
+		go func() {
+			if err := sendAccountExistsEmail(*req.Email, name); err != nil {
+				log.Printf("Error sending account exists email to user %d: %v", existing.Id, err)
+			}
+		}()
+		return registeredResponse(c)
 	}
 
 	// Call DB function (create register_user function in PostgreSQL)
@@ -68,8 +89,61 @@ func Register(c fiber.Ctx) error {
 			"Registration failed", err, http.StatusInternalServerError)
 	}
 
+	// Give the new account the default role
+	var userId int
+	config.DBConnList[0].Raw("SELECT id FROM users WHERE email = ? AND deleted_at IS NULL", *req.Email).Scan(&userId)
+	if err := utils.AssignUserRole(userId, utils.DefaultUserRole()); err != nil {
+		log.Printf("Failed to assign default role to user %d: %v", userId, err)
+	}
+
+	// New accounts start unverified until the emailed link is opened
+	name := ""
+	if req.Name != nil {
+		name = *req.Name
+	}
+	go func() {
+		if err := sendVerificationEmail(userId, *req.Email, name); err != nil {
+			log.Printf("Error sending verification email to user %d: %v", userId, err)
+		}
+	}()
+
+	return registeredResponse(c)
+}
+
+func registeredResponse(c fiber.Ctx) error {
 	return v1.JSONResponseWithData(c, respcode.SUC_CODE_201,
-		"User registered successfully", nil, http.StatusCreated)
+		"User registered successfully, please verify your email", nil, http.StatusCreated)
+}
+
+func sendAccountExistsEmail(email, name string) error {
+	subject := "Someone tried to register with your email"
+
+	htmlBody := fmt.Sprintf(`
+	<!DOCTYPE html>
+	<html>
+	<head>
+		<style>
+			body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+			.container { max-width: 600px; margin: 0 auto; padding: 20px; }
+			.footer { margin-top: 30px; font-size: 12px; color: #666; }
+		</style>
+	</head>
+	<body>
+		<div class="container">
+			<h2>Registration Attempt</h2>
+			<p>Hello %s,</p>
+			<p>Someone tried to create a new account with this email address, which already has an account.</p>
+			<p>If it was you, sign in instead or reset your password if you have forgotten it.</p>
+			<p>If it wasn't you, you can ignore this email; your account has not been changed.</p>
+			<div class="footer">
+				<p>This is an automated message, please do not reply to this email.</p>
+			</div>
+		</div>
+	</body>
+	</html>
+	`, html.EscapeString(name))
+
+	return sendWithSMTP(email, subject, htmlBody)
 }
 
 func Login(c fiber.Ctx) error {
@@ -89,20 +163,19 @@ func Login(c fiber.Ctx) error {
 			"Password is required", nil, http.StatusBadRequest)
 	}
 
-	// Perform a quick raw query to check if the email exists
-	var exists int
-	existenceQuery := "SELECT 1 FROM users WHERE email = ? AND deleted_at IS NULL LIMIT 1"
-	err := config.DBConnList[0].Raw(existenceQuery, *req.Email).Scan(&exists).Error
-
+	// Refuse attempts while the account or IP is locked out. The check runs
+	// before any lookup so locked responses look the same for every email.
+	ip := c.IP()
+	retryAfter, err := utils.CheckLoginAllowed(*req.Email, ip)
 	if err != nil {
-		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error during existence check", err, http.StatusInternalServerError)
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, respcode.ERR_CODE_500_MSG, err, http.StatusInternalServerError)
 	}
-	if exists == 0 {
-		return v1.JSONResponseWithError(c, respcode.ERR_CODE_401, "Invalid Credentials", nil, http.StatusNotFound)
+	if retryAfter > 0 {
+		return tooManyAttempts(c, retryAfter, "Too many failed login attempts, try again later")
 	}
 
 	var userResult mdlFeatureOne.User
-	getUserQuery := "SELECT * FROM users WHERE email = ?"
+	getUserQuery := "SELECT * FROM users WHERE email = ? AND deleted_at IS NULL"
 	err = config.DBConnList[0].Raw(getUserQuery, *req.Email).Scan(&userResult).Error
 
 	// Check if user was found
@@ -110,42 +183,71 @@ func Login(c fiber.Ctx) error {
 		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, respcode.ERR_CODE_500_MSG, nil, http.StatusInternalServerError)
 	}
 
-	// Verify password
-	if !utils_v1.CheckHashData(*req.Password, *userResult.Password) {
+	// Verify password. Unknown emails are checked against a dummy hash so
+	// both cases take the same time and return the same response.
+	passwordHash := utils.DummyPasswordHash()
+	if userResult.Id != nil && userResult.Password != nil {
+		passwordHash = *userResult.Password
+	}
+	if !utils_v1.CheckHashData(*req.Password, passwordHash) || userResult.Id == nil {
+		utils.RecordLoginFailure(*req.Email, ip)
 		return v1.JSONResponseWithError(c, respcode.ERR_CODE_401,
 			"Invalid credentials", nil, http.StatusUnauthorized)
 	}
 
-	// Generate JWT token
-	claims := map[string]interface{}{
-		"userId": *userResult.Id,
-		"email":  *userResult.Email,
-		"name":   *userResult.Name,
+	device := ""
+	if req.Device != nil {
+		device = *req.Device
 	}
+	return completeLogin(c, userResult, device)
+}
+
+// tooManyAttempts answers a locked-out caller with 429 and when to retry
+func tooManyAttempts(c fiber.Ctx, retryAfter time.Duration, message string) error {
+	c.Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	return v1.JSONResponseWithError(c, utils.RespCodeTooManyRequests, message, nil, http.StatusTooManyRequests)
+}
 
-	token, err := utils_v1.GenerateJWTSignedString(
-		[]byte(utils_v1.GetEnv("JWT_SECRET")),
-		24, // 24 hours
-		claims,
-	)
+func Logout(c fiber.Ctx) error {
+	userId := utils.GetUserId(c)
 
-	if err != nil {
-		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500,
-			"Token generation failed", err, http.StatusInternalServerError)
+	var req mdlFeatureOne.LogoutRequest
+	if len(c.Body()) > 0 {
+		if err := c.Bind().Body(&req); err != nil {
+			return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid body", err, http.StatusBadRequest)
+		}
 	}
 
-	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200,
-		"Login successful",
-		map[string]string{"token": token},
-		http.StatusOK)
-}
+	// Revoke the access token used for this request
+	tokenId, _ := c.Locals("tokenId").(string)
+	expiresAt, _ := c.Locals("tokenExpiresAt").(time.Time)
+	if err := utils.RevokeToken(tokenId, expiresAt); err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to revoke token", err, http.StatusInternalServerError)
+	}
+
+	// End the session, which also revokes its refresh tokens
+	if sessionId := utils.GetSessionId(c); sessionId != 0 {
+		if _, err := utils.RevokeSession(userId, sessionId); err != nil {
+			return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to end session", err, http.StatusInternalServerError)
+		}
+	}
+
+	// Revoke the refresh token family so it cannot mint new access tokens
+	if req.RefreshToken != nil && *req.RefreshToken != "" {
+		var familyId string
+		config.DBConnList[0].Raw(
+			"SELECT family_id FROM refresh_tokens WHERE token_hash = ? AND user_id = ?",
+			utils_v1.HashDataSHA512(*req.RefreshToken), userId,
+		).Scan(&familyId)
+		if familyId != "" {
+			revokeRefreshTokenFamily(familyId)
+		}
+	}
 
-func Logout(c fiber.Ctx) error {
-	// With JWT, logout is handled client-side by removing the token
-	// Optionally implement token blacklisting here
 	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200,
 		"Logout successful", nil, http.StatusOK)
 }
+
 func UpdateUser(c fiber.Ctx) error {
 	// 1. Get user ID from JWT
 	userId := utils.GetUserId(c)
@@ -156,13 +258,51 @@ func UpdateUser(c fiber.Ctx) error {
 		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid body", err, http.StatusBadRequest)
 	}
 
-	// 3. Add userId to the payload
-	reqBody["userId"] = userId
+	// 3. Only profile fields are copied. Credentials and account state have
+	// their own endpoints.
+	payload := map[string]interface{}{}
+	for _, field := range updatableUserFields {
+		if value, ok := reqBody[field]; ok {
+			payload[field] = value
+		}
+	}
+
+	// 4. A new email only replaces the old one once the link sent to it is opened
+	if _, ok := reqBody["email"]; ok {
+		newEmail, _ := reqBody["email"].(string)
+		newEmail = strings.TrimSpace(newEmail)
+		if !utils_v1.IsEmailValid(newEmail) {
+			return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Valid email required", nil, http.StatusBadRequest)
+		}
+		currentEmail := utils.GetUserEmail(c)
+		if !strings.EqualFold(newEmail, currentEmail) {
+			var name string
+			config.DBConnList[0].Raw("SELECT COALESCE(name, '') FROM users WHERE id = ?", userId).Scan(&name)
+			go func() {
+				if err := sendEmailChangeVerification(userId, currentEmail, newEmail, name); err != nil {
+					log.Printf("Failed to send email change link for user %d: %v", userId, err)
+				}
+			}()
+			if len(payload) == 0 {
+				return v1.JSONResponseWithData(c, respcode.SUC_CODE_202,
+					"Verification link sent to the new email address", nil, http.StatusAccepted)
+			}
+		}
+	}
+	if len(payload) == 0 {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "No updatable fields provided", nil, http.StatusBadRequest)
+	}
+
+	// 5. Add userId to the payload
+	payload["userId"] = userId
 
-	// 4. Execute the query
-	return utils.ExecuteDBFunction(c, "SELECT update_user_v3($1)", reqBody)
+	// 6. Execute the query
+	return utils.ExecuteDBFunction(c, "SELECT update_user_v3($1)", payload)
 }
 
+// updatableUserFields are the profile fields UpdateUser passes through
+var updatableUserFields = []string{"name"}
+
 func ForgotPassword(c fiber.Ctx) error {
 	var req struct {
 		Email *string `json:"email"`
@@ -175,14 +315,17 @@ func ForgotPassword(c fiber.Ctx) error {
 		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Valid email required", nil, http.StatusBadRequest)
 	}
 
-	// Check user exists and get user info
+	// Answer the same way whether or not the email is registered, so the
+	// endpoint cannot be used to find accounts. The token only goes out by email.
+	const sentMessage = "If the email is registered, a reset link has been sent"
+
 	var user struct {
 		Id    int
 		Name  string
 		Email string
 	}
 	if err := config.DBConnList[0].Raw("SELECT id, name, email FROM users WHERE email = ? AND deleted_at IS NULL", *req.Email).Scan(&user).Error; err != nil || user.Id == 0 {
-		return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "If email exists, reset link sent", nil, http.StatusOK)
+		return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, sentMessage, nil, http.StatusOK)
 	}
 
 	// Generate and store token
@@ -193,20 +336,18 @@ func ForgotPassword(c fiber.Ctx) error {
 	// Invalidate old tokens and create new one
 	config.DBConnList[0].Exec("UPDATE password_reset_tokens SET used_at = NOW() WHERE user_id = ? AND used_at IS NULL", user.Id)
 	if err := config.DBConnList[0].Exec("INSERT INTO password_reset_tokens (user_id, token_hash, expires_at) VALUES (?, ?, ?)", user.Id, tokenHash, expiresAt).Error; err != nil {
-		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to create reset token", err, http.StatusInternalServerError)
+		log.Printf("Error creating reset token for user %d: %v", user.Id, err)
+		return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, sentMessage, nil, http.StatusOK)
 	}
 
 	// Send email with reset link
 	go func() {
 		if err := sendPasswordResetEmail(user.Email, user.Name, token); err != nil {
-			// Log the error but don't fail the request for security reasons
-			fmt.Printf("Failed to send reset email to %s: %v\n", user.Email, err)
+			log.Printf("Error sending reset email to user %d: %v", user.Id, err)
 		}
 	}()
 
-	// In development, return token for testing
-	response := map[string]interface{}{"token": token}
-	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Password reset initiated", response, http.StatusOK)
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, sentMessage, nil, http.StatusOK)
 }
 
 func VerifyResetToken(c fiber.Ctx) error {
@@ -275,6 +416,11 @@ func ResetPassword(c fiber.Ctx) error {
 	config.DBConnList[0].Exec("UPDATE users SET password = ?, updated_at = NOW() WHERE id = ?", hashedPassword, tokenInfo.UserId)
 	config.DBConnList[0].Exec("UPDATE password_reset_tokens SET used_at = NOW() WHERE id = ?", tokenInfo.TokenId)
 
+	// Log out every device, including whoever holds a stolen refresh token
+	if _, err := utils.RevokeUserSessions(tokenInfo.UserId, 0); err != nil {
+		log.Printf("Error revoking sessions for user %d: %v", tokenInfo.UserId, err)
+	}
+
 	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Password reset successfully", nil, http.StatusOK)
 }
 
@@ -323,12 +469,6 @@ func sendPasswordResetEmail(email, name, token string) error {
 	</html>
 	`, name, resetLink, resetLink)
 
-	fmt.Printf("=== PASSWORD RESET EMAIL ===\n")
-	fmt.Printf("To: %s\n", email)
-	fmt.Printf("Subject: %s\n", subject)
-	fmt.Printf("Reset Link: %s\n", resetLink)
-	fmt.Printf("=======================\n")
-
 	// Send via SMTP
 	return sendWithSMTP(email, subject, htmlBody)
 }
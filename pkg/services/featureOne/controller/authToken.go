@@ -0,0 +1,218 @@
+package ctrFeatureOne
+
+import (
+	"errors"
+	"go_template_v3/pkg/config"
+	"go_template_v3/pkg/global/utils"
+	mdlFeatureOne "go_template_v3/pkg/services/featureOne/model"
+	"log"
+	"net/http"
+	"time"
+
+	v1 "github.com/FDSAP-Git-Org/hephaestus/helper/v1"
+	"github.com/FDSAP-Git-Org/hephaestus/respcode"
+	utils_v1 "github.com/FDSAP-Git-Org/hephaestus/utils/v1"
+	"github.com/gofiber/fiber/v3"
+)
+
+func RefreshToken(c fiber.Ctx) error {
+	var req mdlFeatureOne.RefreshTokenRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid body", err, http.StatusBadRequest)
+	}
+
+	if req.RefreshToken == nil || *req.RefreshToken == "" {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Refresh token is required", nil, http.StatusBadRequest)
+	}
+
+	// 1. Look up the presented token by hash
+	var record mdlFeatureOne.RefreshTokenRecord
+	err := config.DBConnList[0].Raw(`
+		SELECT id, user_id, family_id, session_id, expires_at
+		FROM refresh_tokens
+		WHERE token_hash = ?
+	`, utils_v1.HashDataSHA512(*req.RefreshToken)).Scan(&record).Error
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+	if record.Id == 0 {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_401, "Invalid refresh token", nil, http.StatusUnauthorized)
+	}
+
+	// 2. Consume it. A token that was already used or revoked means it was
+	// replayed, so the whole family is cut off.
+	consume := config.DBConnList[0].Exec(`
+		UPDATE refresh_tokens SET used_at = NOW()
+		WHERE id = ? AND used_at IS NULL AND revoked_at IS NULL
+	`, record.Id)
+	if consume.Error != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", consume.Error, http.StatusInternalServerError)
+	}
+	if consume.RowsAffected == 0 {
+		log.Printf("Refresh token reuse detected for user %d, revoking family %s", record.UserId, record.FamilyId)
+		revokeRefreshTokenFamily(record.FamilyId)
+		if record.SessionId != nil {
+			utils.RevokeSession(record.UserId, *record.SessionId)
+		}
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_401, "Refresh token has been revoked", nil, http.StatusUnauthorized)
+	}
+
+	if time.Now().After(record.ExpiresAt) {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_401, "Refresh token expired", nil, http.StatusUnauthorized)
+	}
+
+	// 3. Tokens from a revoked session cannot be refreshed
+	sessionId := 0
+	if record.SessionId != nil {
+		active, err := utils.IsSessionActive(*record.SessionId)
+		if err != nil {
+			return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+		}
+		if !active {
+			return v1.JSONResponseWithError(c, respcode.ERR_CODE_401, "Session has been revoked", nil, http.StatusUnauthorized)
+		}
+		sessionId = *record.SessionId
+	}
+
+	// 4. Reload the user so deleted accounts cannot refresh
+	var user mdlFeatureOne.User
+	err = config.DBConnList[0].Raw("SELECT id, email, name, email_verified_at FROM users WHERE id = ? AND deleted_at IS NULL", record.UserId).Scan(&user).Error
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+	if user.Id == nil {
+		revokeRefreshTokenFamily(record.FamilyId)
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_401, "Invalid refresh token", nil, http.StatusUnauthorized)
+	}
+
+	// 5. Rotate within the same family
+	tokens, err := issueTokenPair(user, sessionId, record.FamilyId)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Token generation failed", err, http.StatusInternalServerError)
+	}
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Token refreshed", tokens, http.StatusOK)
+}
+
+// completeLogin finishes a login once the user is authenticated. Accounts
+// with two-factor enabled get a short-lived pending token that must be
+// exchanged at /auth/mfa/verify; everyone else gets a new session.
+func completeLogin(c fiber.Ctx, user mdlFeatureOne.User, device string) error {
+	mfaEnabled, err := isMFAEnabled(*user.Id)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, respcode.ERR_CODE_500_MSG, err, http.StatusInternalServerError)
+	}
+	if mfaEnabled {
+		mfaToken, _, err := utils.GenerateToken(utils.TokenTypeMFAPending, map[string]interface{}{
+			"userId": *user.Id,
+			"email":  *user.Email,
+		}, utils.MFAPendingTTL())
+		if err != nil {
+			return v1.JSONResponseWithError(c, respcode.ERR_CODE_500,
+				"Token generation failed", err, http.StatusInternalServerError)
+		}
+
+		return v1.JSONResponseWithData(c, respcode.SUC_CODE_200,
+			"Two-factor authentication required",
+			mdlFeatureOne.MFAPendingResponse{
+				MFARequired: true,
+				MFAToken:    mfaToken,
+				ExpiresIn:   int(utils.MFAPendingTTL().Seconds()),
+			},
+			http.StatusOK)
+	}
+
+	// Only reset the lockout counter once no second factor is pending, or
+	// knowing the password would give unlimited code guesses
+	if user.Email != nil {
+		utils.ResetLoginFailures(*user.Email)
+	}
+
+	// Start a session with its own access and refresh tokens
+	tokens, err := startSession(c, user, device)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500,
+			"Token generation failed", err, http.StatusInternalServerError)
+	}
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200,
+		"Login successful",
+		tokens,
+		http.StatusOK)
+}
+
+// startSession records a login and issues its first token pair
+func startSession(c fiber.Ctx, user mdlFeatureOne.User, device string) (*mdlFeatureOne.TokenPair, error) {
+	if user.Id == nil {
+		return nil, errors.New("incomplete user record")
+	}
+
+	sessionId, err := utils.CreateSession(c, *user.Id, device)
+	if err != nil {
+		return nil, err
+	}
+
+	return issueTokenPair(user, sessionId, "")
+}
+
+// issueTokenPair signs a new access token bound to the session and stores a
+// new refresh token in the given family. An empty familyId starts a new family.
+func issueTokenPair(user mdlFeatureOne.User, sessionId int, familyId string) (*mdlFeatureOne.TokenPair, error) {
+	if user.Id == nil || user.Email == nil {
+		return nil, errors.New("incomplete user record")
+	}
+
+	name := ""
+	if user.Name != nil {
+		name = *user.Name
+	}
+
+	roles, permissions, err := utils.GetUserAccess(*user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := map[string]interface{}{
+		"userId":        *user.Id,
+		"email":         *user.Email,
+		"name":          name,
+		"roles":         roles,
+		"permissions":   permissions,
+		"emailVerified": user.EmailVerifiedAt != nil,
+		"sessionId":     sessionId,
+	}
+
+	accessToken, _, err := utils.GenerateToken(utils.TokenTypeAccess, claims, utils.AccessTokenTTL())
+	if err != nil {
+		return nil, err
+	}
+
+	if familyId == "" {
+		familyId = utils.GenerateOpaqueToken(32)
+	}
+
+	refreshToken := utils.GenerateOpaqueToken(64)
+	err = config.DBConnList[0].Exec(`
+		INSERT INTO refresh_tokens (user_id, family_id, session_id, token_hash, expires_at)
+		VALUES (?, ?, NULLIF(?, 0), ?, ?)
+	`, *user.Id, familyId, sessionId, utils_v1.HashDataSHA512(refreshToken), time.Now().Add(utils.RefreshTokenTTL())).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &mdlFeatureOne.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(utils.AccessTokenTTL().Seconds()),
+	}, nil
+}
+
+func revokeRefreshTokenFamily(familyId string) {
+	err := config.DBConnList[0].Exec(
+		"UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = ? AND revoked_at IS NULL",
+		familyId,
+	).Error
+	if err != nil {
+		log.Printf("Error revoking refresh token family %s: %v", familyId, err)
+	}
+}
@@ -0,0 +1,456 @@
+package ctrFeatureOne
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go_template_v3/pkg/config"
+	"go_template_v3/pkg/global/utils"
+	"go_template_v3/pkg/jobs"
+	mdlFeatureOne "go_template_v3/pkg/services/featureOne/model"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	v1 "github.com/FDSAP-Git-Org/hephaestus/helper/v1"
+	"github.com/FDSAP-Git-Org/hephaestus/respcode"
+	"github.com/gofiber/fiber/v3"
+)
+
+// Job types stored in batch_jobs.job_type
+const (
+	jobTypeExpenseBatchUpdate = "expense_batch_update"
+	// CSV batch uploads now run as expense_import jobs, this type is kept so
+	// jobs queued before then still finish and can be retried
+	jobTypeExpenseBatchUploadCSV = "expense_batch_upload_csv"
+	jobTypeAccountPurge          = "account_purge"
+)
+
+// RegisterJobHandlers wires this service's background jobs into the queue
+func RegisterJobHandlers() {
+	jobs.Register(jobTypeExpenseBatchUpdate, processBatchUpdatesAsync)
+	jobs.Register(jobTypeExpenseBatchUploadCSV, processBatchUploadExpensesAsync)
+	jobs.Register(jobTypeAccountPurge, processAccountPurgeAsync)
+	jobs.Register(jobTypeExpenseImport, processExpenseImportAsync)
+	jobs.Register(jobTypeExpenseExport, processExpenseExportAsync)
+	jobs.OnFinish(expenseImportFinished)
+}
+
+// CheckStoragePaths refuses storage settings that would put users' files
+// where anyone can download them
+func CheckStoragePaths() error {
+	if _, err := importUploadPath(); err != nil {
+		return err
+	}
+	_, err := exportPath()
+	return err
+}
+
+func processBatchUpdatesAsync(ctx context.Context, job *jobs.Job) error {
+	var updates []map[string]interface{}
+	if err := job.DecodePayload(&updates); err != nil {
+		return err
+	}
+
+	// Resume after the items a previous run already finished
+	for i := job.ProcessedItems; i < len(updates); i++ {
+		if err := job.CheckCancelled(); err != nil {
+			return err
+		}
+		if err := job.Throttle(ctx); err != nil {
+			return err
+		}
+		// The same checks as a synchronous batch, amounts included
+		expensePayload, _, message := batchUpdatePayload(updates[i], job.UserId)
+		if message != "" {
+			job.ItemDone(batchUpdateError(i, updates[i]["expenseId"], message))
+			continue
+		}
+
+		// Execute the update
+		result, err := utils.ExecuteDBFunctionRaw("SELECT update_expense_v3($1)", expensePayload)
+		if err != nil {
+			log.Printf("Error executing update for expense %v: %v", expensePayload["expenseId"], err)
+			job.ItemDone(map[string]interface{}{
+				"index":     i,
+				"expenseId": expensePayload["expenseId"],
+				"message":   err.Error(),
+			})
+		} else if result["success"] == true {
+			job.ItemDone(nil)
+		} else {
+			// Extract only the message from the result
+			message := "Update failed"
+			if msg, ok := result["message"].(string); ok {
+				message = msg
+			} else if errMsg, ok := result["error"].(string); ok {
+				message = errMsg
+			}
+
+			job.ItemDone(map[string]interface{}{
+				"index":     i,
+				"expenseId": expensePayload["expenseId"],
+				"message":   message,
+			})
+		}
+	}
+
+	return nil
+}
+
+func processBatchUploadExpensesAsync(ctx context.Context, job *jobs.Job) error {
+	var expenses []map[string]interface{}
+	if err := job.DecodePayload(&expenses); err != nil {
+		return err
+	}
+
+	// Resume after the rows a previous run already inserted
+	for i := job.ProcessedItems; i < len(expenses); i++ {
+		if err := job.CheckCancelled(); err != nil {
+			return err
+		}
+		if err := job.Throttle(ctx); err != nil {
+			return err
+		}
+		expense := expenses[i]
+		expense["userId"] = job.UserId
+
+		result, err := utils.ExecuteDBFunctionRaw("SELECT add_expense_v3($1)", expense)
+		if err != nil {
+			log.Printf("Error inserting expense row %d: %v", i+1, err)
+			job.ItemDone(map[string]interface{}{
+				"index":   i,
+				"status":  "error",
+				"message": err.Error(),
+			})
+		} else if result["success"] == true {
+			job.ItemDone(nil)
+		} else {
+			msg := "Insert failed"
+			if m, ok := result["message"].(string); ok {
+				msg = m
+			}
+			job.ItemDone(map[string]interface{}{
+				"index":   i,
+				"status":  "error",
+				"message": msg,
+			})
+		}
+	}
+
+	return nil
+}
+
+// processAccountPurgeAsync removes a deleted account's expenses and receipt
+// files. It works from what is left in the table, so a resumed run simply
+// picks up the remaining rows.
+func processAccountPurgeAsync(ctx context.Context, job *jobs.Job) error {
+	var expenses []struct {
+		Id       int
+		ImageUrl *string
+	}
+	err := config.DBConnList[0].Raw("SELECT id, image_url FROM expenses WHERE user_id = ? ORDER BY id", job.UserId).Scan(&expenses).Error
+	if err != nil {
+		return err
+	}
+
+	for _, expense := range expenses {
+		if err := job.CheckCancelled(); err != nil {
+			return err
+		}
+		if err := job.Throttle(ctx); err != nil {
+			return err
+		}
+
+		// A missing receipt file should not keep the expense around
+		if expense.ImageUrl != nil && *expense.ImageUrl != "" {
+			if err := utils.DeleteUploadedFile(*expense.ImageUrl); err != nil {
+				log.Printf("Warning: Failed to delete image file %s: %v", *expense.ImageUrl, err)
+			}
+		}
+
+		if err := config.DBConnList[0].Exec("DELETE FROM expenses WHERE id = ?", expense.Id).Error; err != nil {
+			job.ItemDone(map[string]interface{}{
+				"expenseId": expense.Id,
+				"message":   err.Error(),
+			})
+		} else {
+			job.ItemDone(nil)
+		}
+	}
+
+	return nil
+}
+
+func GetBatchJobs(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Build filters from query parameters
+	limit := fiber.Query[int](c, "limit")
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	offset := fiber.Query[int](c, "offset")
+	if offset < 0 {
+		offset = 0
+	}
+
+	query := config.DBConnList[0].Table("batch_jobs").Where("user_id = ?", userId)
+	if status := fiber.Query[string](c, "status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if jobType := fiber.Query[string](c, "jobType"); jobType != "" {
+		query = query.Where("job_type = ?", jobType)
+	}
+
+	// 3. Count and fetch the page, newest first
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to fetch jobs", err, http.StatusInternalServerError)
+	}
+
+	batchJobs := []mdlFeatureOne.BatchJob{}
+	err := query.
+		Select("id, job_type, status, total_items, processed_items, successful_items, failed_items, created_at, updated_at, completed_at").
+		Order("id DESC").
+		Limit(limit).
+		Offset(offset).
+		Scan(&batchJobs).Error
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to fetch jobs", err, http.StatusInternalServerError)
+	}
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Jobs retrieved successfully",
+		mdlFeatureOne.BatchJobList{Jobs: batchJobs, Total: int(total), Limit: limit, Offset: offset}, http.StatusOK)
+}
+
+func CancelBatchJob(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Get job ID from params
+	jobId, err := strconv.Atoi(c.Params("jobId"))
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid job ID", err, http.StatusBadRequest)
+	}
+
+	// 3. Pending jobs stop now, running jobs after their current item
+	status, err := jobs.Cancel(jobId, userId)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to cancel job", err, http.StatusInternalServerError)
+	}
+	if status == "" {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_404, "No running job found", nil, http.StatusNotFound)
+	}
+
+	message := "Job cancelled"
+	if status != "cancelled" {
+		message = "Cancellation requested, the job stops after its current item"
+	}
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, message,
+		map[string]interface{}{"jobId": jobId, "status": status}, http.StatusAccepted)
+}
+
+func RetryFailedBatchJob(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Get job ID from params
+	jobId, err := strconv.Atoi(c.Params("jobId"))
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid job ID", err, http.StatusBadRequest)
+	}
+
+	// 3. Load the finished job with its payload and results
+	var job struct {
+		JobType string
+		Status  string
+		Payload *string
+		Results *string
+	}
+	err = config.DBConnList[0].Raw(
+		"SELECT job_type, status, payload, results FROM batch_jobs WHERE id = ? AND user_id = ?",
+		jobId, userId,
+	).Scan(&job).Error
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to fetch job", err, http.StatusInternalServerError)
+	}
+	if job.JobType == "" {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_404, "Job not found", nil, http.StatusNotFound)
+	}
+	if job.JobType != jobTypeExpenseBatchUpdate && job.JobType != jobTypeExpenseBatchUploadCSV && job.JobType != jobTypeExpenseImport {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "This job type cannot be retried", nil, http.StatusBadRequest)
+	}
+	if job.Status == "pending" || job.Status == "processing" {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_409, "Job is still running", nil, http.StatusConflict)
+	}
+	if job.Payload == nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Job has no stored items to retry", nil, http.StatusBadRequest)
+	}
+
+	// Imports, CSV batch uploads included, keep their rejected rows in
+	// expense_import_errors rather than in results
+	if job.JobType == jobTypeExpenseImport {
+		return retryExpenseImport(c, userId, jobId, *job.Payload)
+	}
+
+	// 4. Pick the items whose index is recorded as failed. The payload is
+	// decoded as the handler decodes it, so amounts stay exact.
+	var items []map[string]interface{}
+	var results []map[string]interface{}
+	stored := jobs.Job{Payload: json.RawMessage(*job.Payload)}
+	if err := stored.DecodePayload(&items); err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to parse job data", err, http.StatusInternalServerError)
+	}
+	if job.Results != nil {
+		json.Unmarshal([]byte(*job.Results), &results)
+	}
+
+	retryItems := make([]map[string]interface{}, 0)
+	seen := map[int]bool{}
+	for _, result := range results {
+		index, ok := result["index"].(float64)
+		i := int(index)
+		if !ok || i < 0 || i >= len(items) || seen[i] {
+			continue
+		}
+		seen[i] = true
+		retryItems = append(retryItems, items[i])
+	}
+	if len(retryItems) == 0 {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Job has no failed items", nil, http.StatusBadRequest)
+	}
+
+	// 5. Queue them as a new job of the same type
+	retryJobId, err := jobs.Enqueue(userId, job.JobType, len(retryItems), retryItems)
+	if err != nil {
+		log.Printf("Error creating retry job for job %d: %v", jobId, err)
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to create batch job", err, http.StatusInternalServerError)
+	}
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200,
+		"Retry job created successfully",
+		map[string]interface{}{
+			"jobId":      retryJobId,
+			"retryOf":    jobId,
+			"totalItems": len(retryItems),
+			"status":     "pending",
+		},
+		http.StatusAccepted)
+}
+
+// sseKeepAlive is how often an idle stream sends a comment line and
+// re-reads the job, which also covers any missed notification
+const sseKeepAlive = 15 * time.Second
+
+func StreamBatchJobEvents(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Get job ID from params
+	jobId, err := strconv.Atoi(c.Params("jobId"))
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid job ID", err, http.StatusBadRequest)
+	}
+
+	// 3. Subscribe before reading the job so no update falls in between
+	events, unsubscribe := jobs.Subscribe(jobId)
+
+	job, err := getBatchJob(jobId, userId)
+	if err != nil {
+		unsubscribe()
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to fetch job status", err, http.StatusInternalServerError)
+	}
+	if job == nil {
+		unsubscribe()
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_404, "Job not found", nil, http.StatusNotFound)
+	}
+
+	// 4. Stream the current state, then every change until the job ends
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	return c.SendStreamWriter(func(w *bufio.Writer) {
+		defer unsubscribe()
+
+		if !writeJobSnapshot(w, job) || jobs.IsFinalStatus(job.Status) {
+			return
+		}
+
+		ticker := time.NewTicker(sseKeepAlive)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case event := <-events:
+				if !writeSSE(w, event.Type, event) {
+					return
+				}
+				if event.Type == jobs.EventStatus && jobs.IsFinalStatus(event.Status) {
+					return
+				}
+			case <-ticker.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+				if w.Flush() != nil {
+					return
+				}
+
+				job, err := getBatchJob(jobId, userId)
+				if err != nil || job == nil {
+					continue
+				}
+				if jobs.IsFinalStatus(job.Status) {
+					writeJobSnapshot(w, job)
+					return
+				}
+			}
+		}
+	})
+}
+
+func getBatchJob(jobId, userId int) (*mdlFeatureOne.BatchJob, error) {
+	var job mdlFeatureOne.BatchJob
+	err := config.DBConnList[0].Raw(`
+		SELECT id, job_type, status, total_items, processed_items, successful_items, failed_items, created_at, updated_at, completed_at
+		FROM batch_jobs
+		WHERE id = ? AND user_id = ?
+	`, jobId, userId).Scan(&job).Error
+	if err != nil || job.Id == 0 {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// writeJobSnapshot sends the job's current counters followed by its status
+func writeJobSnapshot(w *bufio.Writer, job *mdlFeatureOne.BatchJob) bool {
+	event := jobs.Event{
+		JobId:           job.Id,
+		Type:            jobs.EventProgress,
+		TotalItems:      job.TotalItems,
+		ProcessedItems:  job.ProcessedItems,
+		SuccessfulItems: job.SuccessfulItems,
+		FailedItems:     job.FailedItems,
+	}
+	if !writeSSE(w, event.Type, event) {
+		return false
+	}
+
+	event.Type = jobs.EventStatus
+	event.Status = job.Status
+	return writeSSE(w, event.Type, event)
+}
+
+// writeSSE sends one event and reports whether the client is still there
+func writeSSE(w *bufio.Writer, event string, data interface{}) bool {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return false
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return w.Flush() == nil
+}
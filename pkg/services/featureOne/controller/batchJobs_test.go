@@ -0,0 +1,84 @@
+package ctrFeatureOne
+
+import (
+	"bytes"
+	"encoding/json"
+	"go_template_v3/pkg/jobs"
+	"go_template_v3/pkg/money"
+	"strings"
+	"testing"
+)
+
+// queueBatchUpdate stores a request body as BatchUpdateExpensesAsync and
+// jobs.Enqueue do, and decodes it as the worker does
+func queueBatchUpdate(t *testing.T, body string) []map[string]interface{} {
+	t.Helper()
+	var req []map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(body)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&req); err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := &jobs.Job{Payload: payload}
+	var updates []map[string]interface{}
+	if err := job.DecodePayload(&updates); err != nil {
+		t.Fatal(err)
+	}
+	return updates
+}
+
+func TestQueuedBatchUpdateKeepsAmountsExact(t *testing.T) {
+	updates := queueBatchUpdate(t, `[
+		{"expenseId": 1, "amount": 12345678901234.5678},
+		{"expenseId": 2, "amount": 0.1234},
+		{"expenseId": 3, "amount": 12345678901234.5678, "currency": "KWD"},
+		{"expenseId": 4, "amount": "19.995", "currency": "kwd"}
+	]`)
+
+	tests := []struct {
+		want    string
+		wantErr string
+	}{
+		{"12345678901234.5678", ""},
+		{"0.1234", ""},
+		// A float64 would have rounded this to 12345678901234.568, which
+		// fits a 3-decimal currency
+		{"", "3 decimal places"},
+		{"19.995", ""},
+	}
+	for i, tt := range tests {
+		payload, expenseId, message := batchUpdatePayload(updates[i], 42)
+		if tt.wantErr != "" {
+			if !strings.Contains(message, tt.wantErr) {
+				t.Errorf("item %d: message %q, want one mentioning %q", i, message, tt.wantErr)
+			}
+			continue
+		}
+		if message != "" {
+			t.Errorf("item %d refused: %s", i, message)
+			continue
+		}
+		if expenseId != i+1 || payload["userId"] != 42 {
+			t.Errorf("item %d: expense %d, payload %v", i, expenseId, payload)
+		}
+		want, _ := money.Parse(tt.want)
+		if amount, ok := payload["amount"].(money.Amount); !ok || amount != want {
+			t.Errorf("item %d: amount %#v, want %s", i, payload["amount"], tt.want)
+		}
+	}
+
+	// The payload sent to update_expense_v3 carries the amount as written
+	payload, _, _ := batchUpdatePayload(updates[0], 42)
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"amount":12345678901234.5678`) {
+		t.Errorf("update payload %s", data)
+	}
+}
@@ -0,0 +1,596 @@
+package ctrFeatureOne
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go_template_v3/pkg/config"
+	"go_template_v3/pkg/currency"
+	"go_template_v3/pkg/global/utils"
+	"go_template_v3/pkg/money"
+	mdlFeatureOne "go_template_v3/pkg/services/featureOne/model"
+	"html"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "github.com/FDSAP-Git-Org/hephaestus/helper/v1"
+	"github.com/FDSAP-Git-Org/hephaestus/respcode"
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
+)
+
+// Budgets are kept in budgets (id, user_id, category_id, null for an
+// overall budget, period, amount, start_date date, end_date date,
+// thresholds jsonb, created_at, updated_at). Month and week budgets repeat
+// every calendar month or ISO week; a custom budget covers start_date to
+// end_date once.
+//
+// Alerts are kept in budget_alerts (id, budget_id, user_id, period_start
+// date, period_end date, threshold, spent, budget_amount, emailed_at,
+// created_at, UNIQUE (budget_id, period_start, threshold)), so each
+// threshold alerts once per period however many instances check it.
+const (
+	budgetPeriodMonth  = "month"
+	budgetPeriodWeek   = "week"
+	budgetPeriodCustom = "custom"
+
+	budgetMaxPerUser    = 50
+	budgetMaxThresholds = 5
+)
+
+var budgetDefaultThresholds = []int{80, 100}
+
+// budgetStatusQuery selects budgets with the bounds of the period that
+// holds the date passed as its first four arguments and what was spent in
+// it
+func budgetStatusQuery(where string) string {
+	return `
+		SELECT b.id, b.user_id, b.category_id, c.name AS category_name, b.period, b.amount,
+			to_char(b.start_date, 'YYYY-MM-DD') AS start_date,
+			to_char(b.end_date, 'YYYY-MM-DD') AS end_date,
+			COALESCE(b.thresholds, '[80,100]'::jsonb)::text AS thresholds,
+			to_char(p.period_start, 'YYYY-MM-DD') AS period_start,
+			to_char(p.period_end, 'YYYY-MM-DD') AS period_end,
+			s.spent, b.created_at, b.updated_at
+		FROM budgets b
+		LEFT JOIN expense_categories c ON c.id = b.category_id
+		CROSS JOIN LATERAL (
+			SELECT
+				CASE b.period
+					WHEN 'month' THEN date_trunc('month', ?::date)::date
+					WHEN 'week' THEN date_trunc('week', ?::date)::date
+					ELSE b.start_date
+				END AS period_start,
+				CASE b.period
+					WHEN 'month' THEN (date_trunc('month', ?::date) + interval '1 month - 1 day')::date
+					WHEN 'week' THEN (date_trunc('week', ?::date) + interval '6 days')::date
+					ELSE b.end_date
+				END AS period_end
+		) p
+		CROSS JOIN LATERAL (
+			SELECT COALESCE(SUM(e.amount), 0) AS spent
+			FROM expenses e
+			WHERE e.user_id = b.user_id
+			  AND e.date >= p.period_start AND e.date < p.period_end + 1
+			  AND (b.category_id IS NULL OR e.category_id = b.category_id)
+		) s
+		WHERE ` + where
+}
+
+// budgetStatusArgs puts the reference date in front of the WHERE arguments
+func budgetStatusArgs(date string, args ...interface{}) []interface{} {
+	return append([]interface{}{date, date, date, date}, args...)
+}
+
+// budgetStatus fills in the values derived from a budget's spending
+func budgetStatus(budget *mdlFeatureOne.Budget) {
+	budget.Thresholds = []int{}
+	json.Unmarshal([]byte(budget.ThresholdsJSON), &budget.Thresholds)
+
+	budget.Remaining = budget.Amount - budget.Spent
+	budget.ThresholdsReached = []int{}
+	if budget.Amount > 0 {
+		budget.PercentUsed = math.Round(budget.Spent.Float64()/budget.Amount.Float64()*1000) / 10
+	}
+	for _, threshold := range budget.Thresholds {
+		if budget.Amount > 0 && budget.Spent*100 >= budget.Amount*money.Amount(threshold) {
+			budget.ThresholdsReached = append(budget.ThresholdsReached, threshold)
+		}
+	}
+}
+
+func CreateBudget(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Parse request body
+	var req mdlFeatureOne.BudgetRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid body", err, http.StatusBadRequest)
+	}
+	if req.Period == nil || req.Amount == nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "period and amount are required", nil, http.StatusBadRequest)
+	}
+
+	// 3. Validate the budget
+	budget := mdlFeatureOne.Budget{Thresholds: budgetDefaultThresholds}
+	if message := mergeBudget(&budget, req, currency.UserBase(&config.DBConnList[0], userId)); message != "" {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, message, nil, http.StatusBadRequest)
+	}
+
+	// 4. Limit budgets per user and allow one repeating budget per category
+	// and period
+	var count int
+	config.DBConnList[0].Raw("SELECT COUNT(*) FROM budgets WHERE user_id = ?", userId).Scan(&count)
+	if count >= budgetMaxPerUser {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400,
+			"Budget limit reached (max "+strconv.Itoa(budgetMaxPerUser)+")", nil, http.StatusBadRequest)
+	}
+	if budget.Period != budgetPeriodCustom && budgetExists(userId, budget.CategoryId, budget.Period, 0) {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_409, "A "+budget.Period+"ly budget for this category already exists", nil, http.StatusConflict)
+	}
+
+	// 5. Store it
+	thresholds, _ := json.Marshal(budget.Thresholds)
+	var budgetId int
+	err := config.DBConnList[0].Raw(`
+		INSERT INTO budgets (user_id, category_id, period, amount, start_date, end_date, thresholds)
+		VALUES (?, ?, ?, ?, ?::date, ?::date, ?::jsonb)
+		RETURNING id
+	`, userId, budget.CategoryId, budget.Period, budget.Amount, budget.StartDate, budget.EndDate, string(thresholds)).Scan(&budgetId).Error
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+
+	// 6. Return it with its current spending
+	created, err := getBudget(budgetId, userId, time.Now().Format("2006-01-02"))
+	if err != nil || created == nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+	go checkBudgetAlerts(userId)
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_201, "Budget created", created, http.StatusCreated)
+}
+
+func GetBudgets(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Get the date whose periods to report, today by default
+	date, message := budgetReferenceDate(c)
+	if message != "" {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, message, nil, http.StatusBadRequest)
+	}
+
+	// 3. Load every budget with spent and remaining
+	budgets := []mdlFeatureOne.Budget{}
+	err := config.DBConnList[0].Raw(
+		budgetStatusQuery("b.user_id = ? ORDER BY b.category_id NULLS FIRST, b.period, b.id"),
+		budgetStatusArgs(date, userId)...,
+	).Scan(&budgets).Error
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+	for i := range budgets {
+		budgetStatus(&budgets[i])
+	}
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Budgets retrieved", budgets, http.StatusOK)
+}
+
+func GetBudget(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Get budget ID from params and the date whose period to report
+	budgetId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid budget ID", err, http.StatusBadRequest)
+	}
+	date, message := budgetReferenceDate(c)
+	if message != "" {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, message, nil, http.StatusBadRequest)
+	}
+
+	// 3. Load it with spent and remaining
+	budget, err := getBudget(budgetId, userId, date)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+	if budget == nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_404, "Budget not found", nil, http.StatusNotFound)
+	}
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Budget retrieved", budget, http.StatusOK)
+}
+
+func UpdateBudget(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Get budget ID from params and parse request body
+	budgetId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid budget ID", err, http.StatusBadRequest)
+	}
+	var req mdlFeatureOne.BudgetRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid body", err, http.StatusBadRequest)
+	}
+
+	// 3. Load and apply the changes
+	today := time.Now().Format("2006-01-02")
+	budget, err := getBudget(budgetId, userId, today)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+	if budget == nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_404, "Budget not found", nil, http.StatusNotFound)
+	}
+	if message := mergeBudget(budget, req, currency.UserBase(&config.DBConnList[0], userId)); message != "" {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, message, nil, http.StatusBadRequest)
+	}
+	if budget.Period != budgetPeriodCustom && budgetExists(userId, budget.CategoryId, budget.Period, budgetId) {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_409, "A "+budget.Period+"ly budget for this category already exists", nil, http.StatusConflict)
+	}
+
+	// 4. Save it
+	thresholds, _ := json.Marshal(budget.Thresholds)
+	err = config.DBConnList[0].Exec(`
+		UPDATE budgets SET
+			category_id = ?, period = ?, amount = ?, start_date = ?::date, end_date = ?::date,
+			thresholds = ?::jsonb, updated_at = NOW()
+		WHERE id = ? AND user_id = ?
+	`, budget.CategoryId, budget.Period, budget.Amount, budget.StartDate, budget.EndDate, string(thresholds), budgetId, userId).Error
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+
+	// 5. Return it with its current spending
+	updated, err := getBudget(budgetId, userId, today)
+	if err != nil || updated == nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+	go checkBudgetAlerts(userId)
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Budget updated", updated, http.StatusOK)
+}
+
+func DeleteBudget(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Get budget ID from params
+	budgetId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid budget ID", err, http.StatusBadRequest)
+	}
+
+	// 3. Delete the budget and its alerts
+	var deleted int64
+	err = config.DBConnList[0].Transaction(func(tx *gorm.DB) error {
+		result := tx.Exec("DELETE FROM budgets WHERE id = ? AND user_id = ?", budgetId, userId)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		deleted = result.RowsAffected
+		return tx.Exec("DELETE FROM budget_alerts WHERE budget_id = ?", budgetId).Error
+	})
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+	if deleted == 0 {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_404, "Budget not found", nil, http.StatusNotFound)
+	}
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Budget deleted", nil, http.StatusOK)
+}
+
+func GetBudgetAlerts(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Read paging
+	limit := fiber.Query[int](c, "limit")
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	offset := fiber.Query[int](c, "offset")
+	if offset < 0 {
+		offset = 0
+	}
+
+	// 3. List alerts, newest first
+	alerts := []mdlFeatureOne.BudgetAlert{}
+	err := config.DBConnList[0].Raw(`
+		SELECT a.id, a.budget_id, b.category_id, c.name AS category_name, b.period,
+			to_char(a.period_start, 'YYYY-MM-DD') AS period_start,
+			to_char(a.period_end, 'YYYY-MM-DD') AS period_end,
+			a.threshold, a.spent, a.budget_amount, a.emailed_at, a.created_at
+		FROM budget_alerts a
+		JOIN budgets b ON b.id = a.budget_id
+		LEFT JOIN expense_categories c ON c.id = b.category_id
+		WHERE a.user_id = ?
+		ORDER BY a.created_at DESC, a.id DESC
+		LIMIT ? OFFSET ?
+	`, userId, limit, offset).Scan(&alerts).Error
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Budget alerts retrieved", alerts, http.StatusOK)
+}
+
+// StartBudgetAlerts checks every budget for crossed thresholds until ctx is
+// cancelled, every BUDGET_ALERT_POLL_SECONDS (default 300). Budgets are
+// also checked as soon as they are created or changed.
+func StartBudgetAlerts(ctx context.Context) {
+	pollInterval := time.Duration(utils.EnvInt("BUDGET_ALERT_POLL_SECONDS", 300, 1)) * time.Second
+
+	go func() {
+		for {
+			checkBudgetAlerts(0)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(pollInterval):
+			}
+		}
+	}()
+	fmt.Printf("BUDGET ALERTS: every %s\n", pollInterval)
+}
+
+// checkBudgetAlerts records an alert for each threshold a budget's current
+// period has passed and emails the user about the highest new one. A
+// userId of 0 checks every user.
+func checkBudgetAlerts(userId int) {
+	today := time.Now().Format("2006-01-02")
+
+	for lastId := 0; ; {
+		where := "b.id > ? AND p.period_start <= ?::date AND p.period_end >= ?::date"
+		args := []interface{}{lastId, today, today}
+		if userId != 0 {
+			where += " AND b.user_id = ?"
+			args = append(args, userId)
+		}
+
+		var budgets []struct {
+			mdlFeatureOne.Budget
+			UserId int
+		}
+		err := config.DBConnList[0].Raw(
+			budgetStatusQuery(where+" ORDER BY b.id LIMIT 500"),
+			budgetStatusArgs(today, args...)...,
+		).Scan(&budgets).Error
+		if err != nil {
+			log.Printf("Error checking budgets: %v", err)
+			return
+		}
+		if len(budgets) == 0 {
+			return
+		}
+
+		for i := range budgets {
+			budget := &budgets[i].Budget
+			lastId = budget.Id
+			budgetStatus(budget)
+			if err := alertBudget(budgets[i].UserId, budget); err != nil {
+				log.Printf("Error alerting budget %d: %v", budget.Id, err)
+			}
+		}
+	}
+}
+
+// alertBudget records the thresholds the budget has reached this period.
+// Only the instance whose insert wins sends the email.
+func alertBudget(userId int, budget *mdlFeatureOne.Budget) error {
+	newThreshold := 0
+	var alertIds []int
+	for _, threshold := range budget.ThresholdsReached {
+		var alertId int
+		err := config.DBConnList[0].Raw(`
+			INSERT INTO budget_alerts (budget_id, user_id, period_start, period_end, threshold, spent, budget_amount)
+			VALUES (?, ?, ?::date, ?::date, ?, ?, ?)
+			ON CONFLICT (budget_id, period_start, threshold) DO NOTHING
+			RETURNING id
+		`, budget.Id, userId, budget.PeriodStart, budget.PeriodEnd, threshold, budget.Spent, budget.Amount).Scan(&alertId).Error
+		if err != nil {
+			return err
+		}
+		if alertId != 0 {
+			alertIds = append(alertIds, alertId)
+			if threshold > newThreshold {
+				newThreshold = threshold
+			}
+		}
+	}
+	if len(alertIds) == 0 {
+		return nil
+	}
+
+	var user struct {
+		Email        *string
+		Name         *string
+		BaseCurrency *string
+	}
+	config.DBConnList[0].Raw("SELECT email, name, base_currency FROM users WHERE id = ? AND deleted_at IS NULL", userId).Scan(&user)
+	if user.Email == nil || *user.Email == "" {
+		return nil
+	}
+	name := *user.Email
+	if user.Name != nil && *user.Name != "" {
+		name = *user.Name
+	}
+
+	baseCurrency := currency.Default()
+	if user.BaseCurrency != nil && currency.Valid(*user.BaseCurrency) {
+		baseCurrency = *user.BaseCurrency
+	}
+
+	if err := sendBudgetAlertEmail(*user.Email, name, baseCurrency, budget, newThreshold); err != nil {
+		return err
+	}
+	return config.DBConnList[0].Exec("UPDATE budget_alerts SET emailed_at = NOW() WHERE id IN ?", alertIds).Error
+}
+
+func sendBudgetAlertEmail(email, name, baseCurrency string, budget *mdlFeatureOne.Budget, threshold int) error {
+	label := "Overall"
+	if budget.CategoryName != nil {
+		label = *budget.CategoryName
+	}
+
+	subject := fmt.Sprintf("%s budget %d%% used", label, threshold)
+	if threshold >= 100 {
+		subject = fmt.Sprintf("%s budget exceeded", label)
+	}
+
+	htmlBody := fmt.Sprintf(`
+	<!DOCTYPE html>
+	<html>
+	<head>
+		<style>
+			body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+			.container { max-width: 600px; margin: 0 auto; padding: 20px; }
+			.footer { margin-top: 30px; font-size: 12px; color: #666; }
+		</style>
+	</head>
+	<body>
+		<div class="container">
+			<h2>Budget Alert</h2>
+			<p>Hello %s,</p>
+			<p>You have used %.1f%% of your %s budget for %s to %s.</p>
+			<p>Spent: %s of %s %s (remaining %s).</p>
+			<div class="footer">
+				<p>This is an automated message, please do not reply to this email.</p>
+			</div>
+		</div>
+	</body>
+	</html>
+	`, html.EscapeString(name), budget.PercentUsed, html.EscapeString(strings.ToLower(label)),
+		budget.PeriodStart, budget.PeriodEnd, budget.Spent.Format(baseCurrency), budget.Amount.Format(baseCurrency),
+		baseCurrency, budget.Remaining.Format(baseCurrency))
+
+	return sendWithSMTP(email, subject, htmlBody)
+}
+
+// getBudget loads a user's budget for the period holding date, or nil when
+// there is none
+func getBudget(budgetId, userId int, date string) (*mdlFeatureOne.Budget, error) {
+	var budget mdlFeatureOne.Budget
+	err := config.DBConnList[0].Raw(
+		budgetStatusQuery("b.id = ? AND b.user_id = ?"),
+		budgetStatusArgs(date, budgetId, userId)...,
+	).Scan(&budget).Error
+	if err != nil || budget.Id == 0 {
+		return nil, err
+	}
+	budgetStatus(&budget)
+	return &budget, nil
+}
+
+// budgetExists reports whether the user has another repeating budget for
+// the same category, or overall, and period
+func budgetExists(userId int, categoryId *int, period string, exceptId int) bool {
+	var count int
+	config.DBConnList[0].Raw(`
+		SELECT COUNT(*) FROM budgets
+		WHERE user_id = ? AND period = ? AND category_id IS NOT DISTINCT FROM ? AND id <> ?
+	`, userId, period, categoryId, exceptId).Scan(&count)
+	return count > 0
+}
+
+// budgetReferenceDate reads the optional ?date= query, today by default
+func budgetReferenceDate(c fiber.Ctx) (string, string) {
+	date := fiber.Query[string](c, "date")
+	if date == "" {
+		return time.Now().Format("2006-01-02"), ""
+	}
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return "", "Invalid date format (expected YYYY-MM-DD)"
+	}
+	return date, ""
+}
+
+// mergeBudget applies the fields set in req to budget and validates the
+// result, returning a message for the client. Budgets are in the user's
+// base currency.
+func mergeBudget(budget *mdlFeatureOne.Budget, req mdlFeatureOne.BudgetRequest, baseCurrency string) string {
+	if req.CategoryId != nil {
+		budget.CategoryId = nil
+		if *req.CategoryId != 0 {
+			var count int
+			config.DBConnList[0].Raw("SELECT COUNT(*) FROM expense_categories WHERE id = ?", *req.CategoryId).Scan(&count)
+			if count == 0 {
+				return "Category not found"
+			}
+			budget.CategoryId = req.CategoryId
+		}
+	}
+	if req.Amount != nil {
+		budget.Amount = *req.Amount
+	}
+	if budget.Amount <= 0 {
+		return "Amount must be greater than 0"
+	}
+	if err := budget.Amount.Check(baseCurrency); err != nil {
+		return err.Error()
+	}
+	if req.Period != nil {
+		budget.Period = strings.ToLower(strings.TrimSpace(*req.Period))
+	}
+	if req.StartDate != nil {
+		budget.StartDate = req.StartDate
+	}
+	if req.EndDate != nil {
+		budget.EndDate = req.EndDate
+	}
+
+	switch budget.Period {
+	case budgetPeriodMonth, budgetPeriodWeek:
+		budget.StartDate, budget.EndDate = nil, nil
+	case budgetPeriodCustom:
+		if budget.StartDate == nil || budget.EndDate == nil {
+			return "startDate and endDate are required for a custom period"
+		}
+		start, err := time.Parse("2006-01-02", *budget.StartDate)
+		if err != nil {
+			return "Invalid startDate format (expected YYYY-MM-DD)"
+		}
+		end, err := time.Parse("2006-01-02", *budget.EndDate)
+		if err != nil {
+			return "Invalid endDate format (expected YYYY-MM-DD)"
+		}
+		if end.Before(start) {
+			return "endDate must not be before startDate"
+		}
+	default:
+		return "period must be month, week or custom"
+	}
+
+	if req.Thresholds != nil {
+		budget.Thresholds = *req.Thresholds
+	}
+	if len(budget.Thresholds) > budgetMaxThresholds {
+		return "At most " + strconv.Itoa(budgetMaxThresholds) + " thresholds are allowed"
+	}
+	thresholds := make([]int, 0, len(budget.Thresholds))
+	seen := map[int]bool{}
+	for _, threshold := range budget.Thresholds {
+		if threshold < 1 || threshold > 1000 {
+			return "Thresholds must be percentages between 1 and 1000"
+		}
+		if !seen[threshold] {
+			seen[threshold] = true
+			thresholds = append(thresholds, threshold)
+		}
+	}
+	sort.Ints(thresholds)
+	budget.Thresholds = thresholds
+	return ""
+}
@@ -0,0 +1,178 @@
+package ctrFeatureOne
+
+import (
+	"fmt"
+	"go_template_v3/pkg/config"
+	"go_template_v3/pkg/currency"
+	"go_template_v3/pkg/global/utils"
+	mdlFeatureOne "go_template_v3/pkg/services/featureOne/model"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	v1 "github.com/FDSAP-Git-Org/hephaestus/helper/v1"
+	"github.com/FDSAP-Git-Org/hephaestus/respcode"
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
+)
+
+const exchangeRatesMaxFileSize = 10 * 1024 * 1024 // 10MB
+
+func GetCurrencies(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. List the currencies with the user's base currency
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Currencies retrieved",
+		map[string]interface{}{
+			"baseCurrency":      currency.UserBase(&config.DBConnList[0], userId),
+			"referenceCurrency": currency.Reference(),
+			"currencies":        currency.Codes(),
+		},
+		http.StatusOK)
+}
+
+func UpdateBaseCurrency(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Parse and validate the currency
+	var req mdlFeatureOne.BaseCurrencyRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid body", err, http.StatusBadRequest)
+	}
+	code, err := currency.Normalize(req.Currency)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, err.Error(), nil, http.StatusBadRequest)
+	}
+
+	// 3. Save it. Expenses without a currency of their own were entered in
+	// the old base currency, so they keep it.
+	err = config.DBConnList[0].Transaction(func(tx *gorm.DB) error {
+		old := currency.UserBase(tx, userId)
+		if err := tx.Exec("UPDATE expenses SET currency = ? WHERE user_id = ? AND currency IS NULL", old, userId).Error; err != nil {
+			return err
+		}
+		return tx.Exec("UPDATE users SET base_currency = ?, updated_at = NOW() WHERE id = ?", code, userId).Error
+	})
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Base currency updated",
+		map[string]interface{}{"baseCurrency": code}, http.StatusOK)
+}
+
+// UploadExchangeRates stores rates sent as JSON, or as a CSV file with date,
+// currency and rate columns
+func UploadExchangeRates(c fiber.Ctx) error {
+	// 1. Get admin user ID from JWT
+	userId := utils.GetUserId(c)
+	source := fmt.Sprintf("admin:%d", userId)
+
+	// 2. Read the rates from the file or the body
+	var rates []currency.Rate
+	if file, err := c.FormFile("file"); err == nil {
+		if file.Size > exchangeRatesMaxFileSize {
+			return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "File too large (max 10 MB)", nil, http.StatusBadRequest)
+		}
+		if strings.ToLower(filepath.Ext(file.Filename)) != ".csv" {
+			return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Only .csv files are supported", nil, http.StatusBadRequest)
+		}
+		f, err := file.Open()
+		if err != nil {
+			return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Failed to read file", err, http.StatusBadRequest)
+		}
+		defer f.Close()
+		if rates, err = currency.ParseRatesCSV(f); err != nil {
+			return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, err.Error(), nil, http.StatusBadRequest)
+		}
+		source += ":" + filepath.Base(file.Filename)
+	} else {
+		var req mdlFeatureOne.ExchangeRatesRequest
+		if err := c.Bind().Body(&req); err != nil {
+			return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid body", err, http.StatusBadRequest)
+		}
+		if req.Date == "" {
+			req.Date = time.Now().Format("2006-01-02")
+		}
+		for code, rate := range req.Rates {
+			rates = append(rates, currency.Rate{Date: req.Date, Currency: code, Rate: rate})
+		}
+	}
+	if len(rates) == 0 {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "No rates given", nil, http.StatusBadRequest)
+	}
+	for i := range rates {
+		if err := rates[i].Validate(); err != nil {
+			return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, err.Error(), nil, http.StatusBadRequest)
+		}
+	}
+
+	// 3. Store them, replacing rates already loaded for the same dates
+	stored, err := currency.Store(&config.DBConnList[0], rates, source)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_201, "Exchange rates stored",
+		map[string]interface{}{
+			"referenceCurrency": currency.Reference(),
+			"stored":            stored,
+		},
+		http.StatusCreated)
+}
+
+func GetExchangeRates(c fiber.Ctx) error {
+	// 1. Read the filters and paging
+	conditions := []string{"TRUE"}
+	args := []interface{}{}
+	if code := fiber.Query[string](c, "currency"); code != "" {
+		code, err := currency.Normalize(code)
+		if err != nil {
+			return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, err.Error(), nil, http.StatusBadRequest)
+		}
+		conditions = append(conditions, "currency = ?")
+		args = append(args, code)
+	}
+	for param, condition := range map[string]string{"startDate": "rate_date >= ?", "endDate": "rate_date <= ?"} {
+		date := fiber.Query[string](c, param)
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Dates must be in YYYY-MM-DD format", nil, http.StatusBadRequest)
+		}
+		conditions = append(conditions, condition)
+		args = append(args, date)
+	}
+	limit := fiber.Query[int](c, "limit")
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	offset := fiber.Query[int](c, "offset")
+	if offset < 0 {
+		offset = 0
+	}
+
+	// 2. List the rates, newest first
+	rates := []mdlFeatureOne.ExchangeRate{}
+	err := config.DBConnList[0].Raw(`
+		SELECT currency, to_char(rate_date, 'YYYY-MM-DD') AS rate_date, rate, source, created_at
+		FROM exchange_rates
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY rate_date DESC, currency
+		LIMIT ? OFFSET ?
+	`, append(args, limit, offset)...).Scan(&rates).Error
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Exchange rates retrieved",
+		map[string]interface{}{
+			"referenceCurrency": currency.Reference(),
+			"rates":             rates,
+		},
+		http.StatusOK)
+}
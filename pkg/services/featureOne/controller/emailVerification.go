@@ -0,0 +1,233 @@
+package ctrFeatureOne
+
+import (
+	"fmt"
+	"go_template_v3/pkg/config"
+	"go_template_v3/pkg/global/utils"
+	mdlFeatureOne "go_template_v3/pkg/services/featureOne/model"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	v1 "github.com/FDSAP-Git-Org/hephaestus/helper/v1"
+	"github.com/FDSAP-Git-Org/hephaestus/respcode"
+	utils_v1 "github.com/FDSAP-Git-Org/hephaestus/utils/v1"
+	"github.com/gofiber/fiber/v3"
+)
+
+func VerifyEmail(c fiber.Ctx) error {
+	var req mdlFeatureOne.VerifyEmailRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid body", err, http.StatusBadRequest)
+	}
+
+	if req.Token == nil || *req.Token == "" {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Token required", nil, http.StatusBadRequest)
+	}
+
+	// 1. Verify signature, expiry and purpose of the link token
+	claims, err := utils.ParseToken(*req.Token, utils.TokenTypeEmailVerification)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid or expired token", nil, http.StatusBadRequest)
+	}
+
+	userId, _ := claims.Body["userId"].(float64)
+	email, _ := claims.Body["email"].(string)
+
+	// Links sent by UpdateUser also carry the address to switch to
+	if newEmail, _ := claims.Body["newEmail"].(string); newEmail != "" {
+		return confirmEmailChange(c, int(userId), email, newEmail)
+	}
+
+	// 2. Mark verified. The email must still match so links sent before an
+	// email change cannot verify the new address.
+	result := config.DBConnList[0].Exec(`
+		UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW()
+		WHERE id = ? AND email = ? AND deleted_at IS NULL
+	`, int(userId), email)
+	if result.Error != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", result.Error, http.StatusInternalServerError)
+	}
+	if result.RowsAffected == 0 {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid or expired token", nil, http.StatusBadRequest)
+	}
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Email verified successfully", nil, http.StatusOK)
+}
+
+// confirmEmailChange moves the account to an address the user has proven
+// they own. The old address must still be current, so each link works once.
+func confirmEmailChange(c fiber.Ctx, userId int, email, newEmail string) error {
+	var taken int
+	config.DBConnList[0].Raw(
+		"SELECT 1 FROM users WHERE email = ? AND id <> ? AND deleted_at IS NULL",
+		newEmail, userId,
+	).Scan(&taken)
+	if taken == 1 {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_409, "Email address is already in use", nil, http.StatusConflict)
+	}
+
+	result := config.DBConnList[0].Exec(`
+		UPDATE users SET email = ?, email_verified_at = NOW(), updated_at = NOW()
+		WHERE id = ? AND email = ? AND deleted_at IS NULL
+	`, newEmail, userId, email)
+	if result.Error != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", result.Error, http.StatusInternalServerError)
+	}
+	if result.RowsAffected == 0 {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid or expired token", nil, http.StatusBadRequest)
+	}
+
+	utils.RecordAuthEvent("email_changed", newEmail, c.IP(), map[string]interface{}{
+		"userId":        userId,
+		"previousEmail": email,
+	})
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Email changed successfully", nil, http.StatusOK)
+}
+
+func ResendVerification(c fiber.Ctx) error {
+	var req mdlFeatureOne.ResendVerificationRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid body", err, http.StatusBadRequest)
+	}
+
+	if req.Email == nil || !utils_v1.IsEmailValid(*req.Email) {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Valid email required", nil, http.StatusBadRequest)
+	}
+
+	// Same response whether or not the account exists or is already verified
+	var user struct {
+		Id    int
+		Name  string
+		Email string
+	}
+	config.DBConnList[0].Raw(
+		"SELECT id, name, email FROM users WHERE email = ? AND email_verified_at IS NULL AND deleted_at IS NULL",
+		*req.Email,
+	).Scan(&user)
+
+	if user.Id != 0 {
+		go func() {
+			if err := sendVerificationEmail(user.Id, user.Email, user.Name); err != nil {
+				log.Printf("Error sending verification email to user %d: %v", user.Id, err)
+			}
+		}()
+	}
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200,
+		"If the account exists and is unverified, a verification link was sent", nil, http.StatusOK)
+}
+
+// EMAIL VERIFICATION SEND MAIL FUNCTIONS
+func sendVerificationEmail(userId int, email, name string) error {
+	if userId == 0 {
+		return fmt.Errorf("user not found")
+	}
+
+	ttl := utils.EmailVerificationTTL()
+
+	// Signed, self-contained token so nothing needs to be stored server-side
+	token, _, err := utils.GenerateToken(utils.TokenTypeEmailVerification, map[string]interface{}{
+		"userId": userId,
+		"email":  email,
+	}, ttl)
+	if err != nil {
+		return err
+	}
+
+	frontendURL := utils_v1.GetEnv("FRONTEND_URL")
+	if frontendURL == "" {
+		frontendURL = "http://localhost:3000" // default for development
+	}
+	verifyLink := fmt.Sprintf("%s/verify-email?token=%s", strings.TrimRight(frontendURL, "/"), url.QueryEscape(token))
+
+	subject := "Verify your email address"
+
+	htmlBody := fmt.Sprintf(`
+	<!DOCTYPE html>
+	<html>
+	<head>
+		<style>
+			body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+			.container { max-width: 600px; margin: 0 auto; padding: 20px; }
+			.button { display: inline-block; padding: 12px 24px; background-color: #007bff;
+					color: white !important; text-decoration: none; border-radius: 4px; margin: 20px 0; }
+			.footer { margin-top: 30px; font-size: 12px; color: #666; }
+		</style>
+	</head>
+	<body>
+		<div class="container">
+			<h2>Verify Your Email</h2>
+			<p>Hello %s,</p>
+			<p>Thanks for signing up. Please confirm your email address by clicking the button below:</p>
+			<p><a href="%s" class="button">Verify Email</a></p>
+			<p>Or copy and paste this link in your browser:</p>
+			<p><code>%s</code></p>
+			<p>This link will expire in %d hours.</p>
+			<p>If you didn't create an account, please ignore this email.</p>
+			<div class="footer">
+				<p>This is an automated message, please do not reply to this email.</p>
+			</div>
+		</div>
+	</body>
+	</html>
+	`, html.EscapeString(name), verifyLink, verifyLink, int(ttl.Hours()))
+
+	return sendWithSMTP(email, subject, htmlBody)
+}
+
+func sendEmailChangeVerification(userId int, email, newEmail, name string) error {
+	ttl := utils.EmailVerificationTTL()
+
+	token, _, err := utils.GenerateToken(utils.TokenTypeEmailVerification, map[string]interface{}{
+		"userId":   userId,
+		"email":    email,
+		"newEmail": newEmail,
+	}, ttl)
+	if err != nil {
+		return err
+	}
+
+	frontendURL := utils_v1.GetEnv("FRONTEND_URL")
+	if frontendURL == "" {
+		frontendURL = "http://localhost:3000" // default for development
+	}
+	verifyLink := fmt.Sprintf("%s/verify-email?token=%s", strings.TrimRight(frontendURL, "/"), url.QueryEscape(token))
+
+	subject := "Confirm your new email address"
+
+	htmlBody := fmt.Sprintf(`
+	<!DOCTYPE html>
+	<html>
+	<head>
+		<style>
+			body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+			.container { max-width: 600px; margin: 0 auto; padding: 20px; }
+			.button { display: inline-block; padding: 12px 24px; background-color: #007bff;
+					color: white !important; text-decoration: none; border-radius: 4px; margin: 20px 0; }
+			.footer { margin-top: 30px; font-size: 12px; color: #666; }
+		</style>
+	</head>
+	<body>
+		<div class="container">
+			<h2>Confirm Your New Email</h2>
+			<p>Hello %s,</p>
+			<p>You asked to change the email address on your account to this one. Confirm by clicking the button below:</p>
+			<p><a href="%s" class="button">Confirm Email</a></p>
+			<p>Or copy and paste this link in your browser:</p>
+			<p><code>%s</code></p>
+			<p>This link will expire in %d hours. Until then you keep signing in with your current address.</p>
+			<p>If you didn't request this, please ignore this email.</p>
+			<div class="footer">
+				<p>This is an automated message, please do not reply to this email.</p>
+			</div>
+		</div>
+	</body>
+	</html>
+	`, html.EscapeString(name), verifyLink, verifyLink, int(ttl.Hours()))
+
+	return sendWithSMTP(newEmail, subject, htmlBody)
+}
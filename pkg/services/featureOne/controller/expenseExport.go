@@ -0,0 +1,359 @@
+package ctrFeatureOne
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"go_template_v3/pkg/config"
+	"go_template_v3/pkg/currency"
+	"go_template_v3/pkg/exports"
+	"go_template_v3/pkg/global/utils"
+	"go_template_v3/pkg/jobs"
+	"go_template_v3/pkg/money"
+	mdlFeatureOne "go_template_v3/pkg/services/featureOne/model"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "github.com/FDSAP-Git-Org/hephaestus/helper/v1"
+	"github.com/FDSAP-Git-Org/hephaestus/respcode"
+	"github.com/gofiber/fiber/v3"
+)
+
+const (
+	jobTypeExpenseExport = "expense_export"
+
+	// exportProgressRows is how often a background export saves progress
+	exportProgressRows = 1000
+)
+
+// exportStreamMaxRows is the largest export sent straight back; bigger ones
+// run as a batch job
+func exportStreamMaxRows() int {
+	return utils.EnvInt("EXPORT_STREAM_MAX_ROWS", 5000, 1)
+}
+
+func ExportExpenses(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Read the format, the same filters as GetExpenses and the currency
+	// to convert into
+	filters, message := expenseQueryFilters(c)
+	if message != "" {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, message, nil, http.StatusBadRequest)
+	}
+	baseCurrency := currency.UserBase(&config.DBConnList[0], userId)
+	targetCurrency, message := expenseTargetCurrency(c, baseCurrency)
+	if message != "" {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, message, nil, http.StatusBadRequest)
+	}
+	payload := mdlFeatureOne.ExpenseExportJob{
+		Format:       strings.ToLower(fiber.Query[string](c, "format")),
+		Filters:      filters,
+		BaseCurrency: baseCurrency,
+		Currency:     targetCurrency,
+	}
+	if payload.Format == "" {
+		payload.Format = exports.FormatCSV
+	}
+	if !exports.IsFormat(payload.Format) {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Format must be csv, xlsx or pdf", nil, http.StatusBadRequest)
+	}
+
+	// 3. Count the matching expenses
+	query, args := expenseExportQuery(userId, payload.Filters, "COUNT(*)", false)
+	var total int
+	if err := config.DBConnList[0].Raw(query, args...).Scan(&total).Error; err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+
+	// 4. Large exports are written by a background job
+	if total > exportStreamMaxRows() {
+		jobId, err := jobs.Enqueue(userId, jobTypeExpenseExport, total, payload)
+		if err != nil {
+			log.Printf("Error creating export job: %v", err)
+			return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to create batch job", err, http.StatusInternalServerError)
+		}
+
+		return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Export job created successfully",
+			map[string]interface{}{
+				"jobId":       jobId,
+				"format":      payload.Format,
+				"totalItems":  total,
+				"status":      "pending",
+				"downloadUrl": strings.TrimSuffix(c.Path(), "/export") + fmt.Sprintf("/exports/%d/download", jobId),
+			},
+			http.StatusAccepted)
+	}
+
+	// 5. Small exports stream straight back
+	c.Set("Content-Type", exports.ContentType(payload.Format))
+	c.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="expenses.%s"`, payload.Format))
+	return c.SendStreamWriter(func(w *bufio.Writer) {
+		if err := writeExpenseExport(userId, payload, w, nil); err != nil {
+			log.Printf("Error streaming export for user %d: %v", userId, err)
+		}
+		w.Flush()
+	})
+}
+
+func DownloadExpenseExport(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Get job ID from params
+	jobId, err := strconv.Atoi(c.Params("jobId"))
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid job ID", err, http.StatusBadRequest)
+	}
+
+	// 3. The export must be the user's and finished
+	var job struct {
+		Status string
+		Format string
+	}
+	err = config.DBConnList[0].Raw(
+		"SELECT status, payload->>'format' AS format FROM batch_jobs WHERE id = ? AND user_id = ? AND job_type = ?",
+		jobId, userId, jobTypeExpenseExport,
+	).Scan(&job).Error
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to fetch job", err, http.StatusInternalServerError)
+	}
+	if job.Status == "" {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_404, "Export not found", nil, http.StatusNotFound)
+	}
+	if job.Status != "completed" {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_409, "Export is not ready", nil, http.StatusConflict)
+	}
+
+	path, err := exportFilePath(jobId, job.Format)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to read export", err, http.StatusInternalServerError)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_404, "Export file is no longer available", nil, http.StatusNotFound)
+	}
+
+	c.Set("Content-Type", exports.ContentType(job.Format))
+	return c.Download(path, fmt.Sprintf("expenses-%d.%s", jobId, job.Format))
+}
+
+// processExpenseExportAsync writes the export to disk for download. A file
+// cannot be resumed half written, so an interrupted export starts over.
+func processExpenseExportAsync(ctx context.Context, job *jobs.Job) error {
+	var payload mdlFeatureOne.ExpenseExportJob
+	if err := job.DecodePayload(&payload); err != nil {
+		return err
+	}
+	job.ProcessedItems, job.SuccessfulItems, job.FailedItems = 0, 0, 0
+
+	path, err := exportFilePath(job.Id, payload.Format)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.Create(path + ".part")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path + ".part")
+	defer f.Close()
+
+	buffered := bufio.NewWriter(f)
+	err = writeExpenseExport(job.UserId, payload, buffered, func(rows int) error {
+		if err := job.CheckCancelled(); err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return job.ItemsDoneTx(&config.DBConnList[0], rows, 0)
+	})
+	if err != nil {
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(path+".part", path)
+}
+
+// writeExpenseExport reads the matching expenses with a cursor and writes
+// them in the payload's format. progress, when given, is called with the
+// number of rows written since its last call.
+func writeExpenseExport(userId int, payload mdlFeatureOne.ExpenseExportJob, w io.Writer, progress func(rows int) error) error {
+	// Jobs queued before currencies were added convert into today's base
+	if payload.BaseCurrency == "" {
+		payload.BaseCurrency = currency.UserBase(&config.DBConnList[0], userId)
+	}
+	if payload.Currency == "" {
+		payload.Currency = payload.BaseCurrency
+	}
+
+	writer, err := exports.NewWriter(payload.Format, w, "Expense report", payload.Currency)
+	if err != nil {
+		return err
+	}
+
+	query, args := expenseExportQuery(userId, payload.Filters,
+		"e.id, COALESCE(TO_CHAR(e.date, 'YYYY-MM-DD'), ''), e.title, COALESCE(c.name, ''), e.amount, "+
+			"COALESCE(e.currency, "+currency.Literal(payload.BaseCurrency)+"), "+
+			fmt.Sprintf("ROUND(e.amount * fx.rate, %d)", currency.MinorUnits(payload.Currency))+", COALESCE(e.notes, '')",
+		true, expenseConversion(payload.BaseCurrency, payload.Currency))
+	rows, err := config.DBConnList[0].Raw(query, args...).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	pending := 0
+	for rows.Next() {
+		var expense exports.Expense
+		if err := rows.Scan(&expense.Id, &expense.Date, &expense.Title, &expense.Category, &expense.Amount,
+			&expense.Currency, &expense.Converted, &expense.Notes); err != nil {
+			return err
+		}
+		if err := writer.Write(expense); err != nil {
+			return err
+		}
+
+		pending++
+		if progress != nil && pending == exportProgressRows {
+			if err := progress(pending); err != nil {
+				return err
+			}
+			pending = 0
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	if progress != nil && pending > 0 {
+		return progress(pending)
+	}
+	return nil
+}
+
+// expenseQueryFilters reads the GetExpenses filters from the query string,
+// returning a message for the client when an amount or date is malformed
+func expenseQueryFilters(c fiber.Ctx) (mdlFeatureOne.ExpenseExportFilters, string) {
+	filters := mdlFeatureOne.ExpenseExportFilters{
+		Title:      fiber.Query[string](c, "title"),
+		CategoryId: fiber.Query[int](c, "categoryId"),
+		StartDate:  fiber.Query[string](c, "startDate"),
+		EndDate:    fiber.Query[string](c, "endDate"),
+	}
+	amounts := map[string]*money.Amount{"amount": &filters.Amount, "minAmount": &filters.MinAmount, "maxAmount": &filters.MaxAmount}
+	for key, amount := range amounts {
+		value, err := queryAmount(c, key)
+		if err != nil {
+			return filters, "Amounts must be decimal numbers"
+		}
+		*amount = value
+	}
+	for _, date := range []string{filters.StartDate, filters.EndDate} {
+		if _, err := time.Parse("2006-01-02", date); date != "" && err != nil {
+			return filters, "Dates must be in YYYY-MM-DD format"
+		}
+	}
+	return filters, ""
+}
+
+// expenseConversion joins, as fx.rate, the rate that converts each expense
+// into target on its date, or null when a rate is missing. Expenses without
+// a currency of their own are in base. Both codes are validated, so they
+// are inlined.
+func expenseConversion(base, target string) string {
+	rate := currency.RateSQL("COALESCE(e.currency, "+currency.Literal(base)+")", currency.Literal(target), "e.date")
+	return "LEFT JOIN LATERAL (SELECT " + rate + " AS rate) fx ON TRUE"
+}
+
+// expenseTargetCurrency reads ?currency=, the currency amounts are
+// converted into, defaulting to the user's base currency
+func expenseTargetCurrency(c fiber.Ctx, base string) (string, string) {
+	code := fiber.Query[string](c, "currency")
+	if code == "" {
+		return base, ""
+	}
+	code, err := currency.Normalize(code)
+	if err != nil {
+		return "", err.Error()
+	}
+	return code, ""
+}
+
+// expenseExportQuery builds a SELECT of columns over the expenses matching
+// the GetExpenses filters. joins, such as expenseConversion, are added
+// after the category join.
+func expenseExportQuery(userId int, filters mdlFeatureOne.ExpenseExportFilters, columns string, ordered bool, joins ...string) (string, []interface{}) {
+	conditions := []string{"e.user_id = ?"}
+	args := []interface{}{userId}
+
+	if filters.Title != "" {
+		conditions = append(conditions, "e.title ILIKE ?")
+		args = append(args, "%"+filters.Title+"%")
+	}
+	if filters.Amount != 0 {
+		conditions = append(conditions, "e.amount = ?")
+		args = append(args, filters.Amount)
+	}
+	if filters.MinAmount != 0 {
+		conditions = append(conditions, "e.amount >= ?")
+		args = append(args, filters.MinAmount)
+	}
+	if filters.MaxAmount != 0 {
+		conditions = append(conditions, "e.amount <= ?")
+		args = append(args, filters.MaxAmount)
+	}
+	if filters.CategoryId != 0 {
+		conditions = append(conditions, "e.category_id = ?")
+		args = append(args, filters.CategoryId)
+	}
+	if filters.StartDate != "" {
+		conditions = append(conditions, "e.date >= ?")
+		args = append(args, filters.StartDate)
+	}
+	if filters.EndDate != "" {
+		conditions = append(conditions, "e.date <= ?")
+		args = append(args, filters.EndDate)
+	}
+
+	query := "SELECT " + columns + `
+		FROM expenses e
+		LEFT JOIN expense_categories c ON c.id = e.category_id
+		` + strings.Join(joins, "\n") + `
+		WHERE ` + strings.Join(conditions, " AND ")
+	if ordered {
+		query += " ORDER BY e.date DESC, e.id DESC"
+	}
+	return query, args
+}
+
+// exportPath is where background exports are kept (EXPORT_PATH). It must
+// not be publicly served, DownloadExpenseExport is the only way to fetch them.
+func exportPath() (string, error) {
+	return utils.PrivateStoragePath("EXPORT_PATH", "./storage/exports")
+}
+
+// exportFilePath is where a background export's file is kept for download
+func exportFilePath(jobId int, format string) (string, error) {
+	path, err := exportPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(path, fmt.Sprintf("%d.%s", jobId, format)), nil
+}
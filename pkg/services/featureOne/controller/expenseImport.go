@@ -0,0 +1,716 @@
+package ctrFeatureOne
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go_template_v3/pkg/config"
+	"go_template_v3/pkg/currency"
+	"go_template_v3/pkg/global/utils"
+	"go_template_v3/pkg/imports"
+	"go_template_v3/pkg/jobs"
+	mdlFeatureOne "go_template_v3/pkg/services/featureOne/model"
+	scpFeatureOne "go_template_v3/pkg/services/featureOne/script"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	v1 "github.com/FDSAP-Git-Org/hephaestus/helper/v1"
+	"github.com/FDSAP-Git-Org/hephaestus/respcode"
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
+)
+
+const (
+	jobTypeExpenseImport = "expense_import"
+
+	importSampleRows = 10
+)
+
+// Import limits can be raised per deployment. Files are streamed, so memory
+// use depends on the chunk size rather than the file size.
+func importMaxFileSize() int64 {
+	return int64(utils.EnvInt("IMPORT_MAX_FILE_MB", 100, 1)) * 1024 * 1024
+}
+
+func importMaxRows() int {
+	return utils.EnvInt("IMPORT_MAX_ROWS", 500000, 1)
+}
+
+func importChunkSize() int {
+	return utils.EnvInt("IMPORT_CHUNK_SIZE", 500, 1)
+}
+
+func UploadExpenseImport(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Get the uploaded file
+	file, err := c.FormFile("file")
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Import file is required", err, http.StatusBadRequest)
+	}
+	if file.Size > importMaxFileSize() {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400,
+			fmt.Sprintf("File too large (max %d MB)", importMaxFileSize()/1024/1024), nil, http.StatusBadRequest)
+	}
+
+	// 3. Keep it on disk until the import is committed
+	uploadPath, err := importUploadPath()
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to store file", err, http.StatusInternalServerError)
+	}
+	if err := os.MkdirAll(uploadPath, 0700); err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to store file", err, http.StatusInternalServerError)
+	}
+	format, err := detectImportFormat(file)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Failed to read file", err, http.StatusBadRequest)
+	}
+	filePath := filepath.Join(uploadPath, fmt.Sprintf("%d_%s.%s", userId, utils.GenerateOpaqueToken(16), format))
+	if err := c.SaveFile(file, filePath); err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to store file", err, http.StatusInternalServerError)
+	}
+
+	// 4. Read headers and sample rows for the preview
+	preview, err := previewImportFile(filePath, format)
+	if err != nil {
+		os.Remove(filePath)
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, err.Error(), nil, http.StatusBadRequest)
+	}
+	if preview.RowCount == 0 {
+		os.Remove(filePath)
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "File has no expenses to import", nil, http.StatusBadRequest)
+	}
+	if preview.RowCount > importMaxRows() {
+		os.Remove(filePath)
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400,
+			fmt.Sprintf("Import too large (max %d rows)", importMaxRows()), nil, http.StatusBadRequest)
+	}
+
+	// 5. Tell the user which published template the file follows, if any
+	var templateSerial string
+	if format == imports.FormatCSV {
+		if templateSerial, err = matchImportTemplate(templateTypeExpenseCSV, preview.Headers); err != nil {
+			log.Printf("Error matching import templates: %v", err)
+		}
+	}
+
+	// 6. Record the import
+	headersJSON, _ := json.Marshal(preview.Headers)
+	var importId int
+	err = config.DBConnList[0].Raw(`
+		INSERT INTO expense_imports (user_id, file_path, original_name, format, delimiter, headers, row_count)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, userId, filePath, file.Filename, format, preview.Delimiter, string(headersJSON), preview.RowCount).Scan(&importId).Error
+	if err != nil {
+		os.Remove(filePath)
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_201, "Import uploaded, review the mapping and commit it",
+		mdlFeatureOne.ExpenseImportPreview{
+			ImportId:       importId,
+			OriginalName:   file.Filename,
+			Format:         format,
+			TemplateSerial: templateSerial,
+			Preview:        preview,
+		},
+		http.StatusCreated)
+}
+
+func CommitExpenseImport(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Get import ID from params
+	importId, err := strconv.Atoi(c.Params("importId"))
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid import ID", err, http.StatusBadRequest)
+	}
+
+	// 3. Parse request body
+	var req mdlFeatureOne.CommitExpenseImportRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid body", err, http.StatusBadRequest)
+	}
+	payload := mdlFeatureOne.ExpenseImportJob{ImportId: importId, Mapping: req.Mapping}
+	if req.DateFormat != nil {
+		payload.DateFormat = *req.DateFormat
+	}
+	if req.DecimalSeparator != nil {
+		payload.DecimalSeparator = *req.DecimalSeparator
+	}
+	// Rows without a currency column, or with it empty, are in the
+	// currency asked for or the user's base currency
+	payload.Currency = currency.UserBase(&config.DBConnList[0], userId)
+	if req.Currency != nil && *req.Currency != "" {
+		payload.Currency = *req.Currency
+	}
+	if req.DryRun != nil {
+		payload.DryRun = *req.DryRun
+	}
+
+	expenseImport, err := getExpenseImport(&config.DBConnList[0], importId, userId)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+	if expenseImport == nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_404, "Import not found", nil, http.StatusNotFound)
+	}
+
+	// 4. Check the mapping and formats against the file before queueing. The
+	// file of a finished import is gone, so that case is answered first.
+	if !payload.DryRun && importCommitted(&config.DBConnList[0], expenseImport.CommittedJobId) {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_409, "Import has already been committed", nil, http.StatusConflict)
+	}
+	if err := checkImportOptions(expenseImport, payload); err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, err.Error(), nil, http.StatusBadRequest)
+	}
+
+	// 5. Queue the job. The import row is locked so it is only committed once.
+	var jobId int
+	err = config.DBConnList[0].Transaction(func(tx *gorm.DB) error {
+		locked, err := getExpenseImport(tx, importId, userId, "FOR UPDATE")
+		if err != nil {
+			return err
+		}
+		if locked == nil {
+			return errors.New("import not found")
+		}
+		if !payload.DryRun && importCommitted(tx, locked.CommittedJobId) {
+			return errImportAlreadyCommitted
+		}
+
+		jobId, err = jobs.EnqueueTx(tx, userId, jobTypeExpenseImport, locked.RowCount, payload)
+		if err != nil {
+			return err
+		}
+
+		return tx.Exec(`
+			UPDATE expense_imports SET
+				last_job_id = ?,
+				committed_job_id = CASE WHEN ? THEN committed_job_id ELSE ? END
+			WHERE id = ?
+		`, jobId, payload.DryRun, jobId, importId).Error
+	})
+	if errors.Is(err, errImportAlreadyCommitted) {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_409, "Import has already been committed", nil, http.StatusConflict)
+	}
+	if err != nil {
+		log.Printf("Error creating import job: %v", err)
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to create batch job", err, http.StatusInternalServerError)
+	}
+
+	message := "Import job created successfully"
+	if payload.DryRun {
+		message = "Dry run job created successfully, nothing will be saved"
+	}
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, message,
+		map[string]interface{}{
+			"jobId":      jobId,
+			"importId":   importId,
+			"totalItems": expenseImport.RowCount,
+			"dryRun":     payload.DryRun,
+			"status":     "pending",
+		},
+		http.StatusAccepted)
+}
+
+func DownloadExpenseImportErrors(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Get import ID from params
+	importId, err := strconv.Atoi(c.Params("importId"))
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid import ID", err, http.StatusBadRequest)
+	}
+
+	expenseImport, err := getExpenseImport(&config.DBConnList[0], importId, userId)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+	if expenseImport == nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_404, "Import not found", nil, http.StatusNotFound)
+	}
+	if expenseImport.LastJobId == nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_404, "Import has not been run yet", nil, http.StatusNotFound)
+	}
+
+	// 3. Stream the original columns plus the line number and reason, so
+	// large error reports are never held in memory
+	var headers []string
+	json.Unmarshal([]byte(expenseImport.Headers), &headers)
+	jobId := *expenseImport.LastJobId
+
+	c.Set("Content-Type", "text/csv")
+	c.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="import-%d-errors.csv"`, importId))
+	return c.SendStreamWriter(func(w *bufio.Writer) {
+		writer := csv.NewWriter(w)
+		writer.Write(append(append([]string{}, headers...), "row", "error"))
+
+		rows, err := config.DBConnList[0].Raw(
+			"SELECT row_number, message, fields FROM expense_import_errors WHERE job_id = ? ORDER BY row_number",
+			jobId,
+		).Rows()
+		if err != nil {
+			log.Printf("Error reading import errors for job %d: %v", jobId, err)
+			writer.Flush()
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var rowNumber int
+			var message, fieldsJSON string
+			if err := rows.Scan(&rowNumber, &message, &fieldsJSON); err != nil {
+				log.Printf("Error reading import errors for job %d: %v", jobId, err)
+				break
+			}
+			var fields []string
+			json.Unmarshal([]byte(fieldsJSON), &fields)
+			writer.Write(append(fields, strconv.Itoa(rowNumber), message))
+		}
+		writer.Flush()
+	})
+}
+
+// processExpenseImportAsync streams the import file and saves it in chunks.
+// Each chunk's expenses, its rejected rows (in expense_import_errors: job_id,
+// row_number, message, fields jsonb) and the job's progress are committed in
+// one transaction, so a resumed job picks up after the last whole chunk.
+func processExpenseImportAsync(ctx context.Context, job *jobs.Job) error {
+	var payload mdlFeatureOne.ExpenseImportJob
+	if err := job.DecodePayload(&payload); err != nil {
+		return err
+	}
+
+	expenseImport, err := getExpenseImport(&config.DBConnList[0], payload.ImportId, job.UserId)
+	if err != nil {
+		return err
+	}
+	if expenseImport == nil {
+		return errors.New("import not found")
+	}
+
+	categories, err := loadCategoryIds()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(expenseImport.FilePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader, err := openImportReader(f, expenseImport, payload, categories)
+	if err != nil {
+		return err
+	}
+
+	// Skip the rows a previous run already committed
+	for i := 0; i < job.ProcessedItems; i++ {
+		if _, err := reader.Next(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+
+	chunkSize := importChunkSize()
+	chunk := make([]*imports.Record, 0, chunkSize)
+	for {
+		chunk = chunk[:0]
+		for len(chunk) < chunkSize {
+			record, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			chunk = append(chunk, record)
+		}
+		if len(chunk) == 0 {
+			return nil
+		}
+
+		if err := job.CheckCancelled(); err != nil {
+			return err
+		}
+		if err := job.Throttle(ctx); err != nil {
+			return err
+		}
+
+		err := config.DBConnList[0].Transaction(func(tx *gorm.DB) error {
+			return saveImportChunk(tx, job, chunk, payload.DryRun)
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// saveImportChunk inserts a chunk's valid rows and records the rejected
+// ones. Each insert runs under a savepoint so one bad row does not abort the
+// rest of the chunk.
+func saveImportChunk(tx *gorm.DB, job *jobs.Job, chunk []*imports.Record, dryRun bool) error {
+	successful, failed := 0, 0
+	for _, record := range chunk {
+		message := ""
+		if record.Err != nil {
+			message = record.Err.Error()
+		} else if !dryRun {
+			message = insertImportRow(tx, job.UserId, record)
+		}
+
+		if message == "" {
+			successful++
+			continue
+		}
+		failed++
+		fieldsJSON, _ := json.Marshal(record.Fields)
+		err := tx.Exec(
+			"INSERT INTO expense_import_errors (job_id, row_number, message, fields) VALUES (?, ?, ?, ?)",
+			job.Id, record.Line, message, string(fieldsJSON),
+		).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return job.ItemsDoneTx(tx, successful, failed)
+}
+
+// insertImportRow adds one expense and returns why it was rejected, or "".
+// Bank transactions are recorded in imported_transactions (user_id,
+// account_id, transaction_id, unique together) in the same savepoint, so one
+// the user already imported is skipped rather than added twice.
+func insertImportRow(tx *gorm.DB, userId int, record *imports.Record) string {
+	tx.SavePoint("import_row")
+
+	if record.ExternalId != "" {
+		res := tx.Exec(`
+			INSERT INTO imported_transactions (user_id, account_id, transaction_id)
+			VALUES (?, ?, ?)
+			ON CONFLICT DO NOTHING
+		`, userId, record.Account, record.ExternalId)
+		if res.Error != nil {
+			tx.RollbackTo("import_row")
+			log.Printf("Error recording transaction on row %d: %v", record.Line, res.Error)
+			return "Insert failed"
+		}
+		if res.RowsAffected == 0 {
+			return ""
+		}
+	}
+
+	inputJSON, _ := json.Marshal(record.Row.Payload(userId))
+	var resultStr string
+	if err := tx.Raw("SELECT add_expense_v3($1)", string(inputJSON)).Scan(&resultStr).Error; err != nil {
+		tx.RollbackTo("import_row")
+		log.Printf("Error inserting expense row %d: %v", record.Line, err)
+		return "Insert failed"
+	}
+
+	var result map[string]interface{}
+	json.Unmarshal([]byte(resultStr), &result)
+	if result["success"] != true {
+		tx.RollbackTo("import_row")
+		if m, ok := result["message"].(string); ok {
+			return m
+		}
+		return "Insert failed"
+	}
+	return ""
+}
+
+// retryExpenseImport queues the rows an import job rejected as a new import
+// with the same mapping and options. The upload is deleted once committed,
+// so the rows are rebuilt from the fields kept in expense_import_errors.
+func retryExpenseImport(c fiber.Ctx, userId, jobId int, payloadJSON string) error {
+	var payload mdlFeatureOne.ExpenseImportJob
+	if err := json.Unmarshal([]byte(payloadJSON), &payload); err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to parse job data", err, http.StatusInternalServerError)
+	}
+	if payload.DryRun {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "A dry run saves nothing, commit the import instead", nil, http.StatusBadRequest)
+	}
+
+	expenseImport, err := getExpenseImport(&config.DBConnList[0], payload.ImportId, userId)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+	if expenseImport == nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_404, "Import not found", nil, http.StatusNotFound)
+	}
+	// Importing a statement again skips the transactions already saved
+	if expenseImport.Format != imports.FormatCSV {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Bank statement imports cannot be retried, import the statement again", nil, http.StatusBadRequest)
+	}
+
+	// 1. Write the failed rows under the original headers
+	uploadPath, err := importUploadPath()
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to store file", err, http.StatusInternalServerError)
+	}
+	if err := os.MkdirAll(uploadPath, 0700); err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to store file", err, http.StatusInternalServerError)
+	}
+	filePath := filepath.Join(uploadPath, fmt.Sprintf("%d_%s.%s", userId, utils.GenerateOpaqueToken(16), imports.FormatCSV))
+
+	rows, err := config.DBConnList[0].Raw(
+		"SELECT fields FROM expense_import_errors WHERE job_id = ? ORDER BY row_number",
+		jobId,
+	).Rows()
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to fetch job", err, http.StatusInternalServerError)
+	}
+	defer rows.Close()
+
+	var headers []string
+	json.Unmarshal([]byte(expenseImport.Headers), &headers)
+	rowCount, err := writeImportRetryFile(filePath, headers, func() ([]string, error) {
+		if !rows.Next() {
+			if err := rows.Err(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+		var fieldsJSON string
+		if err := rows.Scan(&fieldsJSON); err != nil {
+			return nil, err
+		}
+		var fields []string
+		err := json.Unmarshal([]byte(fieldsJSON), &fields)
+		return fields, err
+	})
+	if err != nil {
+		os.Remove(filePath)
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to store file", err, http.StatusInternalServerError)
+	}
+	if rowCount == 0 {
+		os.Remove(filePath)
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Job has no failed items", nil, http.StatusBadRequest)
+	}
+
+	// 2. Record it as a new import and queue its job
+	var retryJobId int
+	err = config.DBConnList[0].Transaction(func(tx *gorm.DB) error {
+		err := tx.Raw(`
+			INSERT INTO expense_imports (user_id, file_path, original_name, format, delimiter, headers, row_count)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			RETURNING id
+		`, userId, filePath, expenseImport.OriginalName, imports.FormatCSV, ",", expenseImport.Headers, rowCount).Scan(&payload.ImportId).Error
+		if err != nil {
+			return err
+		}
+
+		retryJobId, err = jobs.EnqueueTx(tx, userId, jobTypeExpenseImport, rowCount, payload)
+		if err != nil {
+			return err
+		}
+
+		return tx.Exec("UPDATE expense_imports SET last_job_id = ?, committed_job_id = ? WHERE id = ?",
+			retryJobId, retryJobId, payload.ImportId).Error
+	})
+	if err != nil {
+		os.Remove(filePath)
+		log.Printf("Error creating retry job for job %d: %v", jobId, err)
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to create batch job", err, http.StatusInternalServerError)
+	}
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200,
+		"Retry job created successfully",
+		map[string]interface{}{
+			"jobId":      retryJobId,
+			"retryOf":    jobId,
+			"importId":   payload.ImportId,
+			"totalItems": rowCount,
+			"status":     "pending",
+		},
+		http.StatusAccepted)
+}
+
+// writeImportRetryFile writes headers and then each row next returns, until
+// io.EOF, as a comma-separated file the import reads with its original
+// mapping. It returns the number of rows written.
+func writeImportRetryFile(filePath string, headers []string, next func() ([]string, error)) (int, error) {
+	f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	writer := csv.NewWriter(f)
+	if err := writer.Write(headers); err != nil {
+		return 0, err
+	}
+	rowCount := 0
+	for {
+		fields, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		if err := writer.Write(fields); err != nil {
+			return 0, err
+		}
+		rowCount++
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return 0, err
+	}
+	return rowCount, f.Close()
+}
+
+var errImportAlreadyCommitted = errors.New("import has already been committed")
+
+// importCommitted reports whether an import's commit job is queued, running
+// or done. A commit that failed or was cancelled may be tried again.
+func importCommitted(db *gorm.DB, committedJobId *int) bool {
+	if committedJobId == nil {
+		return false
+	}
+	var status string
+	db.Raw("SELECT status FROM batch_jobs WHERE id = ?", *committedJobId).Scan(&status)
+	return status != "failed" && status != "cancelled"
+}
+
+// expenseImportFinished deletes an upload once its import has been committed
+// in full. Dry runs and failed commits keep the file so they can be run again.
+func expenseImportFinished(job *jobs.Job, status string) {
+	if job.JobType != jobTypeExpenseImport || status != "completed" {
+		return
+	}
+
+	var payload mdlFeatureOne.ExpenseImportJob
+	if err := job.DecodePayload(&payload); err != nil || payload.DryRun {
+		return
+	}
+
+	expenseImport, err := getExpenseImport(&config.DBConnList[0], payload.ImportId, job.UserId)
+	if err != nil || expenseImport == nil {
+		return
+	}
+	if err := os.Remove(expenseImport.FilePath); err != nil && !os.IsNotExist(err) {
+		log.Printf("Error removing import file for import %d: %v", payload.ImportId, err)
+	}
+}
+
+// getExpenseImport loads a user's import, or nil when there is none. Extra
+// clauses such as FOR UPDATE are appended to the query.
+func getExpenseImport(db *gorm.DB, importId, userId int, clauses ...string) (*mdlFeatureOne.ExpenseImport, error) {
+	var expenseImport mdlFeatureOne.ExpenseImport
+	err := db.Raw(`
+		SELECT id, user_id, file_path, original_name, COALESCE(format, 'csv') AS format, delimiter, headers, row_count, last_job_id, committed_job_id
+		FROM expense_imports
+		WHERE id = ? AND user_id = ?
+	`+strings.Join(clauses, " "), importId, userId).Scan(&expenseImport).Error
+	if err != nil || expenseImport.Id == 0 {
+		return nil, err
+	}
+	return &expenseImport, nil
+}
+
+// checkImportOptions opens the file with the requested options so mapping
+// and format mistakes are reported before a job is queued
+func checkImportOptions(expenseImport *mdlFeatureOne.ExpenseImport, payload mdlFeatureOne.ExpenseImportJob) error {
+	f, err := os.Open(expenseImport.FilePath)
+	if err != nil {
+		return errors.New("import file is no longer available, upload it again")
+	}
+	defer f.Close()
+
+	_, err = openImportReader(f, expenseImport, payload, nil)
+	return err
+}
+
+// openImportReader reads an import in its format. Bank statements need no
+// column mapping, so it is ignored for them.
+func openImportReader(f io.Reader, expenseImport *mdlFeatureOne.ExpenseImport, payload mdlFeatureOne.ExpenseImportJob, categories map[string]int) (imports.Reader, error) {
+	options := imports.Options{
+		Mapping:          payload.Mapping,
+		DateFormat:       payload.DateFormat,
+		DecimalSeparator: payload.DecimalSeparator,
+		Categories:       categories,
+		Currency:         payload.Currency,
+	}
+	if expenseImport.Format == imports.FormatOFX || expenseImport.Format == imports.FormatQIF {
+		return imports.NewStatementReader(f, expenseImport.Format, options)
+	}
+	return imports.NewCSVReader(f, expenseImport.Delimiter, options)
+}
+
+// detectImportFormat tells CSV from OFX, QFX and QIF uploads
+func detectImportFormat(file *multipart.FileHeader) (string, error) {
+	f, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	return imports.DetectFormat(file.Filename, head[:n]), nil
+}
+
+func previewImportFile(filePath, format string) (*imports.Preview, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if format == imports.FormatCSV {
+		return imports.PreviewCSV(f, importSampleRows)
+	}
+	return imports.PreviewStatement(f, format, importSampleRows)
+}
+
+// loadCategoryIds maps lower-cased category names to IDs for lookups by name
+func loadCategoryIds() (map[string]int, error) {
+	var resultStr string
+	err := config.DBConnList[0].Raw(scpFeatureOne.GetExpenseCategories, 1000, 0).Scan(&resultStr).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var res mdlFeatureOne.GetExpenseCategoriesResponse
+	if err := json.Unmarshal([]byte(resultStr), &res); err != nil {
+		return nil, err
+	}
+
+	categories := map[string]int{}
+	if res.Categories != nil {
+		for _, category := range *res.Categories {
+			if category.ID != nil && category.Name != nil {
+				categories[strings.ToLower(strings.TrimSpace(*category.Name))] = *category.ID
+			}
+		}
+	}
+	return categories, nil
+}
+
+// importUploadPath is where uploaded import files wait to be committed
+// (IMPORT_UPLOAD_PATH). It must not be publicly served.
+func importUploadPath() (string, error) {
+	return utils.PrivateStoragePath("IMPORT_UPLOAD_PATH", "./storage/imports")
+}
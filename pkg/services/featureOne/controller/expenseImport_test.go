@@ -0,0 +1,165 @@
+package ctrFeatureOne
+
+import (
+	"errors"
+	"go_template_v3/pkg/imports"
+	mdlFeatureOne "go_template_v3/pkg/services/featureOne/model"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// readImport reads a file the way processExpenseImportAsync does
+func readImport(t *testing.T, filePath string, expenseImport *mdlFeatureOne.ExpenseImport, payload mdlFeatureOne.ExpenseImportJob) []*imports.Record {
+	t.Helper()
+	f, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	reader, err := openImportReader(f, expenseImport, payload, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []*imports.Record
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			return records
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+}
+
+// retryRows returns the rows' fields one at a time, as the retry reads
+// them from expense_import_errors
+func retryRows(rows [][]string) func() ([]string, error) {
+	return func() ([]string, error) {
+		if len(rows) == 0 {
+			return nil, io.EOF
+		}
+		fields := rows[0]
+		rows = rows[1:]
+		return fields, nil
+	}
+}
+
+func TestRetryFailedBatchUpload(t *testing.T) {
+	dir := t.TempDir()
+	upload := filepath.Join(dir, "upload.csv")
+	file := "\ufefftitle,amount,categoryId,date,notes,currency\n" +
+		"Lunch,12.50,1,2024-03-01,,\n" +
+		"\"Dinner, with friends\",40.125,2,2024-03-02,\"said \"\"hi\"\"\",BHD\n" +
+		"Taxi,9,1,2024-03-03,,\n"
+	if err := os.WriteFile(upload, []byte(file), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The upload is checked and queued as BatchUploadExpensesFromCSV does
+	payload := mdlFeatureOne.ExpenseImportJob{Currency: "USD"}
+	headers, rowCount, message := checkBatchUploadCSV(upload, &payload)
+	if message != "" || rowCount != 3 {
+		t.Fatalf("checkBatchUploadCSV = %d rows, %q", rowCount, message)
+	}
+	expenseImport := &mdlFeatureOne.ExpenseImport{Format: imports.FormatCSV, Delimiter: ","}
+	original := readImport(t, upload, expenseImport, payload)
+
+	// The second and third rows were refused when saved, so only their
+	// fields are left once the upload is deleted
+	failed := original[1:]
+	retry := filepath.Join(dir, "retry.csv")
+	written, err := writeImportRetryFile(retry, headers, retryRows([][]string{failed[0].Fields, failed[1].Fields}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != 2 {
+		t.Fatalf("wrote %d rows, want 2", written)
+	}
+
+	retried := readImport(t, retry, expenseImport, payload)
+	if len(retried) != len(failed) {
+		t.Fatalf("retry read %d rows, want %d", len(retried), len(failed))
+	}
+	for i, record := range retried {
+		if record.Err != nil {
+			t.Errorf("retried row %d rejected: %v", i, record.Err)
+			continue
+		}
+		if !reflect.DeepEqual(record.Fields, failed[i].Fields) {
+			t.Errorf("retried row %d fields = %q, want %q", i, record.Fields, failed[i].Fields)
+		}
+		if !reflect.DeepEqual(record.Row, failed[i].Row) {
+			t.Errorf("retried row %d = %+v, want %+v", i, record.Row, failed[i].Row)
+		}
+	}
+	if row := retried[0].Row; row.Title != "Dinner, with friends" || row.Amount.String() != "40.125" || row.Currency != "BHD" {
+		t.Errorf("first retried row = %+v", row)
+	}
+}
+
+func TestRetryFailedImportKeepsOptions(t *testing.T) {
+	dir := t.TempDir()
+	upload := filepath.Join(dir, "upload.csv")
+	file := "Payee;Spent;On\n" +
+		"Rent;\"1.234,50\";31.01.2024\n" +
+		"Books;12,00;01.02.2024\n"
+	if err := os.WriteFile(upload, []byte(file), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	payload := mdlFeatureOne.ExpenseImportJob{
+		Mapping:          imports.Mapping{imports.FieldTitle: "Payee", imports.FieldAmount: "Spent", imports.FieldDate: "On"},
+		DateFormat:       "DD.MM.YYYY",
+		DecimalSeparator: ",",
+		Currency:         "EUR",
+	}
+	original := readImport(t, upload, &mdlFeatureOne.ExpenseImport{Format: imports.FormatCSV, Delimiter: ";"}, payload)
+
+	// The retry file is comma-separated whatever the upload used
+	retry := filepath.Join(dir, "retry.csv")
+	if _, err := writeImportRetryFile(retry, []string{"Payee", "Spent", "On"}, retryRows([][]string{original[0].Fields})); err != nil {
+		t.Fatal(err)
+	}
+	retried := readImport(t, retry, &mdlFeatureOne.ExpenseImport{Format: imports.FormatCSV, Delimiter: ","}, payload)
+	if len(retried) != 1 || retried[0].Err != nil {
+		t.Fatalf("retry read %+v", retried)
+	}
+	if row := retried[0].Row; row.Amount.String() != "1234.5" || row.Date != "2024-01-31" {
+		t.Errorf("retried row = %+v", row)
+	}
+}
+
+func TestWriteImportRetryFileErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	// A read error while rebuilding the rows is reported, not written
+	failing := func() ([]string, error) { return nil, errors.New("connection lost") }
+	if _, err := writeImportRetryFile(filepath.Join(dir, "a.csv"), []string{"title"}, failing); err == nil {
+		t.Error("read error ignored")
+	}
+
+	// An existing file is never overwritten
+	existing := filepath.Join(dir, "b.csv")
+	if err := os.WriteFile(existing, []byte("keep"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writeImportRetryFile(existing, []string{"title"}, retryRows(nil)); err == nil {
+		t.Error("existing file overwritten")
+	}
+	if data, _ := os.ReadFile(existing); string(data) != "keep" {
+		t.Errorf("existing file now holds %q", data)
+	}
+
+	// No failed rows leaves just the header
+	empty := filepath.Join(dir, "c.csv")
+	written, err := writeImportRetryFile(empty, []string{"title", "amount"}, retryRows(nil))
+	if err != nil || written != 0 {
+		t.Errorf("empty retry = %d, %v", written, err)
+	}
+}
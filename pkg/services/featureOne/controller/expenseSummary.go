@@ -0,0 +1,376 @@
+package ctrFeatureOne
+
+import (
+	"fmt"
+	"go_template_v3/pkg/config"
+	"go_template_v3/pkg/currency"
+	"go_template_v3/pkg/global/utils"
+	"go_template_v3/pkg/money"
+	mdlFeatureOne "go_template_v3/pkg/services/featureOne/model"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "github.com/FDSAP-Git-Org/hephaestus/helper/v1"
+	"github.com/FDSAP-Git-Org/hephaestus/respcode"
+	"github.com/gofiber/fiber/v3"
+)
+
+const (
+	summaryByCategory = "category"
+	summaryByDay      = "day"
+	summaryByWeek     = "week"
+	summaryByMonth    = "month"
+	summaryByYear     = "year"
+
+	// summaryMaxGroups bounds how many time buckets one summary returns
+	summaryMaxGroups = 1000
+)
+
+// summaryColumns total the converted amounts of a group
+const summaryColumns = `COALESCE(SUM(e.amount * fx.rate), 0) AS total, COUNT(*) AS count,
+	COUNT(*) FILTER (WHERE fx.rate IS NULL) AS unconverted`
+
+// summaryRow is one group as the database totals it
+type summaryRow struct {
+	Bucket       string
+	CategoryId   *int
+	CategoryName string
+	Total        money.Amount
+	Count        int
+	Unconverted  int
+}
+
+func GetExpenseSummary(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Read the grouping, from the path or ?groupBy=, monthly by default
+	groupBy := strings.ToLower(c.Params("groupBy"))
+	if groupBy == "" {
+		groupBy = strings.ToLower(fiber.Query[string](c, "groupBy"))
+	}
+	if groupBy == "" {
+		groupBy = summaryByMonth
+	}
+	switch groupBy {
+	case summaryByCategory, summaryByDay, summaryByWeek, summaryByMonth, summaryByYear:
+	default:
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "groupBy must be category, day, week, month or year", nil, http.StatusBadRequest)
+	}
+
+	// 3. Read the same filters as GetExpenses and settle the date range
+	filters, message := expenseQueryFilters(c)
+	if message != "" {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, message, nil, http.StatusBadRequest)
+	}
+	start, end, message := summaryRange(groupBy, filters.StartDate, filters.EndDate)
+	if message != "" {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, message, nil, http.StatusBadRequest)
+	}
+	var buckets []time.Time
+	if groupBy != summaryByCategory {
+		buckets = summaryBuckets(groupBy, start, end)
+		if len(buckets) > summaryMaxGroups {
+			return v1.JSONResponseWithError(c, respcode.ERR_CODE_400,
+				fmt.Sprintf("Date range is too long to group by %s (max %d groups)", groupBy, summaryMaxGroups), nil, http.StatusBadRequest)
+		}
+	}
+	prevStart, prevEnd := summaryPreviousRange(start, end)
+
+	// 4. Amounts are converted into ?currency=, the user's base currency by
+	// default, at the rate of each expense's date
+	baseCurrency := currency.UserBase(&config.DBConnList[0], userId)
+	targetCurrency, message := expenseTargetCurrency(c, baseCurrency)
+	if message != "" {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, message, nil, http.StatusBadRequest)
+	}
+	conversion := expenseConversion(baseCurrency, targetCurrency)
+
+	filters.StartDate, filters.EndDate = start.Format("2006-01-02"), end.Format("2006-01-02")
+	prevFilters := filters
+	prevFilters.StartDate, prevFilters.EndDate = prevStart.Format("2006-01-02"), prevEnd.Format("2006-01-02")
+
+	// 5. Total the range and the one before it
+	summary := mdlFeatureOne.ExpenseSummary{
+		GroupBy:  groupBy,
+		Currency: targetCurrency,
+		Filters:  filters,
+		Groups:   []mdlFeatureOne.ExpenseSummaryGroup{},
+	}
+	var err error
+	if summary.Current, err = summaryPeriod(userId, filters, baseCurrency, targetCurrency, conversion); err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+	if summary.Previous, err = summaryPeriod(userId, prevFilters, baseCurrency, targetCurrency, conversion); err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+	summary.Change = summaryChange(summary.Current.Total, summary.Previous.Total)
+
+	// 6. Break the range down
+	if groupBy == summaryByCategory {
+		summary.Groups, err = summaryCategoryGroups(userId, filters, prevFilters, targetCurrency, conversion)
+	} else {
+		summary.Groups, err = summaryTimeGroups(userId, filters, groupBy, buckets, start, end, targetCurrency, conversion)
+	}
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+	for i := range summary.Groups {
+		if summary.Current.Total != 0 {
+			summary.Groups[i].Share = roundPercent(summary.Groups[i].Total.Float64() / summary.Current.Total.Float64() * 100)
+		}
+	}
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Expense summary retrieved", summary, http.StatusOK)
+}
+
+// summaryPeriod totals the range of filters, converted into targetCurrency
+// and per currency as entered
+func summaryPeriod(userId int, filters mdlFeatureOne.ExpenseExportFilters, baseCurrency, targetCurrency, conversion string) (mdlFeatureOne.ExpenseSummaryPeriod, error) {
+	period := mdlFeatureOne.ExpenseSummaryPeriod{
+		StartDate:  filters.StartDate,
+		EndDate:    filters.EndDate,
+		ByCurrency: []mdlFeatureOne.ExpenseSummaryCurrency{},
+	}
+
+	var row summaryRow
+	query, args := expenseExportQuery(userId, filters, summaryColumns, false, conversion)
+	if err := config.DBConnList[0].Raw(query, args...).Scan(&row).Error; err != nil {
+		return period, err
+	}
+	period.ExpenseSummaryTotals = summaryRowTotals(row, targetCurrency)
+
+	query, args = expenseExportQuery(userId, filters,
+		"COALESCE(e.currency, "+currency.Literal(baseCurrency)+") AS currency, SUM(e.amount) AS total, COUNT(*) AS count, "+
+			"SUM(e.amount * fx.rate) AS converted",
+		false, conversion)
+	err := config.DBConnList[0].Raw(query+" GROUP BY 1 ORDER BY converted DESC NULLS LAST, 1", args...).Scan(&period.ByCurrency).Error
+	if err != nil {
+		return period, err
+	}
+	for i, byCurrency := range period.ByCurrency {
+		period.ByCurrency[i].Total = byCurrency.Total.Round(byCurrency.Currency)
+		if byCurrency.Converted != nil {
+			converted := byCurrency.Converted.Round(targetCurrency)
+			period.ByCurrency[i].Converted = &converted
+		}
+	}
+	return period, nil
+}
+
+// summaryCategoryGroups totals each category, largest first, and compares
+// it with the same category in the previous range
+func summaryCategoryGroups(userId int, filters, prevFilters mdlFeatureOne.ExpenseExportFilters, targetCurrency, conversion string) ([]mdlFeatureOne.ExpenseSummaryGroup, error) {
+	columns := "e.category_id, COALESCE(c.name, '') AS category_name, " + summaryColumns
+
+	var rows, prevRows []summaryRow
+	query, args := expenseExportQuery(userId, filters, columns, false, conversion)
+	if err := config.DBConnList[0].Raw(query+" GROUP BY e.category_id, c.name ORDER BY total DESC", args...).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	query, args = expenseExportQuery(userId, prevFilters, columns, false, conversion)
+	if err := config.DBConnList[0].Raw(query+" GROUP BY e.category_id, c.name", args...).Scan(&prevRows).Error; err != nil {
+		return nil, err
+	}
+
+	previous := map[string]money.Amount{}
+	for _, row := range prevRows {
+		previous[summaryCategoryKey(row.CategoryId)] = row.Total.Round(targetCurrency)
+	}
+
+	groups := make([]mdlFeatureOne.ExpenseSummaryGroup, 0, len(rows))
+	for _, row := range rows {
+		key := summaryCategoryKey(row.CategoryId)
+		label := row.CategoryName
+		if label == "" {
+			label = "Uncategorized"
+		}
+		totals := summaryRowTotals(row, targetCurrency)
+		groups = append(groups, mdlFeatureOne.ExpenseSummaryGroup{
+			Key:                  key,
+			Label:                label,
+			CategoryId:           row.CategoryId,
+			Change:               summaryChange(totals.Total, previous[key]),
+			ExpenseSummaryTotals: totals,
+		})
+	}
+	return groups, nil
+}
+
+// summaryTimeGroups totals each bucket, including empty ones, and compares
+// it with the bucket before
+func summaryTimeGroups(userId int, filters mdlFeatureOne.ExpenseExportFilters, groupBy string, buckets []time.Time, start, end time.Time, targetCurrency, conversion string) ([]mdlFeatureOne.ExpenseSummaryGroup, error) {
+	// groupBy is one of the fixed groupings, so it is safe to inline
+	columns := fmt.Sprintf(
+		"to_char(date_trunc('%s', e.date::timestamp), 'YYYY-MM-DD') AS bucket, %s",
+		groupBy, summaryColumns,
+	)
+
+	var rows []summaryRow
+	query, args := expenseExportQuery(userId, filters, columns, false, conversion)
+	if err := config.DBConnList[0].Raw(query+" GROUP BY 1", args...).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	byBucket := make(map[string]summaryRow, len(rows))
+	for _, row := range rows {
+		byBucket[row.Bucket] = row
+	}
+
+	groups := make([]mdlFeatureOne.ExpenseSummaryGroup, 0, len(buckets))
+	for i, bucket := range buckets {
+		key := bucket.Format("2006-01-02")
+		row := byBucket[key]
+
+		bucketStart, bucketEnd := bucket, summaryNextBucket(groupBy, bucket).AddDate(0, 0, -1)
+		if bucketStart.Before(start) {
+			bucketStart = start
+		}
+		if bucketEnd.After(end) {
+			bucketEnd = end
+		}
+
+		group := mdlFeatureOne.ExpenseSummaryGroup{
+			Key:                  key,
+			Label:                summaryBucketLabel(groupBy, bucket),
+			StartDate:            bucketStart.Format("2006-01-02"),
+			EndDate:              bucketEnd.Format("2006-01-02"),
+			ExpenseSummaryTotals: summaryRowTotals(row, targetCurrency),
+		}
+		if i > 0 {
+			group.Change = summaryChange(group.Total, groups[i-1].Total)
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// summaryRange resolves the requested dates. Without an end date it ends
+// today; without a start date it covers the last 30 days, 12 weeks, 12
+// months or 5 years, or the current month when grouping by category.
+func summaryRange(groupBy, startDate, endDate string) (time.Time, time.Time, string) {
+	y, m, d := time.Now().Date()
+	end := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	if endDate != "" {
+		end, _ = time.Parse("2006-01-02", endDate)
+	}
+
+	var start time.Time
+	if startDate != "" {
+		start, _ = time.Parse("2006-01-02", startDate)
+	} else {
+		switch groupBy {
+		case summaryByDay:
+			start = end.AddDate(0, 0, -29)
+		case summaryByWeek:
+			start = summaryBucketStart(summaryByWeek, end).AddDate(0, 0, -7*11)
+		case summaryByYear:
+			start = summaryBucketStart(summaryByYear, end).AddDate(-4, 0, 0)
+		case summaryByCategory:
+			start = summaryBucketStart(summaryByMonth, end)
+		default:
+			start = summaryBucketStart(summaryByMonth, end).AddDate(0, -11, 0)
+		}
+	}
+
+	if end.Before(start) {
+		return start, end, "endDate must not be before startDate"
+	}
+	return start, end, ""
+}
+
+// summaryPreviousRange is the range just before start to end. Whole
+// calendar months shift by months so that, say, February compares with
+// January rather than with the last 28 days of it.
+func summaryPreviousRange(start, end time.Time) (time.Time, time.Time) {
+	prevEnd := start.AddDate(0, 0, -1)
+	if start.Day() == 1 && end.AddDate(0, 0, 1).Day() == 1 {
+		months := (end.Year()-start.Year())*12 + int(end.Month()) - int(start.Month()) + 1
+		return start.AddDate(0, -months, 0), prevEnd
+	}
+	days := int(end.Sub(start).Hours()/24) + 1
+	return start.AddDate(0, 0, -days), prevEnd
+}
+
+// summaryBuckets lists the start of every bucket that overlaps the range
+func summaryBuckets(groupBy string, start, end time.Time) []time.Time {
+	var buckets []time.Time
+	for bucket := summaryBucketStart(groupBy, start); !bucket.After(end); bucket = summaryNextBucket(groupBy, bucket) {
+		buckets = append(buckets, bucket)
+		if len(buckets) > summaryMaxGroups {
+			break
+		}
+	}
+	return buckets
+}
+
+// summaryBucketStart truncates a date the way date_trunc does; weeks start
+// on Monday
+func summaryBucketStart(groupBy string, date time.Time) time.Time {
+	switch groupBy {
+	case summaryByWeek:
+		return date.AddDate(0, 0, -((int(date.Weekday()) + 6) % 7))
+	case summaryByMonth:
+		return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case summaryByYear:
+		return time.Date(date.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return date
+}
+
+func summaryNextBucket(groupBy string, bucket time.Time) time.Time {
+	switch groupBy {
+	case summaryByWeek:
+		return bucket.AddDate(0, 0, 7)
+	case summaryByMonth:
+		return bucket.AddDate(0, 1, 0)
+	case summaryByYear:
+		return bucket.AddDate(1, 0, 0)
+	}
+	return bucket.AddDate(0, 0, 1)
+}
+
+func summaryBucketLabel(groupBy string, bucket time.Time) string {
+	switch groupBy {
+	case summaryByWeek:
+		year, week := bucket.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case summaryByMonth:
+		return bucket.Format("2006-01")
+	case summaryByYear:
+		return bucket.Format("2006")
+	}
+	return bucket.Format("2006-01-02")
+}
+
+func summaryCategoryKey(categoryId *int) string {
+	if categoryId == nil {
+		return "uncategorized"
+	}
+	return strconv.Itoa(*categoryId)
+}
+
+// summaryRowTotals rounds a group's figures to the currency's decimals
+func summaryRowTotals(row summaryRow, code string) mdlFeatureOne.ExpenseSummaryTotals {
+	totals := mdlFeatureOne.ExpenseSummaryTotals{Total: row.Total.Round(code), Count: row.Count, Unconverted: row.Unconverted}
+	if converted := row.Count - row.Unconverted; converted > 0 {
+		totals.Average = row.Total.DivRound(converted, code)
+	}
+	return totals
+}
+
+func summaryChange(current, previous money.Amount) *mdlFeatureOne.ExpenseSummaryChange {
+	change := &mdlFeatureOne.ExpenseSummaryChange{Amount: current - previous}
+	if previous != 0 {
+		percent := roundPercent((current - previous).Float64() / math.Abs(previous.Float64()) * 100)
+		change.Percent = &percent
+	}
+	return change
+}
+
+// roundPercent rounds a percentage to two decimals
+func roundPercent(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -0,0 +1,186 @@
+package ctrFeatureOne
+
+import (
+	"go_template_v3/pkg/money"
+	"strings"
+	"testing"
+	"time"
+)
+
+func summaryDate(t *testing.T, value string) time.Time {
+	t.Helper()
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return date
+}
+
+func TestSummaryRange(t *testing.T) {
+	tests := []struct {
+		groupBy   string
+		startDate string
+		endDate   string
+		want      string
+	}{
+		{summaryByMonth, "2024-01-15", "2024-03-10", "2024-01-15 2024-03-10"},
+		{summaryByDay, "", "2024-03-10", "2024-02-10 2024-03-10"},
+		// 2024-03-10 is a Sunday, its week starts on Monday the 4th
+		{summaryByWeek, "", "2024-03-10", "2023-12-18 2024-03-10"},
+		{summaryByMonth, "", "2024-03-10", "2023-04-01 2024-03-10"},
+		{summaryByYear, "", "2024-03-10", "2020-01-01 2024-03-10"},
+		{summaryByCategory, "", "2024-03-10", "2024-03-01 2024-03-10"},
+	}
+	for _, tt := range tests {
+		start, end, message := summaryRange(tt.groupBy, tt.startDate, tt.endDate)
+		if got := start.Format("2006-01-02") + " " + end.Format("2006-01-02"); message != "" || got != tt.want {
+			t.Errorf("summaryRange(%s, %q, %q) = %s, %q, want %s", tt.groupBy, tt.startDate, tt.endDate, got, message, tt.want)
+		}
+	}
+
+	if _, _, message := summaryRange(summaryByMonth, "2024-03-02", "2024-03-01"); message == "" {
+		t.Error("end before start accepted")
+	}
+	if _, end, _ := summaryRange(summaryByMonth, "2024-01-01", ""); end.Format("2006-01-02") != time.Now().Format("2006-01-02") {
+		t.Errorf("range without an end date ends %s, want today", end.Format("2006-01-02"))
+	}
+}
+
+func TestSummaryPreviousRange(t *testing.T) {
+	tests := []struct {
+		start string
+		end   string
+		want  string
+	}{
+		// Whole months compare with the months before
+		{"2024-03-01", "2024-03-31", "2024-02-01 2024-02-29"},
+		{"2024-02-01", "2024-02-29", "2024-01-01 2024-01-31"},
+		{"2023-03-01", "2023-03-31", "2023-02-01 2023-02-28"},
+		{"2024-01-01", "2024-03-31", "2023-10-01 2023-12-31"},
+		{"2024-01-01", "2024-12-31", "2023-01-01 2023-12-31"},
+		// Anything else compares with as many days before
+		{"2024-03-01", "2024-03-10", "2024-02-20 2024-02-29"},
+		{"2024-03-15", "2024-04-14", "2024-02-13 2024-03-14"},
+		{"2024-03-05", "2024-03-05", "2024-03-04 2024-03-04"},
+	}
+	for _, tt := range tests {
+		prevStart, prevEnd := summaryPreviousRange(summaryDate(t, tt.start), summaryDate(t, tt.end))
+		if got := prevStart.Format("2006-01-02") + " " + prevEnd.Format("2006-01-02"); got != tt.want {
+			t.Errorf("summaryPreviousRange(%s, %s) = %s, want %s", tt.start, tt.end, got, tt.want)
+		}
+	}
+}
+
+func TestSummaryBuckets(t *testing.T) {
+	tests := []struct {
+		groupBy string
+		start   string
+		end     string
+		want    string
+	}{
+		{summaryByDay, "2024-02-28", "2024-03-01", "2024-02-28 2024-02-29 2024-03-01"},
+		// Buckets that only partly overlap the range are included
+		{summaryByWeek, "2024-12-25", "2025-01-08", "2024-12-23 2024-12-30 2025-01-06"},
+		{summaryByMonth, "2024-01-31", "2024-03-01", "2024-01-01 2024-02-01 2024-03-01"},
+		{summaryByYear, "2023-12-31", "2024-01-01", "2023-01-01 2024-01-01"},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, bucket := range summaryBuckets(tt.groupBy, summaryDate(t, tt.start), summaryDate(t, tt.end)) {
+			got = append(got, bucket.Format("2006-01-02"))
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("summaryBuckets(%s, %s, %s) = %v, want %s", tt.groupBy, tt.start, tt.end, got, tt.want)
+		}
+	}
+
+	// Long ranges stop one past the limit so they can be refused
+	buckets := summaryBuckets(summaryByDay, summaryDate(t, "2000-01-01"), summaryDate(t, "2024-01-01"))
+	if len(buckets) != summaryMaxGroups+1 {
+		t.Errorf("got %d buckets, want %d", len(buckets), summaryMaxGroups+1)
+	}
+}
+
+func TestSummaryBucketLabel(t *testing.T) {
+	tests := []struct {
+		groupBy string
+		bucket  string
+		want    string
+	}{
+		{summaryByDay, "2024-02-29", "2024-02-29"},
+		{summaryByWeek, "2024-01-01", "2024-W01"},
+		// ISO weeks belong to the year holding their Thursday
+		{summaryByWeek, "2024-12-30", "2025-W01"},
+		{summaryByWeek, "2020-12-28", "2020-W53"},
+		{summaryByMonth, "2024-02-01", "2024-02"},
+		{summaryByYear, "2024-01-01", "2024"},
+	}
+	for _, tt := range tests {
+		if got := summaryBucketLabel(tt.groupBy, summaryDate(t, tt.bucket)); got != tt.want {
+			t.Errorf("summaryBucketLabel(%s, %s) = %q, want %q", tt.groupBy, tt.bucket, got, tt.want)
+		}
+	}
+}
+
+func TestSummaryChange(t *testing.T) {
+	amount := func(value string) money.Amount {
+		a, err := money.Parse(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+
+	tests := []struct {
+		current  string
+		previous string
+		amount   string
+		percent  *float64
+	}{
+		{"150", "100", "50", ptr(50)},
+		{"50", "200", "-150", ptr(-75)},
+		{"100", "300", "-200", ptr(-66.67)},
+		{"0", "80", "-80", ptr(-100)},
+		// Refunds can leave a negative total; the change is still measured
+		// against its size
+		{"10", "-20", "30", ptr(150)},
+		// Nothing to compare with
+		{"25", "0", "25", nil},
+	}
+	for _, tt := range tests {
+		change := summaryChange(amount(tt.current), amount(tt.previous))
+		if change.Amount != amount(tt.amount) {
+			t.Errorf("change from %s to %s = %s, want %s", tt.previous, tt.current, change.Amount, tt.amount)
+		}
+		switch {
+		case tt.percent == nil && change.Percent != nil:
+			t.Errorf("change from %s to %s = %v%%, want none", tt.previous, tt.current, *change.Percent)
+		case tt.percent != nil && (change.Percent == nil || *change.Percent != *tt.percent):
+			t.Errorf("change from %s to %s = %v%%, want %v%%", tt.previous, tt.current, change.Percent, *tt.percent)
+		}
+	}
+}
+
+func ptr(value float64) *float64 {
+	return &value
+}
+
+func TestSummaryRowTotals(t *testing.T) {
+	total, _ := money.Parse("100.005")
+
+	totals := summaryRowTotals(summaryRow{Total: total, Count: 4, Unconverted: 1}, "USD")
+	// The unconverted expense is counted but left out of the average
+	if totals.Total.String() != "100.01" || totals.Count != 4 || totals.Unconverted != 1 || totals.Average.String() != "33.34" {
+		t.Errorf("totals = %+v", totals)
+	}
+
+	totals = summaryRowTotals(summaryRow{Total: total, Count: 3}, "JPY")
+	if totals.Total.String() != "100" || totals.Average.String() != "33" {
+		t.Errorf("yen totals = %+v", totals)
+	}
+
+	totals = summaryRowTotals(summaryRow{Count: 2, Unconverted: 2}, "USD")
+	if totals.Total != 0 || totals.Average != 0 {
+		t.Errorf("totals without any converted expense = %+v", totals)
+	}
+}
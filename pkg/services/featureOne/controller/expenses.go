@@ -1,14 +1,24 @@
 package ctrFeatureOne
 
 import (
+	"bytes"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"go_template_v3/pkg/config"
+	"go_template_v3/pkg/currency"
 	"go_template_v3/pkg/global/utils"
+	"go_template_v3/pkg/imports"
+	"go_template_v3/pkg/jobs"
+	"go_template_v3/pkg/money"
 	mdlFeatureOne "go_template_v3/pkg/services/featureOne/model"
+	"io"
 	"log"
 	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -17,6 +27,7 @@ import (
 	"github.com/FDSAP-Git-Org/hephaestus/respcode"
 	utils_v1 "github.com/FDSAP-Git-Org/hephaestus/utils/v1"
 	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
 )
 
 func AddExpense(c fiber.Ctx) error {
@@ -25,14 +36,25 @@ func AddExpense(c fiber.Ctx) error {
 
 	// 2. Parse request body
 	var reqBody map[string]interface{}
-	if err := c.Bind().Body(&reqBody); err != nil {
+	if err := bindExact(c, &reqBody); err != nil {
 		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid body", err, http.StatusBadRequest)
 	}
 
 	// 3. Add userId to the payload (controller logic)
 	reqBody["userId"] = userId
 
-	// 4. Execute the query
+	// 4. Expenses are in the user's base currency unless they name one
+	if message := payloadCurrency(reqBody); message != "" {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, message, nil, http.StatusBadRequest)
+	}
+	if reqBody["currency"] == nil {
+		reqBody["currency"] = currency.UserBase(&config.DBConnList[0], userId)
+	}
+	if message := payloadAmount(reqBody); message != "" {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, message, nil, http.StatusBadRequest)
+	}
+
+	// 5. Execute the query
 	return utils.ExecuteDBFunction(c, "SELECT add_expense_v3($1)", reqBody)
 }
 
@@ -134,6 +156,18 @@ func AddExpenseV2(c fiber.Ctx) error {
 		}
 	}
 
+	expenseCurrency := currency.UserBase(&config.DBConnList[0], userId)
+	if reqBody.Currency != nil && strings.TrimSpace(*reqBody.Currency) != "" {
+		code, err := currency.Normalize(*reqBody.Currency)
+		if err != nil {
+			return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, err.Error(), nil, http.StatusBadRequest)
+		}
+		expenseCurrency = code
+	}
+	if err := reqBody.Amount.Check(expenseCurrency); err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, err.Error(), nil, http.StatusBadRequest)
+	}
+
 	var imageURL *string
 
 	// Handle file upload
@@ -158,9 +192,10 @@ func AddExpenseV2(c fiber.Ctx) error {
 
 	// Prepare payload for DB
 	payload := map[string]interface{}{
-		"userId": userId,
-		"title":  reqBody.Title,
-		"amount": reqBody.Amount,
+		"userId":   userId,
+		"title":    reqBody.Title,
+		"amount":   reqBody.Amount,
+		"currency": expenseCurrency,
 	}
 
 	if reqBody.CategoryID != nil {
@@ -192,13 +227,19 @@ func UpdateExpense(c fiber.Ctx) error {
 
 	// 2. Parse request body
 	var reqBody map[string]interface{}
-	if err := c.Bind().Body(&reqBody); err != nil {
+	if err := bindExact(c, &reqBody); err != nil {
 		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid body", err, http.StatusBadRequest)
 	}
 
 	// 3. Add userId and ensure we have the expense ID
 	reqBody["userId"] = userId
 	reqBody["expenseId"] = c.Params("id") // Get ID from URL params
+	if message := payloadCurrency(reqBody); message != "" {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, message, nil, http.StatusBadRequest)
+	}
+	if message := payloadAmount(reqBody); message != "" {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, message, nil, http.StatusBadRequest)
+	}
 
 	// 4. Execute the query
 	return utils.ExecuteDBFunction(c, "SELECT update_expense_v3($1)", reqBody)
@@ -217,14 +258,14 @@ func GetExpenses(c fiber.Ctx) error {
 	if title := fiber.Query[string](c, "title"); title != "" {
 		payload["title"] = title
 	}
-	if amount := fiber.Query[float64](c, "amount"); amount != 0 {
-		payload["amount"] = amount
-	}
-	if minAmount := fiber.Query[float64](c, "minAmount"); minAmount != 0 {
-		payload["minAmount"] = minAmount
-	}
-	if maxAmount := fiber.Query[float64](c, "maxAmount"); maxAmount != 0 {
-		payload["maxAmount"] = maxAmount
+	for _, key := range []string{"amount", "minAmount", "maxAmount"} {
+		amount, err := queryAmount(c, key)
+		if err != nil {
+			return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Amounts must be decimal numbers", err, http.StatusBadRequest)
+		}
+		if amount != 0 {
+			payload[key] = amount
+		}
 	}
 	if categoryId := fiber.Query[int](c, "categoryId"); categoryId != 0 {
 		payload["categoryId"] = categoryId
@@ -379,7 +420,7 @@ func BatchUpdateExpenses(c fiber.Ctx) error {
 
 	// 2. Parse request body
 	var req []map[string]any
-	if err := c.Bind().Body(&req); err != nil {
+	if err := bindExact(c, &req); err != nil {
 		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid body", err, http.StatusBadRequest)
 	}
 
@@ -392,7 +433,12 @@ func BatchUpdateExpenses(c fiber.Ctx) error {
 		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Batch size too large. Maximum 100 updates allowed", nil, http.StatusBadRequest)
 	}
 
-	// 4. Process batch updates
+	// 4. With atomic=true the whole batch is applied or none of it
+	if fiber.Query[bool](c, "atomic") {
+		return batchUpdateExpensesAtomic(c, userId, req)
+	}
+
+	// 5. Process batch updates
 	results := make([]map[string]interface{}, 0, len(req))
 	hasErrors := false
 
@@ -433,6 +479,19 @@ func BatchUpdateExpenses(c fiber.Ctx) error {
 		if notes, exists := update["notes"]; exists {
 			expensePayload["notes"] = notes
 		}
+		if code, exists := update["currency"]; exists {
+			expensePayload["currency"] = code
+		}
+		message := payloadCurrency(expensePayload)
+		if message == "" {
+			message = payloadAmount(expensePayload)
+		}
+		if message != "" {
+			failedCount++
+			hasErrors = true
+			results = append(results, batchUpdateError(i, expensePayload["expenseId"], message))
+			continue
+		}
 
 		// Execute the update for this expense using the individual update function
 		result, err := utils.ExecuteDBFunctionRaw("SELECT update_expense_v3($1)", expensePayload)
@@ -456,7 +515,7 @@ func BatchUpdateExpenses(c fiber.Ctx) error {
 		}
 	}
 
-	// 5. Return batch response
+	// 6. Return batch response
 	responseData := map[string]interface{}{
 		"results":    results,
 		"total":      len(req),
@@ -473,6 +532,250 @@ func BatchUpdateExpenses(c fiber.Ctx) error {
 		"All expenses updated successfully", responseData, http.StatusOK)
 }
 
+var errBatchRolledBack = errors.New("batch update rolled back")
+
+// batchUpdateExpensesAtomic checks every item before writing anything, then
+// applies the batch in one transaction that rolls back on the first failure.
+// Errors are reported per index in the same shape as the partial mode.
+func batchUpdateExpensesAtomic(c fiber.Ctx, userId int, req []map[string]any) error {
+	// 1. Validate every item up front
+	payloads := make([]map[string]interface{}, len(req))
+	results := []map[string]interface{}{}
+	expenseIds := make([]int, 0, len(req))
+	for i, update := range req {
+		payload, expenseId, message := batchUpdatePayload(update, userId)
+		payloads[i] = payload
+		if message != "" {
+			results = append(results, batchUpdateError(i, update["expenseId"], message))
+			continue
+		}
+		expenseIds = append(expenseIds, expenseId)
+	}
+
+	// 2. Every expense must exist and belong to the user
+	if len(expenseIds) > 0 {
+		var owned []int
+		err := config.DBConnList[0].Raw(
+			"SELECT id FROM expenses WHERE user_id = ? AND id IN ?", userId, expenseIds,
+		).Scan(&owned).Error
+		if err != nil {
+			return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+		}
+		found := make(map[int]bool, len(owned))
+		for _, id := range owned {
+			found[id] = true
+		}
+		for i, payload := range payloads {
+			if id, ok := payload["expenseId"].(int); ok && !found[id] {
+				results = append(results, batchUpdateError(i, id, "Expense not found"))
+			}
+		}
+	}
+
+	if len(results) > 0 {
+		sort.Slice(results, func(a, b int) bool { return results[a]["index"].(int) < results[b]["index"].(int) })
+		return batchUpdateRolledBack(c, len(req), results, http.StatusBadRequest)
+	}
+
+	// 3. Apply the batch in one transaction
+	err := config.DBConnList[0].Transaction(func(tx *gorm.DB) error {
+		for i, payload := range payloads {
+			inputJSON, _ := json.Marshal(payload)
+			var resultStr string
+			if err := tx.Raw("SELECT update_expense_v3($1)", string(inputJSON)).Scan(&resultStr).Error; err != nil {
+				results = append(results, batchUpdateError(i, payload["expenseId"], "Update failed"))
+				return err
+			}
+
+			var result map[string]interface{}
+			json.Unmarshal([]byte(resultStr), &result)
+			if result["success"] != true {
+				results = append(results, batchUpdateError(i, payload["expenseId"], result["message"]))
+				return errBatchRolledBack
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errBatchRolledBack) {
+		return batchUpdateRolledBack(c, len(req), results, http.StatusBadRequest)
+	}
+	if err != nil {
+		log.Printf("Error applying atomic batch update: %v", err)
+		return batchUpdateRolledBack(c, len(req), results, http.StatusInternalServerError)
+	}
+
+	// 4. Return batch response
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "All expenses updated successfully",
+		map[string]interface{}{
+			"results":    results,
+			"total":      len(req),
+			"successful": len(req),
+			"failed":     0,
+			"atomic":     true,
+		},
+		http.StatusOK)
+}
+
+// batchUpdatePayload copies the updatable fields of one batch item and
+// checks their types. It returns the expense ID, or a message when the item
+// is invalid.
+func batchUpdatePayload(update map[string]any, userId int) (map[string]interface{}, int, string) {
+	payload := map[string]interface{}{"userId": userId}
+
+	expenseId, ok := jsonInt(update["expenseId"])
+	if !ok || expenseId <= 0 {
+		return payload, 0, "Expense ID is required"
+	}
+	payload["expenseId"] = expenseId
+
+	if title, exists := update["title"]; exists {
+		if t, ok := title.(string); !ok || strings.TrimSpace(t) == "" {
+			return payload, 0, "Title must be a non-empty string"
+		}
+		payload["title"] = title
+	}
+	if amount, exists := update["amount"]; exists {
+		payload["amount"] = amount
+	}
+	if categoryId, exists := update["categoryId"]; exists {
+		if categoryId != nil {
+			if _, ok := jsonInt(categoryId); !ok {
+				return payload, 0, "Category ID must be an integer"
+			}
+		}
+		payload["categoryId"] = categoryId
+	}
+	if date, exists := update["date"]; exists {
+		d, ok := date.(string)
+		if !ok {
+			return payload, 0, "Date must be a string in YYYY-MM-DD format"
+		}
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			return payload, 0, "Date must be a string in YYYY-MM-DD format"
+		}
+		payload["date"] = date
+	}
+	if notes, exists := update["notes"]; exists {
+		if _, ok := notes.(string); !ok && notes != nil {
+			return payload, 0, "Notes must be a string"
+		}
+		payload["notes"] = notes
+	}
+	if code, exists := update["currency"]; exists {
+		payload["currency"] = code
+		if message := payloadCurrency(payload); message != "" {
+			return payload, 0, message
+		}
+	}
+	if message := payloadAmount(payload); message != "" {
+		return payload, 0, message
+	}
+
+	return payload, expenseId, ""
+}
+
+// payloadCurrency upper-cases the currency of an expense payload in place,
+// returning a message when it is not a known ISO 4217 code. A missing or
+// null currency is left for the caller to default.
+func payloadCurrency(payload map[string]interface{}) string {
+	value, exists := payload["currency"]
+	if !exists || value == nil {
+		return ""
+	}
+	code, ok := value.(string)
+	if !ok {
+		return "Currency must be a string"
+	}
+	normalized, err := currency.Normalize(code)
+	if err != nil {
+		return err.Error()
+	}
+	payload["currency"] = normalized
+	return ""
+}
+
+// payloadAmount replaces the amount of an expense payload with an exact
+// money.Amount, returning a message when it is not a decimal number or has
+// more decimals than the payload's currency allows. Without a currency only
+// the number itself is checked.
+func payloadAmount(payload map[string]interface{}) string {
+	value, exists := payload["amount"]
+	if !exists || value == nil {
+		return ""
+	}
+	amount, err := money.FromValue(value)
+	if err != nil {
+		return "Invalid amount: " + err.Error()
+	}
+	if code, ok := payload["currency"].(string); ok {
+		if err := amount.Check(code); err != nil {
+			return err.Error()
+		}
+	}
+	payload["amount"] = amount
+	return ""
+}
+
+// bindExact decodes a JSON body keeping numbers as json.Number, so amounts
+// reach payloadAmount without passing through float64
+func bindExact(c fiber.Ctx, out interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(c.Body()))
+	decoder.UseNumber()
+	return decoder.Decode(out)
+}
+
+// queryAmount reads an amount from the query string, 0 when it is absent
+func queryAmount(c fiber.Ctx, key string) (money.Amount, error) {
+	value := fiber.Query[string](c, key)
+	if value == "" {
+		return 0, nil
+	}
+	return money.Parse(value)
+}
+
+// jsonInt reads an integer decoded from JSON as a number or a numeric string
+func jsonInt(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case json.Number:
+		n, err := strconv.Atoi(v.String())
+		return n, err == nil
+	case float64:
+		if v != float64(int(v)) {
+			return 0, false
+		}
+		return int(v), true
+	case string:
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func batchUpdateError(index int, expenseId interface{}, message interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"index":     index,
+		"expenseId": expenseId,
+		"message":   message,
+	}
+}
+
+// batchUpdateRolledBack reports an atomic batch that changed nothing
+func batchUpdateRolledBack(c fiber.Ctx, total int, results []map[string]interface{}, status int) error {
+	code := respcode.ERR_CODE_400
+	if status == http.StatusInternalServerError {
+		code = respcode.ERR_CODE_500
+	}
+	return v1.JSONResponseWithData(c, code, "Batch update rolled back, no expenses were changed",
+		map[string]interface{}{
+			"results":    results,
+			"total":      total,
+			"successful": 0,
+			"failed":     len(results),
+			"atomic":     true,
+		},
+		status)
+}
+
 func BatchUpdateExpensesAsync(c fiber.Ctx) error {
 	// 1. Get user ID from JWT
 	userId := utils.GetUserId(c)
@@ -482,7 +785,7 @@ func BatchUpdateExpensesAsync(c fiber.Ctx) error {
 
 	// 2. Parse request body
 	var req []map[string]interface{}
-	if err := c.Bind().Body(&req); err != nil {
+	if err := bindExact(c, &req); err != nil {
 		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid body", err, http.StatusBadRequest)
 	}
 
@@ -495,24 +798,14 @@ func BatchUpdateExpensesAsync(c fiber.Ctx) error {
 		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Batch size too large. Maximum 100 updates allowed", nil, http.StatusBadRequest)
 	}
 
-	// 4. Create batch job record
-	var jobId int
-	err := config.DBConnList[0].Raw(
-		"SELECT create_batch_job($1, $2, $3)",
-		userId,
-		"expense_batch_update",
-		len(req),
-	).Scan(&jobId).Error
-
+	// 4. Queue the job, a worker picks it up in the background
+	jobId, err := jobs.Enqueue(userId, jobTypeExpenseBatchUpdate, len(req), req)
 	if err != nil {
 		log.Printf("Error creating batch job: %v", err)
 		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to create batch job", err, http.StatusInternalServerError)
 	}
 
-	// 5. Process updates in background
-	go processBatchUpdatesAsync(jobId, userId, req)
-
-	// 6. Return immediately with job ID
+	// 5. Return immediately with job ID
 	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200,
 		"Batch update job created successfully",
 		map[string]interface{}{
@@ -551,7 +844,8 @@ func GetBatchJobStatus(c fiber.Ctx) error {
 			'results', results,
 			'createdAt', created_at,
 			'updatedAt', updated_at,
-			'completedAt', completed_at
+			'completedAt', completed_at,
+			'cancelRequestedAt', cancel_requested_at
 		)
 		FROM batch_jobs
 		WHERE id = $1 AND user_id = $2
@@ -585,103 +879,155 @@ func BatchUploadExpensesFromCSV(c fiber.Ctx) error {
 		return v1.JSONResponseWithError(c, respcode.ERR_CODE_401, "User ID not found in token", nil, http.StatusUnauthorized)
 	}
 
-	// 2. Parse uploaded CSV file
+	// 2. Get the uploaded CSV file
 	file, err := c.FormFile("file")
 	if err != nil {
 		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "CSV file is required", err, http.StatusBadRequest)
 	}
-
-	f, err := file.Open()
-	if err != nil {
-		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to open CSV file", err, http.StatusInternalServerError)
+	if file.Size > importMaxFileSize() {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400,
+			fmt.Sprintf("File too large (max %d MB)", importMaxFileSize()/1024/1024), nil, http.StatusBadRequest)
 	}
-	defer f.Close()
 
-	reader := csv.NewReader(f)
-	reader.TrimLeadingSpace = true
-	records, err := reader.ReadAll()
+	// 3. Keep it on disk, the job streams it from there in chunks
+	uploadPath, err := importUploadPath()
 	if err != nil {
-		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid CSV format", err, http.StatusBadRequest)
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to store file", err, http.StatusInternalServerError)
 	}
-
-	if len(records) < 2 {
-		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "CSV must contain header and at least one row", nil, http.StatusBadRequest)
+	if err := os.MkdirAll(uploadPath, 0700); err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to store file", err, http.StatusInternalServerError)
 	}
-
-	// 3. Validate CSV headers
-	expectedHeaders := []string{"title", "amount", "categoryid", "date", "notes"}
-	headers := records[0]
-
-	if len(headers) != len(expectedHeaders) {
-		return v1.JSONResponseWithError(
-			c,
-			respcode.ERR_CODE_400,
-			fmt.Sprintf("Invalid CSV header count. Expected headers: %v", expectedHeaders),
-			nil,
-			http.StatusBadRequest,
-		)
+	filePath := filepath.Join(uploadPath, fmt.Sprintf("%d_%s.%s", userId, utils.GenerateOpaqueToken(16), imports.FormatCSV))
+	if err := c.SaveFile(file, filePath); err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to store file", err, http.StatusInternalServerError)
 	}
 
-	for i, expected := range expectedHeaders {
-		if strings.ToLower(strings.TrimSpace(headers[i])) != expected {
-			return v1.JSONResponseWithError(
-				c,
-				respcode.ERR_CODE_400,
-				fmt.Sprintf("Invalid CSV header at column %d: expected '%s', got '%s'", i+1, expected, headers[i]),
-				nil,
-				http.StatusBadRequest,
-			)
-		}
+	// 4. Check the headers and every row, one row at a time. Rows without a
+	// currency are in the user's base currency.
+	payload := mdlFeatureOne.ExpenseImportJob{Currency: currency.UserBase(&config.DBConnList[0], userId)}
+	headers, rowCount, message := checkBatchUploadCSV(filePath, &payload)
+	if message != "" {
+		os.Remove(filePath)
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, message, nil, http.StatusBadRequest)
 	}
 
-	// 4. Parse CSV data
-	expenses := make([]map[string]interface{}, 0, len(records)-1)
-	for i, row := range records[1:] {
-		if len(row) != len(headers) {
-			return v1.JSONResponseWithError(c, respcode.ERR_CODE_400,
-				fmt.Sprintf("Row %d has mismatched columns", i+2), nil, http.StatusBadRequest)
+	// 5. Record it as an import with the template's mapping and queue the
+	// job, a worker picks it up in the background
+	headersJSON, _ := json.Marshal(headers)
+	var jobId int
+	err = config.DBConnList[0].Transaction(func(tx *gorm.DB) error {
+		err := tx.Raw(`
+			INSERT INTO expense_imports (user_id, file_path, original_name, format, delimiter, headers, row_count)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			RETURNING id
+		`, userId, filePath, file.Filename, imports.FormatCSV, ",", string(headersJSON), rowCount).Scan(&payload.ImportId).Error
+		if err != nil {
+			return err
 		}
 
-		expense := make(map[string]interface{})
-		for j, header := range headers {
-			expense[strings.ToLower(header)] = strings.TrimSpace(row[j])
+		jobId, err = jobs.EnqueueTx(tx, userId, jobTypeExpenseImport, rowCount, payload)
+		if err != nil {
+			return err
 		}
-		expense["userId"] = userId
-		expenses = append(expenses, expense)
-	}
-
-	if len(expenses) > 1000 {
-		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Batch too large (max 1000 rows)", nil, http.StatusBadRequest)
-	}
-
-	// 5. Create batch job
-	var jobId int
-	err = config.DBConnList[0].Raw(
-		"SELECT create_batch_job($1, $2, $3)",
-		userId,
-		"expense_batch_upload_csv",
-		len(expenses),
-	).Scan(&jobId).Error
 
+		return tx.Exec("UPDATE expense_imports SET last_job_id = ?, committed_job_id = ? WHERE id = ?",
+			jobId, jobId, payload.ImportId).Error
+	})
 	if err != nil {
+		os.Remove(filePath)
 		log.Printf("Error creating batch job: %v", err)
 		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to create batch job", err, http.StatusInternalServerError)
 	}
 
-	// 6. Process in background
-	go processBatchUploadExpensesAsync(jobId, userId, expenses)
-
-	// 7. Return response immediately
+	// 6. Return response immediately
 	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200,
 		"CSV batch upload job created successfully",
 		map[string]interface{}{
 			"jobId":      jobId,
-			"totalItems": len(expenses),
+			"importId":   payload.ImportId,
+			"totalItems": rowCount,
 			"status":     "pending",
 		},
 		http.StatusAccepted)
 }
 
+// checkBatchUploadCSV reads a batch upload row by row, so its size is bounded
+// by the import limits rather than memory. It sets the job's column mapping
+// from the headers and returns why the file was refused, or "".
+func checkBatchUploadCSV(filePath string, payload *mdlFeatureOne.ExpenseImportJob) ([]string, int, string) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, 0, "Failed to open CSV file"
+	}
+	defer f.Close()
+
+	// Validate CSV headers, a currency column may follow the required ones
+	headerReader := csv.NewReader(f)
+	headerReader.TrimLeadingSpace = true
+	headers, err := headerReader.Read()
+	if err == io.EOF {
+		return nil, 0, "CSV must contain header and at least one row"
+	}
+	if err != nil {
+		return nil, 0, "Invalid CSV format"
+	}
+	for i := range headers {
+		headers[i] = strings.TrimSpace(strings.TrimPrefix(headers[i], "\ufeff"))
+	}
+
+	fields := []string{imports.FieldTitle, imports.FieldAmount, imports.FieldCategoryId, imports.FieldDate, imports.FieldNotes}
+	if len(headers) == len(fields)+1 && strings.ToLower(headers[len(fields)]) == imports.FieldCurrency {
+		fields = append(fields, imports.FieldCurrency)
+	}
+	expectedHeaders := make([]string, len(fields))
+	for i, field := range fields {
+		expectedHeaders[i] = strings.ToLower(field)
+	}
+	if len(headers) != len(expectedHeaders) {
+		return nil, 0, fmt.Sprintf("Invalid CSV header count. Expected headers: %v", expectedHeaders)
+	}
+	payload.Mapping = map[string]string{}
+	for i, expected := range expectedHeaders {
+		if strings.ToLower(headers[i]) != expected {
+			return nil, 0, fmt.Sprintf("Invalid CSV header at column %d: expected '%s', got '%s'", i+1, expected, headers[i])
+		}
+		payload.Mapping[fields[i]] = headers[i]
+	}
+
+	// Parse every row as the job will, without keeping any of them
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, "Failed to open CSV file"
+	}
+	reader, err := imports.NewCSVReader(f, ",", imports.Options{Mapping: payload.Mapping, Currency: payload.Currency})
+	if err != nil {
+		return nil, 0, err.Error()
+	}
+	rowCount := 0
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, "Invalid CSV format"
+		}
+		if len(record.Fields) != len(headers) {
+			return nil, 0, fmt.Sprintf("Row %d has mismatched columns", record.Line)
+		}
+		if record.Err != nil {
+			return nil, 0, fmt.Sprintf("Row %d: %s", record.Line, record.Err)
+		}
+		rowCount++
+		if rowCount > importMaxRows() {
+			return nil, 0, fmt.Sprintf("Batch too large (max %d rows)", importMaxRows())
+		}
+	}
+	if rowCount == 0 {
+		return nil, 0, "CSV must contain header and at least one row"
+	}
+	return headers, rowCount, ""
+}
+
 func TestInternalSendRequest(c fiber.Ctx) error {
 	// Hardcoded payload
 	payload := map[string]interface{}{
@@ -757,181 +1103,3 @@ func TestInternalSendRequest(c fiber.Ctx) error {
 		)
 	}
 }
-
-// HELPER FUNCTIONS FOR BATCH UPDATE AND UPLOAD
-func updateJobProgress(jobId int, processed, successful, failed int, results interface{}) {
-	resultsJSON, _ := json.Marshal(results)
-
-	err := config.DBConnList[0].Exec(
-		"SELECT update_batch_job_progress($1, NULL, $2, $3, $4, $5)",
-		jobId,
-		processed,
-		successful,
-		failed,
-		string(resultsJSON),
-	).Error
-
-	if err != nil {
-		log.Printf("Error updating job progress for job %d: %v", jobId, err)
-	}
-}
-func updateJobStatus(jobId int, status string, processed, successful, failed int, results interface{}) {
-	resultsJSON, _ := json.Marshal(results)
-	err := config.DBConnList[0].Exec(
-		"SELECT update_batch_job_progress($1, $2, $3, $4, $5, $6)",
-		jobId,
-		status,
-		processed,
-		successful,
-		failed,
-		string(resultsJSON),
-	).Error
-
-	if err != nil {
-		log.Printf("Error updating job status for job %d: %v", jobId, err)
-	}
-}
-
-func processBatchUpdatesAsync(jobId int, userId int, updates []map[string]interface{}) {
-	var successfulCount = 0
-	var failedCount = 0
-	results := make([]map[string]interface{}, 0)
-
-	// Update status to processing
-	updateJobStatus(jobId, "processing", 0, 0, 0, nil)
-
-	// Process each update
-	for i, update := range updates {
-		// Add small delay to prevent overwhelming the database
-		time.Sleep(1 * time.Minute)
-
-		// Create payload for individual expense update
-		expensePayload := make(map[string]interface{})
-
-		// Validate expense ID
-		if expenseId, exists := update["expenseId"]; exists {
-			expensePayload["expenseId"] = expenseId
-		} else {
-			failedCount++
-			results = append(results, map[string]interface{}{
-				"index":     i,
-				"expenseId": nil,
-				"message":   "Expense ID is required",
-			})
-			updateJobProgress(jobId, i+1, successfulCount, failedCount, results)
-			continue
-		}
-
-		// Add userId
-		expensePayload["userId"] = userId
-
-		// Copy updateable fields
-		if title, exists := update["title"]; exists {
-			expensePayload["title"] = title
-		}
-		if amount, exists := update["amount"]; exists {
-			expensePayload["amount"] = amount
-		}
-		if categoryId, exists := update["categoryId"]; exists {
-			expensePayload["categoryId"] = categoryId
-		}
-		if date, exists := update["date"]; exists {
-			expensePayload["date"] = date
-		}
-		if notes, exists := update["notes"]; exists {
-			expensePayload["notes"] = notes
-		}
-
-		// Execute the update
-		result, err := utils.ExecuteDBFunctionRaw("SELECT update_expense_v3($1)", expensePayload)
-		if err != nil {
-			log.Printf("Error executing update for expense %v: %v", expensePayload["expenseId"], err)
-			failedCount++
-			results = append(results, map[string]interface{}{
-				"index":     i,
-				"expenseId": expensePayload["expenseId"],
-				"message":   err.Error(),
-			})
-		} else if result["success"] == true {
-			successfulCount++
-			// For successful updates, you might want to store minimal info or skip
-			// results = append(results, map[string]interface{}{
-			// 	"index":     i,
-			// 	"expenseId": expensePayload["expenseId"],
-			// 	"message":   "Successfully updated",
-			// })
-		} else {
-			failedCount++
-			// Extract only the message from the result
-			message := "Update failed"
-			if msg, exists := result["message"]; exists {
-				message = msg.(string)
-			} else if errMsg, exists := result["error"]; exists {
-				message = errMsg.(string)
-			}
-
-			results = append(results, map[string]interface{}{
-				"index":     i,
-				"expenseId": expensePayload["expenseId"],
-				"message":   message,
-			})
-		}
-
-		// Update progress after each item
-		updateJobProgress(jobId, i+1, successfulCount, failedCount, results)
-	}
-
-	// Mark job as completed
-	finalStatus := "completed"
-	if failedCount == len(updates) {
-		finalStatus = "failed"
-	}
-
-	updateJobStatus(jobId, finalStatus, len(updates), successfulCount, failedCount, results)
-}
-
-func processBatchUploadExpensesAsync(jobId int, userId int, expenses []map[string]interface{}) {
-	var successfulCount = 0
-	var failedCount = 0
-	results := make([]map[string]interface{}, 0)
-
-	updateJobStatus(jobId, "processing", 0, 0, 0, nil)
-
-	for i, expense := range expenses {
-		time.Sleep(30 * time.Second)
-		expense["userId"] = userId
-
-		result, err := utils.ExecuteDBFunctionRaw("SELECT add_expense_v3($1)", expense)
-		if err != nil {
-			log.Printf("Error inserting expense row %d: %v", i+1, err)
-			failedCount++
-			results = append(results, map[string]interface{}{
-				"index":   i,
-				"status":  "error",
-				"message": err.Error(),
-			})
-		} else if result["success"] == true {
-			successfulCount++
-		} else {
-			failedCount++
-			msg := "Insert failed"
-			if m, ok := result["message"].(string); ok {
-				msg = m
-			}
-			results = append(results, map[string]interface{}{
-				"index":   i,
-				"status":  "error",
-				"message": msg,
-			})
-		}
-
-		updateJobProgress(jobId, i+1, successfulCount, failedCount, results)
-	}
-
-	finalStatus := "completed"
-	if failedCount == len(expenses) {
-		finalStatus = "failed"
-	}
-
-	updateJobStatus(jobId, finalStatus, len(expenses), successfulCount, failedCount, results)
-}
@@ -0,0 +1,351 @@
+package ctrFeatureOne
+
+import (
+	"go_template_v3/pkg/config"
+	"go_template_v3/pkg/global/utils"
+	mdlFeatureOne "go_template_v3/pkg/services/featureOne/model"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/FDSAP-Git-Org/hephaestus/encryption"
+	v1 "github.com/FDSAP-Git-Org/hephaestus/helper/v1"
+	"github.com/FDSAP-Git-Org/hephaestus/respcode"
+	utils_v1 "github.com/FDSAP-Git-Org/hephaestus/utils/v1"
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
+)
+
+const mfaRecoveryCodeCount = 10
+
+func EnrollMFA(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+	email := utils.GetUserEmail(c)
+
+	// 2. Refuse to overwrite an active secret
+	mfa, err := getUserMFA(userId)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+	if mfa != nil && mfa.Enabled {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_409, "Two-factor authentication is already enabled", nil, http.StatusConflict)
+	}
+
+	// 3. Generate and store a pending secret, encrypted at rest
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to generate secret", err, http.StatusInternalServerError)
+	}
+	encryptedSecret, err := encryption.Encrypt(secret, utils_v1.GetEnv("SECRET_KEY"))
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to encrypt secret", err, http.StatusInternalServerError)
+	}
+
+	err = config.DBConnList[0].Exec(`
+		INSERT INTO user_mfa (user_id, secret, enabled_at, last_used_step)
+		VALUES (?, ?, NULL, NULL)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, enabled_at = NULL, last_used_step = NULL, updated_at = NOW()
+	`, userId, encryptedSecret).Error
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to start enrollment", err, http.StatusInternalServerError)
+	}
+
+	issuer := utils_v1.GetEnv("PROJECT")
+	if issuer == "" {
+		issuer = "go_template_v3"
+	}
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Scan the QR code and confirm with a code",
+		mdlFeatureOne.MFAEnrollResponse{
+			Secret:     secret,
+			OtpauthURI: utils.TOTPProvisioningURI(issuer, email, secret),
+		}, http.StatusOK)
+}
+
+func ConfirmMFA(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Parse request body
+	var req mdlFeatureOne.MFACodeRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid body", err, http.StatusBadRequest)
+	}
+	if req.Code == nil || *req.Code == "" {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Code is required", nil, http.StatusBadRequest)
+	}
+
+	// 3. Wrong codes count against the same lockout as VerifyMFA, so a stolen
+	// access token cannot be used to guess codes
+	email, ip := utils.GetUserEmail(c), c.IP()
+	retryAfter, err := utils.CheckLoginAllowed(email, ip)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, respcode.ERR_CODE_500_MSG, err, http.StatusInternalServerError)
+	}
+	if retryAfter > 0 {
+		return tooManyAttempts(c, retryAfter, "Too many failed attempts, try again later")
+	}
+
+	// 4. Check the code against the pending secret
+	mfa, err := getUserMFA(userId)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+	if mfa == nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Two-factor enrollment has not been started", nil, http.StatusBadRequest)
+	}
+	if mfa.Enabled {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_409, "Two-factor authentication is already enabled", nil, http.StatusConflict)
+	}
+	if !consumeTOTPCode(mfa, *req.Code) {
+		utils.RecordLoginFailure(email, ip)
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid code", nil, http.StatusBadRequest)
+	}
+
+	// 5. Enable and issue recovery codes in one transaction
+	codes := utils.GenerateRecoveryCodes(mfaRecoveryCodeCount)
+	err = config.DBConnList[0].Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("UPDATE user_mfa SET enabled_at = NOW(), updated_at = NOW() WHERE user_id = ?", userId).Error; err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(tx, userId, codes)
+	})
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to enable two-factor authentication", err, http.StatusInternalServerError)
+	}
+
+	utils.RecordAuthEvent("mfa_enabled", email, ip, map[string]interface{}{"userId": userId})
+
+	// Recovery codes are only ever shown here
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Two-factor authentication enabled",
+		map[string]interface{}{"recoveryCodes": codes}, http.StatusOK)
+}
+
+func DisableMFA(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Parse request body
+	var req mdlFeatureOne.MFACodeRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid body", err, http.StatusBadRequest)
+	}
+	if req.Code == nil || *req.Code == "" {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Code is required", nil, http.StatusBadRequest)
+	}
+
+	// 3. Wrong codes count against the login lockout, as in ConfirmMFA
+	email, ip := utils.GetUserEmail(c), c.IP()
+	retryAfter, err := utils.CheckLoginAllowed(email, ip)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, respcode.ERR_CODE_500_MSG, err, http.StatusInternalServerError)
+	}
+	if retryAfter > 0 {
+		return tooManyAttempts(c, retryAfter, "Too many failed attempts, try again later")
+	}
+
+	// 4. A fresh TOTP code is required, recovery codes are not accepted here
+	mfa, err := getUserMFA(userId)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+	if mfa == nil || !mfa.Enabled {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Two-factor authentication is not enabled", nil, http.StatusBadRequest)
+	}
+	if !consumeTOTPCode(mfa, *req.Code) {
+		utils.RecordLoginFailure(email, ip)
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid code", nil, http.StatusBadRequest)
+	}
+
+	// 5. Remove secret and recovery codes
+	err = config.DBConnList[0].Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = ?", userId).Error; err != nil {
+			return err
+		}
+		return tx.Exec("DELETE FROM user_mfa WHERE user_id = ?", userId).Error
+	})
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to disable two-factor authentication", err, http.StatusInternalServerError)
+	}
+
+	utils.RecordAuthEvent("mfa_disabled", email, ip, map[string]interface{}{"userId": userId})
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Two-factor authentication disabled", nil, http.StatusOK)
+}
+
+func VerifyMFA(c fiber.Ctx) error {
+	var req mdlFeatureOne.MFAVerifyRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid body", err, http.StatusBadRequest)
+	}
+	if req.MFAToken == nil || *req.MFAToken == "" {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "MFA token is required", nil, http.StatusBadRequest)
+	}
+	if (req.Code == nil || *req.Code == "") && (req.RecoveryCode == nil || *req.RecoveryCode == "") {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Code or recovery code is required", nil, http.StatusBadRequest)
+	}
+
+	// 1. The pending token proves the password step succeeded
+	claims, err := utils.ParseToken(*req.MFAToken, utils.TokenTypeMFAPending)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_401, "Invalid or expired MFA token", nil, http.StatusUnauthorized)
+	}
+	userIdClaim, _ := claims.Body["userId"].(float64)
+	userId := int(userIdClaim)
+	email, _ := claims.Body["email"].(string)
+
+	// Each pending token completes at most one login
+	used, err := utils.IsTokenRevoked(claims.ID)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, respcode.ERR_CODE_500_MSG, err, http.StatusInternalServerError)
+	}
+	if used {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_401, "Invalid or expired MFA token", nil, http.StatusUnauthorized)
+	}
+
+	// 2. Second factor guesses count against the same lockout as passwords
+	ip := c.IP()
+	retryAfter, err := utils.CheckLoginAllowed(email, ip)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, respcode.ERR_CODE_500_MSG, err, http.StatusInternalServerError)
+	}
+	if retryAfter > 0 {
+		return tooManyAttempts(c, retryAfter, "Too many failed login attempts, try again later")
+	}
+
+	mfa, err := getUserMFA(userId)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+	if mfa == nil || !mfa.Enabled {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_401, "Invalid or expired MFA token", nil, http.StatusUnauthorized)
+	}
+
+	// 3. Accept either a TOTP code or an unused recovery code
+	verified := false
+	if req.Code != nil && *req.Code != "" {
+		verified = consumeTOTPCode(mfa, *req.Code)
+	} else {
+		verified = consumeRecoveryCode(userId, *req.RecoveryCode)
+		if verified {
+			utils.RecordAuthEvent("mfa_recovery_code_used", email, ip, map[string]interface{}{"userId": userId})
+		}
+	}
+	if !verified {
+		utils.RecordLoginFailure(email, ip)
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_401, "Invalid code", nil, http.StatusUnauthorized)
+	}
+
+	// 4. Use up the pending token before anything is issued for it
+	claimed, err := utils.ClaimToken(claims.ID, claims.ExpiresAt)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, respcode.ERR_CODE_500_MSG, err, http.StatusInternalServerError)
+	}
+	if !claimed {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_401, "Invalid or expired MFA token", nil, http.StatusUnauthorized)
+	}
+
+	// Both factors passed, so the login is complete
+	utils.ResetLoginFailures(email)
+
+	// 5. Issue the real tokens
+	var user mdlFeatureOne.User
+	err = config.DBConnList[0].Raw("SELECT id, email, name, email_verified_at FROM users WHERE id = ? AND deleted_at IS NULL", userId).Scan(&user).Error
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+	if user.Id == nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_401, "Invalid or expired MFA token", nil, http.StatusUnauthorized)
+	}
+
+	device := ""
+	if req.Device != nil {
+		device = *req.Device
+	}
+	tokens, err := startSession(c, user, device)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Token generation failed", err, http.StatusInternalServerError)
+	}
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Login successful", tokens, http.StatusOK)
+}
+
+// HELPER FUNCTIONS FOR TWO-FACTOR AUTHENTICATION
+func getUserMFA(userId int) (*mdlFeatureOne.UserMFA, error) {
+	var mfa mdlFeatureOne.UserMFA
+	err := config.DBConnList[0].Raw(`
+		SELECT user_id, secret, enabled_at IS NOT NULL AS enabled, last_used_step
+		FROM user_mfa
+		WHERE user_id = ?
+	`, userId).Scan(&mfa).Error
+	if err != nil {
+		return nil, err
+	}
+	if mfa.UserId == 0 {
+		return nil, nil
+	}
+
+	mfa.Secret, err = encryption.Decrypt(mfa.Secret, utils_v1.GetEnv("SECRET_KEY"))
+	if err != nil {
+		return nil, err
+	}
+	return &mfa, nil
+}
+
+// isMFAEnabled is used by Login to decide whether a second step is needed
+func isMFAEnabled(userId int) (bool, error) {
+	var enabled int
+	err := config.DBConnList[0].Raw(
+		"SELECT 1 FROM user_mfa WHERE user_id = ? AND enabled_at IS NOT NULL",
+		userId,
+	).Scan(&enabled).Error
+	return enabled == 1, err
+}
+
+// consumeTOTPCode validates a code and records its time step so the same
+// code cannot be used twice
+func consumeTOTPCode(mfa *mdlFeatureOne.UserMFA, code string) bool {
+	step, ok := utils.ValidateTOTP(mfa.Secret, code, time.Now())
+	if !ok {
+		return false
+	}
+
+	result := config.DBConnList[0].Exec(`
+		UPDATE user_mfa SET last_used_step = ?
+		WHERE user_id = ? AND (last_used_step IS NULL OR last_used_step < ?)
+	`, step, mfa.UserId, step)
+	if result.Error != nil {
+		log.Printf("Error recording TOTP step for user %d: %v", mfa.UserId, result.Error)
+		return false
+	}
+	return result.RowsAffected == 1
+}
+
+func consumeRecoveryCode(userId int, code string) bool {
+	result := config.DBConnList[0].Exec(`
+		UPDATE mfa_recovery_codes SET used_at = NOW()
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL
+	`, userId, utils_v1.HashDataSHA512(utils.NormalizeRecoveryCode(code)))
+	if result.Error != nil {
+		log.Printf("Error consuming recovery code for user %d: %v", userId, result.Error)
+		return false
+	}
+	return result.RowsAffected == 1
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userId int, codes []string) error {
+	if err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = ?", userId).Error; err != nil {
+		return err
+	}
+	for _, code := range codes {
+		err := tx.Exec(
+			"INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES (?, ?)",
+			userId, utils_v1.HashDataSHA512(code),
+		).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
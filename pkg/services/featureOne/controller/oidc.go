@@ -0,0 +1,288 @@
+package ctrFeatureOne
+
+import (
+	"crypto/subtle"
+	"errors"
+	"go_template_v3/pkg/config"
+	"go_template_v3/pkg/global/utils"
+	mdlFeatureOne "go_template_v3/pkg/services/featureOne/model"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	v1 "github.com/FDSAP-Git-Org/hephaestus/helper/v1"
+	"github.com/FDSAP-Git-Org/hephaestus/respcode"
+	utils_v1 "github.com/FDSAP-Git-Org/hephaestus/utils/v1"
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
+)
+
+const (
+	// oidcStateTTL bounds how long a user may take at the provider's login page
+	oidcStateTTL = 10 * time.Minute
+	// oidcStateCookie holds the hashed state of the login this browser started
+	oidcStateCookie = "oidc_state"
+)
+
+func OIDCLogin(c fiber.Ctx) error {
+	return startOIDCFlow(c, 0)
+}
+
+// OIDCLink starts the same flow for a logged-in user, attaching the external
+// identity to their account instead of logging in with it
+func OIDCLink(c fiber.Ctx) error {
+	return startOIDCFlow(c, utils.GetUserId(c))
+}
+
+// startOIDCFlow sends the browser to the provider. A non-zero linkUserId
+// marks the attempt as an explicit link for that user.
+func startOIDCFlow(c fiber.Ctx, linkUserId int) error {
+	// 1. Look up the provider
+	provider, err := utils.GetOIDCProvider(c.Params("provider"))
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_404, "Unknown login provider", err, http.StatusNotFound)
+	}
+
+	// 2. Generate state, nonce and PKCE verifier for this attempt
+	state := utils.GenerateOpaqueToken(32)
+	nonce := utils.GenerateOpaqueToken(32)
+	verifier, challenge := utils.NewPKCEVerifier()
+
+	authorizationURL, err := provider.AuthorizationURL(state, nonce, challenge)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_502, "Login provider unavailable", err, http.StatusBadGateway)
+	}
+
+	// 3. Remember them until the callback, keyed by the state hash
+	stateHash := utils_v1.HashDataSHA512(state)
+	config.DBConnList[0].Exec("DELETE FROM oidc_login_states WHERE expires_at < NOW()")
+	err = config.DBConnList[0].Exec(`
+		INSERT INTO oidc_login_states (state_hash, provider, nonce, code_verifier, user_id, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, stateHash, provider.Name, nonce, verifier, utils.Ptr(linkUserId), time.Now().Add(oidcStateTTL)).Error
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+
+	// 4. Bind the state to this browser so a callback URL started elsewhere
+	// cannot log the victim into someone else's account
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Value:    stateHash,
+		Path:     "/",
+		MaxAge:   int(oidcStateTTL.Seconds()),
+		Secure:   c.Secure(),
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Redirect to the login provider",
+		mdlFeatureOne.OIDCLoginResponse{AuthorizationURL: authorizationURL, State: state}, http.StatusOK)
+}
+
+func OIDCCallback(c fiber.Ctx) error {
+	// 1. Look up the provider
+	provider, err := utils.GetOIDCProvider(c.Params("provider"))
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_404, "Unknown login provider", err, http.StatusNotFound)
+	}
+
+	// 2. The provider reports a cancelled or denied login as an error param
+	if providerError := c.Query("error"); providerError != "" {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_401, "Login was not completed: "+providerError, nil, http.StatusUnauthorized)
+	}
+
+	code, state := c.Query("code"), c.Query("state")
+	if code == "" || state == "" {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Code and state are required", nil, http.StatusBadRequest)
+	}
+
+	// 3. The state must be the one this browser started
+	stateHash := utils_v1.HashDataSHA512(state)
+	browserState := c.Cookies(oidcStateCookie)
+	c.ClearCookie(oidcStateCookie)
+	if subtle.ConstantTimeCompare([]byte(browserState), []byte(stateHash)) != 1 {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid or expired login state", nil, http.StatusBadRequest)
+	}
+
+	// 4. Consume the state so each login attempt can only complete once
+	var loginState mdlFeatureOne.OIDCLoginState
+	err = config.DBConnList[0].Raw(`
+		DELETE FROM oidc_login_states
+		WHERE state_hash = ? AND provider = ?
+		RETURNING provider, nonce, code_verifier, user_id, expires_at
+	`, stateHash, provider.Name).Scan(&loginState).Error
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+	if loginState.Provider == "" || time.Now().After(loginState.ExpiresAt) {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid or expired login state", nil, http.StatusBadRequest)
+	}
+
+	// 5. Exchange the code and verify the ID token
+	idToken, err := provider.Exchange(code, loginState.CodeVerifier)
+	if err != nil {
+		log.Printf("OIDC code exchange with %s failed: %v", provider.Name, err)
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_401, "Login failed", nil, http.StatusUnauthorized)
+	}
+	identity, err := provider.VerifyIDToken(idToken, loginState.Nonce)
+	if err != nil {
+		log.Printf("OIDC id_token from %s rejected: %v", provider.Name, err)
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_401, "Login failed", nil, http.StatusUnauthorized)
+	}
+
+	// 6. An explicit link attaches the identity to the logged-in user
+	if loginState.UserId != nil {
+		return linkOIDCIdentityToUser(c, *loginState.UserId, provider.Name, identity)
+	}
+
+	// 7. Otherwise find or create the local user
+	user, err := linkOIDCIdentity(provider.Name, identity)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to link account", err, http.StatusInternalServerError)
+	}
+	if user == nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_409,
+			"An account with this email already exists, log in with your password and link this provider from your account", nil, http.StatusConflict)
+	}
+
+	utils.RecordAuthEvent("oidc_login", *user.Email, c.IP(), map[string]interface{}{
+		"userId":   *user.Id,
+		"provider": provider.Name,
+	})
+
+	// 8. Finish exactly like a password login
+	return completeLogin(c, *user, c.Query("device"))
+}
+
+// linkOIDCIdentityToUser attaches an external identity to a logged-in user.
+// An identity already attached to another account is refused.
+func linkOIDCIdentityToUser(c fiber.Ctx, userId int, provider string, identity *utils.OIDCIdentity) error {
+	var ownerId int
+	err := config.DBConnList[0].Raw(`
+		WITH linked AS (
+			INSERT INTO user_identities (user_id, provider, subject, email)
+			VALUES (?, ?, ?, ?)
+			ON CONFLICT (provider, subject) DO NOTHING
+			RETURNING user_id
+		)
+		SELECT user_id FROM linked
+		UNION ALL
+		SELECT user_id FROM user_identities WHERE provider = ? AND subject = ?
+	`, userId, provider, identity.Subject, strings.ToLower(strings.TrimSpace(identity.Email)), provider, identity.Subject).Scan(&ownerId).Error
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to link account", err, http.StatusInternalServerError)
+	}
+	if ownerId != userId {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_409,
+			"This login is already linked to another account", nil, http.StatusConflict)
+	}
+
+	var email string
+	config.DBConnList[0].Raw("SELECT email FROM users WHERE id = ?", userId).Scan(&email)
+	utils.RecordAuthEvent("oidc_linked", email, c.IP(), map[string]interface{}{
+		"userId":   userId,
+		"provider": provider,
+	})
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Login provider linked", nil, http.StatusOK)
+}
+
+// linkOIDCIdentity returns the user an external identity belongs to. Known
+// identities map straight to their user. New identities are linked to an
+// existing account only when both the provider and this service have
+// verified the email (see utils.CanAutoLinkOIDC); otherwise a new user is
+// created. A nil user means the email is taken by an account the user has
+// to log in to and link explicitly.
+func linkOIDCIdentity(provider string, identity *utils.OIDCIdentity) (*mdlFeatureOne.User, error) {
+	db := config.DBConnList[0]
+
+	var userId int
+	err := db.Raw(`
+		SELECT ui.user_id FROM user_identities ui
+		JOIN users u ON u.id = ui.user_id
+		WHERE ui.provider = ? AND ui.subject = ? AND u.deleted_at IS NULL
+	`, provider, identity.Subject).Scan(&userId).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if userId == 0 {
+		email := strings.ToLower(strings.TrimSpace(identity.Email))
+		if !utils_v1.IsEmailValid(email) {
+			return nil, errors.New("login provider did not share a valid email")
+		}
+
+		created := false
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var existing struct {
+				Id            int
+				EmailVerified bool
+			}
+			err := tx.Raw(`
+				SELECT id, email_verified_at IS NOT NULL AS email_verified
+				FROM users WHERE LOWER(email) = ? AND deleted_at IS NULL
+			`, email).Scan(&existing).Error
+			if err != nil {
+				return err
+			}
+			userId = existing.Id
+
+			if userId != 0 && !utils.CanAutoLinkOIDC(identity, existing.EmailVerified) {
+				userId = 0
+				return nil
+			}
+
+			if userId == 0 {
+				// SSO-only accounts get a random password nobody knows
+				hashedPassword, err := utils_v1.HashData(utils.GenerateOpaqueToken(32))
+				if err != nil {
+					return err
+				}
+				name := identity.Name
+				if name == "" {
+					name = email
+				}
+				if err := tx.Raw("SELECT register_user(?, ?, ?)", email, hashedPassword, name).Scan(new(string)).Error; err != nil {
+					return err
+				}
+				if err := tx.Raw("SELECT id FROM users WHERE email = ? AND deleted_at IS NULL", email).Scan(&userId).Error; err != nil {
+					return err
+				}
+				if identity.EmailVerified {
+					if err := tx.Exec("UPDATE users SET email_verified_at = NOW() WHERE id = ?", userId).Error; err != nil {
+						return err
+					}
+				}
+				created = true
+			}
+
+			return tx.Exec(`
+				INSERT INTO user_identities (user_id, provider, subject, email)
+				VALUES (?, ?, ?, ?)
+				ON CONFLICT (provider, subject) DO NOTHING
+			`, userId, provider, identity.Subject, email).Error
+		})
+		if err != nil {
+			return nil, err
+		}
+		if userId == 0 {
+			return nil, nil
+		}
+
+		// Roles are assigned once the user row is committed
+		if created {
+			if err := utils.AssignUserRole(userId, utils.DefaultUserRole()); err != nil {
+				log.Printf("Failed to assign default role to user %d: %v", userId, err)
+			}
+		}
+	}
+
+	var user mdlFeatureOne.User
+	err = db.Raw("SELECT id, email, name, email_verified_at FROM users WHERE id = ?", userId).Scan(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -0,0 +1,352 @@
+package ctrFeatureOne
+
+import (
+	"encoding/json"
+	"go_template_v3/pkg/config"
+	"go_template_v3/pkg/currency"
+	"go_template_v3/pkg/global/utils"
+	"go_template_v3/pkg/recurring"
+	mdlFeatureOne "go_template_v3/pkg/services/featureOne/model"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "github.com/FDSAP-Git-Org/hephaestus/helper/v1"
+	"github.com/FDSAP-Git-Org/hephaestus/respcode"
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
+)
+
+const recurringExpenseColumns = `
+	id, title, amount, currency, category_id, notes, frequency, interval_count AS interval,
+	to_char(start_date, 'YYYY-MM-DD') AS start_date,
+	to_char(end_date, 'YYYY-MM-DD') AS end_date,
+	COALESCE(skip_dates, '[]'::jsonb)::text AS skip_dates,
+	to_char(next_run_date, 'YYYY-MM-DD') AS next_run_date,
+	active, created_at, updated_at
+`
+
+func decodeSkipDates(recurringExpense *mdlFeatureOne.RecurringExpense) {
+	recurringExpense.SkipDates = []string{}
+	json.Unmarshal([]byte(recurringExpense.SkipDatesJSON), &recurringExpense.SkipDates)
+}
+
+func CreateRecurringExpense(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Parse request body
+	var req mdlFeatureOne.RecurringExpenseRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid body", err, http.StatusBadRequest)
+	}
+	if req.Title == nil || req.Amount == nil || req.Frequency == nil || req.StartDate == nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "title, amount, frequency and startDate are required", nil, http.StatusBadRequest)
+	}
+
+	// 3. Validate the rule and its schedule
+	baseCurrency := currency.UserBase(&config.DBConnList[0], userId)
+	recurringExpense := mdlFeatureOne.RecurringExpense{Currency: &baseCurrency, Interval: 1, SkipDates: []string{}, Active: true}
+	schedule, message := mergeRecurringExpense(&recurringExpense, req)
+	if message != "" {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, message, nil, http.StatusBadRequest)
+	}
+
+	// 4. A start date in the past creates the occurrences since then on the
+	// scheduler's next pass
+	var nextRunDate *string
+	if next, ok := schedule.Next(schedule.StartDate); ok {
+		date := next.Format(recurring.DateLayout)
+		nextRunDate = &date
+	}
+
+	// 5. Store the rule
+	skipDates, _ := json.Marshal(recurringExpense.SkipDates)
+	var created mdlFeatureOne.RecurringExpense
+	err := config.DBConnList[0].Raw(`
+		INSERT INTO recurring_expenses (user_id, title, amount, currency, category_id, notes, frequency, interval_count,
+			start_date, end_date, skip_dates, next_run_date, active)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?::date, ?::date, ?::jsonb, ?::date, TRUE)
+		RETURNING `+recurringExpenseColumns,
+		userId, recurringExpense.Title, recurringExpense.Amount, recurringExpense.Currency, recurringExpense.CategoryId, recurringExpense.Notes,
+		recurringExpense.Frequency, recurringExpense.Interval, recurringExpense.StartDate, recurringExpense.EndDate,
+		string(skipDates), nextRunDate,
+	).Scan(&created).Error
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+
+	decodeSkipDates(&created)
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_201, "Recurring expense created", created, http.StatusCreated)
+}
+
+func GetRecurringExpenses(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. List the user's rules, active ones first
+	recurringExpenses := []mdlFeatureOne.RecurringExpense{}
+	err := config.DBConnList[0].Raw(`
+		SELECT `+recurringExpenseColumns+`
+		FROM recurring_expenses
+		WHERE user_id = ?
+		ORDER BY active DESC, next_run_date NULLS LAST, id
+	`, userId).Scan(&recurringExpenses).Error
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+
+	for i := range recurringExpenses {
+		decodeSkipDates(&recurringExpenses[i])
+	}
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Recurring expenses retrieved", recurringExpenses, http.StatusOK)
+}
+
+func GetRecurringExpense(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Get rule ID from params
+	ruleId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid recurring expense ID", err, http.StatusBadRequest)
+	}
+
+	// 3. Load the rule
+	recurringExpense, err := getRecurringExpense(&config.DBConnList[0], ruleId, userId)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+	if recurringExpense == nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_404, "Recurring expense not found", nil, http.StatusNotFound)
+	}
+
+	// 4. Add its latest runs
+	details := mdlFeatureOne.RecurringExpenseDetails{RecurringExpense: *recurringExpense, RecentRuns: []mdlFeatureOne.RecurringExpenseRun{}}
+	err = config.DBConnList[0].Raw(`
+		SELECT to_char(occurrence_date, 'YYYY-MM-DD') AS occurrence_date, status, message, created_at
+		FROM recurring_expense_runs
+		WHERE rule_id = ?
+		ORDER BY occurrence_date DESC
+		LIMIT 20
+	`, ruleId).Scan(&details.RecentRuns).Error
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Recurring expense retrieved", details, http.StatusOK)
+}
+
+func UpdateRecurringExpense(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Get rule ID from params and parse request body
+	ruleId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid recurring expense ID", err, http.StatusBadRequest)
+	}
+	var req mdlFeatureOne.RecurringExpenseRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid body", err, http.StatusBadRequest)
+	}
+
+	var updated mdlFeatureOne.RecurringExpense
+	notFound := false
+	message := ""
+	err = config.DBConnList[0].Transaction(func(tx *gorm.DB) error {
+		// 3. Lock the rule so the scheduler does not run it mid-update
+		recurringExpense, err := getRecurringExpense(tx, ruleId, userId, "FOR UPDATE")
+		if err != nil || recurringExpense == nil {
+			notFound = recurringExpense == nil
+			return err
+		}
+		wasActive := recurringExpense.Active
+
+		// 4. Apply and validate the changes
+		schedule, msg := mergeRecurringExpense(recurringExpense, req)
+		if msg != "" {
+			message = msg
+			return nil
+		}
+
+		// 5. A changed schedule starts again from today, keeping occurrences
+		// that are already due. A resumed rule skips the time it was paused.
+		nextRunDate := recurringExpense.NextRunDate
+		scheduleChanged := req.Frequency != nil || req.Interval != nil || req.StartDate != nil ||
+			req.EndDate != nil || req.SkipDates != nil
+		if recurringExpense.Active && (scheduleChanged || !wasActive) {
+			from := recurring.Today()
+			if wasActive && nextRunDate != nil {
+				if pending, err := recurring.ParseDate(*nextRunDate); err == nil && pending.Before(from) {
+					from = pending
+				}
+			}
+			if from.Before(schedule.StartDate) {
+				from = schedule.StartDate
+			}
+
+			nextRunDate = nil
+			if next, ok := schedule.Next(from); ok {
+				date := next.Format(recurring.DateLayout)
+				nextRunDate = &date
+			}
+		}
+
+		// 6. Save the rule
+		skipDates, _ := json.Marshal(recurringExpense.SkipDates)
+		err = tx.Raw(`
+			UPDATE recurring_expenses SET
+				title = ?, amount = ?, currency = ?, category_id = ?, notes = ?, frequency = ?, interval_count = ?,
+				start_date = ?::date, end_date = ?::date, skip_dates = ?::jsonb, next_run_date = ?::date,
+				active = ?, updated_at = NOW()
+			WHERE id = ? AND user_id = ?
+			RETURNING `+recurringExpenseColumns,
+			recurringExpense.Title, recurringExpense.Amount, recurringExpense.Currency, recurringExpense.CategoryId, recurringExpense.Notes,
+			recurringExpense.Frequency, recurringExpense.Interval, recurringExpense.StartDate, recurringExpense.EndDate,
+			string(skipDates), nextRunDate, recurringExpense.Active, ruleId, userId,
+		).Scan(&updated).Error
+		decodeSkipDates(&updated)
+		return err
+	})
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+	if notFound {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_404, "Recurring expense not found", nil, http.StatusNotFound)
+	}
+	if message != "" {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, message, nil, http.StatusBadRequest)
+	}
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Recurring expense updated", updated, http.StatusOK)
+}
+
+func DeleteRecurringExpense(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Get rule ID from params
+	ruleId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid recurring expense ID", err, http.StatusBadRequest)
+	}
+
+	// 3. Delete the rule and its run log. Expenses it created are kept.
+	var deleted int64
+	err = config.DBConnList[0].Transaction(func(tx *gorm.DB) error {
+		result := tx.Exec("DELETE FROM recurring_expenses WHERE id = ? AND user_id = ?", ruleId, userId)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		deleted = result.RowsAffected
+		return tx.Exec("DELETE FROM recurring_expense_runs WHERE rule_id = ?", ruleId).Error
+	})
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+	if deleted == 0 {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_404, "Recurring expense not found", nil, http.StatusNotFound)
+	}
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Recurring expense deleted", nil, http.StatusOK)
+}
+
+// getRecurringExpense loads a user's rule, or nil when there is none. Extra
+// clauses such as FOR UPDATE are appended to the query.
+func getRecurringExpense(db *gorm.DB, ruleId, userId int, clauses ...string) (*mdlFeatureOne.RecurringExpense, error) {
+	var recurringExpense mdlFeatureOne.RecurringExpense
+	err := db.Raw(`
+		SELECT `+recurringExpenseColumns+`
+		FROM recurring_expenses
+		WHERE id = ? AND user_id = ?
+	`+strings.Join(clauses, " "), ruleId, userId).Scan(&recurringExpense).Error
+	if err != nil || recurringExpense.Id == 0 {
+		return nil, err
+	}
+	decodeSkipDates(&recurringExpense)
+	return &recurringExpense, nil
+}
+
+// mergeRecurringExpense applies the fields set in req to recurringExpense
+// and validates the result, returning its schedule or a message for the
+// client
+func mergeRecurringExpense(recurringExpense *mdlFeatureOne.RecurringExpense, req mdlFeatureOne.RecurringExpenseRequest) (recurring.Schedule, string) {
+	if req.Title != nil {
+		recurringExpense.Title = strings.TrimSpace(*req.Title)
+	}
+	if recurringExpense.Title == "" {
+		return recurring.Schedule{}, "Title is required"
+	}
+	if req.Amount != nil {
+		recurringExpense.Amount = *req.Amount
+	}
+	if recurringExpense.Amount <= 0 {
+		return recurring.Schedule{}, "Amount must be greater than 0"
+	}
+	if req.Currency != nil {
+		code, err := currency.Normalize(*req.Currency)
+		if err != nil {
+			return recurring.Schedule{}, err.Error()
+		}
+		recurringExpense.Currency = &code
+	}
+	if recurringExpense.Currency != nil {
+		if err := recurringExpense.Amount.Check(*recurringExpense.Currency); err != nil {
+			return recurring.Schedule{}, err.Error()
+		}
+	}
+	if req.CategoryId != nil {
+		var count int
+		config.DBConnList[0].Raw("SELECT COUNT(*) FROM expense_categories WHERE id = ?", *req.CategoryId).Scan(&count)
+		if count == 0 {
+			return recurring.Schedule{}, "Category not found"
+		}
+		recurringExpense.CategoryId = req.CategoryId
+	}
+	if req.Notes != nil {
+		recurringExpense.Notes = req.Notes
+	}
+	if req.Frequency != nil {
+		recurringExpense.Frequency = strings.ToLower(strings.TrimSpace(*req.Frequency))
+	}
+	if req.Interval != nil {
+		recurringExpense.Interval = *req.Interval
+	}
+	if req.StartDate != nil {
+		recurringExpense.StartDate = strings.TrimSpace(*req.StartDate)
+	}
+	if req.EndDate != nil {
+		recurringExpense.EndDate = nil
+		if endDate := strings.TrimSpace(*req.EndDate); endDate != "" {
+			recurringExpense.EndDate = &endDate
+		}
+	}
+	if req.SkipDates != nil {
+		recurringExpense.SkipDates = *req.SkipDates
+	}
+	if req.Active != nil {
+		recurringExpense.Active = *req.Active
+	}
+
+	schedule, err := recurring.NewSchedule(recurringExpense.Frequency, recurringExpense.Interval,
+		recurringExpense.StartDate, recurringExpense.EndDate, recurringExpense.SkipDates)
+	if err != nil {
+		return recurring.Schedule{}, err.Error()
+	}
+
+	// Store skip dates in order and once each
+	normalized := make([]string, 0, len(schedule.SkipDates))
+	seen := map[time.Time]bool{}
+	for _, date := range schedule.SkipDates {
+		if !seen[date] {
+			seen[date] = true
+			normalized = append(normalized, date.Format(recurring.DateLayout))
+		}
+	}
+	sort.Strings(normalized)
+	recurringExpense.SkipDates = normalized
+	return schedule, ""
+}
@@ -0,0 +1,78 @@
+package ctrFeatureOne
+
+import (
+	"go_template_v3/pkg/config"
+	"go_template_v3/pkg/global/utils"
+	mdlFeatureOne "go_template_v3/pkg/services/featureOne/model"
+	"net/http"
+	"strconv"
+
+	v1 "github.com/FDSAP-Git-Org/hephaestus/helper/v1"
+	"github.com/FDSAP-Git-Org/hephaestus/respcode"
+	"github.com/gofiber/fiber/v3"
+)
+
+func GetSessions(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+	currentSessionId := utils.GetSessionId(c)
+
+	// 2. Query active sessions, most recently used first
+	sessions := []mdlFeatureOne.Session{}
+	err := config.DBConnList[0].Raw(`
+		SELECT id, device, ip_address, user_agent, created_at, last_seen_at
+		FROM user_sessions
+		WHERE user_id = ? AND revoked_at IS NULL
+		ORDER BY last_seen_at DESC
+	`, userId).Scan(&sessions).Error
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].Id == currentSessionId
+	}
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Sessions retrieved", sessions, http.StatusOK)
+}
+
+func RevokeSession(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Get session ID from params
+	sessionId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid session ID", err, http.StatusBadRequest)
+	}
+
+	// 3. Revoke it along with its refresh tokens
+	revoked, err := utils.RevokeSession(userId, sessionId)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to revoke session", err, http.StatusInternalServerError)
+	}
+	if !revoked {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_404, "Session not found", nil, http.StatusNotFound)
+	}
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Session revoked", nil, http.StatusOK)
+}
+
+func RevokeAllSessions(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Optionally keep the session making this request
+	keepSessionId := 0
+	if fiber.Query[bool](c, "keepCurrent") {
+		keepSessionId = utils.GetSessionId(c)
+	}
+
+	revoked, err := utils.RevokeUserSessions(userId, keepSessionId)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to revoke sessions", err, http.StatusInternalServerError)
+	}
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Logged out of all sessions",
+		map[string]interface{}{"revoked": revoked}, http.StatusOK)
+}
@@ -0,0 +1,204 @@
+package ctrFeatureOne
+
+import (
+	"bytes"
+	"fmt"
+	"go_template_v3/pkg/config"
+	"go_template_v3/pkg/global/model"
+	"go_template_v3/pkg/global/utils"
+	"go_template_v3/pkg/imports"
+	"io"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	v1 "github.com/FDSAP-Git-Org/hephaestus/helper/v1"
+	"github.com/FDSAP-Git-Org/hephaestus/respcode"
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
+)
+
+// Templates are kept in template_details (id, upload_type, template_serial
+// unique per upload type, file_data bytea, file_ext, encoded_by, created_at).
+// Each upload adds a version; the newest is the one handed out.
+const (
+	templateTypeExpenseCSV = "expense_csv"
+
+	templateMaxFileSize = 5 * 1024 * 1024 // 5MB
+)
+
+var (
+	templateUploadTypePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,49}$`)
+
+	templateContentTypes = map[string]string{
+		"csv":  "text/csv",
+		"xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	}
+)
+
+func UploadTemplate(c fiber.Ctx) error {
+	// 1. Get admin user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Validate the upload type and file
+	uploadType := strings.ToLower(strings.TrimSpace(c.FormValue("uploadType")))
+	if !templateUploadTypePattern.MatchString(uploadType) {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400,
+			"uploadType is required and may only contain lowercase letters, digits, _ and -", nil, http.StatusBadRequest)
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Template file is required", err, http.StatusBadRequest)
+	}
+	if file.Size > templateMaxFileSize {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "File too large (max 5 MB)", nil, http.StatusBadRequest)
+	}
+	fileExt := strings.TrimPrefix(strings.ToLower(filepath.Ext(file.Filename)), ".")
+	if _, ok := templateContentTypes[fileExt]; !ok {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Only .csv and .xlsx templates are supported", nil, http.StatusBadRequest)
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Failed to read file", err, http.StatusBadRequest)
+	}
+	defer f.Close()
+	fileData, err := io.ReadAll(f)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Failed to read file", err, http.StatusBadRequest)
+	}
+	if fileExt == "csv" {
+		if _, err := imports.PreviewCSV(bytes.NewReader(fileData), 0); err != nil {
+			return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, err.Error(), nil, http.StatusBadRequest)
+		}
+	}
+
+	// 3. Record who uploaded it
+	var encodedBy string
+	config.DBConnList[0].Raw("SELECT email FROM users WHERE id = ?", userId).Scan(&encodedBy)
+	if encodedBy == "" {
+		encodedBy = fmt.Sprintf("user:%d", userId)
+	}
+
+	// 4. Store it as the next version of its upload type
+	var template model.ViewTemplateDetails
+	err = config.DBConnList[0].Transaction(func(tx *gorm.DB) error {
+		// Serialize uploads of one type so versions are not handed out twice
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "template_details:"+uploadType).Error; err != nil {
+			return err
+		}
+
+		var versions int
+		if err := tx.Raw("SELECT COUNT(*) FROM template_details WHERE upload_type = ?", uploadType).Scan(&versions).Error; err != nil {
+			return err
+		}
+		serial := fmt.Sprintf("%s-v%d", uploadType, versions+1)
+
+		return tx.Raw(`
+			INSERT INTO template_details (upload_type, template_serial, file_data, file_ext, encoded_by)
+			VALUES (?, ?, ?, ?, ?)
+			RETURNING upload_type, template_serial, file_ext, encoded_by, created_at
+		`, uploadType, serial, fileData, fileExt, encodedBy).Scan(&template).Error
+	})
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_201, "Template uploaded", template, http.StatusCreated)
+}
+
+func GetTemplates(c fiber.Ctx) error {
+	// 1. Build the query, optionally for one upload type
+	query := `
+		SELECT upload_type, template_serial, file_ext, encoded_by, created_at
+		FROM template_details
+	`
+	args := []interface{}{}
+	if uploadType := strings.ToLower(fiber.Query[string](c, "uploadType")); uploadType != "" {
+		query += " WHERE upload_type = ?"
+		args = append(args, uploadType)
+	}
+	query += " ORDER BY upload_type, created_at DESC, id DESC"
+
+	// 2. List every version, newest first
+	templates := []model.ViewTemplateDetails{}
+	if err := config.DBConnList[0].Raw(query, args...).Scan(&templates).Error; err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Templates retrieved", templates, http.StatusOK)
+}
+
+func DownloadTemplate(c fiber.Ctx) error {
+	// 1. Get the upload type from params
+	uploadType := strings.ToLower(c.Params("uploadType"))
+	if !templateUploadTypePattern.MatchString(uploadType) {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid upload type", nil, http.StatusBadRequest)
+	}
+
+	// 2. Load the latest version
+	var template model.TemplateDetails
+	err := config.DBConnList[0].Raw(`
+		SELECT id, upload_type, template_serial, file_data, file_ext, encoded_by, created_at
+		FROM template_details
+		WHERE upload_type = ?
+		ORDER BY created_at DESC, id DESC
+		LIMIT 1
+	`, uploadType).Scan(&template).Error
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+	if template.Id == 0 {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_404, "No template for this upload type", nil, http.StatusNotFound)
+	}
+
+	// 3. Send the file
+	c.Set("Content-Type", templateContentTypes[template.FileExt])
+	c.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, template.TemplateSerial, template.FileExt))
+	c.Set("X-Template-Serial", template.TemplateSerial)
+	return c.Send(template.FileData)
+}
+
+// matchImportTemplate returns the serial of the newest CSV template of the
+// upload type whose columns are the same as headers, ignoring order and
+// case, or "" when none match
+func matchImportTemplate(uploadType string, headers []string) (string, error) {
+	var templates []model.TemplateDetails
+	err := config.DBConnList[0].Raw(`
+		SELECT template_serial, file_data
+		FROM template_details
+		WHERE upload_type = ? AND file_ext = 'csv'
+		ORDER BY created_at DESC, id DESC
+		LIMIT 20
+	`, uploadType).Scan(&templates).Error
+	if err != nil {
+		return "", err
+	}
+
+	want := headerKey(headers)
+	for _, template := range templates {
+		preview, err := imports.PreviewCSV(bytes.NewReader(template.FileData), 0)
+		if err != nil {
+			continue
+		}
+		if headerKey(preview.Headers) == want {
+			return template.TemplateSerial, nil
+		}
+	}
+	return "", nil
+}
+
+// headerKey is a comparable form of a header row
+func headerKey(headers []string) string {
+	normalized := make([]string, 0, len(headers))
+	for _, header := range headers {
+		if header = strings.ToLower(strings.TrimSpace(header)); header != "" {
+			normalized = append(normalized, header)
+		}
+	}
+	sort.Strings(normalized)
+	return strings.Join(normalized, "\x1f")
+}
@@ -0,0 +1,98 @@
+package ctrFeatureOne
+
+import (
+	"go_template_v3/pkg/config"
+	"go_template_v3/pkg/global/utils"
+	mdlFeatureOne "go_template_v3/pkg/services/featureOne/model"
+	"net/http"
+	"strconv"
+
+	v1 "github.com/FDSAP-Git-Org/hephaestus/helper/v1"
+	"github.com/FDSAP-Git-Org/hephaestus/respcode"
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
+)
+
+func GetUserRoles(c fiber.Ctx) error {
+	// 1. Get target user from URL params
+	userId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid user ID", err, http.StatusBadRequest)
+	}
+
+	// 2. Load roles and effective permissions
+	roles, permissions, err := utils.GetUserAccess(userId)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "User roles retrieved",
+		map[string]interface{}{
+			"userId":      userId,
+			"roles":       roles,
+			"permissions": permissions,
+		}, http.StatusOK)
+}
+
+func UpdateUserRoles(c fiber.Ctx) error {
+	// 1. Get target user from URL params
+	userId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid user ID", err, http.StatusBadRequest)
+	}
+
+	// 2. Parse request body
+	var req mdlFeatureOne.UpdateUserRolesRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid body", err, http.StatusBadRequest)
+	}
+
+	req.Roles = uniqueRoles(req.Roles)
+	if len(req.Roles) == 0 {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "At least one role is required", nil, http.StatusBadRequest)
+	}
+
+	// 3. Make sure every role exists before touching assignments
+	var known int64
+	if err := config.DBConnList[0].Raw("SELECT COUNT(*) FROM roles WHERE name IN ?", req.Roles).Scan(&known).Error; err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+	if int(known) != len(req.Roles) {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Unknown role in request", nil, http.StatusBadRequest)
+	}
+
+	// 4. Replace the user's roles in one transaction
+	err = config.DBConnList[0].Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM user_roles WHERE user_id = ?", userId).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`
+			INSERT INTO user_roles (user_id, role_id)
+			SELECT ?, id FROM roles WHERE name IN ?
+		`, userId, req.Roles).Error
+	})
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "Failed to update roles", err, http.StatusInternalServerError)
+	}
+
+	// New roles take effect on the user's next login or token refresh
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "User roles updated",
+		map[string]interface{}{
+			"userId": userId,
+			"roles":  req.Roles,
+		}, http.StatusOK)
+}
+
+// uniqueRoles drops repeated role names, keeping the first of each, so the
+// count of known roles can be compared with the request
+func uniqueRoles(roles []string) []string {
+	seen := map[string]bool{}
+	unique := make([]string, 0, len(roles))
+	for _, role := range roles {
+		if !seen[role] {
+			seen[role] = true
+			unique = append(unique, role)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,23 @@
+package ctrFeatureOne
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUniqueRoles(t *testing.T) {
+	tests := []struct {
+		roles []string
+		want  []string
+	}{
+		{[]string{"user"}, []string{"user"}},
+		{[]string{"admin", "user", "admin", "admin"}, []string{"admin", "user"}},
+		{[]string{}, []string{}},
+		{nil, []string{}},
+	}
+	for _, tt := range tests {
+		if got := uniqueRoles(tt.roles); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("uniqueRoles(%q) = %q, want %q", tt.roles, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package ctrFeatureOne
+
+import (
+	"encoding/json"
+	"go_template_v3/pkg/config"
+	"go_template_v3/pkg/global/utils"
+	mdlFeatureOne "go_template_v3/pkg/services/featureOne/model"
+	"go_template_v3/pkg/webhooks"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "github.com/FDSAP-Git-Org/hephaestus/helper/v1"
+	"github.com/FDSAP-Git-Org/hephaestus/respcode"
+	"github.com/gofiber/fiber/v3"
+)
+
+const webhookMaxEndpoints = 10
+
+// webhookRow is a webhook_endpoints row with its events still encoded
+type webhookRow struct {
+	Id        int
+	Url       string
+	Events    string
+	CreatedAt time.Time
+}
+
+func (r webhookRow) toModel() mdlFeatureOne.Webhook {
+	webhook := mdlFeatureOne.Webhook{Id: r.Id, Url: r.Url, Events: []string{}, CreatedAt: r.CreatedAt}
+	json.Unmarshal([]byte(r.Events), &webhook.Events)
+	return webhook
+}
+
+func CreateWebhook(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Parse and validate request body
+	var req mdlFeatureOne.CreateWebhookRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid body", err, http.StatusBadRequest)
+	}
+	if req.Url == nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "url is required", nil, http.StatusBadRequest)
+	}
+	url := strings.TrimSpace(*req.Url)
+	if err := webhooks.ValidateURL(url); err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, err.Error(), nil, http.StatusBadRequest)
+	}
+	events := []string{}
+	for _, event := range req.Events {
+		if !webhooks.ValidEvent(event) {
+			return v1.JSONResponseWithError(c, respcode.ERR_CODE_400,
+				"Unknown event "+event+", expected one of "+strings.Join(webhooks.Events, ", "), nil, http.StatusBadRequest)
+		}
+		events = append(events, event)
+	}
+
+	// 3. Limit endpoints per user
+	var count int
+	config.DBConnList[0].Raw("SELECT COUNT(*) FROM webhook_endpoints WHERE user_id = ? AND active", userId).Scan(&count)
+	if count >= webhookMaxEndpoints {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400,
+			"Webhook limit reached (max "+strconv.Itoa(webhookMaxEndpoints)+")", nil, http.StatusBadRequest)
+	}
+
+	// 4. Store the endpoint with a new signing secret
+	secret := "whsec_" + utils.GenerateOpaqueToken(32)
+	eventsJSON, _ := json.Marshal(events)
+	var row webhookRow
+	err := config.DBConnList[0].Raw(`
+		INSERT INTO webhook_endpoints (user_id, url, secret, events, active)
+		VALUES (?, ?, ?, ?::jsonb, TRUE)
+		RETURNING id, url, events::text AS events, created_at
+	`, userId, url, secret, string(eventsJSON)).Scan(&row).Error
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+
+	// 5. The secret is shown only once
+	webhook := row.toModel()
+	webhook.Secret = secret
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_201, "Webhook created, store the secret now as it will not be shown again",
+		webhook, http.StatusCreated)
+}
+
+func GetWebhooks(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. List active endpoints
+	var rows []webhookRow
+	err := config.DBConnList[0].Raw(`
+		SELECT id, url, COALESCE(events, '[]'::jsonb)::text AS events, created_at
+		FROM webhook_endpoints
+		WHERE user_id = ? AND active
+		ORDER BY id
+	`, userId).Scan(&rows).Error
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+
+	webhookList := make([]mdlFeatureOne.Webhook, 0, len(rows))
+	for _, row := range rows {
+		webhookList = append(webhookList, row.toModel())
+	}
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Webhooks retrieved", webhookList, http.StatusOK)
+}
+
+func DeleteWebhook(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Get webhook ID from params
+	webhookId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid webhook ID", err, http.StatusBadRequest)
+	}
+
+	// 3. Deactivate it, keeping its delivery log
+	result := config.DBConnList[0].Exec(
+		"UPDATE webhook_endpoints SET active = FALSE WHERE id = ? AND user_id = ? AND active",
+		webhookId, userId,
+	)
+	if result.Error != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", result.Error, http.StatusInternalServerError)
+	}
+	if result.RowsAffected == 0 {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_404, "Webhook not found", nil, http.StatusNotFound)
+	}
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Webhook deleted", nil, http.StatusOK)
+}
+
+func GetWebhookDeliveries(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Get webhook ID from params
+	webhookId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid webhook ID", err, http.StatusBadRequest)
+	}
+
+	// 3. Read paging and an optional status filter
+	limit := fiber.Query[int](c, "limit")
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	offset := fiber.Query[int](c, "offset")
+	if offset < 0 {
+		offset = 0
+	}
+	where := "endpoint_id = ? AND user_id = ?"
+	args := []interface{}{webhookId, userId}
+	if status := fiber.Query[string](c, "status"); status != "" {
+		where += " AND status = ?"
+		args = append(args, status)
+	}
+
+	// 4. Load the page, newest first
+	list := mdlFeatureOne.WebhookDeliveryList{Deliveries: []mdlFeatureOne.WebhookDelivery{}, Limit: limit, Offset: offset}
+	if err := config.DBConnList[0].Raw("SELECT COUNT(*) FROM webhook_deliveries WHERE "+where, args...).Scan(&list.Total).Error; err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+
+	var rows []struct {
+		mdlFeatureOne.WebhookDelivery
+		PayloadText string
+	}
+	err = config.DBConnList[0].Raw(`
+		SELECT id, endpoint_id, event, status, attempts,
+			CASE WHEN status = 'pending' THEN next_attempt_at END AS next_attempt_at,
+			last_status_code, last_error, replay_of, payload::text AS payload_text, created_at, delivered_at
+		FROM webhook_deliveries
+		WHERE `+where+`
+		ORDER BY id DESC
+		LIMIT ? OFFSET ?
+	`, append(args, limit, offset)...).Scan(&rows).Error
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+	for _, row := range rows {
+		delivery := row.WebhookDelivery
+		delivery.Payload = json.RawMessage(row.PayloadText)
+		list.Deliveries = append(list.Deliveries, delivery)
+	}
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Webhook deliveries retrieved", list, http.StatusOK)
+}
+
+func ReplayWebhookDelivery(c fiber.Ctx) error {
+	// 1. Get user ID from JWT
+	userId := utils.GetUserId(c)
+
+	// 2. Get delivery ID from params
+	deliveryId, err := strconv.Atoi(c.Params("deliveryId"))
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_400, "Invalid delivery ID", err, http.StatusBadRequest)
+	}
+
+	// 3. Queue the same payload again as a new delivery
+	newId, err := webhooks.Replay(deliveryId, userId)
+	if err != nil {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_500, "DB error", err, http.StatusInternalServerError)
+	}
+	if newId == 0 {
+		return v1.JSONResponseWithError(c, respcode.ERR_CODE_404, "Delivery not found or its webhook was deleted", nil, http.StatusNotFound)
+	}
+
+	return v1.JSONResponseWithData(c, respcode.SUC_CODE_200, "Delivery queued for replay",
+		map[string]interface{}{
+			"deliveryId": newId,
+			"replayOf":   deliveryId,
+			"status":     "pending",
+		},
+		http.StatusAccepted)
+}
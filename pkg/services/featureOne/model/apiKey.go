@@ -0,0 +1,28 @@
+package mdlFeatureOne
+
+import "time"
+
+type (
+	CreateAPIKeyRequest struct {
+		Name      *string    `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expiresAt"`
+	}
+
+	APIKey struct {
+		Id         int        `json:"id"`
+		Name       string     `json:"name"`
+		KeyPrefix  string     `json:"keyPrefix"`
+		Scopes     []string   `json:"scopes" gorm:"-"`
+		ScopesJSON string     `json:"-" gorm:"column:scopes"`
+		ExpiresAt  *time.Time `json:"expiresAt"`
+		LastUsedAt *time.Time `json:"lastUsedAt"`
+		RevokedAt  *time.Time `json:"revokedAt"`
+		CreatedAt  time.Time  `json:"createdAt"`
+	}
+
+	CreateAPIKeyResponse struct {
+		APIKey
+		Key string `json:"key"`
+	}
+)
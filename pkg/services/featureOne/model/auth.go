@@ -1,5 +1,7 @@
 package mdlFeatureOne
 
+import "time"
+
 type (
     RegisterRequest struct {
         Email    *string `json:"email"`
@@ -10,6 +12,7 @@ type (
     LoginRequest struct {
         Email    *string `json:"email"`
         Password *string `json:"password"`
+        Device   *string `json:"device"`
     }
 
 	 User struct {
@@ -17,5 +20,60 @@ type (
 		Email    *string `json:"email"`
 		Password *string `json:"password"`
 		Name     *string `json:"name"`
+
+		EmailVerifiedAt *time.Time `json:"emailVerifiedAt"`
+	}
+
+	ChangePasswordRequest struct {
+		CurrentPassword *string `json:"currentPassword"`
+		NewPassword     *string `json:"newPassword"`
+	}
+
+	DeleteAccountRequest struct {
+		Password *string `json:"password"`
+	}
+
+	VerifyEmailRequest struct {
+		Token *string `json:"token"`
+	}
+
+	ResendVerificationRequest struct {
+		Email *string `json:"email"`
+	}
+
+	RefreshTokenRequest struct {
+		RefreshToken *string `json:"refreshToken"`
+	}
+
+	LogoutRequest struct {
+		RefreshToken *string `json:"refreshToken"`
+	}
+
+	TokenPair struct {
+		AccessToken  string `json:"token"`
+		RefreshToken string `json:"refreshToken"`
+		ExpiresIn    int    `json:"expiresIn"`
+	}
+
+	Session struct {
+		Id         int       `json:"id"`
+		Device     string    `json:"device"`
+		IpAddress  string    `json:"ipAddress"`
+		UserAgent  string    `json:"userAgent"`
+		CreatedAt  time.Time `json:"createdAt"`
+		LastSeenAt time.Time `json:"lastSeenAt"`
+		Current    bool      `json:"current" gorm:"-"`
+	}
+
+	UpdateUserRolesRequest struct {
+		Roles []string `json:"roles"`
+	}
+
+	RefreshTokenRecord struct {
+		Id        int
+		UserId    int
+		FamilyId  string
+		SessionId *int
+		ExpiresAt time.Time
 	}
 )
\ No newline at end of file
@@ -0,0 +1,25 @@
+package mdlFeatureOne
+
+import "time"
+
+type (
+	BatchJob struct {
+		Id              int        `json:"jobId"`
+		JobType         string     `json:"jobType"`
+		Status          string     `json:"status"`
+		TotalItems      int        `json:"totalItems"`
+		ProcessedItems  int        `json:"processedItems"`
+		SuccessfulItems int        `json:"successfulItems"`
+		FailedItems     int        `json:"failedItems"`
+		CreatedAt       time.Time  `json:"createdAt"`
+		UpdatedAt       time.Time  `json:"updatedAt"`
+		CompletedAt     *time.Time `json:"completedAt"`
+	}
+
+	BatchJobList struct {
+		Jobs   []BatchJob `json:"jobs"`
+		Total  int        `json:"total"`
+		Limit  int        `json:"limit"`
+		Offset int        `json:"offset"`
+	}
+)
@@ -0,0 +1,55 @@
+package mdlFeatureOne
+
+import (
+	"go_template_v3/pkg/money"
+	"time"
+)
+
+type (
+	// BudgetRequest creates a budget, or changes the fields it sets on
+	// update. Leave categoryId out, or set it to 0, for an overall budget.
+	BudgetRequest struct {
+		CategoryId *int          `json:"categoryId"`
+		Period     *string       `json:"period"`
+		Amount     *money.Amount `json:"amount"`
+		StartDate  *string       `json:"startDate"`
+		EndDate    *string       `json:"endDate"`
+		Thresholds *[]int        `json:"thresholds"`
+	}
+
+	// Budget is a budget with its spending in one period
+	Budget struct {
+		Id                int          `json:"id"`
+		CategoryId        *int         `json:"categoryId"`
+		CategoryName      *string      `json:"categoryName"`
+		Period            string       `json:"period"`
+		Amount            money.Amount `json:"amount"`
+		StartDate         *string      `json:"startDate"`
+		EndDate           *string      `json:"endDate"`
+		Thresholds        []int        `json:"thresholds" gorm:"-"`
+		ThresholdsJSON    string       `json:"-" gorm:"column:thresholds"`
+		PeriodStart       string       `json:"periodStart"`
+		PeriodEnd         string       `json:"periodEnd"`
+		Spent             money.Amount `json:"spent"`
+		Remaining         money.Amount `json:"remaining" gorm:"-"`
+		PercentUsed       float64      `json:"percentUsed" gorm:"-"`
+		ThresholdsReached []int        `json:"thresholdsReached" gorm:"-"`
+		CreatedAt         time.Time    `json:"createdAt"`
+		UpdatedAt         time.Time    `json:"updatedAt"`
+	}
+
+	BudgetAlert struct {
+		Id           int          `json:"id"`
+		BudgetId     int          `json:"budgetId"`
+		CategoryId   *int         `json:"categoryId"`
+		CategoryName *string      `json:"categoryName"`
+		Period       string       `json:"period"`
+		PeriodStart  string       `json:"periodStart"`
+		PeriodEnd    string       `json:"periodEnd"`
+		Threshold    int          `json:"threshold"`
+		Spent        money.Amount `json:"spent"`
+		BudgetAmount money.Amount `json:"budgetAmount"`
+		EmailedAt    *time.Time   `json:"emailedAt"`
+		CreatedAt    time.Time    `json:"createdAt"`
+	}
+)
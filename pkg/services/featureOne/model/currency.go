@@ -0,0 +1,27 @@
+package mdlFeatureOne
+
+import (
+	"go_template_v3/pkg/currency"
+	"time"
+)
+
+type (
+	BaseCurrencyRequest struct {
+		Currency string `json:"currency"`
+	}
+
+	// ExchangeRatesRequest sets the rates of one date, keyed by currency,
+	// against the reference currency
+	ExchangeRatesRequest struct {
+		Date  string                      `json:"date"`
+		Rates map[string]currency.Decimal `json:"rates"`
+	}
+
+	ExchangeRate struct {
+		Currency  string           `json:"currency"`
+		RateDate  string           `json:"rateDate"`
+		Rate      currency.Decimal `json:"rate"`
+		Source    *string          `json:"source"`
+		CreatedAt time.Time        `json:"createdAt"`
+	}
+)
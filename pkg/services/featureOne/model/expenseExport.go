@@ -0,0 +1,26 @@
+package mdlFeatureOne
+
+import "go_template_v3/pkg/money"
+
+type (
+	// ExpenseExportFilters are the GetExpenses filters an export accepts
+	ExpenseExportFilters struct {
+		Title      string       `json:"title,omitempty"`
+		Amount     money.Amount `json:"amount,omitempty"`
+		MinAmount  money.Amount `json:"minAmount,omitempty"`
+		MaxAmount  money.Amount `json:"maxAmount,omitempty"`
+		CategoryId int          `json:"categoryId,omitempty"`
+		StartDate  string       `json:"startDate,omitempty"`
+		EndDate    string       `json:"endDate,omitempty"`
+	}
+
+	// ExpenseExportJob is the payload of an expense_export job. Amounts are
+	// converted into Currency; expenses without a currency are in
+	// BaseCurrency, the user's base currency when the export was requested.
+	ExpenseExportJob struct {
+		Format       string               `json:"format"`
+		Filters      ExpenseExportFilters `json:"filters"`
+		BaseCurrency string               `json:"baseCurrency"`
+		Currency     string               `json:"currency"`
+	}
+)
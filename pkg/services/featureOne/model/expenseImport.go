@@ -0,0 +1,45 @@
+package mdlFeatureOne
+
+import "go_template_v3/pkg/imports"
+
+type (
+	ExpenseImport struct {
+		Id             int
+		UserId         int
+		FilePath       string
+		OriginalName   string
+		Format         string
+		Delimiter      string
+		Headers        string
+		RowCount       int
+		LastJobId      *int
+		CommittedJobId *int
+	}
+
+	ExpenseImportPreview struct {
+		ImportId     int    `json:"importId"`
+		OriginalName string `json:"originalName"`
+		Format       string `json:"format"`
+		// TemplateSerial is the published template the file's columns match
+		TemplateSerial string `json:"templateSerial,omitempty"`
+		*imports.Preview
+	}
+
+	CommitExpenseImportRequest struct {
+		Mapping          map[string]string `json:"mapping"`
+		DateFormat       *string           `json:"dateFormat"`
+		DecimalSeparator *string           `json:"decimalSeparator"`
+		Currency         *string           `json:"currency"`
+		DryRun           *bool             `json:"dryRun"`
+	}
+
+	// ExpenseImportJob is the payload of an expense_import job
+	ExpenseImportJob struct {
+		ImportId         int               `json:"importId"`
+		Mapping          map[string]string `json:"mapping"`
+		DateFormat       string            `json:"dateFormat"`
+		DecimalSeparator string            `json:"decimalSeparator"`
+		Currency         string            `json:"currency"`
+		DryRun           bool              `json:"dryRun"`
+	}
+)
@@ -0,0 +1,63 @@
+package mdlFeatureOne
+
+import "go_template_v3/pkg/money"
+
+type (
+	// ExpenseSummaryTotals are the figures reported for a range or a group,
+	// in the summary's currency. Unconverted expenses had no exchange rate
+	// for their date; they are counted but left out of the total and
+	// average.
+	ExpenseSummaryTotals struct {
+		Total       money.Amount `json:"total"`
+		Count       int          `json:"count"`
+		Average     money.Amount `json:"average"`
+		Unconverted int          `json:"unconverted"`
+	}
+
+	// ExpenseSummaryCurrency is what was spent in one currency, as entered
+	// and converted. Converted is null when none of it could be converted.
+	ExpenseSummaryCurrency struct {
+		Currency  string        `json:"currency"`
+		Total     money.Amount  `json:"total"`
+		Count     int           `json:"count"`
+		Converted *money.Amount `json:"converted"`
+	}
+
+	// ExpenseSummaryChange compares a total with the one before it. Percent
+	// is null when there was nothing to compare with.
+	ExpenseSummaryChange struct {
+		Amount  money.Amount `json:"amount"`
+		Percent *float64     `json:"percent"`
+	}
+
+	ExpenseSummaryPeriod struct {
+		StartDate string `json:"startDate"`
+		EndDate   string `json:"endDate"`
+		ExpenseSummaryTotals
+		ByCurrency []ExpenseSummaryCurrency `json:"byCurrency"`
+	}
+
+	// ExpenseSummaryGroup is one category or time bucket. Time buckets
+	// compare with the bucket before them, categories with the same category
+	// in the previous period.
+	ExpenseSummaryGroup struct {
+		Key        string                `json:"key"`
+		Label      string                `json:"label"`
+		CategoryId *int                  `json:"categoryId,omitempty"`
+		StartDate  string                `json:"startDate,omitempty"`
+		EndDate    string                `json:"endDate,omitempty"`
+		Share      float64               `json:"share"`
+		Change     *ExpenseSummaryChange `json:"change"`
+		ExpenseSummaryTotals
+	}
+
+	ExpenseSummary struct {
+		GroupBy  string                `json:"groupBy"`
+		Currency string                `json:"currency"`
+		Filters  ExpenseExportFilters  `json:"filters"`
+		Current  ExpenseSummaryPeriod  `json:"current"`
+		Previous ExpenseSummaryPeriod  `json:"previous"`
+		Change   *ExpenseSummaryChange `json:"change"`
+		Groups   []ExpenseSummaryGroup `json:"groups"`
+	}
+)
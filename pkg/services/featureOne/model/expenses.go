@@ -1,12 +1,15 @@
 package mdlFeatureOne
 
+import "go_template_v3/pkg/money"
+
 type (
 	AddExpenseRequest struct {
-		Title      string  `json:"title"`
-		Amount     float64 `json:"amount"`
-		CategoryID *int    `json:"categoryId"`
-		Date       *string `json:"date"`
-		Notes      *string `json:"notes"`
+		Title      string       `json:"title"`
+		Amount     money.Amount `json:"amount"`
+		CategoryID *int         `json:"categoryId"`
+		Date       *string      `json:"date"`
+		Notes      *string      `json:"notes"`
+		Currency   *string      `json:"currency"`
 		ImageURL    *string `json:"imageUrl"` 
 	}
 )
@@ -0,0 +1,32 @@
+package mdlFeatureOne
+
+type (
+	MFACodeRequest struct {
+		Code *string `json:"code"`
+	}
+
+	MFAVerifyRequest struct {
+		MFAToken     *string `json:"mfaToken"`
+		Code         *string `json:"code"`
+		RecoveryCode *string `json:"recoveryCode"`
+		Device       *string `json:"device"`
+	}
+
+	MFAEnrollResponse struct {
+		Secret     string `json:"secret"`
+		OtpauthURI string `json:"otpauthUri"`
+	}
+
+	MFAPendingResponse struct {
+		MFARequired bool   `json:"mfaRequired"`
+		MFAToken    string `json:"mfaToken"`
+		ExpiresIn   int    `json:"expiresIn"`
+	}
+
+	UserMFA struct {
+		UserId       int
+		Secret       string
+		Enabled      bool
+		LastUsedStep *int64
+	}
+)
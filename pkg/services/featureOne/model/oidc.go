@@ -0,0 +1,18 @@
+package mdlFeatureOne
+
+import "time"
+
+type (
+	OIDCLoginResponse struct {
+		AuthorizationURL string `json:"authorizationUrl"`
+		State            string `json:"state"`
+	}
+
+	OIDCLoginState struct {
+		Provider     string
+		Nonce        string
+		CodeVerifier string
+		UserId       *int
+		ExpiresAt    time.Time
+	}
+)
@@ -0,0 +1,55 @@
+package mdlFeatureOne
+
+import (
+	"go_template_v3/pkg/money"
+	"time"
+)
+
+type (
+	// RecurringExpenseRequest creates a rule, or changes the fields it sets
+	// on update. An empty endDate removes the end date.
+	RecurringExpenseRequest struct {
+		Title      *string       `json:"title"`
+		Amount     *money.Amount `json:"amount"`
+		Currency   *string       `json:"currency"`
+		CategoryId *int          `json:"categoryId"`
+		Notes      *string       `json:"notes"`
+		Frequency  *string       `json:"frequency"`
+		Interval   *int          `json:"interval"`
+		StartDate  *string       `json:"startDate"`
+		EndDate    *string       `json:"endDate"`
+		SkipDates  *[]string     `json:"skipDates"`
+		Active     *bool         `json:"active"`
+	}
+
+	RecurringExpense struct {
+		Id            int          `json:"id"`
+		Title         string       `json:"title"`
+		Amount        money.Amount `json:"amount"`
+		Currency      *string      `json:"currency"`
+		CategoryId    *int         `json:"categoryId"`
+		Notes         *string      `json:"notes"`
+		Frequency     string       `json:"frequency"`
+		Interval      int          `json:"interval"`
+		StartDate     string       `json:"startDate"`
+		EndDate       *string      `json:"endDate"`
+		SkipDates     []string     `json:"skipDates" gorm:"-"`
+		SkipDatesJSON string       `json:"-" gorm:"column:skip_dates"`
+		NextRunDate   *string      `json:"nextRunDate"`
+		Active        bool         `json:"active"`
+		CreatedAt     time.Time    `json:"createdAt"`
+		UpdatedAt     time.Time    `json:"updatedAt"`
+	}
+
+	RecurringExpenseRun struct {
+		OccurrenceDate string    `json:"occurrenceDate"`
+		Status         string    `json:"status"`
+		Message        *string   `json:"message"`
+		CreatedAt      time.Time `json:"createdAt"`
+	}
+
+	RecurringExpenseDetails struct {
+		RecurringExpense
+		RecentRuns []RecurringExpenseRun `json:"recentRuns"`
+	}
+)
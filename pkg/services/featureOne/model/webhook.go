@@ -0,0 +1,44 @@
+package mdlFeatureOne
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type (
+	CreateWebhookRequest struct {
+		Url    *string  `json:"url"`
+		Events []string `json:"events"`
+	}
+
+	Webhook struct {
+		Id        int       `json:"id"`
+		Url       string    `json:"url"`
+		Events    []string  `json:"events"`
+		CreatedAt time.Time `json:"createdAt"`
+		// Secret is only returned when the endpoint is created
+		Secret string `json:"secret,omitempty"`
+	}
+
+	WebhookDelivery struct {
+		Id             int             `json:"deliveryId"`
+		EndpointId     int             `json:"endpointId"`
+		Event          string          `json:"event"`
+		Status         string          `json:"status"`
+		Attempts       int             `json:"attempts"`
+		NextAttemptAt  *time.Time      `json:"nextAttemptAt"`
+		LastStatusCode *int            `json:"lastStatusCode"`
+		LastError      *string         `json:"lastError"`
+		ReplayOf       *int            `json:"replayOf"`
+		Payload        json.RawMessage `json:"payload"`
+		CreatedAt      time.Time       `json:"createdAt"`
+		DeliveredAt    *time.Time      `json:"deliveredAt"`
+	}
+
+	WebhookDeliveryList struct {
+		Deliveries []WebhookDelivery `json:"deliveries"`
+		Total      int               `json:"total"`
+		Limit      int               `json:"limit"`
+		Offset     int               `json:"offset"`
+	}
+)
@@ -0,0 +1,15 @@
+package svcWellKnown
+
+import (
+	"go_template_v3/pkg/global/utils"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// JWKS publishes the public keys other services use to verify our tokens.
+// It is served as a bare key set, not the usual response envelope, because
+// JWT libraries expect the standard format.
+func JWKS(c fiber.Ctx) error {
+	c.Set("Cache-Control", "public, max-age=300")
+	return c.JSON(utils.JWKS())
+}
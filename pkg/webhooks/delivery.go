@@ -0,0 +1,259 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go_template_v3/pkg/config"
+	"go_template_v3/pkg/global/utils"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	utils_v1 "github.com/FDSAP-Git-Org/hephaestus/utils/v1"
+)
+
+const (
+	// deliveryTimeout bounds one attempt; the claim lease must outlast it
+	deliveryTimeout = 10 * time.Second
+	claimLease      = 60 * time.Second
+
+	// Retries wait retryBase, doubling each attempt, up to retryMax
+	retryBase = 30 * time.Second
+	retryMax  = 6 * time.Hour
+)
+
+// wake nudges idle workers when this process queues a delivery
+var wake = make(chan struct{}, 1)
+
+var errPrivateAddress = errors.New("webhook target resolves to a private address")
+
+// Start launches WEBHOOK_WORKERS workers (default 2) that send due
+// deliveries until ctx is cancelled
+func Start(ctx context.Context) {
+	workers := utils.EnvInt("WEBHOOK_WORKERS", 2, 1)
+	client := newClient()
+	for i := 0; i < workers; i++ {
+		go work(ctx, client)
+	}
+	fmt.Printf("WEBHOOK WORKERS: %d\n", workers)
+}
+
+func work(ctx context.Context, client *http.Client) {
+	pollInterval := time.Duration(utils.EnvInt("WEBHOOK_POLL_SECONDS", 5, 1)) * time.Second
+
+	for {
+		delivered, err := deliverNext(ctx, client)
+		if err != nil {
+			log.Printf("Error delivering webhook: %v", err)
+		}
+		if delivered {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// delivery is a claimed webhook_deliveries row with its endpoint. Url and
+// Secret are nil when the endpoint was removed after the event was queued.
+type delivery struct {
+	Id       int
+	Event    string
+	Payload  string
+	Attempts int
+	Url      *string
+	Secret   *string
+}
+
+// outcome is what an attempt records on the delivery. Status stays pending
+// when it is to be retried after RetryIn.
+type outcome struct {
+	Status     string
+	StatusCode *int
+	Error      string
+	RetryIn    time.Duration
+}
+
+// deliverNext claims one due delivery and attempts it. The claim pushes
+// next_attempt_at out by a lease, so a worker that dies mid-attempt only
+// delays the delivery.
+func deliverNext(ctx context.Context, client *http.Client) (bool, error) {
+	var claimed delivery
+	err := config.DBConnList[0].Raw(`
+		WITH claimed AS (
+			UPDATE webhook_deliveries SET
+				attempts = attempts + 1,
+				next_attempt_at = NOW() + make_interval(secs => ?)
+			WHERE id = (
+				SELECT id FROM webhook_deliveries
+				WHERE status = 'pending' AND next_attempt_at <= NOW()
+				ORDER BY next_attempt_at
+				FOR UPDATE SKIP LOCKED
+				LIMIT 1
+			)
+			RETURNING id, endpoint_id, event, payload, attempts
+		)
+		SELECT c.id, c.event, c.payload::text AS payload, c.attempts, e.url, e.secret
+		FROM claimed c
+		LEFT JOIN webhook_endpoints e ON e.id = c.endpoint_id AND e.active
+	`, int(claimLease.Seconds())).Scan(&claimed).Error
+	if err != nil || claimed.Id == 0 {
+		return false, err
+	}
+
+	result := attempt(ctx, client, claimed, utils.EnvInt("WEBHOOK_MAX_ATTEMPTS", 8, 1))
+	if result.Status == "pending" {
+		return true, retry(claimed.Id, result.RetryIn, result.StatusCode, result.Error)
+	}
+	return true, finish(claimed.Id, result.Status, result.StatusCode, result.Error)
+}
+
+// attempt sends a claimed delivery and decides what to record: succeeded
+// on a 2xx, a retry with backoff on anything else, and failed once
+// maxAttempts is reached or the endpoint is gone
+func attempt(ctx context.Context, client *http.Client, d delivery, maxAttempts int) outcome {
+	if d.Url == nil || d.Secret == nil {
+		return outcome{Status: "failed", Error: "endpoint was removed"}
+	}
+
+	statusCode, err := send(ctx, client, *d.Url, *d.Secret, d.Id, d.Event, []byte(d.Payload))
+	result := outcome{Status: "succeeded"}
+	if statusCode != 0 {
+		result.StatusCode = &statusCode
+	}
+	if err == nil {
+		return result
+	}
+
+	result.Error = err.Error()
+	if d.Attempts >= maxAttempts {
+		result.Status = "failed"
+		return result
+	}
+	result.Status = "pending"
+	result.RetryIn = backoff(d.Attempts)
+	return result
+}
+
+// send posts one signed delivery and returns the response status, with an
+// error unless it was 2xx
+func send(ctx context.Context, client *http.Client, url, secret string, deliveryId int, event string, body []byte) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, deliveryTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go_template_v3-webhooks")
+	req.Header.Set(HeaderEvent, event)
+	req.Header.Set(HeaderDelivery, fmt.Sprint(deliveryId))
+	req.Header.Set(HeaderSignature, Sign(secret, time.Now().Unix(), body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return resp.StatusCode, fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(snippet)))
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	return resp.StatusCode, nil
+}
+
+func finish(deliveryId int, status string, statusCode *int, lastError string) error {
+	var errArg interface{}
+	if lastError != "" {
+		errArg = truncate(lastError, 1000)
+	}
+	return config.DBConnList[0].Exec(`
+		UPDATE webhook_deliveries SET
+			status = ?,
+			last_status_code = ?,
+			last_error = ?,
+			delivered_at = CASE WHEN ?::text = 'succeeded' THEN NOW() ELSE delivered_at END
+		WHERE id = ?
+	`, status, statusCode, errArg, status, deliveryId).Error
+}
+
+func retry(deliveryId int, wait time.Duration, statusCode *int, lastError string) error {
+	return config.DBConnList[0].Exec(`
+		UPDATE webhook_deliveries SET
+			next_attempt_at = NOW() + make_interval(secs => ?),
+			last_status_code = ?,
+			last_error = ?
+		WHERE id = ?
+	`, int(wait.Seconds()), statusCode, truncate(lastError, 1000), deliveryId).Error
+}
+
+// backoff is the wait after the given number of failed attempts
+func backoff(attempts int) time.Duration {
+	wait := retryBase
+	for i := 1; i < attempts && wait < retryMax; i++ {
+		wait *= 2
+	}
+	if wait > retryMax {
+		wait = retryMax
+	}
+	return wait
+}
+
+// newClient returns an HTTP client that does not follow redirects and, unless
+// WEBHOOK_ALLOW_PRIVATE is true, refuses to connect to loopback, private or
+// link-local addresses, so endpoints cannot be pointed at internal services
+func newClient() *http.Client {
+	allowPrivate := strings.EqualFold(utils_v1.GetEnv("WEBHOOK_ALLOW_PRIVATE"), "true")
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if allowPrivate {
+				return nil
+			}
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+				ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+				return errPrivateAddress
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     30 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// truncate shortens text for the log, keeping it valid for a text column
+func truncate(value string, max int) string {
+	if len(value) > max {
+		value = value[:max]
+	}
+	return strings.ReplaceAll(strings.ToValidUTF8(value, ""), "\x00", "")
+}
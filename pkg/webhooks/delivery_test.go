@@ -0,0 +1,205 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receiver is a webhook endpoint that answers with the queued status codes,
+// then 200, and keeps what it was sent
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	w.WriteHeader(status)
+	io.WriteString(w, http.StatusText(status))
+}
+
+// newReceiver starts an endpoint, and a client allowed to reach it on
+// loopback
+func newReceiver(t *testing.T, statuses ...int) (*receiver, *httptest.Server, *http.Client) {
+	t.Helper()
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE", "true")
+	r := &receiver{statuses: statuses}
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return r, server, newClient()
+}
+
+const testPayload = `{"event":"batch_job.completed","data":{"jobId":7}}`
+
+func testDelivery(url string, attempts int) delivery {
+	secret := "whsec_test"
+	return delivery{
+		Id:       42,
+		Event:    EventBatchJobCompleted,
+		Payload:  testPayload,
+		Attempts: attempts,
+		Url:      &url,
+		Secret:   &secret,
+	}
+}
+
+func TestAttemptSendsSignedRequest(t *testing.T) {
+	r, server, client := newReceiver(t)
+
+	result := attempt(context.Background(), client, testDelivery(server.URL, 1), 8)
+	if result.Status != "succeeded" || result.Error != "" || result.StatusCode == nil || *result.StatusCode != http.StatusOK {
+		t.Fatalf("outcome = %+v", result)
+	}
+
+	if len(r.requests) != 1 {
+		t.Fatalf("endpoint got %d requests, want 1", len(r.requests))
+	}
+	req, body := r.requests[0], r.bodies[0]
+	if req.Method != http.MethodPost || req.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("request = %s %q", req.Method, req.Header.Get("Content-Type"))
+	}
+	if req.Header.Get(HeaderEvent) != EventBatchJobCompleted || req.Header.Get(HeaderDelivery) != "42" {
+		t.Errorf("event header %q, delivery header %q", req.Header.Get(HeaderEvent), req.Header.Get(HeaderDelivery))
+	}
+	if string(body) != testPayload {
+		t.Errorf("body = %s", body)
+	}
+	if err := Verify("whsec_test", req.Header.Get(HeaderSignature), body, time.Minute); err != nil {
+		t.Errorf("receiver could not verify the signature: %v", err)
+	}
+}
+
+func TestAttemptRetriesServerErrors(t *testing.T) {
+	_, server, client := newReceiver(t, http.StatusInternalServerError, http.StatusBadGateway)
+
+	// Each failed attempt waits twice as long as the one before, and the
+	// response is recorded for the delivery log
+	tests := []struct {
+		status int
+		wait   time.Duration
+	}{
+		{http.StatusInternalServerError, 30 * time.Second},
+		{http.StatusBadGateway, time.Minute},
+	}
+	for i, tt := range tests {
+		result := attempt(context.Background(), client, testDelivery(server.URL, i+1), 8)
+		if result.Status != "pending" || result.RetryIn != tt.wait {
+			t.Errorf("attempt %d: %q retrying in %v, want pending retrying in %v", i+1, result.Status, result.RetryIn, tt.wait)
+		}
+		if result.StatusCode == nil || *result.StatusCode != tt.status {
+			t.Errorf("attempt %d: recorded status code %v, want %d", i+1, result.StatusCode, tt.status)
+		}
+		if want := http.StatusText(tt.status); !strings.Contains(result.Error, want) {
+			t.Errorf("attempt %d: recorded error %q does not contain the response %q", i+1, result.Error, want)
+		}
+	}
+
+	if result := attempt(context.Background(), client, testDelivery(server.URL, 3), 8); result.Status != "succeeded" {
+		t.Errorf("third attempt = %+v, want succeeded", result)
+	}
+}
+
+func TestAttemptGivesUp(t *testing.T) {
+	_, server, client := newReceiver(t, http.StatusServiceUnavailable)
+
+	result := attempt(context.Background(), client, testDelivery(server.URL, 8), 8)
+	if result.Status != "failed" || result.StatusCode == nil || *result.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("last attempt = %+v, want failed with 503", result)
+	}
+}
+
+func TestAttemptRemovedEndpoint(t *testing.T) {
+	r, server, client := newReceiver(t)
+
+	d := testDelivery(server.URL, 1)
+	d.Url, d.Secret = nil, nil
+	result := attempt(context.Background(), client, d, 8)
+	if result.Status != "failed" || result.Error != "endpoint was removed" || result.StatusCode != nil {
+		t.Errorf("outcome = %+v", result)
+	}
+	if len(r.requests) != 0 {
+		t.Error("a removed endpoint was called")
+	}
+}
+
+func TestAttemptDoesNotFollowRedirects(t *testing.T) {
+	r, target, client := newReceiver(t)
+	redirect := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusFound))
+	defer redirect.Close()
+
+	result := attempt(context.Background(), client, testDelivery(redirect.URL, 1), 8)
+	if result.Status != "pending" || result.StatusCode == nil || *result.StatusCode != http.StatusFound {
+		t.Errorf("redirect = %+v, want a retry recording 302", result)
+	}
+	if len(r.requests) != 0 {
+		t.Error("the redirect was followed")
+	}
+}
+
+func TestClientRefusesPrivateAddresses(t *testing.T) {
+	_, server, _ := newReceiver(t)
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE", "")
+
+	result := attempt(context.Background(), newClient(), testDelivery(server.URL, 1), 8)
+	if result.Status != "pending" || result.StatusCode != nil || !strings.Contains(result.Error, errPrivateAddress.Error()) {
+		t.Errorf("loopback endpoint gave %+v", result)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{10, 512 * 30 * time.Second},
+		{11, retryMax},
+		{100, retryMax},
+	}
+	for _, tt := range tests {
+		if got := backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestSendTimesOutWithContext(t *testing.T) {
+	_, server, client := newReceiver(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := send(ctx, client, server.URL, "whsec_test", 1, EventBatchJobFailed, []byte("{}")); !errors.Is(err, context.Canceled) {
+		t.Errorf("send on a cancelled context returned %v", err)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if got := truncate("abc\x00def", 100); got != "abcdef" {
+		t.Errorf("truncate kept a NUL byte: %q", got)
+	}
+	// Cutting inside a multi-byte character leaves valid UTF-8
+	if got := truncate("ab€", 3); got != "ab" {
+		t.Errorf("truncate = %q, want %q", got, "ab")
+	}
+}
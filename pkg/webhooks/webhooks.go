@@ -0,0 +1,202 @@
+// Package webhooks delivers signed JSON callbacks to endpoints users
+// register.
+//
+// Events are written to webhook_deliveries, one row per matching endpoint,
+// and sent by background workers that retry failures with exponential
+// backoff, so a delivery survives restarts and the table doubles as the
+// delivery log.
+//
+// Tables:
+//
+//	webhook_endpoints  (id, user_id, url, secret, events jsonb, active, created_at)
+//	webhook_deliveries (id, endpoint_id, user_id, event, payload jsonb, status,
+//	                    attempts, next_attempt_at, last_status_code, last_error,
+//	                    replay_of, created_at, delivered_at)
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go_template_v3/pkg/config"
+	"go_template_v3/pkg/jobs"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	utils_v1 "github.com/FDSAP-Git-Org/hephaestus/utils/v1"
+)
+
+// Events an endpoint can subscribe to
+const (
+	EventBatchJobCompleted = "batch_job.completed"
+	EventBatchJobFailed    = "batch_job.failed"
+)
+
+// Events lists every event, for validating subscriptions
+var Events = []string{EventBatchJobCompleted, EventBatchJobFailed}
+
+// Headers sent with each delivery. The signature header is
+// "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>" keyed by the secret>".
+const (
+	HeaderSignature = "X-Webhook-Signature"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+)
+
+// Payload is the JSON body of a delivery
+type Payload struct {
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"createdAt"`
+	Data      interface{} `json:"data"`
+}
+
+// Enqueue records an event for every active endpoint of the user that
+// subscribes to it. Workers send them shortly after.
+func Enqueue(userId int, event string, data interface{}) error {
+	payload, err := json.Marshal(Payload{Event: event, CreatedAt: time.Now().UTC(), Data: data})
+	if err != nil {
+		return err
+	}
+
+	// An endpoint with no events listed receives all of them
+	result := config.DBConnList[0].Exec(`
+		INSERT INTO webhook_deliveries (endpoint_id, user_id, event, payload, status, attempts, next_attempt_at)
+		SELECT id, user_id, ?, ?, 'pending', 0, NOW()
+		FROM webhook_endpoints
+		WHERE user_id = ? AND active
+		  AND (events IS NULL OR jsonb_array_length(events) = 0 OR events @> jsonb_build_array(?::text))
+	`, event, string(payload), userId, event)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected > 0 {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// JobFinished is a jobs.OnFinish hook that sends batch_job.completed and
+// batch_job.failed events
+func JobFinished(job *jobs.Job, status string) {
+	var event string
+	switch status {
+	case "completed":
+		event = EventBatchJobCompleted
+	case "failed":
+		event = EventBatchJobFailed
+	default:
+		return
+	}
+
+	err := Enqueue(job.UserId, event, map[string]interface{}{
+		"jobId":           job.Id,
+		"jobType":         job.JobType,
+		"status":          status,
+		"totalItems":      job.TotalItems,
+		"processedItems":  job.ProcessedItems,
+		"successfulItems": job.SuccessfulItems,
+		"failedItems":     job.FailedItems,
+	})
+	if err != nil {
+		log.Printf("Error queueing webhooks for job %d: %v", job.Id, err)
+	}
+}
+
+// Replay queues a new delivery of a past one's payload and returns its ID,
+// or 0 when the user has no such delivery
+func Replay(deliveryId, userId int) (int, error) {
+	var newId int
+	err := config.DBConnList[0].Raw(`
+		INSERT INTO webhook_deliveries (endpoint_id, user_id, event, payload, status, attempts, next_attempt_at, replay_of)
+		SELECT d.endpoint_id, d.user_id, d.event, d.payload, 'pending', 0, NOW(), d.id
+		FROM webhook_deliveries d
+		JOIN webhook_endpoints e ON e.id = d.endpoint_id AND e.active
+		WHERE d.id = ? AND d.user_id = ?
+		RETURNING id
+	`, deliveryId, userId).Scan(&newId).Error
+	if err == nil && newId != 0 {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+	return newId, err
+}
+
+// Sign returns the signature header value for a body sent at timestamp
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// Verify checks a signature header against the body, rejecting timestamps
+// further than tolerance from now. Receivers written in Go can use it as is.
+func Verify(secret, header string, body []byte, tolerance time.Duration) error {
+	var timestamp int64
+	var signature string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp, _ = strconv.ParseInt(value, 10, 64)
+		case "v1":
+			signature = value
+		}
+	}
+	if timestamp == 0 || signature == "" {
+		return errors.New("malformed signature header")
+	}
+	if age := time.Since(time.Unix(timestamp, 0)); age > tolerance || age < -tolerance {
+		return errors.New("signature timestamp outside tolerance")
+	}
+
+	expected := Sign(secret, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(fmt.Sprintf("t=%d,v1=%s", timestamp, signature))) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+// ValidateURL checks an endpoint URL. Plain http is only accepted when
+// WEBHOOK_ALLOW_HTTP is true.
+func ValidateURL(raw string) error {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || parsed.Host == "" {
+		return errors.New("url must be an absolute http(s) URL")
+	}
+	switch parsed.Scheme {
+	case "https":
+	case "http":
+		if !strings.EqualFold(utils_v1.GetEnv("WEBHOOK_ALLOW_HTTP"), "true") {
+			return errors.New("url must use https")
+		}
+	default:
+		return errors.New("url must be an absolute http(s) URL")
+	}
+	if parsed.User != nil {
+		return errors.New("url must not contain credentials")
+	}
+	return nil
+}
+
+// ValidEvent reports whether event can be subscribed to
+func ValidEvent(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
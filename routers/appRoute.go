@@ -1,20 +1,25 @@
 package routers
 
 import (
+	"go_template_v3/pkg/global/utils"
 	"go_template_v3/pkg/middleware"
 	ctrEncryption "go_template_v3/pkg/services/encryption/controller"
 	ctrFeatureOne "go_template_v3/pkg/services/featureOne/controller"
 	svcHealthcheck "go_template_v3/pkg/services/healthcheck"
+	svcWellKnown "go_template_v3/pkg/services/wellknown"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/gofiber/fiber/v3/middleware/static"
 )
 
 func APIRoute(app *fiber.App) {
-	app.Use("/assets", static.New("./assets", static.Config{
+	app.Use("/assets", static.New(utils.PublicAssetsDir, static.Config{
 		MaxAge: 3600, // 1 hour cache
 	}))
 
+	// Public keys for verifying our JWTs
+	app.Get("/.well-known/jwks.json", svcWellKnown.JWKS)
+
 	publicV1 := app.Group("/api/public/v1")
 	privateV1 := app.Group("/api/private/v1")
 
@@ -24,40 +29,111 @@ func APIRoute(app *fiber.App) {
 
 	// Expense Category
 	expenseCategoryEndpoint := publicV1.Group("/expense-categories")
-	expenseCategoryEndpoint.Post("/", ctrFeatureOne.AddExpenseCategory)
+	expenseCategoryEndpoint.Post("/", middleware.AuthMiddleware, middleware.RequirePermission("categories:write"), ctrFeatureOne.AddExpenseCategory)
 	expenseCategoryEndpoint.Get("/", ctrFeatureOne.GetExpenseCategories)
 
 	// Auth Routes
 	authGroup := publicV1.Group("/auth")
 	authGroup.Post("/register", ctrFeatureOne.Register)
 	authGroup.Post("/login", ctrFeatureOne.Login)
+	authGroup.Post("/refresh", ctrFeatureOne.RefreshToken)
 	authGroup.Post("/forgot-password", ctrFeatureOne.ForgotPassword)
 	authGroup.Post("/verify-reset-token", ctrFeatureOne.VerifyResetToken)
 	authGroup.Post("/reset-password", ctrFeatureOne.ResetPassword)
+	authGroup.Post("/verify-email", ctrFeatureOne.VerifyEmail)
+	authGroup.Post("/resend-verification", ctrFeatureOne.ResendVerification)
+	authGroup.Post("/mfa/verify", ctrFeatureOne.VerifyMFA)
+	authGroup.Get("/oidc/:provider/login", ctrFeatureOne.OIDCLogin)
+	authGroup.Get("/oidc/:provider/callback", ctrFeatureOne.OIDCCallback)
 
 	// Protected Auth Routes
-	authGroupProtected := publicV1.Group("/auth", middleware.AuthMiddleware)
+	authGroupProtected := publicV1.Group("/auth", middleware.AuthMiddleware, middleware.RequireTokenAuth)
 	authGroupProtected.Put("/update-user", ctrFeatureOne.UpdateUser)
+	authGroupProtected.Put("/password", ctrFeatureOne.ChangePassword)
+	authGroupProtected.Delete("/account", ctrFeatureOne.DeleteAccount)
 	authGroupProtected.Post("/logout", ctrFeatureOne.Logout)
+	authGroupProtected.Post("/mfa/enroll", ctrFeatureOne.EnrollMFA)
+	authGroupProtected.Post("/mfa/confirm", ctrFeatureOne.ConfirmMFA)
+	authGroupProtected.Post("/mfa/disable", ctrFeatureOne.DisableMFA)
+	authGroupProtected.Post("/api-keys", ctrFeatureOne.CreateAPIKey)
+	authGroupProtected.Get("/api-keys", ctrFeatureOne.GetAPIKeys)
+	authGroupProtected.Delete("/api-keys/:id", ctrFeatureOne.RevokeAPIKey)
+	authGroupProtected.Get("/sessions", ctrFeatureOne.GetSessions)
+	authGroupProtected.Post("/sessions/revoke-all", ctrFeatureOne.RevokeAllSessions)
+	authGroupProtected.Delete("/sessions/:id", ctrFeatureOne.RevokeSession)
+	authGroupProtected.Post("/oidc/:provider/link", ctrFeatureOne.OIDCLink)
 
 	// Protected expense routes
 	expenseGroup := publicV1.Group("/expenses", middleware.AuthMiddleware)
-	expenseGroup.Put("/batch", ctrFeatureOne.BatchUpdateExpenses)
-	expenseGroup.Put("/batch-async", ctrFeatureOne.BatchUpdateExpensesAsync)
-	expenseGroup.Post("/batch-upload", ctrFeatureOne.BatchUploadExpensesFromCSV)
-	expenseGroup.Get("/batch-async/:jobId", ctrFeatureOne.GetBatchJobStatus)
-
-	expenseGroup.Post("/", ctrFeatureOne.AddExpense)
-	expenseGroup.Post("/v2", ctrFeatureOne.AddExpenseV2)
-	expenseGroup.Get("/", ctrFeatureOne.GetExpenses)
-	expenseGroup.Get("/:id", ctrFeatureOne.GetExpense)
-	expenseGroup.Delete("/:id", ctrFeatureOne.DeleteExpense)
-	expenseGroup.Put("/:id", ctrFeatureOne.UpdateExpense)
+	expenseGroup.Put("/batch", middleware.RequirePermission("expenses:batch"), ctrFeatureOne.BatchUpdateExpenses)
+	expenseGroup.Put("/batch-async", middleware.RequirePermission("expenses:batch"), ctrFeatureOne.BatchUpdateExpensesAsync)
+	expenseGroup.Post("/batch-upload", middleware.RequirePermission("expenses:batch"), ctrFeatureOne.BatchUploadExpensesFromCSV)
+	expenseGroup.Get("/batch-async/:jobId", middleware.RequirePermission("expenses:read"), ctrFeatureOne.GetBatchJobStatus)
+	expenseGroup.Get("/batch-async/:jobId/events", middleware.RequirePermission("expenses:read"), ctrFeatureOne.StreamBatchJobEvents)
+	expenseGroup.Get("/batch-jobs", middleware.RequirePermission("expenses:read"), ctrFeatureOne.GetBatchJobs)
+	expenseGroup.Post("/imports", middleware.RequirePermission("expenses:batch"), ctrFeatureOne.UploadExpenseImport)
+	expenseGroup.Post("/imports/:importId/commit", middleware.RequirePermission("expenses:batch"), ctrFeatureOne.CommitExpenseImport)
+	expenseGroup.Get("/imports/:importId/errors", middleware.RequirePermission("expenses:read"), ctrFeatureOne.DownloadExpenseImportErrors)
+	expenseGroup.Get("/export", middleware.RequirePermission("expenses:read"), ctrFeatureOne.ExportExpenses)
+	expenseGroup.Get("/exports/:jobId/download", middleware.RequirePermission("expenses:read"), ctrFeatureOne.DownloadExpenseExport)
+	expenseGroup.Post("/batch-jobs/:jobId/cancel", middleware.RequirePermission("expenses:batch"), ctrFeatureOne.CancelBatchJob)
+	expenseGroup.Post("/batch-jobs/:jobId/retry-failed", middleware.RequirePermission("expenses:batch"), ctrFeatureOne.RetryFailedBatchJob)
+
+	expenseGroup.Get("/summary", middleware.RequirePermission("expenses:read"), ctrFeatureOne.GetExpenseSummary)
+	expenseGroup.Get("/summary/:groupBy", middleware.RequirePermission("expenses:read"), ctrFeatureOne.GetExpenseSummary)
+
+	expenseGroup.Post("/recurring", middleware.RequirePermission("expenses:write"), ctrFeatureOne.CreateRecurringExpense)
+	expenseGroup.Get("/recurring", middleware.RequirePermission("expenses:read"), ctrFeatureOne.GetRecurringExpenses)
+	expenseGroup.Get("/recurring/:id", middleware.RequirePermission("expenses:read"), ctrFeatureOne.GetRecurringExpense)
+	expenseGroup.Put("/recurring/:id", middleware.RequirePermission("expenses:write"), ctrFeatureOne.UpdateRecurringExpense)
+	expenseGroup.Delete("/recurring/:id", middleware.RequirePermission("expenses:write"), ctrFeatureOne.DeleteRecurringExpense)
+
+	expenseGroup.Post("/", middleware.RequirePermission("expenses:write"), ctrFeatureOne.AddExpense)
+	expenseGroup.Post("/v2", middleware.RequirePermission("expenses:write"), ctrFeatureOne.AddExpenseV2)
+	expenseGroup.Get("/", middleware.RequirePermission("expenses:read"), ctrFeatureOne.GetExpenses)
+	expenseGroup.Get("/:id", middleware.RequirePermission("expenses:read"), ctrFeatureOne.GetExpense)
+	expenseGroup.Delete("/:id", middleware.RequirePermission("expenses:write"), ctrFeatureOne.DeleteExpense)
+	expenseGroup.Put("/:id", middleware.RequirePermission("expenses:write"), ctrFeatureOne.UpdateExpense)
 
 	expenseGroup.Post("test-internal-send-request", ctrFeatureOne.TestInternalSendRequest)
 
+	// Admin Routes
+	adminGroup := publicV1.Group("/admin", middleware.AuthMiddleware)
+	adminGroup.Get("/users/:id/roles", middleware.RequirePermission("users:manage"), ctrFeatureOne.GetUserRoles)
+	adminGroup.Put("/users/:id/roles", middleware.RequirePermission("users:manage"), ctrFeatureOne.UpdateUserRoles)
+	adminGroup.Post("/templates", middleware.RequirePermission("templates:manage"), ctrFeatureOne.UploadTemplate)
+	adminGroup.Get("/templates", middleware.RequirePermission("templates:manage"), ctrFeatureOne.GetTemplates)
+	adminGroup.Post("/exchange-rates", middleware.RequirePermission("exchange-rates:manage"), ctrFeatureOne.UploadExchangeRates)
+	adminGroup.Get("/exchange-rates", middleware.RequirePermission("exchange-rates:manage"), ctrFeatureOne.GetExchangeRates)
+
+	// Import templates
+	templateGroup := publicV1.Group("/templates", middleware.AuthMiddleware)
+	templateGroup.Get("/:uploadType", ctrFeatureOne.DownloadTemplate)
+
+	// Currencies
+	currencyGroup := publicV1.Group("/currencies", middleware.AuthMiddleware)
+	currencyGroup.Get("/", ctrFeatureOne.GetCurrencies)
+	currencyGroup.Put("/base", middleware.RequirePermission("expenses:write"), ctrFeatureOne.UpdateBaseCurrency)
+
+	// Budgets
+	budgetGroup := publicV1.Group("/budgets", middleware.AuthMiddleware)
+	budgetGroup.Post("/", middleware.RequirePermission("expenses:write"), ctrFeatureOne.CreateBudget)
+	budgetGroup.Get("/", middleware.RequirePermission("expenses:read"), ctrFeatureOne.GetBudgets)
+	budgetGroup.Get("/alerts", middleware.RequirePermission("expenses:read"), ctrFeatureOne.GetBudgetAlerts)
+	budgetGroup.Get("/:id", middleware.RequirePermission("expenses:read"), ctrFeatureOne.GetBudget)
+	budgetGroup.Put("/:id", middleware.RequirePermission("expenses:write"), ctrFeatureOne.UpdateBudget)
+	budgetGroup.Delete("/:id", middleware.RequirePermission("expenses:write"), ctrFeatureOne.DeleteBudget)
+
+	// Webhooks
+	webhookGroup := publicV1.Group("/webhooks", middleware.AuthMiddleware)
+	webhookGroup.Post("/", middleware.RequirePermission("expenses:write"), ctrFeatureOne.CreateWebhook)
+	webhookGroup.Get("/", middleware.RequirePermission("expenses:read"), ctrFeatureOne.GetWebhooks)
+	webhookGroup.Delete("/:id", middleware.RequirePermission("expenses:write"), ctrFeatureOne.DeleteWebhook)
+	webhookGroup.Get("/:id/deliveries", middleware.RequirePermission("expenses:read"), ctrFeatureOne.GetWebhookDeliveries)
+	webhookGroup.Post("/deliveries/:deliveryId/replay", middleware.RequirePermission("expenses:write"), ctrFeatureOne.ReplayWebhookDelivery)
+
 	// ENCRYPTION
-	encryptionGroup := publicV1.Group("/encryption")
+	encryptionGroup := publicV1.Group("/encryption", middleware.AuthMiddleware, middleware.RequirePermission("encryption:manage"))
 	encryptionGroup.Post("/encrypt/db-credentials", ctrEncryption.EncryptDBCredentials)
 	encryptionGroup.Post("/decrypt/db-credentials", ctrEncryption.DecryptDBCredentials)
 }